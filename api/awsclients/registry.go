@@ -0,0 +1,64 @@
+package awsclients
+
+import (
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// fallbackRegion is used when the base config has no region.
+const fallbackRegion = "us-east-1"
+
+// Registry holds AWS service clients shared by every invocation handled by a Lambda container.
+// Clients are created from a single base aws.Config loaded at cold start, one per service and region,
+// on first use. A Registry is safe for concurrent use.
+type Registry struct {
+	config aws.Config
+
+	mu      sync.Mutex
+	clients map[clientKey]any
+}
+
+type clientKey struct {
+	service string
+	region  string
+}
+
+// NewRegistry returns a Registry that creates clients from copies of cfg.
+func NewRegistry(cfg aws.Config) *Registry {
+	return &Registry{config: cfg, clients: map[clientKey]any{}}
+}
+
+// Config returns a copy of the base config.
+func (r *Registry) Config() aws.Config {
+	return r.config.Copy()
+}
+
+// Region returns the region of the base config, the region used when a caller does not ask for one.
+func (r *Registry) Region() string {
+	if r.config.Region == "" {
+		return fallbackRegion
+	}
+	return r.config.Region
+}
+
+// Get returns the client for service in region, calling newClient with a copy of the base config
+// set to region the first time. An empty region means Registry.Region. service must always be used
+// with the same client type T.
+func Get[T any](r *Registry, service, region string, newClient func(aws.Config) T) T {
+	if region == "" {
+		region = r.Region()
+	}
+	key := clientKey{service: service, region: region}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if client, ok := r.clients[key]; ok {
+		return client.(T)
+	}
+	cfg := r.config.Copy()
+	cfg.Region = region
+	client := newClient(cfg)
+	r.clients[key] = client
+	return client
+}
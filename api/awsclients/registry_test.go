@@ -0,0 +1,57 @@
+package awsclients
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClient struct {
+	region string
+}
+
+func TestGet(t *testing.T) {
+	registry := NewRegistry(aws.Config{Region: "us-east-1"})
+	created := 0
+	newFake := func(cfg aws.Config) *fakeClient {
+		created++
+		return &fakeClient{region: cfg.Region}
+	}
+
+	defaultClient := Get(registry, "fake", "", newFake)
+	assert.Equal(t, "us-east-1", defaultClient.region)
+	assert.Same(t, defaultClient, Get(registry, "fake", "us-east-1", newFake))
+
+	afs1Client := Get(registry, "fake", "af-south-1", newFake)
+	assert.Equal(t, "af-south-1", afs1Client.region)
+	assert.NotSame(t, defaultClient, afs1Client)
+
+	otherService := Get(registry, "other", "af-south-1", newFake)
+	assert.NotSame(t, afs1Client, otherService)
+
+	assert.Equal(t, 3, created)
+	assert.Equal(t, "us-east-1", registry.Config().Region, "base config should not be changed")
+}
+
+func TestGet_Concurrent(t *testing.T) {
+	registry := NewRegistry(aws.Config{})
+	assert.Equal(t, fallbackRegion, registry.Region())
+
+	clients := make([]*fakeClient, 20)
+	var wg sync.WaitGroup
+	for i := range clients {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			clients[i] = Get(registry, "fake", "eu-west-1", func(cfg aws.Config) *fakeClient {
+				return &fakeClient{region: cfg.Region}
+			})
+		}(i)
+	}
+	wg.Wait()
+	for _, client := range clients {
+		assert.Same(t, clients[0], client)
+	}
+}
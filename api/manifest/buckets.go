@@ -0,0 +1,261 @@
+package manifest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/pennsieve/packages-service/api/regions"
+)
+
+// MaxPresignDuration is the longest expiry we set on a presigned URL, and the most a PresignExpiryPolicy may allow.
+// URLs are signed with the Lambda execution role's session credentials, which do not report when they expire, so
+// URLs are kept well within their lifetime; downloads that take longer re-sign their URLs. The expiry will be lower
+// than this if the bucket requires us to assume a role for signing. In that case it is at most STSCredentialsDuration,
+// since the URL will only be usable while the STS credentials used to sign it are valid.
+const MaxPresignDuration = 3 * time.Hour
+
+// STSCredentialsDuration is the duration of the STS credentials when we need to assume a role in an external account
+// to sign for one of its buckets, for example to have the external account pay for a requester pays bucket.
+// The max value for this is one hour since AWS imposes this as a hard limit when one role (Lambda execution role)
+// is assuming another (external publish bucket role).
+const STSCredentialsDuration = 1 * time.Hour
+
+const ExternalBucketsRoleMapKey = "EXTERNAL_BUCKETS_ROLE_MAP"
+
+// defaultExternalBucketActions are the actions that the session policy allows on an external bucket whose
+// ExternalBucket has no AllowedActions.
+var defaultExternalBucketActions = []string{"s3:GetObject", "s3:GetObjectVersion"}
+
+// ExternalBucket is the configuration of a bucket in an external account, which is signed for with the
+// credentials of a role in that account.
+type ExternalBucket struct {
+	RoleARN string `json:"roleArn"`
+	// Region of the bucket. If empty, it is looked up as for any other bucket.
+	Region        string `json:"region,omitempty"`
+	RequesterPays bool   `json:"requesterPays,omitempty"`
+	// MaxPresignSeconds caps the expiry of URLs of the bucket below STSCredentialsDuration. Zero leaves it there.
+	MaxPresignSeconds int    `json:"maxPresignSeconds,omitempty"`
+	ExternalID        string `json:"externalId,omitempty"`
+	// AllowedActions are the S3 actions that the session policy allows on the objects of the bucket. If empty,
+	// defaultExternalBucketActions are allowed.
+	AllowedActions []string `json:"allowedActions,omitempty"`
+}
+
+// UnmarshalJSON also accepts the role ARN on its own, the format of ExternalBucketsRoleMapKey before buckets had
+// more configuration than that, as a requester pays bucket.
+func (b *ExternalBucket) UnmarshalJSON(data []byte) error {
+	var roleARN string
+	if err := json.Unmarshal(data, &roleARN); err == nil {
+		*b = ExternalBucket{RoleARN: roleARN, RequesterPays: true}
+		return nil
+	}
+	type externalBucket ExternalBucket
+	return json.Unmarshal(data, (*externalBucket)(b))
+}
+
+func (b ExternalBucket) validate() error {
+	roleARN, err := arn.Parse(b.RoleARN)
+	if err != nil {
+		return fmt.Errorf("roleArn %q: %w", b.RoleARN, err)
+	}
+	if roleARN.Service != "iam" || !strings.HasPrefix(roleARN.Resource, "role/") {
+		return fmt.Errorf("roleArn %q is not the ARN of an IAM role", b.RoleARN)
+	}
+	if b.MaxPresignSeconds < 0 || time.Duration(b.MaxPresignSeconds)*time.Second > STSCredentialsDuration {
+		return fmt.Errorf("maxPresignSeconds %d not between 0 and %d", b.MaxPresignSeconds, int(STSCredentialsDuration.Seconds()))
+	}
+	// The length limits of the ExternalId parameter of AssumeRole.
+	if b.ExternalID != "" && (len(b.ExternalID) < 2 || len(b.ExternalID) > 1224) {
+		return fmt.Errorf("externalId must be between 2 and 1224 characters")
+	}
+	for _, action := range b.AllowedActions {
+		if !strings.HasPrefix(action, "s3:") {
+			return fmt.Errorf("allowedActions: %q is not an S3 action", action)
+		}
+	}
+	if len(b.AllowedActions) > 0 && !slices.Contains(b.AllowedActions, "s3:GetObject") {
+		return fmt.Errorf("allowedActions must include s3:GetObject, which downloads need")
+	}
+	return nil
+}
+
+// sessionPolicy returns the policy that limits the credentials of the role to the allowed actions.
+func (b ExternalBucket) sessionPolicy() (string, error) {
+	actions := b.AllowedActions
+	if len(actions) == 0 {
+		actions = defaultExternalBucketActions
+	}
+	policy, err := json.Marshal(map[string]any{
+		"Version": "2012-10-17",
+		"Statement": []map[string]any{{
+			"Effect":   "Allow",
+			"Action":   actions,
+			"Resource": "*",
+		}},
+	})
+	return string(policy), err
+}
+
+// ExternalBucketConfig maps the names of buckets in external accounts to their configuration.
+type ExternalBucketConfig map[string]ExternalBucket
+
+// Validate checks the configuration of every bucket.
+func (c ExternalBucketConfig) Validate() error {
+	for bucket, config := range c {
+		if err := config.validate(); err != nil {
+			return fmt.Errorf("bucket %s: %w", bucket, err)
+		}
+	}
+	return nil
+}
+
+// LoadExternalBucketConfigFromEnv parses and validates the ExternalBucketsRoleMapKey environment variable, which must be set.
+func LoadExternalBucketConfigFromEnv() (ExternalBucketConfig, error) {
+	raw := os.Getenv(ExternalBucketsRoleMapKey)
+	if raw == "" {
+		return nil, fmt.Errorf("%s not set", ExternalBucketsRoleMapKey)
+	}
+	var config ExternalBucketConfig
+	if err := json.Unmarshal([]byte(raw), &config); err != nil {
+		return nil, fmt.Errorf("parsing %s value [%s]: %w", ExternalBucketsRoleMapKey, raw, err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", ExternalBucketsRoleMapKey, err)
+	}
+	return config, nil
+}
+
+type BucketOptions struct {
+	Region              string
+	CredentialsProvider *aws.CredentialsCache
+	RequestPayer        types.RequestPayer
+	// PresignDuration is the longest expiry that the credentials used for the bucket can sign for.
+	PresignDuration time.Duration
+}
+
+func (o BucketOptions) S3Options() func(s3Options *s3.Options) {
+	return func(s3Options *s3.Options) {
+		s3Options.Region = o.Region
+		if o.CredentialsProvider != nil {
+			s3Options.Credentials = o.CredentialsProvider
+		}
+	}
+}
+
+// minCredentialsLifetime is the least time that cached credentials of an external bucket role must have left to
+// be used. Credentials closer to expiring are refreshed first, so that URLs signed with them last at least this long.
+const minCredentialsLifetime = 15 * time.Minute
+
+// BucketOptionsCache caches the options of each bucket, including the credentials of the role to assume for
+// external buckets. It is safe for concurrent use, and meant to be created once at cold start, so that role
+// credentials are reused across invocations until shortly before they expire.
+type BucketOptionsCache struct {
+	assumeRoleClient       stscreds.AssumeRoleAPIClient
+	bucketRegions          *regions.Resolver
+	stsCredentialsDuration time.Duration
+	externalBucketConfig   ExternalBucketConfig
+
+	mu    sync.Mutex
+	cache map[string]BucketOptions
+}
+
+func NewBucketOptionsCache(assumeRoleClient stscreds.AssumeRoleAPIClient, bucketRegions *regions.Resolver, stsCredentialsDuration time.Duration, externalBucketConfig ExternalBucketConfig) *BucketOptionsCache {
+	return &BucketOptionsCache{
+		cache:                  make(map[string]BucketOptions),
+		assumeRoleClient:       assumeRoleClient,
+		bucketRegions:          bucketRegions,
+		stsCredentialsDuration: stsCredentialsDuration,
+		externalBucketConfig:   externalBucketConfig,
+	}
+}
+
+// NewBucketOptionsCacheFromEnv returns a BucketOptionsCache for the external buckets of the ExternalBucketsRoleMapKey
+// environment variable, which must be set.
+func NewBucketOptionsCacheFromEnv(assumeRoleClient stscreds.AssumeRoleAPIClient, bucketRegions *regions.Resolver, stsCredentialsDuration time.Duration) (*BucketOptionsCache, error) {
+	externalBucketConfig, err := LoadExternalBucketConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return NewBucketOptionsCache(assumeRoleClient, bucketRegions, stsCredentialsDuration, externalBucketConfig), nil
+}
+
+// Get returns the options of the bucket. For external buckets, PresignDuration is cut down to what is left of the
+// role credentials, which are refreshed first if less than minCredentialsLifetime is left.
+func (c *BucketOptionsCache) Get(ctx context.Context, bucketName string) (BucketOptions, error) {
+	bucketOptions, err := c.get(ctx, bucketName)
+	if err != nil || bucketOptions.CredentialsProvider == nil {
+		return bucketOptions, err
+	}
+	credentials, err := bucketOptions.CredentialsProvider.Retrieve(ctx)
+	if err == nil && credentials.CanExpire && time.Until(credentials.Expires) < minCredentialsLifetime {
+		bucketOptions.CredentialsProvider.Invalidate()
+		credentials, err = bucketOptions.CredentialsProvider.Retrieve(ctx)
+	}
+	if err != nil {
+		return BucketOptions{}, fmt.Errorf("failed to assume role of external bucket: %w", err)
+	}
+	if credentials.CanExpire {
+		bucketOptions.PresignDuration = min(bucketOptions.PresignDuration, time.Until(credentials.Expires).Round(time.Second))
+	}
+	return bucketOptions, nil
+}
+
+func (c *BucketOptionsCache) get(ctx context.Context, bucketName string) (BucketOptions, error) {
+	c.mu.Lock()
+	bucketOptions, found := c.cache[bucketName]
+	c.mu.Unlock()
+	if found {
+		return bucketOptions, nil
+	}
+
+	externalBucket, isExternal := c.externalBucketConfig[bucketName]
+	region := externalBucket.Region
+	if region == "" {
+		var err error
+		if region, err = c.bucketRegions.ForBucket(ctx, bucketName); err != nil {
+			return BucketOptions{}, err
+		}
+	}
+	bucketOptions = BucketOptions{Region: region, PresignDuration: MaxPresignDuration}
+	if isExternal {
+		sessionPolicy, err := externalBucket.sessionPolicy()
+		if err != nil {
+			return BucketOptions{}, err
+		}
+		bucketOptions.CredentialsProvider = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(c.assumeRoleClient, externalBucket.RoleARN, func(options *stscreds.AssumeRoleOptions) {
+			options.RoleSessionName = "packages-service-presign-session"
+			options.Duration = c.stsCredentialsDuration
+			options.Policy = aws.String(sessionPolicy)
+			if externalBucket.ExternalID != "" {
+				options.ExternalID = aws.String(externalBucket.ExternalID)
+			}
+		}))
+		if externalBucket.RequesterPays {
+			bucketOptions.RequestPayer = types.RequestPayerRequester
+		}
+		bucketOptions.PresignDuration = c.stsCredentialsDuration
+		if externalBucket.MaxPresignSeconds > 0 {
+			bucketOptions.PresignDuration = min(bucketOptions.PresignDuration, time.Duration(externalBucket.MaxPresignSeconds)*time.Second)
+		}
+	}
+
+	// Requests for the same bucket at the same time all keep the options cached first, so they share its credentials.
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached, found := c.cache[bucketName]; found {
+		return cached, nil
+	}
+	c.cache[bucketName] = bucketOptions
+	return bucketOptions, nil
+}
@@ -0,0 +1,187 @@
+package manifest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	ststypes "github.com/aws/aws-sdk-go-v2/service/sts/types"
+	"github.com/pennsieve/packages-service/api/regions"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubAssumeRoleClient returns credentials that expire after each of lifetimes in turn, and counts its calls.
+type stubAssumeRoleClient struct {
+	mu        sync.Mutex
+	lifetimes []time.Duration
+	calls     int
+	lastInput *sts.AssumeRoleInput
+}
+
+func (c *stubAssumeRoleClient) AssumeRole(_ context.Context, params *sts.AssumeRoleInput, _ ...func(*sts.Options)) (*sts.AssumeRoleOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastInput = params
+	lifetime := c.lifetimes[min(c.calls, len(c.lifetimes)-1)]
+	c.calls++
+	return &sts.AssumeRoleOutput{
+		AssumedRoleUser: &ststypes.AssumedRoleUser{},
+		Credentials: &ststypes.Credentials{
+			AccessKeyId:     aws.String("access-key-id"),
+			SecretAccessKey: aws.String("secret-access-key"),
+			SessionToken:    aws.String("session-token"),
+			Expiration:      aws.Time(time.Now().Add(lifetime)),
+		},
+	}, nil
+}
+
+func (c *stubAssumeRoleClient) Calls() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls
+}
+
+const testRoleARN = "arn:aws:iam::123456789012:role/external"
+
+func newTestBucketOptionsCache(assumeRoleClient *stubAssumeRoleClient) *BucketOptionsCache {
+	bucketRegions := regions.NewResolver(nil, map[string]string{"internal": "us-east-1", "external": "us-west-2"})
+	return NewBucketOptionsCache(assumeRoleClient, bucketRegions, STSCredentialsDuration, ExternalBucketConfig{
+		"external": {RoleARN: testRoleARN, RequesterPays: true},
+		// not in bucketRegions, so only found from its config
+		"partner": {RoleARN: testRoleARN, Region: "eu-west-1", MaxPresignSeconds: 1800, ExternalID: "partner-external-id", AllowedActions: []string{"s3:GetObject"}},
+	})
+}
+
+func TestBucketOptionsCache_Get(t *testing.T) {
+	ctx := context.Background()
+	assumeRoleClient := &stubAssumeRoleClient{lifetimes: []time.Duration{STSCredentialsDuration}}
+	cache := newTestBucketOptionsCache(assumeRoleClient)
+
+	internal, err := cache.Get(ctx, "internal")
+	require.NoError(t, err)
+	assert.Equal(t, BucketOptions{Region: "us-east-1", PresignDuration: MaxPresignDuration}, internal)
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			external, err := cache.Get(ctx, "external")
+			if assert.NoError(t, err) {
+				assert.Equal(t, "us-west-2", external.Region)
+				assert.Equal(t, types.RequestPayerRequester, external.RequestPayer)
+				assert.Equal(t, STSCredentialsDuration, external.PresignDuration)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, assumeRoleClient.Calls(), "credentials are shared until they near expiry")
+}
+
+func TestBucketOptionsCache_GetRefreshesNearExpiry(t *testing.T) {
+	ctx := context.Background()
+	assumeRoleClient := &stubAssumeRoleClient{lifetimes: []time.Duration{minCredentialsLifetime / 2, 30 * time.Minute}}
+	cache := newTestBucketOptionsCache(assumeRoleClient)
+
+	external, err := cache.Get(ctx, "external")
+	require.NoError(t, err)
+	assert.Equal(t, 2, assumeRoleClient.Calls(), "credentials with too little left are refreshed")
+	assert.Equal(t, 30*time.Minute, external.PresignDuration, "URLs do not outlive the credentials")
+
+	external, err = cache.Get(ctx, "external")
+	require.NoError(t, err)
+	assert.Equal(t, 2, assumeRoleClient.Calls())
+	assert.Equal(t, 30*time.Minute, external.PresignDuration)
+}
+
+func TestBucketOptionsCache_GetConfiguredExternalBucket(t *testing.T) {
+	ctx := context.Background()
+	assumeRoleClient := &stubAssumeRoleClient{lifetimes: []time.Duration{STSCredentialsDuration}}
+	cache := newTestBucketOptionsCache(assumeRoleClient)
+
+	partner, err := cache.Get(ctx, "partner")
+	require.NoError(t, err)
+	assert.Equal(t, "eu-west-1", partner.Region)
+	assert.Empty(t, partner.RequestPayer, "the bucket is not requester pays")
+	assert.Equal(t, 30*time.Minute, partner.PresignDuration)
+
+	require.NotNil(t, assumeRoleClient.lastInput)
+	assert.Equal(t, testRoleARN, aws.ToString(assumeRoleClient.lastInput.RoleArn))
+	assert.Equal(t, "partner-external-id", aws.ToString(assumeRoleClient.lastInput.ExternalId))
+	assert.JSONEq(t, `{"Version": "2012-10-17", "Statement": [{"Effect": "Allow", "Action": ["s3:GetObject"], "Resource": "*"}]}`,
+		aws.ToString(assumeRoleClient.lastInput.Policy))
+}
+
+// flakyBucketLocationClient fails its first GetBucketLocation call and finds every bucket in region after that.
+type flakyBucketLocationClient struct {
+	region string
+	calls  int
+}
+
+func (c *flakyBucketLocationClient) GetBucketLocation(_ context.Context, _ *s3.GetBucketLocationInput, _ ...func(*s3.Options)) (*s3.GetBucketLocationOutput, error) {
+	c.calls++
+	if c.calls == 1 {
+		return nil, errors.New("ServiceUnavailable")
+	}
+	return &s3.GetBucketLocationOutput{LocationConstraint: types.BucketLocationConstraint(c.region)}, nil
+}
+
+func TestBucketOptionsCache_GetRegionLookupFailure(t *testing.T) {
+	ctx := context.Background()
+	bucketRegions := regions.NewResolver(&flakyBucketLocationClient{region: "ap-southeast-2"}, nil)
+	cache := NewBucketOptionsCache(&stubAssumeRoleClient{}, bucketRegions, STSCredentialsDuration, ExternalBucketConfig{})
+
+	_, err := cache.Get(ctx, "looked-up")
+	assert.ErrorContains(t, err, "looked-up")
+
+	// The failure is not cached, so the next request finds the bucket's region.
+	bucketOptions, err := cache.Get(ctx, "looked-up")
+	require.NoError(t, err)
+	assert.Equal(t, "ap-southeast-2", bucketOptions.Region)
+}
+
+func TestLoadExternalBucketConfigFromEnv(t *testing.T) {
+	t.Run("not set", func(t *testing.T) {
+		t.Setenv(ExternalBucketsRoleMapKey, "")
+		_, err := LoadExternalBucketConfigFromEnv()
+		assert.Error(t, err)
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		t.Setenv(ExternalBucketsRoleMapKey, `{
+			"legacy": "`+testRoleARN+`",
+			"partner": {"roleArn": "`+testRoleARN+`", "region": "eu-west-1", "maxPresignSeconds": 1800, "externalId": "partner-external-id", "allowedActions": ["s3:GetObject"]}
+		}`)
+		config, err := LoadExternalBucketConfigFromEnv()
+		require.NoError(t, err)
+		assert.Equal(t, ExternalBucketConfig{
+			"legacy":  {RoleARN: testRoleARN, RequesterPays: true},
+			"partner": {RoleARN: testRoleARN, Region: "eu-west-1", MaxPresignSeconds: 1800, ExternalID: "partner-external-id", AllowedActions: []string{"s3:GetObject"}},
+		}, config)
+	})
+
+	for name, raw := range map[string]string{
+		"not json":           `{"partner":`,
+		"no role":            `{"partner": {"requesterPays": true}}`,
+		"not a role":         `{"partner": {"roleArn": "arn:aws:s3:::partner"}}`,
+		"presign too long":   `{"partner": {"roleArn": "` + testRoleARN + `", "maxPresignSeconds": 7200}}`,
+		"negative presign":   `{"partner": {"roleArn": "` + testRoleARN + `", "maxPresignSeconds": -1}}`,
+		"short external id":  `{"partner": {"roleArn": "` + testRoleARN + `", "externalId": "x"}}`,
+		"not an s3 action":   `{"partner": {"roleArn": "` + testRoleARN + `", "allowedActions": ["s3:GetObject", "sts:AssumeRole"]}}`,
+		"cannot get objects": `{"partner": {"roleArn": "` + testRoleARN + `", "allowedActions": ["s3:GetObjectVersion"]}}`,
+		"wrong type":         `{"partner": {"roleArn": "` + testRoleARN + `", "requesterPays": "yes"}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(ExternalBucketsRoleMapKey, raw)
+			_, err := LoadExternalBucketConfigFromEnv()
+			assert.Error(t, err)
+		})
+	}
+}
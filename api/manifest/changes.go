@@ -0,0 +1,100 @@
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/pennsieve/packages-service/api/models"
+)
+
+// NewSnapshot returns the snapshot of a manifest of rows, which must have their target paths assigned. Files that
+// scanPolicy withholds are left out, so that they count as added once they are let through.
+func NewSnapshot(id string, orgId int, datasetNodeId string, rows []models.PackageHierarchyRow, scanPolicy ScanPolicy, createdAt time.Time) models.ManifestSnapshot {
+	snapshot := models.ManifestSnapshot{
+		Id:            id,
+		OrgId:         orgId,
+		DatasetNodeId: datasetNodeId,
+		CreatedAt:     createdAt,
+		Files:         []models.ManifestSnapshotFile{},
+	}
+	for _, row := range rows {
+		if scanPolicy.Blocks(row) {
+			continue
+		}
+		snapshot.Files = append(snapshot.Files, models.ManifestSnapshotFile{
+			FileId:      row.FileId,
+			NodeId:      row.NodeId,
+			TargetPath:  row.TargetPath,
+			Fingerprint: Fingerprint(row),
+		})
+	}
+	return snapshot
+}
+
+// WithoutFiles returns snapshot without the files with the ids of fileIds, as when they were withheld for quota, so
+// that they count as added on the next sync.
+func WithoutFiles(snapshot models.ManifestSnapshot, fileIds map[int64]bool) models.ManifestSnapshot {
+	files := make([]models.ManifestSnapshotFile, 0, len(snapshot.Files))
+	for _, file := range snapshot.Files {
+		if !fileIds[file.FileId] {
+			files = append(files, file)
+		}
+	}
+	snapshot.Files = files
+	return snapshot
+}
+
+// Fingerprint returns a digest of the object, version, size and checksum of the file of row, which changes when
+// its content may have.
+func Fingerprint(row models.PackageHierarchyRow) string {
+	hash := sha256.New()
+	for _, field := range []string{row.S3Bucket, row.S3Key, aws.ToString(row.PublishedS3VersionId), strconv.FormatInt(row.Size, 10), row.Checksum.String} {
+		hash.Write([]byte(field))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil)[:16])
+}
+
+// Changes returns the rows of the files added or changed since snapshot, in order and with their Change set, and
+// the files of snapshot to remove. rows must have their target paths assigned. A file that moved is removed from
+// its old target path, as well as changed. A file of snapshot that scanPolicy now withholds is removed, and also
+// returned, so that it is listed as blocked.
+func Changes(snapshot models.ManifestSnapshot, rows []models.PackageHierarchyRow, scanPolicy ScanPolicy) ([]models.PackageHierarchyRow, []models.DownloadManifestRemovedEntry) {
+	previous := make(map[int64]models.ManifestSnapshotFile, len(snapshot.Files))
+	for _, file := range snapshot.Files {
+		previous[file.FileId] = file
+	}
+
+	var changed []models.PackageHierarchyRow
+	kept := map[int64]bool{}
+	for _, row := range rows {
+		file, found := previous[row.FileId]
+		blocked := scanPolicy.Blocks(row)
+		switch {
+		case !found && blocked:
+			continue
+		case !found:
+			row.Change = models.DownloadChangeAdded
+		case blocked, file.TargetPath != row.TargetPath:
+			row.Change = models.DownloadChangeModified
+		case file.Fingerprint != Fingerprint(row):
+			row.Change = models.DownloadChangeModified
+			kept[row.FileId] = true
+		default:
+			kept[row.FileId] = true
+			continue
+		}
+		changed = append(changed, row)
+	}
+
+	var removed []models.DownloadManifestRemovedEntry
+	for _, file := range snapshot.Files {
+		if !kept[file.FileId] {
+			removed = append(removed, models.DownloadManifestRemovedEntry{NodeId: file.NodeId, TargetPath: file.TargetPath})
+		}
+	}
+	return changed, removed
+}
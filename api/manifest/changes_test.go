@@ -0,0 +1,107 @@
+package manifest
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/pennsieve/packages-service/api/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChanges(t *testing.T) {
+	row := func(fileId int64, nodeId, targetPath, s3Key string) models.PackageHierarchyRow {
+		return models.PackageHierarchyRow{
+			FileId:     fileId,
+			NodeId:     nodeId,
+			TargetPath: targetPath,
+			S3Bucket:   "bucket",
+			S3Key:      s3Key,
+			Size:       100,
+			ScanStatus: sql.NullString{String: "clean", Valid: true},
+		}
+	}
+	previousRows := []models.PackageHierarchyRow{
+		row(1, "N:package:same", "same.csv", "key-1"),
+		row(2, "N:package:replaced", "replaced.csv", "key-2"),
+		row(3, "N:package:moved", "old/moved.csv", "key-3"),
+		row(4, "N:package:deleted", "deleted.csv", "key-4"),
+		row(5, "N:package:infected", "infected.csv", "key-5"),
+	}
+	snapshot := NewSnapshot("token", 2, "N:dataset:1", previousRows, ScanPolicy{}, time.Now())
+
+	infected := row(5, "N:package:infected", "", "key-5")
+	infected.ScanStatus = sql.NullString{String: "infected", Valid: true}
+	newlyInfected := row(7, "N:package:new-infected", "", "key-7")
+	newlyInfected.ScanStatus = sql.NullString{String: "infected", Valid: true}
+	currentRows := []models.PackageHierarchyRow{
+		row(1, "N:package:same", "same.csv", "key-1"),
+		row(2, "N:package:replaced", "replaced.csv", "key-2-v2"),
+		row(3, "N:package:moved", "new/moved.csv", "key-3"),
+		infected,
+		row(6, "N:package:added", "added.csv", "key-6"),
+		newlyInfected,
+	}
+
+	changed, removed := Changes(snapshot, currentRows, ScanPolicy{})
+	var changes []string
+	for _, row := range changed {
+		changes = append(changes, row.NodeId+" "+row.Change)
+	}
+	assert.Equal(t, []string{
+		"N:package:replaced changed",
+		"N:package:moved changed",
+		"N:package:infected changed",
+		"N:package:added added",
+	}, changes, "files withheld since the snapshot are returned to be listed as blocked; new ones are not")
+	assert.Equal(t, []models.DownloadManifestRemovedEntry{
+		{NodeId: "N:package:moved", TargetPath: "old/moved.csv"},
+		{NodeId: "N:package:deleted", TargetPath: "deleted.csv"},
+		{NodeId: "N:package:infected", TargetPath: "infected.csv"},
+	}, removed)
+
+	changed, removed = Changes(NewSnapshot("token", 2, "N:dataset:1", currentRows, ScanPolicy{}, time.Now()), currentRows, ScanPolicy{})
+	assert.Empty(t, changed)
+	assert.Empty(t, removed)
+}
+
+func TestWithoutFiles(t *testing.T) {
+	rows := []models.PackageHierarchyRow{
+		{FileId: 1, NodeId: "N:package:a", TargetPath: "a.csv"},
+		{FileId: 2, NodeId: "N:package:b", TargetPath: "b.csv"},
+	}
+	snapshot := NewSnapshot("token", 2, "N:dataset:1", rows, ScanPolicy{}, time.Now())
+	withheld := WithoutFiles(snapshot, map[int64]bool{2: true})
+	require.Len(t, withheld.Files, 1)
+	assert.Equal(t, int64(1), withheld.Files[0].FileId)
+	assert.Len(t, snapshot.Files, 2, "the snapshot passed in is left as it was")
+
+	changed, removed := Changes(withheld, rows, ScanPolicy{})
+	require.Len(t, changed, 1)
+	assert.Equal(t, "N:package:b", changed[0].NodeId)
+	assert.Equal(t, models.DownloadChangeAdded, changed[0].Change)
+	assert.Empty(t, removed)
+}
+
+func TestFingerprint(t *testing.T) {
+	versionId := "v1"
+	base := models.PackageHierarchyRow{S3Bucket: "bucket", S3Key: "key", Size: 100}
+	for name, change := range map[string]func(row *models.PackageHierarchyRow){
+		"key":     func(row *models.PackageHierarchyRow) { row.S3Key = "other-key" },
+		"version": func(row *models.PackageHierarchyRow) { row.PublishedS3VersionId = &versionId },
+		"size":    func(row *models.PackageHierarchyRow) { row.Size = 101 },
+		"checksum": func(row *models.PackageHierarchyRow) {
+			row.Checksum = sql.NullString{String: `{"checksum": "abc"}`, Valid: true}
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			changed := base
+			change(&changed)
+			assert.NotEqual(t, Fingerprint(base), Fingerprint(changed))
+		})
+	}
+	renamed := base
+	renamed.FileName, renamed.TargetPath = "renamed.csv", "renamed.csv"
+	assert.Equal(t, Fingerprint(base), Fingerprint(renamed), "moves are told apart by target path, not fingerprint")
+}
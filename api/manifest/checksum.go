@@ -0,0 +1,71 @@
+package manifest
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/pennsieve/packages-service/api/models"
+)
+
+// Checksum algorithms of manifest entries, named as in hashlib and the sha256sum/md5sum tools.
+const (
+	ChecksumAlgorithmSHA256 = "sha256"
+	ChecksumAlgorithmMD5    = "md5"
+)
+
+// storedChecksum is the files.checksum column, as recorded at upload: {"chunkSize": ..., "checksum": "..."}.
+// Older rows hold "{}". encoding/json matches keys case-insensitively, so both key casings written by
+// upload clients over the years are read. The uploader digests a file in chunks of chunkSize bytes, so
+// the checksum of a file larger than that is a digest of its chunk digests, not of the file.
+type storedChecksum struct {
+	ChunkSize int64  `json:"chunkSize"`
+	Checksum  string `json:"checksum"`
+}
+
+// StoredChecksum returns the checksum recorded for row's file and its algorithm, or two empty strings if none
+// was recorded, it is not a digest this service recognises, or it is not a digest of the whole file, as when
+// the file spans more than one chunk or the chunk size is not recorded. The algorithm is told by the length
+// of the digest.
+func StoredChecksum(row models.PackageHierarchyRow) (checksum, algorithm string) {
+	if !row.Checksum.Valid {
+		return "", ""
+	}
+	var stored storedChecksum
+	if err := json.Unmarshal([]byte(row.Checksum.String), &stored); err != nil {
+		return "", ""
+	}
+	if stored.ChunkSize <= 0 || row.Size > stored.ChunkSize {
+		return "", ""
+	}
+	return hexDigest(stored.Checksum)
+}
+
+// ETagChecksum returns the MD5 digest held in an S3 ETag, or two empty strings if it does not hold one.
+// The ETag of a multipart upload is a digest of its part digests, suffixed with "-<part count>", and
+// cannot be used to verify the object.
+func ETagChecksum(etag string) (checksum, algorithm string) {
+	etag = strings.Trim(etag, `"`)
+	if strings.Contains(etag, "-") {
+		return "", ""
+	}
+	checksum, algorithm = hexDigest(etag)
+	if algorithm != ChecksumAlgorithmMD5 {
+		return "", ""
+	}
+	return checksum, algorithm
+}
+
+func hexDigest(s string) (digest, algorithm string) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if _, err := hex.DecodeString(s); err != nil {
+		return "", ""
+	}
+	switch len(s) {
+	case 64:
+		return s, ChecksumAlgorithmSHA256
+	case 32:
+		return s, ChecksumAlgorithmMD5
+	}
+	return "", ""
+}
@@ -0,0 +1,60 @@
+package manifest
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/pennsieve/packages-service/api/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStoredChecksum(t *testing.T) {
+	sha256 := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	md5 := "5d41402abc4b2a76b9719d911017c592"
+	tests := map[string]struct {
+		size              int64
+		column            sql.NullString
+		expectedChecksum  string
+		expectedAlgorithm string
+	}{
+		"sha256":            {1024, sql.NullString{String: `{"chunkSize": 33554432, "checksum": "` + sha256 + `"}`, Valid: true}, sha256, ChecksumAlgorithmSHA256},
+		"capitalised keys":  {1024, sql.NullString{String: `{"ChunkSize": 33554432, "Checksum": "` + sha256 + `"}`, Valid: true}, sha256, ChecksumAlgorithmSHA256},
+		"upper-case digest": {1024, sql.NullString{String: `{"chunkSize": 1024, "checksum": "5D41402ABC4B2A76B9719D911017C592"}`, Valid: true}, md5, ChecksumAlgorithmMD5},
+		"exactly one chunk": {33554432, sql.NullString{String: `{"chunkSize": 33554432, "checksum": "` + sha256 + `"}`, Valid: true}, sha256, ChecksumAlgorithmSHA256},
+		"multi-chunk":       {33554433, sql.NullString{String: `{"chunkSize": 33554432, "checksum": "` + sha256 + `"}`, Valid: true}, "", ""},
+		"no chunk size":     {1024, sql.NullString{String: `{"checksum": "` + sha256 + `"}`, Valid: true}, "", ""},
+		"empty object":      {1024, sql.NullString{String: `{}`, Valid: true}, "", ""},
+		"null":              {1024, sql.NullString{}, "", ""},
+		"not a digest":      {1024, sql.NullString{String: `{"chunkSize": 33554432, "checksum": "unknown"}`, Valid: true}, "", ""},
+		"unexpected length": {1024, sql.NullString{String: `{"chunkSize": 33554432, "checksum": "abcdef"}`, Valid: true}, "", ""},
+		"not a json object": {1024, sql.NullString{String: `"` + sha256 + `"`, Valid: true}, "", ""},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			checksum, algorithm := StoredChecksum(models.PackageHierarchyRow{Size: test.size, Checksum: test.column})
+			assert.Equal(t, test.expectedChecksum, checksum)
+			assert.Equal(t, test.expectedAlgorithm, algorithm)
+		})
+	}
+}
+
+func TestETagChecksum(t *testing.T) {
+	tests := map[string]struct {
+		etag              string
+		expectedChecksum  string
+		expectedAlgorithm string
+	}{
+		"single part":  {`"5d41402abc4b2a76b9719d911017c592"`, "5d41402abc4b2a76b9719d911017c592", ChecksumAlgorithmMD5},
+		"unquoted":     {`5d41402abc4b2a76b9719d911017c592`, "5d41402abc4b2a76b9719d911017c592", ChecksumAlgorithmMD5},
+		"multipart":    {`"5d41402abc4b2a76b9719d911017c592-3"`, "", ""},
+		"missing":      {"", "", ""},
+		"sha256 sized": {`"2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"`, "", ""},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			checksum, algorithm := ETagChecksum(test.etag)
+			assert.Equal(t, test.expectedChecksum, checksum)
+			assert.Equal(t, test.expectedAlgorithm, algorithm)
+		})
+	}
+}
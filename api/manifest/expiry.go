@@ -0,0 +1,123 @@
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// MinPresignDuration is the shortest expiry a client may ask for, unless the expiry policy sets another.
+const MinPresignDuration = time.Minute
+
+const PresignExpiryPolicyKey = "PRESIGN_EXPIRY_POLICY"
+
+// PresignBounds bounds the expiry of presigned URLs, in seconds. Zero leaves a bound as it is.
+type PresignBounds struct {
+	MinSeconds int64 `json:"minSeconds,omitempty"`
+	MaxSeconds int64 `json:"maxSeconds,omitempty"`
+}
+
+func (b PresignBounds) validate() error {
+	maxSeconds := int64(MaxPresignDuration / time.Second)
+	if b.MinSeconds < 0 || b.MinSeconds > maxSeconds {
+		return fmt.Errorf("minSeconds must be between 0 and %d", maxSeconds)
+	}
+	if b.MaxSeconds < 0 || b.MaxSeconds > maxSeconds {
+		return fmt.Errorf("maxSeconds must be between 0 and %d", maxSeconds)
+	}
+	if b.MaxSeconds > 0 && b.MinSeconds > b.MaxSeconds {
+		return fmt.Errorf("minSeconds %d is greater than maxSeconds %d", b.MinSeconds, b.MaxSeconds)
+	}
+	return nil
+}
+
+// PresignExpiryPolicy bounds the expiry that clients may ask for on presigned URLs. The bounds of a URL
+// start from MinPresignDuration and MaxPresignDuration, which Default, then the bounds of the organization
+// and then those of the bucket override in turn. The zero policy keeps those defaults everywhere.
+type PresignExpiryPolicy struct {
+	Default PresignBounds `json:"default"`
+	// Orgs are keyed by organization int id.
+	Orgs    map[int]PresignBounds    `json:"orgs,omitempty"`
+	Buckets map[string]PresignBounds `json:"buckets,omitempty"`
+}
+
+// LoadPresignExpiryPolicyFromEnv parses and validates the PresignExpiryPolicyKey environment variable.
+// If it is not set, the zero policy is returned.
+func LoadPresignExpiryPolicyFromEnv() (PresignExpiryPolicy, error) {
+	var policy PresignExpiryPolicy
+	raw := os.Getenv(PresignExpiryPolicyKey)
+	if raw == "" {
+		return policy, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &policy); err != nil {
+		return PresignExpiryPolicy{}, fmt.Errorf("parsing %s value [%s]: %w", PresignExpiryPolicyKey, raw, err)
+	}
+	if err := policy.Validate(); err != nil {
+		return PresignExpiryPolicy{}, fmt.Errorf("invalid %s: %w", PresignExpiryPolicyKey, err)
+	}
+	return policy, nil
+}
+
+// Validate checks that every bound of the policy is at most MaxPresignDuration, and that no minimum is above its maximum.
+func (p PresignExpiryPolicy) Validate() error {
+	if err := p.Default.validate(); err != nil {
+		return fmt.Errorf("default: %w", err)
+	}
+	for orgId, bounds := range p.Orgs {
+		if err := bounds.validate(); err != nil {
+			return fmt.Errorf("org %d: %w", orgId, err)
+		}
+	}
+	for bucket, bounds := range p.Buckets {
+		if err := bounds.validate(); err != nil {
+			return fmt.Errorf("bucket %s: %w", bucket, err)
+		}
+	}
+	return nil
+}
+
+// Bounds returns the shortest and longest expiry allowed on presigned URLs of the bucket for the organization.
+// An orgId of zero, as for anonymous Discover requests, has no organization bounds.
+func (p PresignExpiryPolicy) Bounds(orgId int, bucket string) (time.Duration, time.Duration) {
+	minDuration, maxDuration := MinPresignDuration, MaxPresignDuration
+	for _, bounds := range []PresignBounds{p.Default, p.Orgs[orgId], p.Buckets[bucket]} {
+		if bounds.MinSeconds > 0 {
+			minDuration = time.Duration(bounds.MinSeconds) * time.Second
+		}
+		if bounds.MaxSeconds > 0 {
+			maxDuration = time.Duration(bounds.MaxSeconds) * time.Second
+		}
+	}
+	// Bounds from different levels can cross, in which case the maximum wins.
+	if minDuration > maxDuration {
+		minDuration = maxDuration
+	}
+	return minDuration, maxDuration
+}
+
+// PresignExpiry is the expiry that a manifest asks for on its presigned URLs.
+type PresignExpiry struct {
+	Policy PresignExpiryPolicy
+	OrgId  int
+	// Requested is the expiry the client asked for. Zero asks for the longest the policy allows.
+	Requested time.Duration
+}
+
+// duration returns the expiry of a presigned URL of the bucket: the requested one, held within the bounds of
+// the policy and then cut down to signingLimit, the longest the bucket's signing credentials are valid for.
+// resignable reports whether signingLimit cut it short, so the client will need a fresh URL to keep going.
+func (e PresignExpiry) duration(bucket string, signingLimit time.Duration) (duration time.Duration, resignable bool) {
+	minDuration, maxDuration := e.Policy.Bounds(e.OrgId, bucket)
+	duration = e.Requested
+	if duration == 0 || duration > maxDuration {
+		duration = maxDuration
+	}
+	if duration < minDuration {
+		duration = minDuration
+	}
+	if duration > signingLimit {
+		return signingLimit, true
+	}
+	return duration, false
+}
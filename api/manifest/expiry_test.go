@@ -0,0 +1,101 @@
+package manifest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPresignExpiryPolicy_Bounds(t *testing.T) {
+	policy := PresignExpiryPolicy{
+		Default: PresignBounds{MinSeconds: 300},
+		Orgs:    map[int]PresignBounds{2: {MaxSeconds: 3600}, 3: {MinSeconds: 600}},
+		Buckets: map[string]PresignBounds{"slow-bucket": {MaxSeconds: 2 * 3600}, "short-bucket": {MaxSeconds: 60}},
+	}
+
+	for name, test := range map[string]struct {
+		orgId       int
+		bucket      string
+		expectedMin time.Duration
+		expectedMax time.Duration
+	}{
+		"default":                  {0, "other", 5 * time.Minute, MaxPresignDuration},
+		"org max":                  {2, "other", 5 * time.Minute, time.Hour},
+		"org min":                  {3, "other", 10 * time.Minute, MaxPresignDuration},
+		"bucket overrides org":     {2, "slow-bucket", 5 * time.Minute, 2 * time.Hour},
+		"crossed bounds take max":  {0, "short-bucket", time.Minute, time.Minute},
+		"unknown org uses default": {99, "other", 5 * time.Minute, MaxPresignDuration},
+	} {
+		t.Run(name, func(t *testing.T) {
+			minDuration, maxDuration := policy.Bounds(test.orgId, test.bucket)
+			assert.Equal(t, test.expectedMin, minDuration)
+			assert.Equal(t, test.expectedMax, maxDuration)
+		})
+	}
+
+	minDuration, maxDuration := PresignExpiryPolicy{}.Bounds(2, "any")
+	assert.Equal(t, MinPresignDuration, minDuration)
+	assert.Equal(t, MaxPresignDuration, maxDuration)
+}
+
+func TestPresignExpiry_Duration(t *testing.T) {
+	policy := PresignExpiryPolicy{Default: PresignBounds{MaxSeconds: 2 * 3600}}
+
+	for name, test := range map[string]struct {
+		requested          time.Duration
+		signingLimit       time.Duration
+		expectedDuration   time.Duration
+		expectedResignable bool
+	}{
+		"default":                {0, MaxPresignDuration, 2 * time.Hour, false},
+		"requested":              {90 * time.Minute, MaxPresignDuration, 90 * time.Minute, false},
+		"below the minimum":      {time.Second, MaxPresignDuration, MinPresignDuration, false},
+		"above the maximum":      {3 * time.Hour, MaxPresignDuration, 2 * time.Hour, false},
+		"beyond the credentials": {2 * time.Hour, STSCredentialsDuration, STSCredentialsDuration, true},
+		"within the credentials": {30 * time.Minute, STSCredentialsDuration, 30 * time.Minute, false},
+		"default beyond them":    {0, STSCredentialsDuration, STSCredentialsDuration, true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			expiry := PresignExpiry{Policy: policy, Requested: test.requested}
+			duration, resignable := expiry.duration("bucket", test.signingLimit)
+			assert.Equal(t, test.expectedDuration, duration)
+			assert.Equal(t, test.expectedResignable, resignable)
+		})
+	}
+}
+
+func TestLoadPresignExpiryPolicyFromEnv(t *testing.T) {
+	t.Run("not set", func(t *testing.T) {
+		t.Setenv(PresignExpiryPolicyKey, "")
+		policy, err := LoadPresignExpiryPolicyFromEnv()
+		require.NoError(t, err)
+		assert.Equal(t, PresignExpiryPolicy{}, policy)
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		t.Setenv(PresignExpiryPolicyKey, `{"default": {"maxSeconds": 7200}, "orgs": {"2": {"maxSeconds": 10800}}, "buckets": {"b": {"minSeconds": 60, "maxSeconds": null}}}`)
+		policy, err := LoadPresignExpiryPolicyFromEnv()
+		require.NoError(t, err)
+		assert.Equal(t, PresignExpiryPolicy{
+			Default: PresignBounds{MaxSeconds: 7200},
+			Orgs:    map[int]PresignBounds{2: {MaxSeconds: 10800}},
+			Buckets: map[string]PresignBounds{"b": {MinSeconds: 60}},
+		}, policy)
+	})
+
+	for name, raw := range map[string]string{
+		"malformed":           `{"default": `,
+		"negative":            `{"default": {"minSeconds": -1}}`,
+		"beyond the maximum":  `{"buckets": {"b": {"maxSeconds": 10801}}}`,
+		"min above max":       `{"orgs": {"2": {"minSeconds": 600, "maxSeconds": 60}}}`,
+		"non-numeric org key": `{"orgs": {"two": {"maxSeconds": 60}}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(PresignExpiryPolicyKey, raw)
+			_, err := LoadPresignExpiryPolicyFromEnv()
+			assert.ErrorContains(t, err, PresignExpiryPolicyKey)
+		})
+	}
+}
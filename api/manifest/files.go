@@ -0,0 +1,88 @@
+package manifest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/pennsieve/packages-service/api/models"
+	"github.com/pennsieve/packages-service/api/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// GetFiles returns the rows of the files of the dataset with the given ids, for signing their URLs again
+// without resolving the package hierarchy. The rows have no manifest path, which depends on the packages
+// that a manifest was requested for. Ids of no file of the dataset are left out, as are files of packages
+// in a state that they cannot be downloaded in, see GetUnavailablePackages. Rows are returned in file id order.
+func GetFiles(ctx context.Context, db *sql.DB, orgId int, datasetNodeId string, fileIds []int64) (_ []models.PackageHierarchyRow, err error) {
+	ctx, span := tracing.Start(ctx, "manifest.GetFiles",
+		attribute.Int("pennsieve.org_id", orgId),
+		attribute.Int("pennsieve.requested_file_count", len(fileIds)))
+	defer func() {
+		tracing.End(span, err)
+	}()
+
+	query := fmt.Sprintf(`
+		SELECT
+			p.dataset_id,
+			p.id AS package_id,
+			p.node_id,
+			p.type AS package_type,
+			p.state AS package_state,
+			p.name AS package_name,
+			f.id AS file_id,
+			f.name AS file_name,
+			f.size,
+			f.file_type,
+			f.s3_bucket,
+			f.s3_key,
+			f.published_s3_version_id,
+			f.scan_status,
+			f.checksum::text,
+			f.object_type
+		FROM "%[1]d".files f
+		JOIN "%[1]d".packages p ON p.id = f.package_id
+		WHERE f.id = ANY($1::bigint[])
+		AND p.dataset_id = (SELECT id FROM "%[1]d".datasets WHERE node_id = $2)
+		AND p.type != 'Collection'
+		AND NOT p.state = ANY($3::text[])
+		ORDER BY f.id`, orgId)
+
+	dbRows, err := db.QueryContext(ctx, query, pq.Array(fileIds), datasetNodeId, pq.Array(unavailableStates()))
+	if err != nil {
+		return nil, fmt.Errorf("files query failed: %w", err)
+	}
+	defer dbRows.Close()
+
+	var results []models.PackageHierarchyRow
+	for dbRows.Next() {
+		var row models.PackageHierarchyRow
+		if err := dbRows.Scan(
+			&row.DatasetId,
+			&row.PackageId,
+			&row.NodeId,
+			&row.PackageType,
+			&row.PackageState,
+			&row.PackageName,
+			&row.FileId,
+			&row.FileName,
+			&row.Size,
+			&row.FileType,
+			&row.S3Bucket,
+			&row.S3Key,
+			&row.PublishedS3VersionId,
+			&row.ScanStatus,
+			&row.Checksum,
+			&row.ObjectType,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan file row: %w", err)
+		}
+		results = append(results, row)
+	}
+	if err := dbRows.Err(); err != nil {
+		return nil, fmt.Errorf("file row iteration error: %w", err)
+	}
+
+	return results, nil
+}
@@ -0,0 +1,162 @@
+package manifest
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pennsieve/packages-service/api/models"
+)
+
+// Filter is a validated models.DownloadFilter, ready to match rows. A nil *Filter matches every row.
+type Filter struct {
+	extensions   map[string]bool
+	formats      []models.DownloadFilterFormat
+	minSize      *int64
+	maxSize      *int64
+	path         *regexp.Regexp
+	packageTypes []string
+}
+
+// NewFilter validates filter and compiles it. Formats must already be resolved from FormatIds. A nil filter gives
+// a nil *Filter.
+func NewFilter(filter *models.DownloadFilter) (*Filter, error) {
+	if filter == nil {
+		return nil, nil
+	}
+	if len(filter.FormatIds) != len(filter.Formats) {
+		return nil, fmt.Errorf("filter formats %v have not been resolved", filter.FormatIds)
+	}
+	if filter.MinSize != nil && *filter.MinSize < 0 {
+		return nil, fmt.Errorf("filter minSize must not be negative")
+	}
+	if filter.MaxSize != nil && *filter.MaxSize < 0 {
+		return nil, fmt.Errorf("filter maxSize must not be negative")
+	}
+	if filter.MinSize != nil && filter.MaxSize != nil && *filter.MinSize > *filter.MaxSize {
+		return nil, fmt.Errorf("filter minSize %d is greater than maxSize %d", *filter.MinSize, *filter.MaxSize)
+	}
+
+	compiled := &Filter{
+		formats:      filter.Formats,
+		minSize:      filter.MinSize,
+		maxSize:      filter.MaxSize,
+		packageTypes: filter.PackageTypes,
+	}
+	if len(filter.Extensions) > 0 {
+		compiled.extensions = make(map[string]bool, len(filter.Extensions))
+		for _, extension := range filter.Extensions {
+			extension = normalizeExtension(extension)
+			if extension == "" {
+				return nil, fmt.Errorf("filter extensions must not be empty")
+			}
+			compiled.extensions[extension] = true
+		}
+	}
+	if filter.Path != "" {
+		compiled.path = globRegexp(filter.Path)
+	}
+	return compiled, nil
+}
+
+// Matches reports whether row matches every criterion of the filter.
+func (f *Filter) Matches(row models.PackageHierarchyRow) bool {
+	if f == nil {
+		return true
+	}
+	extension := normalizeExtension(FileExtension(row.S3Key))
+	if f.extensions != nil && !f.extensions[extension] {
+		return false
+	}
+	if len(f.formats) > 0 && !f.matchesFormat(row.FileType, extension) {
+		return false
+	}
+	if f.minSize != nil && row.Size < *f.minSize {
+		return false
+	}
+	if f.maxSize != nil && row.Size > *f.maxSize {
+		return false
+	}
+	if f.path != nil && !f.path.MatchString(strings.Join(EntryPath(row), "/")) {
+		return false
+	}
+	if len(f.packageTypes) > 0 && !containsFold(f.packageTypes, row.PackageType) {
+		return false
+	}
+	return true
+}
+
+func (f *Filter) matchesFormat(fileType, extension string) bool {
+	for _, format := range f.formats {
+		if containsFold(format.FileTypes, fileType) {
+			return true
+		}
+		for _, formatExtension := range format.Extensions {
+			if normalizeExtension(formatExtension) == extension {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Apply returns the rows that match the filter, keeping their order.
+func (f *Filter) Apply(rows []models.PackageHierarchyRow) []models.PackageHierarchyRow {
+	if f == nil {
+		return rows
+	}
+	var matched []models.PackageHierarchyRow
+	for _, row := range rows {
+		if f.Matches(row) {
+			matched = append(matched, row)
+		}
+	}
+	return matched
+}
+
+func normalizeExtension(extension string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(extension), "."))
+}
+
+func containsFold(values []string, s string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// globRegexp translates a path glob into an anchored regular expression. "*" matches within one path component and
+// "?" one character other than "/". "**" matches across components, and "a/**" also matches "a" itself so that a
+// glob for everything under a folder includes the files directly in it. Every other character is literal.
+func globRegexp(glob string) *regexp.Regexp {
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	for i := 0; i < len(glob); {
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			pattern.WriteString("(.*/)?")
+			i += 3
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			pattern.WriteString("(/.*)?")
+			i += 3
+		case strings.HasPrefix(glob[i:], "**"):
+			pattern.WriteString(".*")
+			i += 2
+		case glob[i] == '*':
+			pattern.WriteString("[^/]*")
+			i++
+		case glob[i] == '?':
+			pattern.WriteString("[^/]")
+			i++
+		default:
+			// QuoteMeta leaves the bytes of multi-byte characters alone, so they are rejoined intact.
+			pattern.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+			i++
+		}
+	}
+	pattern.WriteString("$")
+	// Every special character has been quoted, so the pattern always compiles.
+	return regexp.MustCompile(pattern.String())
+}
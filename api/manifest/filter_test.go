@@ -0,0 +1,99 @@
+package manifest
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/pennsieve/packages-service/api/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var filterTestRows = map[string]models.PackageHierarchyRow{
+	"nwb": {
+		NodeId: "N:package:nwb", PackageType: "TimeSeries", PackageName: "session.nwb", PackageFileCount: 1,
+		PackageNamePath: []string{"primary", "sub-1"}, FileName: "session.nwb", FileType: "NWB", S3Key: "org2/session.NWB", Size: 5000,
+	},
+	"nested nwb": {
+		NodeId: "N:package:nested-nwb", PackageType: "TimeSeries", PackageName: "other.nwb", PackageFileCount: 1,
+		PackageNamePath: []string{"primary", "sub-1", "ses-2"}, FileName: "other.nwb", FileType: "NWB", S3Key: "org2/other.nwb", Size: 50,
+	},
+	"csv": {
+		NodeId: "N:package:csv", PackageType: "Tabular", PackageName: "data.csv", PackageFileCount: 1,
+		PackageNamePath: []string{"derivative"}, FileName: "data.csv", FileType: "CSV", S3Key: "org2/data.csv", Size: 1024,
+	},
+	"ome tiff": {
+		NodeId: "N:package:image", PackageType: "Image", PackageName: "image", PackageFileCount: 2,
+		PackageNamePath: []string{"primary"}, FileName: "image.ome.tiff", FileType: "OMETIFF", S3Key: "org2/image.ome.tiff", Size: 8192,
+	},
+}
+
+func TestFilter_Matches(t *testing.T) {
+	tests := map[string]struct {
+		filter   *models.DownloadFilter
+		expected []string
+	}{
+		"nil filter":            {nil, []string{"nwb", "nested nwb", "csv", "ome tiff"}},
+		"empty filter":          {&models.DownloadFilter{}, []string{"nwb", "nested nwb", "csv", "ome tiff"}},
+		"extension":             {&models.DownloadFilter{Extensions: []string{".NWB"}}, []string{"nwb", "nested nwb"}},
+		"multi-dot extension":   {&models.DownloadFilter{Extensions: []string{"ome.tiff"}}, []string{"ome tiff"}},
+		"format by file type":   {&models.DownloadFilter{FormatIds: []string{"csv"}, Formats: []models.DownloadFilterFormat{{FileTypes: []string{"CSV"}}}}, []string{"csv"}},
+		"format by extension":   {&models.DownloadFilter{FormatIds: []string{"nwb"}, Formats: []models.DownloadFilterFormat{{Extensions: []string{".nwb"}}}}, []string{"nwb", "nested nwb"}},
+		"min size":              {&models.DownloadFilter{MinSize: aws.Int64(1024)}, []string{"nwb", "csv", "ome tiff"}},
+		"max size":              {&models.DownloadFilter{MaxSize: aws.Int64(1024)}, []string{"nested nwb", "csv"}},
+		"size range":            {&models.DownloadFilter{MinSize: aws.Int64(1024), MaxSize: aws.Int64(5000)}, []string{"nwb", "csv"}},
+		"path under folder":     {&models.DownloadFilter{Path: "primary/sub-1/**"}, []string{"nwb", "nested nwb"}},
+		"path single component": {&models.DownloadFilter{Path: "primary/*"}, []string{"nwb", "ome tiff"}},
+		"path anywhere":         {&models.DownloadFilter{Path: "**/ses-?"}, []string{"nested nwb"}},
+		"literal path":          {&models.DownloadFilter{Path: "derivative"}, []string{"csv"}},
+		"package type":          {&models.DownloadFilter{PackageTypes: []string{"image", "Tabular"}}, []string{"csv", "ome tiff"}},
+		"combined":              {&models.DownloadFilter{Extensions: []string{"nwb"}, Path: "primary/sub-1"}, []string{"nwb"}},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			filter, err := NewFilter(test.filter)
+			require.NoError(t, err)
+			var matched []string
+			for _, rowName := range []string{"nwb", "nested nwb", "csv", "ome tiff"} {
+				if filter.Matches(filterTestRows[rowName]) {
+					matched = append(matched, rowName)
+				}
+			}
+			assert.Equal(t, test.expected, matched)
+		})
+	}
+}
+
+func TestNewFilter_Invalid(t *testing.T) {
+	tests := map[string]struct {
+		filter           *models.DownloadFilter
+		expectedContains string
+	}{
+		"negative min size":    {&models.DownloadFilter{MinSize: aws.Int64(-1)}, "minSize must not be negative"},
+		"negative max size":    {&models.DownloadFilter{MaxSize: aws.Int64(-1)}, "maxSize must not be negative"},
+		"min above max":        {&models.DownloadFilter{MinSize: aws.Int64(2), MaxSize: aws.Int64(1)}, "greater than maxSize"},
+		"empty extension":      {&models.DownloadFilter{Extensions: []string{"."}}, "extensions must not be empty"},
+		"unresolved format id": {&models.DownloadFilter{FormatIds: []string{"nwb"}}, "have not been resolved"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewFilter(test.filter)
+			assert.ErrorContains(t, err, test.expectedContains)
+		})
+	}
+}
+
+func TestGlobRegexp_QuotesLiterals(t *testing.T) {
+	assert.True(t, globRegexp("a+b/(c)/ñ.[x]").MatchString("a+b/(c)/ñ.[x]"))
+	assert.False(t, globRegexp("a.b").MatchString("axb"))
+}
+
+func TestFilter_Apply(t *testing.T) {
+	filter, err := NewFilter(&models.DownloadFilter{Extensions: []string{"csv"}})
+	require.NoError(t, err)
+	rows := []models.PackageHierarchyRow{filterTestRows["nwb"], filterTestRows["csv"]}
+	assert.Equal(t, []models.PackageHierarchyRow{filterTestRows["csv"]}, filter.Apply(rows))
+
+	var noFilter *Filter
+	assert.Equal(t, rows, noFilter.Apply(rows))
+}
@@ -0,0 +1,257 @@
+package manifest
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pennsieve/packages-service/api/models"
+)
+
+// Format is an output format of a download manifest.
+type Format string
+
+const (
+	// FormatJSON is the default format. Synchronous manifests are a models.DownloadManifestResponse,
+	// asynchronous ones JSON Lines of models.DownloadManifestEntry.
+	FormatJSON  Format = "json"
+	FormatCSV   Format = "csv"
+	FormatTSV   Format = "tsv"
+	FormatCurl  Format = "curl"
+	FormatWget  Format = "wget"
+	FormatAria2 Format = "aria2"
+)
+
+var formats = []Format{FormatJSON, FormatCSV, FormatTSV, FormatCurl, FormatWget, FormatAria2}
+
+// ParseFormat returns the Format named s, or an error naming the supported formats.
+func ParseFormat(s string) (Format, error) {
+	for _, f := range formats {
+		if string(f) == s {
+			return f, nil
+		}
+	}
+	names := make([]string, len(formats))
+	for i, f := range formats {
+		names[i] = string(f)
+	}
+	return "", fmt.Errorf("unsupported manifest format %q: must be one of %s", s, strings.Join(names, ", "))
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatTSV:
+		return "text/tab-separated-values; charset=utf-8"
+	case FormatCurl, FormatWget:
+		return "text/x-shellscript; charset=utf-8"
+	case FormatAria2:
+		return "text/plain; charset=utf-8"
+	default:
+		return "application/x-ndjson"
+	}
+}
+
+// FileName is the name a manifest in this format is downloaded as.
+func (f Format) FileName() string {
+	switch f {
+	case FormatCSV:
+		return "manifest.csv"
+	case FormatTSV:
+		return "manifest.tsv"
+	case FormatCurl:
+		return "download-curl.sh"
+	case FormatWget:
+		return "download-wget.sh"
+	case FormatAria2:
+		return "aria2-input.txt"
+	default:
+		return "manifest.jsonl"
+	}
+}
+
+// EntryWriter writes manifest entries one at a time, so that a manifest can be rendered without holding it all.
+// Flush must be called after the last entry.
+type EntryWriter interface {
+	Write(entry models.DownloadManifestEntry) error
+	Flush() error
+}
+
+// NewEntryWriter returns an EntryWriter rendering entries in format f to w.
+func (f Format) NewEntryWriter(w io.Writer) EntryWriter {
+	switch f {
+	case FormatCSV:
+		return newDelimitedWriter(w, ',')
+	case FormatTSV:
+		return newDelimitedWriter(w, '\t')
+	case FormatCurl, FormatWget:
+		return newScriptWriter(w, f)
+	case FormatAria2:
+		return &aria2Writer{w: bufio.NewWriter(w)}
+	default:
+		return &jsonLinesWriter{encoder: json.NewEncoder(w)}
+	}
+}
+
+// LocalPath returns the relative path of a file in a download: the manifest path of its entry
+// followed by its file name, joined with "/". Components are made safe to use in a file system
+// path and on a single line, so the result never leaves the download directory. Files that share
+// a LocalPath are told apart by AssignTargetPaths.
+func LocalPath(path []string, fileName string) string {
+	components := make([]string, 0, len(path)+1)
+	for _, component := range path {
+		components = append(components, safePathComponent(component))
+	}
+	components = append(components, safePathComponent(fileName))
+	return strings.Join(components, "/")
+}
+
+var unsafePathCharacters = strings.NewReplacer("/", "_", `\`, "_", "\n", "_", "\r", "_", "\x00", "_")
+
+func safePathComponent(name string) string {
+	name = unsafePathCharacters.Replace(name)
+	if name == "" || name == "." || name == ".." {
+		return "_"
+	}
+	return name
+}
+
+type jsonLinesWriter struct {
+	encoder *json.Encoder
+}
+
+func (j *jsonLinesWriter) Write(entry models.DownloadManifestEntry) error {
+	return j.encoder.Encode(entry)
+}
+
+func (j *jsonLinesWriter) Flush() error {
+	return nil
+}
+
+var delimitedColumns = []string{"nodeId", "packageName", "fileName", "targetPath", "size", "fileExtension", "scanStatus", "objectType", "checksumAlgorithm", "checksum", "url"}
+
+// delimitedWriter writes CSV or TSV with a header row. Columns are named for the JSON fields of an entry, but
+// there is no column for its path: the targetPath column already has it, followed by the file name.
+type delimitedWriter struct {
+	w             *csv.Writer
+	headerWritten bool
+}
+
+func newDelimitedWriter(w io.Writer, comma rune) *delimitedWriter {
+	csvWriter := csv.NewWriter(w)
+	csvWriter.Comma = comma
+	return &delimitedWriter{w: csvWriter}
+}
+
+func (d *delimitedWriter) writeHeader() error {
+	if d.headerWritten {
+		return nil
+	}
+	d.headerWritten = true
+	return d.w.Write(delimitedColumns)
+}
+
+func (d *delimitedWriter) Write(entry models.DownloadManifestEntry) error {
+	if err := d.writeHeader(); err != nil {
+		return err
+	}
+	return d.w.Write([]string{
+		entry.NodeId,
+		entry.PackageName,
+		entry.FileName,
+		TargetPath(entry),
+		strconv.FormatInt(entry.Size, 10),
+		entry.FileExtension,
+		entry.ScanStatus,
+		entry.ObjectType,
+		entry.ChecksumAlgorithm,
+		entry.Checksum,
+		entry.URL,
+	})
+}
+
+func (d *delimitedWriter) Flush() error {
+	// An empty manifest still gets its header row.
+	if err := d.writeHeader(); err != nil {
+		return err
+	}
+	d.w.Flush()
+	return d.w.Error()
+}
+
+// scriptWriter writes a POSIX shell script that downloads each entry to its TargetPath with curl or wget.
+type scriptWriter struct {
+	w             *bufio.Writer
+	format        Format
+	headerWritten bool
+}
+
+func newScriptWriter(w io.Writer, format Format) *scriptWriter {
+	return &scriptWriter{w: bufio.NewWriter(w), format: format}
+}
+
+func (s *scriptWriter) writeHeader() {
+	if s.headerWritten {
+		return
+	}
+	s.headerWritten = true
+	fmt.Fprintf(s.w, "#!/bin/sh\n# Pennsieve download manifest. The URLs in this script expire; request a new manifest if downloads fail with 403 Forbidden.\nset -e\n")
+}
+
+func (s *scriptWriter) Write(entry models.DownloadManifestEntry) error {
+	s.writeHeader()
+	targetPath := TargetPath(entry)
+	switch s.format {
+	case FormatWget:
+		if i := strings.LastIndex(targetPath, "/"); i >= 0 {
+			fmt.Fprintf(s.w, "mkdir -p -- %s\n", shellQuote(targetPath[:i]))
+		}
+		_, err := fmt.Fprintf(s.w, "wget -O %s -- %s\n", shellQuote(targetPath), shellQuote(entry.URL))
+		return err
+	default:
+		_, err := fmt.Fprintf(s.w, "curl -fL --create-dirs -o %s -- %s\n", shellQuote(targetPath), shellQuote(entry.URL))
+		return err
+	}
+}
+
+func (s *scriptWriter) Flush() error {
+	s.writeHeader()
+	return s.w.Flush()
+}
+
+// aria2Writer writes an aria2c input file, for use with aria2c --input-file. Entries with a checksum
+// get a checksum option, so that aria2c verifies the download.
+type aria2Writer struct {
+	w *bufio.Writer
+}
+
+// aria2ChecksumTypes are the aria2c names of the checksum algorithms of manifest entries.
+var aria2ChecksumTypes = map[string]string{
+	ChecksumAlgorithmSHA256: "sha-256",
+	ChecksumAlgorithmMD5:    "md5",
+}
+
+func (a *aria2Writer) Write(entry models.DownloadManifestEntry) error {
+	if _, err := fmt.Fprintf(a.w, "%s\n  out=%s\n", entry.URL, TargetPath(entry)); err != nil {
+		return err
+	}
+	if checksumType, ok := aria2ChecksumTypes[entry.ChecksumAlgorithm]; ok && entry.Checksum != "" {
+		_, err := fmt.Fprintf(a.w, "  checksum=%s=%s\n", checksumType, entry.Checksum)
+		return err
+	}
+	return nil
+}
+
+func (a *aria2Writer) Flush() error {
+	return a.w.Flush()
+}
+
+// shellQuote quotes s as a single POSIX shell word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
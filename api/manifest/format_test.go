@@ -0,0 +1,130 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+
+	"github.com/pennsieve/packages-service/api/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testEntries = []models.DownloadManifestEntry{
+	{
+		NodeId:            "N:package:one",
+		FileName:          "data.csv",
+		PackageName:       "data.csv",
+		Path:              []string{"root", "it's here"},
+		URL:               "https://pennsieve-test-storage.s3.amazonaws.com/org2/data.csv?X-Amz-Signature=abc&X-Amz-Expires=10800",
+		Size:              1024,
+		FileExtension:     "csv",
+		ScanStatus:        "clean",
+		ObjectType:        "source",
+		Checksum:          "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+		ChecksumAlgorithm: "sha256",
+	},
+	{
+		NodeId:        "N:package:two",
+		FileName:      "notes, v2.txt",
+		PackageName:   "notes, v2.txt",
+		Path:          []string{},
+		URL:           "https://pennsieve-test-storage.s3.amazonaws.com/org2/notes.txt?X-Amz-Signature=def",
+		Size:          12,
+		FileExtension: "txt",
+	},
+}
+
+func render(t *testing.T, format Format, entries []models.DownloadManifestEntry) string {
+	t.Helper()
+	var out bytes.Buffer
+	writer := format.NewEntryWriter(&out)
+	for _, entry := range entries {
+		require.NoError(t, writer.Write(entry))
+	}
+	require.NoError(t, writer.Flush())
+	return out.String()
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, name := range []string{"json", "csv", "tsv", "curl", "wget", "aria2"} {
+		format, err := ParseFormat(name)
+		require.NoError(t, err)
+		assert.Equal(t, name, string(format))
+	}
+	_, err := ParseFormat("xml")
+	assert.ErrorContains(t, err, "must be one of json, csv, tsv, curl, wget, aria2")
+}
+
+func TestLocalPath(t *testing.T) {
+	tests := map[string]struct {
+		path     []string
+		fileName string
+		expected string
+	}{
+		"dataset root":         {[]string{}, "notes.txt", "notes.txt"},
+		"nested":               {[]string{"a", "b"}, "notes.txt", "a/b/notes.txt"},
+		"separators in names":  {[]string{"a/b"}, `x\y.txt`, "a_b/x_y.txt"},
+		"relative names":       {[]string{".", ".."}, "", "_/_/_"},
+		"line breaks in names": {[]string{"a\nb"}, "c\r\n.txt", "a_b/c__.txt"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.expected, LocalPath(test.path, test.fileName))
+		})
+	}
+}
+
+func TestEntryWriter_CSV(t *testing.T) {
+	records, err := csv.NewReader(bytes.NewBufferString(render(t, FormatCSV, testEntries))).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, []string{"nodeId", "packageName", "fileName", "targetPath", "size", "fileExtension", "scanStatus", "objectType", "checksumAlgorithm", "checksum", "url"}, records[0])
+	assert.Equal(t, []string{"N:package:one", "data.csv", "data.csv", "root/it's here/data.csv", "1024", "csv", "clean", "source", "sha256", testEntries[0].Checksum, testEntries[0].URL}, records[1])
+	assert.Equal(t, "notes, v2.txt", records[2][3])
+}
+
+func TestEntryWriter_TSV(t *testing.T) {
+	reader := csv.NewReader(bytes.NewBufferString(render(t, FormatTSV, testEntries)))
+	reader.Comma = '\t'
+	records, err := reader.ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, "root/it's here/data.csv", records[1][3])
+}
+
+func TestEntryWriter_EmptyDelimited(t *testing.T) {
+	assert.Equal(t, "nodeId,packageName,fileName,targetPath,size,fileExtension,scanStatus,objectType,checksumAlgorithm,checksum,url\n", render(t, FormatCSV, nil))
+}
+
+func TestEntryWriter_Curl(t *testing.T) {
+	assert.Equal(t, `#!/bin/sh
+# Pennsieve download manifest. The URLs in this script expire; request a new manifest if downloads fail with 403 Forbidden.
+set -e
+curl -fL --create-dirs -o 'root/it'\''s here/data.csv' -- 'https://pennsieve-test-storage.s3.amazonaws.com/org2/data.csv?X-Amz-Signature=abc&X-Amz-Expires=10800'
+curl -fL --create-dirs -o 'notes, v2.txt' -- 'https://pennsieve-test-storage.s3.amazonaws.com/org2/notes.txt?X-Amz-Signature=def'
+`, render(t, FormatCurl, testEntries))
+}
+
+func TestEntryWriter_Wget(t *testing.T) {
+	assert.Equal(t, `#!/bin/sh
+# Pennsieve download manifest. The URLs in this script expire; request a new manifest if downloads fail with 403 Forbidden.
+set -e
+mkdir -p -- 'root/it'\''s here'
+wget -O 'root/it'\''s here/data.csv' -- 'https://pennsieve-test-storage.s3.amazonaws.com/org2/data.csv?X-Amz-Signature=abc&X-Amz-Expires=10800'
+wget -O 'notes, v2.txt' -- 'https://pennsieve-test-storage.s3.amazonaws.com/org2/notes.txt?X-Amz-Signature=def'
+`, render(t, FormatWget, testEntries))
+}
+
+func TestEntryWriter_Aria2(t *testing.T) {
+	assert.Equal(t, `https://pennsieve-test-storage.s3.amazonaws.com/org2/data.csv?X-Amz-Signature=abc&X-Amz-Expires=10800
+  out=root/it's here/data.csv
+  checksum=sha-256=2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824
+https://pennsieve-test-storage.s3.amazonaws.com/org2/notes.txt?X-Amz-Signature=def
+  out=notes, v2.txt
+`, render(t, FormatAria2, testEntries))
+}
+
+func TestEntryWriter_JSONLines(t *testing.T) {
+	assert.Equal(t, 2, bytes.Count([]byte(render(t, FormatJSON, testEntries)), []byte("\n")))
+}
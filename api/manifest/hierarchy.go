@@ -0,0 +1,158 @@
+package manifest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+
+	"github.com/lib/pq"
+	"github.com/pennsieve/packages-service/api/models"
+	"github.com/pennsieve/packages-service/api/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Object types of the files of a package. Source files are the files as uploaded, view files the
+// converted forms the platform generated for viewing them, and file objects other derived files.
+const (
+	ObjectTypeSource = "source"
+	ObjectTypeView   = "view"
+	ObjectTypeFile   = "file"
+)
+
+// ParseObjectTypes validates the object types of a download request. Empty means source files only,
+// which is what clients that predate the option receive. Duplicates are removed.
+func ParseObjectTypes(requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return []string{ObjectTypeSource}, nil
+	}
+	var objectTypes []string
+	for _, objectType := range requested {
+		switch objectType {
+		case ObjectTypeSource, ObjectTypeView, ObjectTypeFile:
+		default:
+			return nil, fmt.Errorf("unsupported object type %q: must be one of %s, %s, %s", objectType, ObjectTypeSource, ObjectTypeView, ObjectTypeFile)
+		}
+		if !slices.Contains(objectTypes, objectType) {
+			objectTypes = append(objectTypes, objectType)
+		}
+	}
+	return objectTypes, nil
+}
+
+// GetPackageHierarchy runs the recursive CTE to resolve package node IDs into
+// file-level rows with S3 locations, scoped to the given dataset. Empty nodeIds
+// means the whole dataset: the CTE is seeded from the packages at its root. Only
+// files of the given object types are returned, see ParseObjectTypes. Rows are returned
+// in file id order, once per file, so that manifest pages are stable. Files of packages
+// in a state that they cannot be downloaded in are left out, see GetUnavailablePackages.
+func GetPackageHierarchy(ctx context.Context, db *sql.DB, orgId int, datasetNodeId string, nodeIds []string, objectTypes []string) (_ []models.PackageHierarchyRow, err error) {
+	ctx, span := tracing.Start(ctx, "manifest.GetPackageHierarchy",
+		attribute.Int("pennsieve.org_id", orgId),
+		attribute.Int("pennsieve.requested_node_count", len(nodeIds)),
+		attribute.StringSlice("pennsieve.object_types", objectTypes))
+	defer func() {
+		tracing.End(span, err)
+	}()
+
+	query := fmt.Sprintf(`
+		WITH RECURSIVE parents AS (
+			SELECT
+				id, parent_id, dataset_id, name, type, node_id, size, state,
+				ARRAY[]::VARCHAR[] AS node_id_path,
+				ARRAY[]::VARCHAR[] AS name_path
+			FROM "%[1]d".packages
+			WHERE (node_id = ANY($1::text[]) OR (COALESCE(cardinality($1::text[]), 0) = 0 AND parent_id IS NULL))
+			AND dataset_id = (SELECT id FROM "%[1]d".datasets WHERE node_id = $2)
+
+			UNION ALL
+
+			SELECT
+				children.id, children.parent_id, children.dataset_id, children.name,
+				children.type, children.node_id, children.size, children.state,
+				(parents.node_id_path || parents.node_id)::VARCHAR[],
+				(parents.name_path || parents.name)::VARCHAR[]
+			FROM "%[1]d".packages children
+			INNER JOIN parents ON parents.id = children.parent_id
+		)
+		SELECT
+			parents.dataset_id,
+			parents.node_id_path,
+			parents.id AS package_id,
+			parents.node_id,
+			parents.type AS package_type,
+			parents.state AS package_state,
+			parents.name_path AS package_name_path,
+			parents.name AS package_name,
+			f_count.package_file_count,
+			f.id AS file_id,
+			f.name AS file_name,
+			f.size,
+			f.file_type,
+			f.s3_bucket,
+			f.s3_key,
+            f.published_s3_version_id,
+            f.scan_status,
+            f.checksum::text,
+            f.object_type
+		FROM parents
+		JOIN "%[1]d".files f ON f.package_id = parents.id
+		JOIN (
+			SELECT package_id, count(*) AS package_file_count
+			FROM "%[1]d".files
+			WHERE object_type = ANY($3::text[])
+			GROUP BY package_id
+		) AS f_count ON f_count.package_id = parents.id
+		WHERE parents.type != 'Collection'
+		AND NOT parents.state = ANY($4::text[])
+		AND f.object_type = ANY($3::text[])
+		ORDER BY f.id, cardinality(parents.node_id_path) DESC`, orgId)
+
+	dbRows, err := db.QueryContext(ctx, query, pq.Array(nodeIds), datasetNodeId, pq.Array(objectTypes), pq.Array(unavailableStates()))
+	if err != nil {
+		return nil, fmt.Errorf("package hierarchy query failed: %w", err)
+	}
+	defer dbRows.Close()
+
+	var results []models.PackageHierarchyRow
+	var lastFileId int64
+	for dbRows.Next() {
+		var row models.PackageHierarchyRow
+		if err := dbRows.Scan(
+			&row.DatasetId,
+			pq.Array(&row.NodeIdPath),
+			&row.PackageId,
+			&row.NodeId,
+			&row.PackageType,
+			&row.PackageState,
+			pq.Array(&row.PackageNamePath),
+			&row.PackageName,
+			&row.PackageFileCount,
+			&row.FileId,
+			&row.FileName,
+			&row.Size,
+			&row.FileType,
+			&row.S3Bucket,
+			&row.S3Key,
+			&row.PublishedS3VersionId,
+			&row.ScanStatus,
+			&row.Checksum,
+			&row.ObjectType,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan hierarchy row: %w", err)
+		}
+		// A file is reached more than once when the request names both a collection and one of
+		// its descendants. Rows are ordered by file id and then deepest path first, so keeping the
+		// first row keeps the file nested under the outermost requested collection.
+		if len(results) > 0 && row.FileId == lastFileId {
+			continue
+		}
+		lastFileId = row.FileId
+		results = append(results, row)
+	}
+	if err := dbRows.Err(); err != nil {
+		return nil, fmt.Errorf("hierarchy row iteration error: %w", err)
+	}
+
+	return results, nil
+}
@@ -0,0 +1,29 @@
+package manifest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseObjectTypes(t *testing.T) {
+	tests := map[string]struct {
+		requested []string
+		expected  []string
+	}{
+		"default":    {nil, []string{ObjectTypeSource}},
+		"views":      {[]string{"source", "view"}, []string{ObjectTypeSource, ObjectTypeView}},
+		"duplicates": {[]string{"file", "view", "file"}, []string{ObjectTypeFile, ObjectTypeView}},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			objectTypes, err := ParseObjectTypes(test.requested)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, objectTypes)
+		})
+	}
+
+	_, err := ParseObjectTypes([]string{"source", "thumbnail"})
+	assert.ErrorContains(t, err, `unsupported object type "thumbnail"`)
+}
@@ -0,0 +1,36 @@
+package manifest
+
+import (
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/pennsieve/packages-service/api/models"
+)
+
+// Issued tallies the files that download URLs were issued for by bucket, for the download audit log.
+// The zero value is ready to use.
+type Issued struct {
+	buckets []models.DownloadIssuanceBucket
+	index   map[string]int
+}
+
+// Add tallies the file of row, which was issued from a bucket with bucketOptions.
+func (i *Issued) Add(row models.PackageHierarchyRow, bucketOptions BucketOptions) {
+	n, ok := i.index[row.S3Bucket]
+	if !ok {
+		if i.index == nil {
+			i.index = map[string]int{}
+		}
+		n = len(i.buckets)
+		i.index[row.S3Bucket] = n
+		i.buckets = append(i.buckets, models.DownloadIssuanceBucket{
+			Bucket:        row.S3Bucket,
+			RequesterPays: bucketOptions.RequestPayer == types.RequestPayerRequester,
+		})
+	}
+	i.buckets[n].FileIds = append(i.buckets[n].FileIds, row.FileId)
+	i.buckets[n].Bytes += row.Size
+}
+
+// Buckets returns the tallies of the buckets that files were issued from, in the order they were first issued from.
+func (i *Issued) Buckets() []models.DownloadIssuanceBucket {
+	return i.buckets
+}
@@ -0,0 +1,24 @@
+package manifest
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/pennsieve/packages-service/api/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIssued(t *testing.T) {
+	var issued Issued
+	assert.Empty(t, issued.Buckets())
+
+	external := BucketOptions{RequestPayer: types.RequestPayerRequester}
+	issued.Add(models.PackageHierarchyRow{FileId: 1, Size: 100, S3Bucket: "storage"}, BucketOptions{})
+	issued.Add(models.PackageHierarchyRow{FileId: 2, Size: 200, S3Bucket: "external-publish"}, external)
+	issued.Add(models.PackageHierarchyRow{FileId: 3, Size: 300, S3Bucket: "storage"}, BucketOptions{})
+
+	assert.Equal(t, []models.DownloadIssuanceBucket{
+		{Bucket: "storage", FileIds: []int64{1, 3}, Bytes: 400},
+		{Bucket: "external-publish", RequesterPays: true, FileIds: []int64{2}, Bytes: 200},
+	}, issued.Buckets())
+}
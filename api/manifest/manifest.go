@@ -0,0 +1,255 @@
+// Package manifest turns package hierarchy rows into download manifest entries. It is shared by the
+// synchronous POST /download-manifest handler and the lambda that runs asynchronous download jobs.
+package manifest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/pennsieve/packages-service/api/models"
+)
+
+// scan_status values that prevent a presigned URL from being issued.
+// See scan-service developer docs §12.
+const (
+	scanStatusInfected = "infected"
+	scanStatusFailed   = "failed"
+)
+
+// ScanStatusBlocks reports whether a file with the given (normalized) scan status must be withheld from download
+// under the permissive ScanPolicy.
+//
+// See pennsieve/scan-service/docs/developer.md §12 for the permissive-during-scan
+// policy: infected/failed are blocked (no URL emitted); pending/scanning/clean/unscanned/
+// not_required pass through with the status surfaced to the client. Null scan_status
+// (pre-migration rows) is treated as clean — permissive default.
+func ScanStatusBlocks(s string) bool {
+	switch s {
+	case scanStatusInfected, scanStatusFailed:
+		return true
+	}
+	return false
+}
+
+// NormalizeScanStatus turns a nullable DB scan_status into a plain
+// string: null / empty → "" (pre-migration rows, permissive default).
+func NormalizeScanStatus(s sql.NullString) string {
+	if !s.Valid {
+		return ""
+	}
+	return s.String
+}
+
+// NewQuotaBlockedEntry returns the entry that explains that row was withheld from download because it would
+// have gone over a download quota.
+func NewQuotaBlockedEntry(row models.PackageHierarchyRow) models.DownloadManifestBlockedEntry {
+	entry := newBlockedEntry(row, models.DownloadBlockedReasonQuotaExceeded)
+	entry.Message = "Downloading this file would go over a download quota."
+	entry.Remediation = "Try again once the quota resets: user quotas reset daily and dataset quotas monthly, at midnight UTC."
+	return entry
+}
+
+func newBlockedEntry(row models.PackageHierarchyRow, reason string) models.DownloadManifestBlockedEntry {
+	return models.DownloadManifestBlockedEntry{
+		FileId:      row.FileId,
+		NodeId:      row.NodeId,
+		FileName:    row.FileName,
+		PackageName: row.PackageName,
+		ScanStatus:  NormalizeScanStatus(row.ScanStatus),
+		Reason:      reason,
+	}
+}
+
+// EntryPath returns the directories a downloaded file belongs under.
+// Single-file packages use only parent names, multi-file packages append the package's own name.
+// The file count only counts files of the object types requested, so a package whose view files are
+// included alongside its source gets its own directory.
+func EntryPath(row models.PackageHierarchyRow) []string {
+	var path []string
+	if row.PackageFileCount == 1 {
+		path = row.PackageNamePath
+	} else {
+		path = append(row.PackageNamePath, row.PackageName)
+	}
+	if path == nil {
+		path = []string{}
+	}
+	return path
+}
+
+// Deliveries of download URLs, as in models.DownloadManifestEntry.Delivery.
+const (
+	DeliveryS3         = "s3"
+	DeliveryCloudFront = "cloudfront"
+)
+
+// URLSigner signs download URLs that are served other than straight from S3, such as through CloudFront.
+type URLSigner interface {
+	// SignURL returns the URL of row signed to expire at expiresAt. ok is false if the signer does not serve
+	// the file, which is then presigned for S3 as usual.
+	SignURL(row models.PackageHierarchyRow, expiresAt time.Time) (signedURL string, ok bool, err error)
+	// Delivery is the delivery of the URLs the signer signs.
+	Delivery() string
+}
+
+// Presigner creates the presigned download URLs of manifest entries. Use one per manifest, with a
+// BucketOptionsCache shared by every manifest of the process.
+type Presigner struct {
+	s3Client      *s3.Client
+	client        *s3.PresignClient
+	bucketOptions *BucketOptionsCache
+	etagChecksums bool
+	expiry        PresignExpiry
+	urlSigner     URLSigner
+	issued        Issued
+}
+
+func NewPresigner(s3Client *s3.Client, bucketOptions *BucketOptionsCache) *Presigner {
+	return &Presigner{s3Client: s3Client, client: s3.NewPresignClient(s3Client), bucketOptions: bucketOptions}
+}
+
+// WithETagChecksums makes the Presigner fall back to the S3 ETag of files that have no stored checksum,
+// at the cost of a HeadObject request for each of them. It is meant for asynchronous jobs, which are not
+// bound by the API Gateway timeout.
+func (p *Presigner) WithETagChecksums() *Presigner {
+	p.etagChecksums = true
+	return p
+}
+
+// WithExpiry sets the expiry that the Presigner signs URLs for. Without it, URLs are signed for the longest
+// expiry of the default PresignExpiryPolicy.
+func (p *Presigner) WithExpiry(expiry PresignExpiry) *Presigner {
+	p.expiry = expiry
+	return p
+}
+
+// WithURLSigner makes the Presigner sign the URLs of the files that urlSigner serves with it, and presign the
+// rest for S3.
+func (p *Presigner) WithURLSigner(urlSigner URLSigner) *Presigner {
+	p.urlSigner = urlSigner
+	return p
+}
+
+// Entry returns the manifest entry of a downloadable row, including its presigned URL.
+func (p *Presigner) Entry(ctx context.Context, row models.PackageHierarchyRow) (models.DownloadManifestEntry, error) {
+	bucketOptions, err := p.bucketOptions.Get(ctx, row.S3Bucket)
+	if err != nil {
+		return models.DownloadManifestEntry{}, fmt.Errorf("failed to get bucket options for bucket=%s: %w", row.S3Bucket, err)
+	}
+
+	duration, resignable := p.expiry.duration(row.S3Bucket, bucketOptions.PresignDuration)
+	signedAt := time.Now().UTC().Truncate(time.Second)
+	signedURL, delivery, err := p.signURL(ctx, row, bucketOptions, signedAt.Add(duration), duration)
+	if err != nil {
+		return models.DownloadManifestEntry{}, err
+	}
+
+	checksum, algorithm := StoredChecksum(row)
+	if checksum == "" && p.etagChecksums {
+		if checksum, algorithm, err = p.etagChecksum(ctx, row, bucketOptions); err != nil {
+			return models.DownloadManifestEntry{}, err
+		}
+	}
+	p.issued.Add(row, bucketOptions)
+
+	return models.DownloadManifestEntry{
+		FileId:            row.FileId,
+		NodeId:            row.NodeId,
+		FileName:          row.FileName,
+		PackageName:       row.PackageName,
+		Path:              EntryPath(row),
+		URL:               signedURL,
+		ExpiresAt:         signedAt.Add(duration),
+		Resignable:        resignable,
+		Delivery:          delivery,
+		Size:              row.Size,
+		FileExtension:     FileExtension(row.S3Key),
+		ScanStatus:        NormalizeScanStatus(row.ScanStatus),
+		Checksum:          checksum,
+		ChecksumAlgorithm: algorithm,
+		ObjectType:        row.ObjectType,
+		TargetPath:        row.TargetPath,
+		Change:            row.Change,
+		Parts:             Parts(row.Size),
+	}, nil
+}
+
+// Issued returns the files that the Presigner has issued URLs for, by bucket.
+func (p *Presigner) Issued() []models.DownloadIssuanceBucket {
+	return p.issued.Buckets()
+}
+
+// signURL signs the download URL of row with the URL signer if it serves the file, and presigns it for S3 otherwise.
+// It returns the URL along with its delivery.
+func (p *Presigner) signURL(ctx context.Context, row models.PackageHierarchyRow, bucketOptions BucketOptions, expiresAt time.Time, duration time.Duration) (string, string, error) {
+	if p.urlSigner != nil {
+		signedURL, ok, err := p.urlSigner.SignURL(row, expiresAt)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to sign %s URL for bucket=%s key=%s: %w", p.urlSigner.Delivery(), row.S3Bucket, row.S3Key, err)
+		}
+		if ok {
+			return signedURL, p.urlSigner.Delivery(), nil
+		}
+	}
+
+	presignResult, err := p.client.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket:                     aws.String(row.S3Bucket),
+		Key:                        aws.String(row.S3Key),
+		VersionId:                  row.PublishedS3VersionId,
+		RequestPayer:               bucketOptions.RequestPayer,
+		ResponseContentDisposition: aws.String(fmt.Sprintf(`attachment; filename="%s"`, row.PackageName)),
+	}, s3.WithPresignExpires(duration),
+		func(options *s3.PresignOptions) {
+			options.ClientOptions = append(options.ClientOptions, bucketOptions.S3Options())
+		})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate presigned URL for bucket=%s key=%s: %w", row.S3Bucket, row.S3Key, err)
+	}
+	return presignResult.URL, DeliveryS3, nil
+}
+
+func (p *Presigner) etagChecksum(ctx context.Context, row models.PackageHierarchyRow, bucketOptions BucketOptions) (checksum, algorithm string, err error) {
+	output, err := p.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:       aws.String(row.S3Bucket),
+		Key:          aws.String(row.S3Key),
+		VersionId:    row.PublishedS3VersionId,
+		RequestPayer: bucketOptions.RequestPayer,
+	}, bucketOptions.S3Options())
+	if err != nil {
+		return "", "", fmt.Errorf("failed to head bucket=%s key=%s: %w", row.S3Bucket, row.S3Key, err)
+	}
+	checksum, algorithm = ETagChecksum(aws.ToString(output.ETag))
+	return checksum, algorithm, nil
+}
+
+// Common multi-dot extensions from the Pennsieve file type map.
+var multiDotExtensions = []string{
+	".ome.tiff", ".ome.tif", ".ome.tf2", ".ome.tf8", ".ome.btf", ".ome.xml",
+	".nii.gz", ".tar.gz", ".brukertiff.gz", ".mefd.gz", ".mgh.gz",
+}
+
+// FileExtension returns the file extension without the leading dot.
+// It checks known multi-dot extensions first, then falls back to filepath.Ext.
+func FileExtension(fileName string) string {
+	lower := strings.ToLower(fileName)
+	best := ""
+	for _, ext := range multiDotExtensions {
+		if strings.HasSuffix(lower, ext) && len(ext) > len(best) {
+			best = ext
+		}
+	}
+	if best != "" {
+		return best[1:] // strip leading dot
+	}
+	ext := filepath.Ext(fileName)
+	if ext != "" {
+		return ext[1:]
+	}
+	return ""
+}
@@ -0,0 +1,53 @@
+package manifest
+
+import (
+	"github.com/pennsieve/packages-service/api/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFileExtension(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"image.ome.tiff", "ome.tiff"},
+		{"brain.nii.gz", "nii.gz"},
+		{"archive.tar.gz", "tar.gz"},
+		{"document.pdf", "pdf"},
+		{"data.csv", "csv"},
+		{"noext", ""},
+		{"file.ome.tif", "ome.tif"},
+		{"FILE.OME.TIFF", "ome.tiff"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			assert.Equal(t, tt.expected, FileExtension(tt.input))
+		})
+	}
+}
+
+func TestEntryPath(t *testing.T) {
+	for name, tt := range map[string]struct {
+		row      models.PackageHierarchyRow
+		expected []string
+	}{
+		"top-level single file": {
+			row:      models.PackageHierarchyRow{PackageName: "data.csv", PackageFileCount: 1},
+			expected: []string{},
+		},
+		"nested single file": {
+			row:      models.PackageHierarchyRow{PackageName: "data.csv", PackageFileCount: 1, PackageNamePath: []string{"root", "child"}},
+			expected: []string{"root", "child"},
+		},
+		"nested multi file": {
+			row:      models.PackageHierarchyRow{PackageName: "recording", PackageFileCount: 2, PackageNamePath: []string{"root"}},
+			expected: []string{"root", "recording"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, EntryPath(tt.row))
+		})
+	}
+}
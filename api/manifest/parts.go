@@ -0,0 +1,26 @@
+package manifest
+
+import "github.com/pennsieve/packages-service/api/models"
+
+// Files of at least PartsThreshold bytes get part hints in their manifest entry, so that downloaders can fetch
+// them over several connections and resume a failed download from the part it failed in.
+const PartsThreshold = 5 << 30
+
+// PartSize is the size of the parts of a file, other than the last, unless the file has more than MaxParts of them.
+const PartSize = 1 << 30
+
+// MaxParts is the most parts a file is split into. Larger files get parts bigger than PartSize.
+const MaxParts = 1000
+
+// Parts returns the byte ranges of the parts of a file of size bytes, or nil if it is smaller than PartsThreshold.
+func Parts(size int64) []models.DownloadManifestPart {
+	if size < PartsThreshold {
+		return nil
+	}
+	partSize := max(int64(PartSize), (size+MaxParts-1)/MaxParts)
+	parts := make([]models.DownloadManifestPart, 0, (size+partSize-1)/partSize)
+	for start := int64(0); start < size; start += partSize {
+		parts = append(parts, models.DownloadManifestPart{Start: start, End: min(start+partSize, size) - 1})
+	}
+	return parts
+}
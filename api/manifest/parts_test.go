@@ -0,0 +1,41 @@
+package manifest
+
+import (
+	"testing"
+
+	"github.com/pennsieve/packages-service/api/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParts(t *testing.T) {
+	assert.Nil(t, Parts(0))
+	assert.Nil(t, Parts(PartsThreshold-1))
+
+	assert.Equal(t, []models.DownloadManifestPart{
+		{Start: 0, End: PartSize - 1},
+		{Start: PartSize, End: 2*PartSize - 1},
+		{Start: 2 * PartSize, End: 3*PartSize - 1},
+		{Start: 3 * PartSize, End: 4*PartSize - 1},
+		{Start: 4 * PartSize, End: 5*PartSize - 1},
+		{Start: 5 * PartSize, End: 5*PartSize + 99},
+	}, Parts(PartsThreshold+100), "the last part holds the rest")
+
+	for name, size := range map[string]int64{
+		"whole parts":            20 * PartSize,
+		"odd size":               300*PartSize + 12345,
+		"more than MaxParts":     (MaxParts + 1) * PartSize,
+		"far more than MaxParts": 5*MaxParts*PartSize + 7,
+	} {
+		t.Run(name, func(t *testing.T) {
+			parts := Parts(size)
+			assert.LessOrEqual(t, len(parts), MaxParts)
+			next := int64(0)
+			for _, part := range parts {
+				assert.Equal(t, next, part.Start, "parts are contiguous")
+				assert.GreaterOrEqual(t, part.End, part.Start)
+				next = part.End + 1
+			}
+			assert.Equal(t, size, next, "parts cover the whole file")
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package manifest
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pennsieve/packages-service/api/models"
+	"github.com/pennsieve/packages-service/api/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// The tables read here are the ones the Pennsieve discover-service creates in the discover schema of its
+// database, through the Flyway migrations of that service. A version's publish state is its status column there,
+// which takes the values of the service's PublishStatus enum.
+
+// publishSucceeded is the status of a version that is available on Discover.
+const publishSucceeded = "PUBLISH_SUCCEEDED"
+
+// embargoedStatuses are the statuses of versions published under embargo, including ones whose release has not
+// yet succeeded. A released version goes back to publishSucceeded.
+var embargoedStatuses = map[string]bool{
+	"EMBARGO_SUCCEEDED":   true,
+	"RELEASE_IN_PROGRESS": true,
+	"RELEASE_FAILED":      true,
+}
+
+var (
+	// ErrPublishedVersionNotFound is returned when a published dataset has no version with the given number, or
+	// the version did not finish publishing.
+	ErrPublishedVersionNotFound = errors.New("published dataset version not found")
+	// ErrPublishedVersionEmbargoed is returned for versions under embargo, whose files are only available to
+	// users granted access on Discover.
+	ErrPublishedVersionEmbargoed = errors.New("published dataset version is under embargo")
+)
+
+// PublishedVersion is a published dataset version available on Discover.
+type PublishedVersion struct {
+	DatasetId int64
+	Version   int
+	// S3Bucket is the publish bucket that the files of the version are in, and S3Prefix the prefix of the
+	// version's files within it.
+	S3Bucket string
+	S3Prefix string
+}
+
+// GetPublishedVersion looks up a version of a published dataset in the Discover database.
+func GetPublishedVersion(ctx context.Context, discoverDB *sql.DB, publishedDatasetId int64, version int) (PublishedVersion, error) {
+	published := PublishedVersion{DatasetId: publishedDatasetId, Version: version}
+	var status string
+	err := discoverDB.QueryRowContext(ctx, `
+		SELECT s3_bucket, s3_key, status
+		FROM discover.public_dataset_versions
+		WHERE dataset_id = $1 AND version = $2`, publishedDatasetId, version).
+		Scan(&published.S3Bucket, &published.S3Prefix, &status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return PublishedVersion{}, ErrPublishedVersionNotFound
+	}
+	if err != nil {
+		return PublishedVersion{}, fmt.Errorf("published dataset version query failed: %w", err)
+	}
+	if embargoedStatuses[status] {
+		return PublishedVersion{}, ErrPublishedVersionEmbargoed
+	}
+	if status != publishSucceeded {
+		return PublishedVersion{}, ErrPublishedVersionNotFound
+	}
+	return published, nil
+}
+
+// publishedFile is a row of discover.public_file_versions.
+type publishedFile struct {
+	Id              int64
+	Name            string
+	FileType        string
+	Size            int64
+	SourcePackageId string
+	S3Key           string
+	S3Version       *string
+	SHA256          sql.NullString
+}
+
+// GetPublishedFiles returns the files of a published dataset version as hierarchy rows, in file id order, so that
+// they page and render like the files of a workspace manifest. Published files are pinned to their S3 version,
+// and are laid out in the manifest as they are under the version's S3 prefix.
+func GetPublishedFiles(ctx context.Context, discoverDB *sql.DB, published PublishedVersion) (_ []models.PackageHierarchyRow, err error) {
+	ctx, span := tracing.Start(ctx, "manifest.GetPublishedFiles",
+		attribute.Int64("pennsieve.published_dataset_id", published.DatasetId),
+		attribute.Int("pennsieve.published_version", published.Version))
+	defer func() {
+		tracing.End(span, err)
+	}()
+
+	dbRows, err := discoverDB.QueryContext(ctx, `
+		SELECT fv.id, fv.name, fv.file_type, fv.size, fv.source_package_id, fv.s3_key, fv.s3_version, fv.sha256
+		FROM discover.public_file_versions fv
+		JOIN discover.public_dataset_version_files dvf ON dvf.file_id = fv.id
+		WHERE dvf.dataset_id = $1 AND dvf.dataset_version = $2 AND fv.dataset_id = $1
+		ORDER BY fv.id`, published.DatasetId, published.Version)
+	if err != nil {
+		return nil, fmt.Errorf("published files query failed: %w", err)
+	}
+	defer dbRows.Close()
+
+	var results []models.PackageHierarchyRow
+	for dbRows.Next() {
+		var file publishedFile
+		if err := dbRows.Scan(
+			&file.Id,
+			&file.Name,
+			&file.FileType,
+			&file.Size,
+			&file.SourcePackageId,
+			&file.S3Key,
+			&file.S3Version,
+			&file.SHA256,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan published file row: %w", err)
+		}
+		results = append(results, publishedRow(published, file))
+	}
+	if err := dbRows.Err(); err != nil {
+		return nil, fmt.Errorf("published file row iteration error: %w", err)
+	}
+	return results, nil
+}
+
+// publishedRow maps a published file onto a single-file package row, whose path is the directories of its
+// key below the version's prefix.
+func publishedRow(published PublishedVersion, file publishedFile) models.PackageHierarchyRow {
+	relativeKey := strings.TrimPrefix(strings.TrimPrefix(file.S3Key, published.S3Prefix), "/")
+	directories := strings.Split(relativeKey, "/")
+	directories = directories[:len(directories)-1]
+
+	row := models.PackageHierarchyRow{
+		NodeId:               file.SourcePackageId,
+		PackageType:          file.FileType,
+		PackageNamePath:      directories,
+		PackageName:          file.Name,
+		PackageFileCount:     1,
+		FileId:               file.Id,
+		FileName:             file.Name,
+		Size:                 file.Size,
+		FileType:             file.FileType,
+		S3Bucket:             published.S3Bucket,
+		S3Key:                file.S3Key,
+		PublishedS3VersionId: file.S3Version,
+	}
+	if file.SHA256.Valid && file.SHA256.String != "" {
+		// The digest is of the whole file, as of one chunk of its size. Marshalling a struct of two scalars cannot fail.
+		checksum, _ := json.Marshal(storedChecksum{ChunkSize: file.Size, Checksum: file.SHA256.String})
+		row.Checksum = sql.NullString{String: string(checksum), Valid: true}
+	}
+	return row
+}
@@ -0,0 +1,126 @@
+package manifest
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/pennsieve/packages-service/api/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupPublishedTestDB loads published dataset 9001 of published-test.sql into the test database, which
+// stands in for the Discover database with the discover-service tables the queries read.
+func setupPublishedTestDB(t *testing.T) *store.TestDB {
+	t.Helper()
+	db := store.OpenDB(t)
+	db.ExecSQLFile("published-test.sql")
+	t.Cleanup(func() {
+		_, err := db.Exec(`
+			DELETE FROM discover.public_dataset_version_files WHERE dataset_id = 9001;
+			DELETE FROM discover.public_file_versions WHERE id BETWEEN 900100 AND 900199;
+			DELETE FROM discover.public_dataset_versions WHERE dataset_id = 9001;
+			DELETE FROM discover.public_datasets WHERE id = 9001;`)
+		assert.NoError(t, err)
+		db.Close()
+	})
+	return db
+}
+
+func TestGetPublishedVersion(t *testing.T) {
+	db := setupPublishedTestDB(t)
+
+	published, err := GetPublishedVersion(context.Background(), db.DB, 9001, 2)
+	require.NoError(t, err)
+	assert.Equal(t, PublishedVersion{DatasetId: 9001, Version: 2, S3Bucket: "pennsieve-test-discover-publish", S3Prefix: "9001/"}, published)
+
+	tests := map[string]struct {
+		datasetId int64
+		version   int
+		expected  error
+	}{
+		"no such version":     {9001, 6, ErrPublishedVersionNotFound},
+		"no such dataset":     {9002, 1, ErrPublishedVersionNotFound},
+		"failed to publish":   {9001, 3, ErrPublishedVersionNotFound},
+		"published embargoed": {9001, 4, ErrPublishedVersionEmbargoed},
+		"release failed":      {9001, 5, ErrPublishedVersionEmbargoed},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := GetPublishedVersion(context.Background(), db.DB, test.datasetId, test.version)
+			assert.ErrorIs(t, err, test.expected)
+		})
+	}
+}
+
+func TestGetPublishedFiles(t *testing.T) {
+	db := setupPublishedTestDB(t)
+
+	first, err := GetPublishedVersion(context.Background(), db.DB, 9001, 1)
+	require.NoError(t, err)
+	rows, err := GetPublishedFiles(context.Background(), db.DB, first)
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, int64(900101), rows[0].FileId)
+	assert.Equal(t, "N:package:published-data", rows[0].NodeId)
+	assert.Equal(t, "pennsieve-test-discover-publish", rows[0].S3Bucket)
+	assert.Equal(t, "data-v1", aws.ToString(rows[0].PublishedS3VersionId))
+	assert.Equal(t, []string{"files", "primary", "sub-1"}, EntryPath(rows[0]))
+	checksum, _ := StoredChecksum(rows[0])
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", checksum)
+	assert.Equal(t, int64(900102), rows[1].FileId)
+	assert.Equal(t, []string{}, EntryPath(rows[1]))
+	assert.False(t, rows[1].Checksum.Valid)
+
+	// The second version pins the file it replaced to its new S3 version, and keeps the file it carried over.
+	second, err := GetPublishedVersion(context.Background(), db.DB, 9001, 2)
+	require.NoError(t, err)
+	rows, err = GetPublishedFiles(context.Background(), db.DB, second)
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, int64(900102), rows[0].FileId)
+	assert.Equal(t, int64(900103), rows[1].FileId)
+	assert.Equal(t, "data-v2", aws.ToString(rows[1].PublishedS3VersionId))
+	assert.Equal(t, int64(2048), rows[1].Size)
+
+	// Versions that are not available are not looked up by GetPublishedVersion, and have no files of their own.
+	rows, err = GetPublishedFiles(context.Background(), db.DB, PublishedVersion{DatasetId: 9001, Version: 3})
+	require.NoError(t, err)
+	assert.Empty(t, rows)
+}
+
+func TestPublishedRow(t *testing.T) {
+	published := PublishedVersion{DatasetId: 42, Version: 3, S3Bucket: "pennsieve-test-discover-publish", S3Prefix: "42/"}
+	sha256 := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	row := publishedRow(published, publishedFile{
+		Id:              7,
+		Name:            "data.csv",
+		FileType:        "CSV",
+		Size:            1024,
+		SourcePackageId: "N:package:source",
+		S3Key:           "42/files/primary/sub-1/data.csv",
+		S3Version:       aws.String("published-version"),
+		SHA256:          sql.NullString{String: sha256, Valid: true},
+	})
+
+	assert.Equal(t, "N:package:source", row.NodeId)
+	assert.Equal(t, int64(7), row.FileId)
+	assert.Equal(t, "pennsieve-test-discover-publish", row.S3Bucket)
+	assert.Equal(t, "42/files/primary/sub-1/data.csv", row.S3Key)
+	assert.Equal(t, "published-version", aws.ToString(row.PublishedS3VersionId))
+	assert.Equal(t, []string{"files", "primary", "sub-1"}, EntryPath(row))
+	assert.False(t, ScanPolicy{}.Blocks(row))
+	checksum, algorithm := StoredChecksum(row)
+	assert.Equal(t, sha256, checksum)
+	assert.Equal(t, ChecksumAlgorithmSHA256, algorithm)
+}
+
+func TestPublishedRow_TopLevelFileWithoutChecksum(t *testing.T) {
+	published := PublishedVersion{DatasetId: 42, Version: 3, S3Bucket: "pennsieve-test-discover-publish", S3Prefix: "42/"}
+	row := publishedRow(published, publishedFile{Id: 8, Name: "manifest.json", S3Key: "42/manifest.json"})
+
+	assert.Equal(t, []string{}, EntryPath(row))
+	assert.False(t, row.Checksum.Valid)
+}
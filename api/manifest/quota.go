@@ -0,0 +1,174 @@
+package manifest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pennsieve/packages-service/api/models"
+)
+
+const DownloadQuotaPolicyKey = "DOWNLOAD_QUOTA_POLICY"
+
+// QuotaLimits are the bytes of download URLs that may be issued per user per UTC day, across datasets, and
+// per dataset per UTC month, across users. Zero leaves a limit as it is.
+type QuotaLimits struct {
+	UserDailyBytes      int64 `json:"userDailyBytes,omitempty"`
+	DatasetMonthlyBytes int64 `json:"datasetMonthlyBytes,omitempty"`
+}
+
+func (l QuotaLimits) validate() error {
+	if l.UserDailyBytes < 0 {
+		return fmt.Errorf("userDailyBytes cannot be negative")
+	}
+	if l.DatasetMonthlyBytes < 0 {
+		return fmt.Errorf("datasetMonthlyBytes cannot be negative")
+	}
+	return nil
+}
+
+// DownloadQuotaPolicy limits the bytes of download URLs, and archives, issued for workspace datasets. The limits of an
+// organization override Default. The zero policy has no limits.
+type DownloadQuotaPolicy struct {
+	Default QuotaLimits `json:"default"`
+	// Orgs are keyed by organization int id.
+	Orgs map[int]QuotaLimits `json:"orgs,omitempty"`
+}
+
+// LoadDownloadQuotaPolicyFromEnv parses and validates the DownloadQuotaPolicyKey environment variable.
+// If it is not set, the zero policy is returned.
+func LoadDownloadQuotaPolicyFromEnv() (DownloadQuotaPolicy, error) {
+	var policy DownloadQuotaPolicy
+	raw := os.Getenv(DownloadQuotaPolicyKey)
+	if raw == "" {
+		return policy, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &policy); err != nil {
+		return DownloadQuotaPolicy{}, fmt.Errorf("parsing %s value [%s]: %w", DownloadQuotaPolicyKey, raw, err)
+	}
+	if err := policy.Validate(); err != nil {
+		return DownloadQuotaPolicy{}, fmt.Errorf("invalid %s: %w", DownloadQuotaPolicyKey, err)
+	}
+	return policy, nil
+}
+
+// Validate checks that no limit of the policy is negative.
+func (p DownloadQuotaPolicy) Validate() error {
+	if err := p.Default.validate(); err != nil {
+		return fmt.Errorf("default: %w", err)
+	}
+	for orgId, limits := range p.Orgs {
+		if err := limits.validate(); err != nil {
+			return fmt.Errorf("org %d: %w", orgId, err)
+		}
+	}
+	return nil
+}
+
+// Limits returns the limits that apply to downloads from datasets of the organization.
+func (p DownloadQuotaPolicy) Limits(orgId int) QuotaLimits {
+	limits := p.Default
+	if orgLimits := p.Orgs[orgId]; orgLimits.UserDailyBytes > 0 {
+		limits.UserDailyBytes = orgLimits.UserDailyBytes
+	}
+	if orgLimits := p.Orgs[orgId]; orgLimits.DatasetMonthlyBytes > 0 {
+		limits.DatasetMonthlyBytes = orgLimits.DatasetMonthlyBytes
+	}
+	return limits
+}
+
+// Quota is what is left of the download quotas of a request as its files are issued. Once a file does not
+// fit, no later file is issued either, so the files issued are always a prefix of the files asked for. A nil
+// Quota has no limits.
+type Quota struct {
+	userDailyRemaining      *int64
+	datasetMonthlyRemaining *int64
+	exceeded                bool
+}
+
+// NewQuota returns the quota left under limits once userDailyBytes have been issued to the user today and
+// datasetMonthlyBytes from the dataset this month. It returns nil if limits has no limits.
+func NewQuota(limits QuotaLimits, userDailyBytes, datasetMonthlyBytes int64) *Quota {
+	if limits == (QuotaLimits{}) {
+		return nil
+	}
+	quota := &Quota{}
+	if limits.UserDailyBytes > 0 {
+		remaining := max(limits.UserDailyBytes-userDailyBytes, 0)
+		quota.userDailyRemaining = &remaining
+	}
+	if limits.DatasetMonthlyBytes > 0 {
+		remaining := max(limits.DatasetMonthlyBytes-datasetMonthlyBytes, 0)
+		quota.datasetMonthlyRemaining = &remaining
+	}
+	return quota
+}
+
+// QuotaUsage is the bytes of download URLs already issued, as the download audit records them.
+type QuotaUsage interface {
+	GetUserDailyBytes(ctx context.Context, userNodeId string, day time.Time) (int64, error)
+	GetDatasetMonthlyBytes(ctx context.Context, datasetKey string, month time.Time) (int64, error)
+}
+
+// GetQuota returns what is left of the download quotas of limits for the user and the dataset at now, reading
+// only the usage that limits need from usage. It returns nil if limits has no limits.
+func GetQuota(ctx context.Context, usage QuotaUsage, limits QuotaLimits, userNodeId, datasetNodeId string, now time.Time) (*Quota, error) {
+	if limits == (QuotaLimits{}) {
+		return nil, nil
+	}
+	var userBytes, datasetBytes int64
+	var err error
+	if limits.UserDailyBytes > 0 {
+		if userBytes, err = usage.GetUserDailyBytes(ctx, userNodeId, now); err != nil {
+			return nil, err
+		}
+	}
+	if limits.DatasetMonthlyBytes > 0 {
+		if datasetBytes, err = usage.GetDatasetMonthlyBytes(ctx, datasetNodeId, now); err != nil {
+			return nil, err
+		}
+	}
+	return NewQuota(limits, userBytes, datasetBytes), nil
+}
+
+// Take takes size bytes from the quota, and reports whether they fit. Nothing is taken if they do not.
+func (q *Quota) Take(size int64) bool {
+	if q == nil {
+		return true
+	}
+	if q.exceeded || !fits(q.userDailyRemaining, size) || !fits(q.datasetMonthlyRemaining, size) {
+		q.exceeded = true
+		return false
+	}
+	for _, remaining := range []*int64{q.userDailyRemaining, q.datasetMonthlyRemaining} {
+		if remaining != nil {
+			*remaining -= size
+		}
+	}
+	return true
+}
+
+func fits(remaining *int64, size int64) bool {
+	return remaining == nil || size <= *remaining
+}
+
+// Remaining returns what is left of the quota for a manifest header, or nil if q is nil.
+func (q *Quota) Remaining() *models.DownloadManifestQuota {
+	if q == nil {
+		return nil
+	}
+	return &models.DownloadManifestQuota{
+		UserDailyRemainingBytes:      copyInt64(q.userDailyRemaining),
+		DatasetMonthlyRemainingBytes: copyInt64(q.datasetMonthlyRemaining),
+	}
+}
+
+func copyInt64(p *int64) *int64 {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
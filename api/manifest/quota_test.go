@@ -0,0 +1,73 @@
+package manifest
+
+import (
+	"testing"
+
+	"github.com/pennsieve/packages-service/api/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadQuotaPolicy_Limits(t *testing.T) {
+	policy := DownloadQuotaPolicy{
+		Default: QuotaLimits{UserDailyBytes: 1000, DatasetMonthlyBytes: 50000},
+		Orgs:    map[int]QuotaLimits{2: {UserDailyBytes: 5000}},
+	}
+	assert.Equal(t, QuotaLimits{UserDailyBytes: 5000, DatasetMonthlyBytes: 50000}, policy.Limits(2))
+	assert.Equal(t, policy.Default, policy.Limits(3))
+	assert.Equal(t, QuotaLimits{}, DownloadQuotaPolicy{}.Limits(2))
+}
+
+func TestLoadDownloadQuotaPolicyFromEnv(t *testing.T) {
+	t.Run("not set", func(t *testing.T) {
+		t.Setenv(DownloadQuotaPolicyKey, "")
+		policy, err := LoadDownloadQuotaPolicyFromEnv()
+		require.NoError(t, err)
+		assert.Equal(t, DownloadQuotaPolicy{}, policy)
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		t.Setenv(DownloadQuotaPolicyKey, `{"default": {"userDailyBytes": 1000}, "orgs": {"2": {"datasetMonthlyBytes": 9000}}}`)
+		policy, err := LoadDownloadQuotaPolicyFromEnv()
+		require.NoError(t, err)
+		assert.Equal(t, QuotaLimits{UserDailyBytes: 1000, DatasetMonthlyBytes: 9000}, policy.Limits(2))
+	})
+
+	for name, raw := range map[string]string{
+		"not json":     `{"default":`,
+		"negative":     `{"default": {"userDailyBytes": -1}}`,
+		"negative org": `{"orgs": {"2": {"datasetMonthlyBytes": -1}}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(DownloadQuotaPolicyKey, raw)
+			_, err := LoadDownloadQuotaPolicyFromEnv()
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestQuota(t *testing.T) {
+	int64Ptr := func(v int64) *int64 { return &v }
+
+	quota := NewQuota(QuotaLimits{UserDailyBytes: 1000, DatasetMonthlyBytes: 5000}, 200, 4500)
+	assert.Equal(t, &models.DownloadManifestQuota{
+		UserDailyRemainingBytes:      int64Ptr(800),
+		DatasetMonthlyRemainingBytes: int64Ptr(500),
+	}, quota.Remaining())
+	assert.True(t, quota.Take(300))
+	assert.False(t, quota.Take(300), "the dataset quota has 200 bytes left")
+	assert.False(t, quota.Take(100), "once a file does not fit, later files are not issued either")
+	assert.Equal(t, &models.DownloadManifestQuota{
+		UserDailyRemainingBytes:      int64Ptr(500),
+		DatasetMonthlyRemainingBytes: int64Ptr(200),
+	}, quota.Remaining())
+
+	quota = NewQuota(QuotaLimits{UserDailyBytes: 1000}, 1500, 0)
+	assert.Equal(t, &models.DownloadManifestQuota{UserDailyRemainingBytes: int64Ptr(0)}, quota.Remaining(), "usage over the limit leaves nothing")
+	assert.True(t, quota.Take(0))
+
+	var unlimited *Quota
+	assert.Nil(t, NewQuota(QuotaLimits{}, 100, 100))
+	assert.True(t, unlimited.Take(1<<40))
+	assert.Nil(t, unlimited.Remaining())
+}
@@ -0,0 +1,62 @@
+package manifest
+
+import (
+	"fmt"
+
+	"github.com/pennsieve/packages-service/api/models"
+)
+
+// scan_status values that strict policies tell apart when explaining why a file was withheld.
+const (
+	scanStatusClean    = "clean"
+	scanStatusPending  = "pending"
+	scanStatusScanning = "scanning"
+)
+
+// ScanPolicy decides which files are withheld from download because of their scan status. The zero value is
+// the permissive policy.
+type ScanPolicy struct {
+	Mode models.ScanPolicyMode
+}
+
+// NewScanPolicy returns the policy of stored, or the permissive policy if stored is nil.
+func NewScanPolicy(stored *models.ScanPolicy) (ScanPolicy, error) {
+	if stored == nil {
+		return ScanPolicy{}, nil
+	}
+	switch stored.Mode {
+	case models.ScanPolicyPermissive, models.ScanPolicyStrict:
+		return ScanPolicy{Mode: stored.Mode}, nil
+	default:
+		return ScanPolicy{}, fmt.Errorf("%s scan policy of org %d has unknown mode %q", stored.Scope, stored.OrgId, stored.Mode)
+	}
+}
+
+// Blocks reports whether row is withheld from download because of its scan status.
+func (p ScanPolicy) Blocks(row models.PackageHierarchyRow) bool {
+	scanStatus := NormalizeScanStatus(row.ScanStatus)
+	if p.Mode == models.ScanPolicyStrict {
+		return scanStatus != scanStatusClean
+	}
+	return ScanStatusBlocks(scanStatus)
+}
+
+// BlockedEntry returns the entry that explains why row was withheld from download because of its scan status.
+func (p ScanPolicy) BlockedEntry(row models.PackageHierarchyRow) models.DownloadManifestBlockedEntry {
+	entry := newBlockedEntry(row, models.DownloadBlockedReasonScanStatus)
+	switch entry.ScanStatus {
+	case scanStatusInfected:
+		entry.Message = "Malware was found in this file."
+		entry.Remediation = "Contact the dataset owner about replacing the file."
+	case scanStatusFailed:
+		entry.Message = "This file could not be scanned for malware."
+		entry.Remediation = "Contact support to have the file scanned again."
+	case scanStatusPending, scanStatusScanning:
+		entry.Message = "This file is still being scanned for malware, and this dataset only allows downloading files that scanned clean."
+		entry.Remediation = "Try again once the scan has finished."
+	default:
+		entry.Message = "This file has not been scanned for malware, and this dataset only allows downloading files that scanned clean."
+		entry.Remediation = "Contact support to have the file scanned."
+	}
+	return entry
+}
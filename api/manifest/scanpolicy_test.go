@@ -0,0 +1,56 @@
+package manifest
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/pennsieve/packages-service/api/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanPolicy_Blocks(t *testing.T) {
+	for scanStatus, expected := range map[sql.NullString]struct{ permissive, strict bool }{
+		{}:                                    {false, true},
+		{String: "pending", Valid: true}:      {false, true},
+		{String: "clean", Valid: true}:        {false, false},
+		{String: "infected", Valid: true}:     {true, true},
+		{String: "failed", Valid: true}:       {true, true},
+		{String: "unscanned", Valid: true}:    {false, true},
+		{String: "not_required", Valid: true}: {false, true},
+	} {
+		t.Run(scanStatus.String, func(t *testing.T) {
+			row := models.PackageHierarchyRow{ScanStatus: scanStatus}
+			assert.Equal(t, expected.permissive, ScanPolicy{}.Blocks(row))
+			assert.Equal(t, expected.permissive, ScanPolicy{Mode: models.ScanPolicyPermissive}.Blocks(row))
+			assert.Equal(t, expected.strict, ScanPolicy{Mode: models.ScanPolicyStrict}.Blocks(row))
+		})
+	}
+}
+
+func TestScanPolicy_BlockedEntry(t *testing.T) {
+	policy := ScanPolicy{Mode: models.ScanPolicyStrict}
+	for _, scanStatus := range []sql.NullString{{}, {String: "pending", Valid: true}, {String: "infected", Valid: true}, {String: "failed", Valid: true}} {
+		t.Run(scanStatus.String, func(t *testing.T) {
+			entry := policy.BlockedEntry(models.PackageHierarchyRow{NodeId: "N:package:1", FileName: "a.bin", PackageName: "a", ScanStatus: scanStatus})
+			assert.Equal(t, "N:package:1", entry.NodeId)
+			assert.Equal(t, scanStatus.String, entry.ScanStatus)
+			assert.Equal(t, models.DownloadBlockedReasonScanStatus, entry.Reason)
+			assert.NotEmpty(t, entry.Message)
+			assert.NotEmpty(t, entry.Remediation)
+		})
+	}
+}
+
+func TestNewScanPolicy(t *testing.T) {
+	policy, err := NewScanPolicy(nil)
+	require.NoError(t, err)
+	assert.Equal(t, ScanPolicy{}, policy)
+
+	policy, err = NewScanPolicy(&models.ScanPolicy{OrgId: 2, Scope: models.ScanPolicyScopeOrg, Mode: models.ScanPolicyStrict})
+	require.NoError(t, err)
+	assert.Equal(t, ScanPolicy{Mode: models.ScanPolicyStrict}, policy)
+
+	_, err = NewScanPolicy(&models.ScanPolicy{OrgId: 2, Scope: models.ScanPolicyScopeOrg, Mode: "paranoid"})
+	assert.Error(t, err)
+}
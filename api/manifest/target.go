@@ -0,0 +1,70 @@
+package manifest
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pennsieve/packages-service/api/models"
+)
+
+// AssignTargetPaths sets the TargetPath of each row that scanPolicy lets through to its LocalPath, unless another row has the same
+// one. Paths that differ only in case are the same, since they are on case-insensitive file systems. Of the rows
+// sharing a path, the one with the lowest file id keeps it, and each of the others gets " (n)" added before its
+// extension, with the lowest n that gives a path no other row has.
+//
+// rows must be every row of the manifest, in file id order, so that a file gets the same target path on
+// every page.
+func AssignTargetPaths(rows []models.PackageHierarchyRow, scanPolicy ScanPolicy) {
+	localPaths := make([]string, len(rows))
+	taken := map[string]bool{}
+	for i, row := range rows {
+		if scanPolicy.Blocks(row) {
+			continue
+		}
+		localPaths[i] = LocalPath(EntryPath(row), row.FileName)
+		taken[strings.ToLower(localPaths[i])] = true
+	}
+
+	kept := map[string]bool{}
+	for i := range rows {
+		if scanPolicy.Blocks(rows[i]) {
+			continue
+		}
+		localPath := localPaths[i]
+		if key := strings.ToLower(localPath); !kept[key] {
+			kept[key] = true
+			rows[i].TargetPath = localPath
+			continue
+		}
+		for n := 1; ; n++ {
+			candidate := disambiguatedPath(localPath, n)
+			if key := strings.ToLower(candidate); !taken[key] {
+				taken[key] = true
+				rows[i].TargetPath = candidate
+				break
+			}
+		}
+	}
+}
+
+// disambiguatedPath adds " (n)" to the file name of localPath, before its extension if it has one.
+func disambiguatedPath(localPath string, n int) string {
+	directory, name := "", localPath
+	if i := strings.LastIndex(localPath, "/"); i >= 0 {
+		directory, name = localPath[:i+1], localPath[i+1:]
+	}
+	extension := FileExtension(name)
+	if extension == "" || len(extension)+1 >= len(name) {
+		return fmt.Sprintf("%s%s (%d)", directory, name, n)
+	}
+	stem := name[:len(name)-len(extension)-1]
+	return fmt.Sprintf("%s%s (%d).%s", directory, stem, n, name[len(stem)+1:])
+}
+
+// TargetPath returns the relative path that entry is downloaded to.
+func TargetPath(entry models.DownloadManifestEntry) string {
+	if entry.TargetPath != "" {
+		return entry.TargetPath
+	}
+	return LocalPath(entry.Path, entry.FileName)
+}
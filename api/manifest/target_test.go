@@ -0,0 +1,58 @@
+package manifest
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/pennsieve/packages-service/api/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssignTargetPaths(t *testing.T) {
+	single := func(fileId int64, packageName string, path ...string) models.PackageHierarchyRow {
+		return models.PackageHierarchyRow{FileId: fileId, PackageName: packageName, FileName: packageName, PackageFileCount: 1, PackageNamePath: path}
+	}
+	multi := func(fileId int64, packageName, fileName string, path ...string) models.PackageHierarchyRow {
+		return models.PackageHierarchyRow{FileId: fileId, PackageName: packageName, FileName: fileName, PackageFileCount: 2, PackageNamePath: path}
+	}
+	infected := single(6, "data.csv", "root")
+	infected.ScanStatus = sql.NullString{String: "infected", Valid: true}
+
+	rows := []models.PackageHierarchyRow{
+		single(1, "data.csv", "root"),
+		single(2, "data.csv", "root"),
+		single(3, "Data.CSV", "root"),
+		// Already named like a disambiguated file, so the duplicates skip its name
+		single(4, "data (2).csv", "root"),
+		multi(5, "image", "tile.ome.tiff", "root"),
+		multi(7, "image", "tile.ome.tiff", "root"),
+		single(8, "README", "root"),
+		single(9, "README", "root"),
+		single(10, "data.csv", "other"),
+		infected,
+	}
+	AssignTargetPaths(rows, ScanPolicy{})
+
+	var targetPaths []string
+	for _, row := range rows {
+		targetPaths = append(targetPaths, row.TargetPath)
+	}
+	assert.Equal(t, []string{
+		"root/data.csv",
+		"root/data (1).csv",
+		"root/Data (3).CSV",
+		"root/data (2).csv",
+		"root/image/tile.ome.tiff",
+		"root/image/tile (1).ome.tiff",
+		"root/README",
+		"root/README (1)",
+		"other/data.csv",
+		// Blocked files are not downloaded, so they neither get a target path nor take one
+		"",
+	}, targetPaths)
+}
+
+func TestTargetPath(t *testing.T) {
+	assert.Equal(t, "a/b (1).csv", TargetPath(models.DownloadManifestEntry{Path: []string{"a"}, FileName: "b.csv", TargetPath: "a/b (1).csv"}))
+	assert.Equal(t, "a/b.csv", TargetPath(models.DownloadManifestEntry{Path: []string{"a"}, FileName: "b.csv"}))
+}
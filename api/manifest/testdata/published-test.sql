@@ -0,0 +1,95 @@
+-- Test data for the published dataset queries of published.go
+-- The Discover database is separate from the Pennsieve database, so its tables are created here. They follow the
+-- definitions of the discover schema in the Flyway migrations of the Pennsieve discover-service, less the
+-- columns that neither the queries nor their constraints touch (banner, readme, path, ...).
+
+CREATE SCHEMA IF NOT EXISTS discover;
+
+CREATE TABLE IF NOT EXISTS discover.public_datasets (
+    id                     SERIAL PRIMARY KEY,
+    name                   VARCHAR(255) NOT NULL,
+    source_organization_id INTEGER NOT NULL,
+    source_dataset_id      INTEGER NOT NULL,
+    owner_id               INTEGER NOT NULL,
+    owner_first_name       VARCHAR(255) NOT NULL,
+    owner_last_name        VARCHAR(255) NOT NULL,
+    owner_orcid            VARCHAR(255) NOT NULL,
+    created_at             TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at             TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS discover.public_dataset_versions (
+    dataset_id           INTEGER NOT NULL REFERENCES discover.public_datasets (id) ON DELETE CASCADE,
+    version              INTEGER NOT NULL,
+    size                 BIGINT NOT NULL,
+    description          TEXT NOT NULL,
+    model_count          JSONB NOT NULL,
+    file_count           BIGINT NOT NULL,
+    record_count         BIGINT NOT NULL,
+    s3_bucket            VARCHAR(255) NOT NULL,
+    s3_key               VARCHAR(255) NOT NULL,
+    status               VARCHAR(255) NOT NULL,
+    doi                  VARCHAR(255) NOT NULL,
+    embargo_release_date DATE,
+    created_at           TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at           TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (dataset_id, version)
+);
+
+CREATE TABLE IF NOT EXISTS discover.public_file_versions (
+    id                SERIAL PRIMARY KEY,
+    name              VARCHAR(255) NOT NULL,
+    file_type         VARCHAR(255) NOT NULL,
+    size              BIGINT NOT NULL,
+    source_package_id VARCHAR(255),
+    source_file_uuid  UUID,
+    s3_key            VARCHAR(1024) NOT NULL,
+    s3_version        VARCHAR(255) NOT NULL,
+    sha256            VARCHAR(255),
+    dataset_id        INTEGER NOT NULL REFERENCES discover.public_datasets (id) ON DELETE CASCADE,
+    created_at        TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at        TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS discover.public_dataset_version_files (
+    dataset_id      INTEGER NOT NULL,
+    dataset_version INTEGER NOT NULL,
+    file_id         INTEGER NOT NULL REFERENCES discover.public_file_versions (id) ON DELETE CASCADE,
+    created_at      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (dataset_id, dataset_version, file_id),
+    FOREIGN KEY (dataset_id, dataset_version) REFERENCES discover.public_dataset_versions (dataset_id, version) ON DELETE CASCADE
+);
+
+-- Published dataset 9001:
+--   version 1 published, with 2 files
+--   version 2 published, with 1 file carried over from version 1 and 1 new file
+--   version 3 failed to publish
+--   version 4 published under embargo
+--   version 5 under embargo, whose release failed
+INSERT INTO discover.public_datasets (id, name, source_organization_id, source_dataset_id, owner_id, owner_first_name, owner_last_name, owner_orcid) VALUES
+(9001, 'Published Test Dataset', 1, 1, 1, 'Test', 'Owner', '0000-0000-0000-0000')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO discover.public_dataset_versions (dataset_id, version, size, description, model_count, file_count, record_count, s3_bucket, s3_key, status, doi, embargo_release_date) VALUES
+(9001, 1, 1280, 'version 1', '[]', 2, 0, 'pennsieve-test-discover-publish', '9001/', 'PUBLISH_SUCCEEDED', '10.0000/test-9001-1', null),
+(9001, 2, 2304, 'version 2', '[]', 2, 0, 'pennsieve-test-discover-publish', '9001/', 'PUBLISH_SUCCEEDED', '10.0000/test-9001-2', null),
+(9001, 3, 0, 'version 3', '[]', 0, 0, 'pennsieve-test-discover-publish', '9001/', 'PUBLISH_FAILED', '10.0000/test-9001-3', null),
+(9001, 4, 2048, 'version 4', '[]', 1, 0, 'pennsieve-test-discover-embargo', '9001/', 'EMBARGO_SUCCEEDED', '10.0000/test-9001-4', '2099-01-01'),
+(9001, 5, 2048, 'version 5', '[]', 1, 0, 'pennsieve-test-discover-embargo', '9001/', 'RELEASE_FAILED', '10.0000/test-9001-5', '2020-01-01')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO discover.public_file_versions (id, name, file_type, size, source_package_id, s3_key, s3_version, sha256, dataset_id) VALUES
+(900101, 'data.csv', 'CSV', 1024, 'N:package:published-data', '9001/files/primary/sub-1/data.csv', 'data-v1', '2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824', 9001),
+(900102, 'README.md', 'Markdown', 256, 'N:package:published-readme', '9001/README.md', 'readme-v1', null, 9001),
+(900103, 'data.csv', 'CSV', 2048, 'N:package:published-data', '9001/files/primary/sub-1/data.csv', 'data-v2', null, 9001)
+ON CONFLICT DO NOTHING;
+
+INSERT INTO discover.public_dataset_version_files (dataset_id, dataset_version, file_id) VALUES
+(9001, 1, 900101),
+(9001, 1, 900102),
+(9001, 2, 900102),
+(9001, 2, 900103),
+(9001, 4, 900103),
+(9001, 5, 900103)
+ON CONFLICT DO NOTHING;
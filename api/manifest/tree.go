@@ -0,0 +1,51 @@
+package manifest
+
+import (
+	"sort"
+
+	"github.com/pennsieve/packages-service/api/models"
+)
+
+// FolderTree summarises the rows of a manifest that scanPolicy lets through by the folders of their manifest
+// paths. The root folder is unnamed and holds the whole manifest. Folders are sorted by name.
+func FolderTree(rows []models.PackageHierarchyRow, scanPolicy ScanPolicy) models.DownloadManifestFolder {
+	root := &folderNode{children: map[string]*folderNode{}}
+	for _, row := range rows {
+		if scanPolicy.Blocks(row) {
+			continue
+		}
+		node := root
+		node.count++
+		node.size += row.Size
+		for _, name := range EntryPath(row) {
+			child, ok := node.children[name]
+			if !ok {
+				child = &folderNode{children: map[string]*folderNode{}}
+				node.children[name] = child
+			}
+			node = child
+			node.count++
+			node.size += row.Size
+		}
+	}
+	return root.folder("")
+}
+
+type folderNode struct {
+	count    int
+	size     int64
+	children map[string]*folderNode
+}
+
+func (n *folderNode) folder(name string) models.DownloadManifestFolder {
+	folder := models.DownloadManifestFolder{Name: name, Count: n.count, Size: n.size}
+	names := make([]string, 0, len(n.children))
+	for childName := range n.children {
+		names = append(names, childName)
+	}
+	sort.Strings(names)
+	for _, childName := range names {
+		folder.Folders = append(folder.Folders, n.children[childName].folder(childName))
+	}
+	return folder
+}
@@ -0,0 +1,57 @@
+package manifest
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/pennsieve/packages-service/api/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFolderTree(t *testing.T) {
+	single := func(size int64, packageName string, path ...string) models.PackageHierarchyRow {
+		return models.PackageHierarchyRow{PackageName: packageName, FileName: packageName, PackageFileCount: 1, PackageNamePath: path, Size: size}
+	}
+	multi := func(size int64, packageName, fileName string, path ...string) models.PackageHierarchyRow {
+		return models.PackageHierarchyRow{PackageName: packageName, FileName: fileName, PackageFileCount: 2, PackageNamePath: path, Size: size}
+	}
+	infected := single(1000, "virus.bin", "b")
+	infected.ScanStatus = sql.NullString{String: "infected", Valid: true}
+
+	tree := FolderTree([]models.PackageHierarchyRow{
+		single(1, "top.txt"),
+		single(2, "data.csv", "b"),
+		single(4, "data.csv", "a"),
+		multi(8, "image", "tile1.tiff", "a", "nested"),
+		multi(16, "image", "tile2.tiff", "a", "nested"),
+		infected,
+	}, ScanPolicy{})
+
+	assert.Equal(t, models.DownloadManifestFolder{
+		Name:  "",
+		Count: 5,
+		Size:  31,
+		Folders: []models.DownloadManifestFolder{
+			{
+				Name:  "a",
+				Count: 3,
+				Size:  28,
+				Folders: []models.DownloadManifestFolder{
+					{
+						Name:  "nested",
+						Count: 2,
+						Size:  24,
+						// Multi-file packages are folders of their files
+						Folders: []models.DownloadManifestFolder{{Name: "image", Count: 2, Size: 24}},
+					},
+				},
+			},
+			// Blocked files are not downloaded, so they are not counted
+			{Name: "b", Count: 1, Size: 2},
+		},
+	}, tree)
+}
+
+func TestFolderTree_Empty(t *testing.T) {
+	assert.Equal(t, models.DownloadManifestFolder{}, FolderTree(nil, ScanPolicy{}))
+}
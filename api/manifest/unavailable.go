@@ -0,0 +1,149 @@
+package manifest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+
+	"github.com/lib/pq"
+	"github.com/pennsieve/packages-service/api/models"
+	"github.com/pennsieve/packages-service/api/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// unavailableReasons are the package states that files cannot be downloaded in, with the reason
+// they are reported under. GetPackageHierarchy leaves out the files of packages in these states.
+var unavailableReasons = map[string]string{
+	"DELETING":      models.DownloadUnavailableDeleted,
+	"DELETED":       models.DownloadUnavailableDeleted,
+	"RESTORING":     models.DownloadUnavailableRestoring,
+	"UNAVAILABLE":   models.DownloadUnavailableUploading,
+	"UPLOAD_FAILED": models.DownloadUnavailableUploadFailed,
+}
+
+var unavailableMessages = map[string]string{
+	models.DownloadUnavailableNotFound:     "No package with this id exists in the dataset.",
+	models.DownloadUnavailableDeleted:      "This package has been deleted.",
+	models.DownloadUnavailableRestoring:    "This package is being restored from the trash. Try again once the restore completes.",
+	models.DownloadUnavailableUploading:    "The files of this package are still being uploaded. Try again once the upload completes.",
+	models.DownloadUnavailableUploadFailed: "The upload of this package failed, so it has no files to download.",
+}
+
+// unavailableStates returns the package states of unavailableReasons, in a stable order for queries.
+func unavailableStates() []string {
+	var states []string
+	for state := range unavailableReasons {
+		states = append(states, state)
+	}
+	slices.Sort(states)
+	return states
+}
+
+// Unavailable returns an entry for each of the requested nodeIds that is not a key of states, the
+// states of the packages of the dataset by node id, or whose package is in a state that files cannot
+// be downloaded in. Entries are in the order of nodeIds, once per node id.
+func Unavailable(nodeIds []string, states map[string]string) []models.DownloadManifestUnavailableEntry {
+	var unavailable []models.DownloadManifestUnavailableEntry
+	seen := make(map[string]bool, len(nodeIds))
+	for _, nodeId := range nodeIds {
+		if seen[nodeId] {
+			continue
+		}
+		seen[nodeId] = true
+		entry := models.DownloadManifestUnavailableEntry{NodeId: nodeId}
+		state, found := states[nodeId]
+		if !found {
+			entry.Reason = models.DownloadUnavailableNotFound
+		} else if reason, ok := unavailableReasons[state]; ok {
+			entry.Reason = reason
+			entry.State = state
+		} else {
+			continue
+		}
+		entry.Message = unavailableMessages[entry.Reason]
+		unavailable = append(unavailable, entry)
+	}
+	return unavailable
+}
+
+// GetUnavailablePackages returns the requested nodeIds that GetPackageHierarchy has no files of
+// because they are not packages of the dataset, or their package is in a state that files cannot
+// be downloaded in. Only the requested node ids are checked: descendants of a requested collection
+// in such states are counted by CountUnavailableDescendants. Empty nodeIds means the whole dataset,
+// which has nothing to report.
+func GetUnavailablePackages(ctx context.Context, db *sql.DB, orgId int, datasetNodeId string, nodeIds []string) (_ []models.DownloadManifestUnavailableEntry, err error) {
+	if len(nodeIds) == 0 {
+		return nil, nil
+	}
+	ctx, span := tracing.Start(ctx, "manifest.GetUnavailablePackages",
+		attribute.Int("pennsieve.org_id", orgId),
+		attribute.Int("pennsieve.requested_node_count", len(nodeIds)))
+	defer func() {
+		tracing.End(span, err)
+	}()
+
+	query := fmt.Sprintf(`
+		SELECT node_id, state
+		FROM "%[1]d".packages
+		WHERE node_id = ANY($1::text[])
+		AND dataset_id = (SELECT id FROM "%[1]d".datasets WHERE node_id = $2)`, orgId)
+
+	dbRows, err := db.QueryContext(ctx, query, pq.Array(nodeIds), datasetNodeId)
+	if err != nil {
+		return nil, fmt.Errorf("package states query failed: %w", err)
+	}
+	defer dbRows.Close()
+
+	states := make(map[string]string, len(nodeIds))
+	for dbRows.Next() {
+		var nodeId, state string
+		if err := dbRows.Scan(&nodeId, &state); err != nil {
+			return nil, fmt.Errorf("failed to scan package state row: %w", err)
+		}
+		states[nodeId] = state
+	}
+	if err := dbRows.Err(); err != nil {
+		return nil, fmt.Errorf("package state row iteration error: %w", err)
+	}
+	return Unavailable(nodeIds, states), nil
+}
+
+// CountUnavailableDescendants counts the packages below the requested nodeIds whose files GetPackageHierarchy
+// leaves out because the package is in a state that files cannot be downloaded in, such as packages of a
+// requested collection that are in the trash or still uploading. The requested node ids themselves are
+// reported by GetUnavailablePackages instead. Empty nodeIds means the whole dataset, in which every package
+// is counted.
+func CountUnavailableDescendants(ctx context.Context, db *sql.DB, orgId int, datasetNodeId string, nodeIds []string) (_ int, err error) {
+	ctx, span := tracing.Start(ctx, "manifest.CountUnavailableDescendants",
+		attribute.Int("pennsieve.org_id", orgId),
+		attribute.Int("pennsieve.requested_node_count", len(nodeIds)))
+	defer func() {
+		tracing.End(span, err)
+	}()
+
+	query := fmt.Sprintf(`
+		WITH RECURSIVE parents AS (
+			SELECT id, node_id, type, state
+			FROM "%[1]d".packages
+			WHERE (node_id = ANY($1::text[]) OR (COALESCE(cardinality($1::text[]), 0) = 0 AND parent_id IS NULL))
+			AND dataset_id = (SELECT id FROM "%[1]d".datasets WHERE node_id = $2)
+
+			UNION
+
+			SELECT children.id, children.node_id, children.type, children.state
+			FROM "%[1]d".packages children
+			INNER JOIN parents ON parents.id = children.parent_id
+		)
+		SELECT count(DISTINCT id)
+		FROM parents
+		WHERE NOT node_id = ANY(COALESCE($1::text[], '{}'))
+		AND type != 'Collection'
+		AND state = ANY($3::text[])`, orgId)
+
+	var count int
+	if err := db.QueryRowContext(ctx, query, pq.Array(nodeIds), datasetNodeId, pq.Array(unavailableStates())).Scan(&count); err != nil {
+		return 0, fmt.Errorf("unavailable descendants query failed: %w", err)
+	}
+	return count, nil
+}
@@ -0,0 +1,52 @@
+package manifest
+
+import (
+	"testing"
+
+	"github.com/pennsieve/packages-service/api/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnavailable(t *testing.T) {
+	states := map[string]string{
+		"N:package:ready":     "READY",
+		"N:package:uploaded":  "UPLOADED",
+		"N:package:deleting":  "DELETING",
+		"N:package:deleted":   "DELETED",
+		"N:package:restoring": "RESTORING",
+		"N:package:uploading": "UNAVAILABLE",
+		"N:package:failed":    "UPLOAD_FAILED",
+	}
+	tests := map[string]struct {
+		nodeIds  []string
+		expected []string
+	}{
+		"whole dataset": {nil, nil},
+		"available":     {[]string{"N:package:ready", "N:package:uploaded"}, nil},
+		"not found": {
+			[]string{"N:package:ready", "N:package:missing"},
+			[]string{models.DownloadUnavailableNotFound},
+		},
+		"states": {
+			[]string{"N:package:deleting", "N:package:deleted", "N:package:restoring", "N:package:uploading", "N:package:failed"},
+			[]string{models.DownloadUnavailableDeleted, models.DownloadUnavailableDeleted, models.DownloadUnavailableRestoring, models.DownloadUnavailableUploading, models.DownloadUnavailableUploadFailed},
+		},
+		"duplicates": {
+			[]string{"N:package:deleted", "N:package:deleted"},
+			[]string{models.DownloadUnavailableDeleted},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			unavailable := Unavailable(test.nodeIds, states)
+			var reasons []string
+			for _, entry := range unavailable {
+				reasons = append(reasons, entry.Reason)
+				assert.Contains(t, test.nodeIds, entry.NodeId)
+				assert.Equal(t, states[entry.NodeId], entry.State)
+				assert.NotEmpty(t, entry.Message)
+			}
+			assert.Equal(t, test.expected, reasons)
+		})
+	}
+}
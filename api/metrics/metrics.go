@@ -0,0 +1,223 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NamespaceEnvKey is the environment variable holding the CloudWatch namespace metrics are published under.
+const NamespaceEnvKey = "METRICS_NAMESPACE"
+
+// DefaultNamespace is used when NamespaceEnvKey is unset.
+const DefaultNamespace = "Pennsieve/PackagesService"
+
+// maxValuesPerMetric is the most values Embedded Metric Format accepts for one metric in one document.
+const maxValuesPerMetric = 100
+
+type Unit string
+
+const (
+	Count        Unit = "Count"
+	Bytes        Unit = "Bytes"
+	Milliseconds Unit = "Milliseconds"
+)
+
+type Dimension struct {
+	Name  string
+	Value string
+}
+
+func Dim(name, value string) Dimension {
+	return Dimension{Name: name, Value: value}
+}
+
+// Recorder buffers metric values and writes them as CloudWatch Embedded Metric Format (EMF) documents on Flush.
+// Lambda forwards the documents to CloudWatch Logs, which extracts the metrics; no CloudWatch API calls are made.
+// Count values are summed between flushes; other units keep every value. A Recorder is safe for concurrent use
+// and a nil *Recorder discards everything, so code paths exercised by tests need no setup.
+type Recorder struct {
+	namespace  string
+	dimensions []Dimension
+	out        io.Writer
+	now        func() time.Time
+
+	mu   sync.Mutex
+	sets map[string]*metricSet
+	keys []string
+}
+
+// metricSet holds the metrics recorded with one combination of dimension values.
+type metricSet struct {
+	dimensions []Dimension
+	names      []string
+	units      map[string]Unit
+	values     map[string][]float64
+}
+
+// New returns a Recorder that writes to out. dimensions are added to every metric.
+func New(namespace string, out io.Writer, dimensions ...Dimension) *Recorder {
+	return &Recorder{
+		namespace:  namespace,
+		dimensions: dimensions,
+		out:        out,
+		now:        time.Now,
+		sets:       map[string]*metricSet{},
+	}
+}
+
+// NewFromEnv returns a Recorder that writes to stdout under the namespace in NamespaceEnvKey,
+// with a Service dimension and, if ENV is set, an Environment dimension.
+func NewFromEnv(service string) *Recorder {
+	namespace := os.Getenv(NamespaceEnvKey)
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+	dimensions := []Dimension{Dim("Service", service)}
+	if env := os.Getenv("ENV"); env != "" {
+		dimensions = append(dimensions, Dim("Environment", env))
+	}
+	return New(namespace, os.Stdout, dimensions...)
+}
+
+// Count adds value to the named Count metric.
+func (r *Recorder) Count(name string, value int, dimensions ...Dimension) {
+	r.Add(name, Count, float64(value), dimensions...)
+}
+
+// Bytes records value in the named Bytes metric.
+func (r *Recorder) Bytes(name string, value int64, dimensions ...Dimension) {
+	r.Add(name, Bytes, float64(value), dimensions...)
+}
+
+// Duration records d in the named Milliseconds metric.
+func (r *Recorder) Duration(name string, d time.Duration, dimensions ...Dimension) {
+	r.Add(name, Milliseconds, float64(d.Milliseconds()), dimensions...)
+}
+
+// Add records value in the named metric. The unit of the first value recorded for a name
+// with a given set of dimensions is used until the next Flush.
+func (r *Recorder) Add(name string, unit Unit, value float64, dimensions ...Dimension) {
+	if r == nil {
+		return
+	}
+	all := make([]Dimension, 0, len(r.dimensions)+len(dimensions))
+	all = append(all, r.dimensions...)
+	all = append(all, dimensions...)
+	key := dimensionsKey(all)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	set, ok := r.sets[key]
+	if !ok {
+		set = &metricSet{dimensions: all, units: map[string]Unit{}, values: map[string][]float64{}}
+		r.sets[key] = set
+		r.keys = append(r.keys, key)
+	}
+	existingUnit, ok := set.units[name]
+	if !ok {
+		set.names = append(set.names, name)
+		set.units[name] = unit
+		existingUnit = unit
+	}
+	if existingUnit == Count && len(set.values[name]) == 1 {
+		set.values[name][0] += value
+	} else {
+		set.values[name] = append(set.values[name], value)
+	}
+}
+
+// Flush writes everything recorded since the last Flush, one line per document, and resets the Recorder.
+// Call it before a Lambda invocation returns.
+func (r *Recorder) Flush() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	sets, keys := r.sets, r.keys
+	r.sets, r.keys = map[string]*metricSet{}, nil
+	r.mu.Unlock()
+
+	timestamp := r.now().UnixMilli()
+	encoder := json.NewEncoder(r.out)
+	for _, key := range keys {
+		for _, document := range sets[key].documents(r.namespace, timestamp) {
+			if err := encoder.Encode(document); err != nil {
+				return fmt.Errorf("unable to write metrics to %s: %w", r.namespace, err)
+			}
+		}
+	}
+	return nil
+}
+
+type metadata struct {
+	Timestamp         int64       `json:"Timestamp"`
+	CloudWatchMetrics []directive `json:"CloudWatchMetrics"`
+}
+
+type directive struct {
+	Namespace  string       `json:"Namespace"`
+	Dimensions [][]string   `json:"Dimensions"`
+	Metrics    []definition `json:"Metrics"`
+}
+
+type definition struct {
+	Name string `json:"Name"`
+	Unit Unit   `json:"Unit"`
+}
+
+// documents splits the set into as many EMF documents as needed to stay within maxValuesPerMetric.
+func (s *metricSet) documents(namespace string, timestamp int64) []map[string]any {
+	dimensionNames := make([]string, len(s.dimensions))
+	for i, d := range s.dimensions {
+		dimensionNames[i] = d.Name
+	}
+	var documents []map[string]any
+	for offset := 0; ; offset += maxValuesPerMetric {
+		document := map[string]any{}
+		for _, d := range s.dimensions {
+			document[d.Name] = d.Value
+		}
+		var definitions []definition
+		for _, name := range s.names {
+			values := s.values[name]
+			if offset >= len(values) {
+				continue
+			}
+			values = values[offset:min(offset+maxValuesPerMetric, len(values))]
+			definitions = append(definitions, definition{Name: name, Unit: s.units[name]})
+			if len(values) == 1 {
+				document[name] = values[0]
+			} else {
+				document[name] = values
+			}
+		}
+		if len(definitions) == 0 {
+			return documents
+		}
+		document["_aws"] = metadata{
+			Timestamp: timestamp,
+			CloudWatchMetrics: []directive{{
+				Namespace:  namespace,
+				Dimensions: [][]string{dimensionNames},
+				Metrics:    definitions,
+			}},
+		}
+		documents = append(documents, document)
+	}
+}
+
+func dimensionsKey(dimensions []Dimension) string {
+	var b strings.Builder
+	for _, d := range dimensions {
+		b.WriteString(d.Name)
+		b.WriteByte('=')
+		b.WriteString(d.Value)
+		b.WriteByte(0)
+	}
+	return b.String()
+}
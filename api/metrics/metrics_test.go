@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRecorder(out *bytes.Buffer) *Recorder {
+	recorder := New("Test/Namespace", out, Dim("Service", "test-service"))
+	recorder.now = func() time.Time { return time.UnixMilli(1700000000000) }
+	return recorder
+}
+
+func decodeDocuments(t *testing.T, out *bytes.Buffer) []map[string]any {
+	var documents []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var document map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &document))
+		documents = append(documents, document)
+	}
+	return documents
+}
+
+func TestRecorder_Flush(t *testing.T) {
+	out := &bytes.Buffer{}
+	recorder := newTestRecorder(out)
+
+	recorder.Count("ManifestFiles", 3)
+	recorder.Count("ManifestFiles", 4)
+	recorder.Bytes("ManifestBytes", 1024)
+	recorder.Duration("RestoreDuration", 1500*time.Millisecond)
+	recorder.Duration("RestoreDuration", 500*time.Millisecond)
+	recorder.Count("PresignFailures", 1, Dim("Bucket", "pennsieve-test-storage"))
+
+	require.NoError(t, recorder.Flush())
+	documents := decodeDocuments(t, out)
+	require.Len(t, documents, 2)
+
+	serviceOnly := documents[0]
+	assert.Equal(t, "test-service", serviceOnly["Service"])
+	assert.Equal(t, float64(7), serviceOnly["ManifestFiles"])
+	assert.Equal(t, float64(1024), serviceOnly["ManifestBytes"])
+	assert.Equal(t, []any{float64(1500), float64(500)}, serviceOnly["RestoreDuration"])
+
+	aws := serviceOnly["_aws"].(map[string]any)
+	assert.Equal(t, float64(1700000000000), aws["Timestamp"])
+	directive := aws["CloudWatchMetrics"].([]any)[0].(map[string]any)
+	assert.Equal(t, "Test/Namespace", directive["Namespace"])
+	assert.Equal(t, []any{[]any{"Service"}}, directive["Dimensions"])
+	assert.Equal(t, []any{
+		map[string]any{"Name": "ManifestFiles", "Unit": "Count"},
+		map[string]any{"Name": "ManifestBytes", "Unit": "Bytes"},
+		map[string]any{"Name": "RestoreDuration", "Unit": "Milliseconds"},
+	}, directive["Metrics"])
+
+	byBucket := documents[1]
+	assert.Equal(t, "pennsieve-test-storage", byBucket["Bucket"])
+	assert.Equal(t, float64(1), byBucket["PresignFailures"])
+	byBucketDirective := byBucket["_aws"].(map[string]any)["CloudWatchMetrics"].([]any)[0].(map[string]any)
+	assert.Equal(t, []any{[]any{"Service", "Bucket"}}, byBucketDirective["Dimensions"])
+
+	out.Reset()
+	require.NoError(t, recorder.Flush())
+	assert.Empty(t, out.String(), "flush should reset the recorder")
+}
+
+func TestRecorder_FlushSplitsLargeMetrics(t *testing.T) {
+	out := &bytes.Buffer{}
+	recorder := newTestRecorder(out)
+	for i := 0; i < maxValuesPerMetric+1; i++ {
+		recorder.Bytes("ManifestBytes", int64(i))
+	}
+	recorder.Count("ManifestFiles", 1)
+
+	require.NoError(t, recorder.Flush())
+	documents := decodeDocuments(t, out)
+	require.Len(t, documents, 2)
+	assert.Len(t, documents[0]["ManifestBytes"], maxValuesPerMetric)
+	assert.Equal(t, float64(1), documents[0]["ManifestFiles"])
+	assert.Equal(t, float64(maxValuesPerMetric), documents[1]["ManifestBytes"])
+	assert.NotContains(t, documents[1], "ManifestFiles")
+}
+
+func TestRecorder_Nil(t *testing.T) {
+	var recorder *Recorder
+	recorder.Count("ManifestFiles", 1)
+	recorder.Duration("RestoreDuration", time.Second)
+	assert.NoError(t, recorder.Flush())
+}
+
+func TestNewFromEnv(t *testing.T) {
+	t.Setenv(NamespaceEnvKey, "")
+	t.Setenv("ENV", "dev")
+	recorder := NewFromEnv("packages-service")
+	assert.Equal(t, DefaultNamespace, recorder.namespace)
+	assert.Equal(t, []Dimension{Dim("Service", "packages-service"), Dim("Environment", "dev")}, recorder.dimensions)
+}
@@ -0,0 +1,92 @@
+package models
+
+import "time"
+
+// DownloadAuditSource is what issued the download URLs of a DownloadIssuance.
+type DownloadAuditSource string
+
+const (
+	// DownloadAuditManifest is a POST /download-manifest response.
+	DownloadAuditManifest DownloadAuditSource = "manifest"
+	// DownloadAuditResign is a POST /download-manifest/resign response.
+	DownloadAuditResign DownloadAuditSource = "resign"
+	// DownloadAuditPublishedManifest is a GET /discover/download-manifest response.
+	DownloadAuditPublishedManifest DownloadAuditSource = "published-manifest"
+	// DownloadAuditManifestJob is the result of an asynchronous manifest job.
+	DownloadAuditManifestJob DownloadAuditSource = "manifest-job"
+	// DownloadAuditArchiveJob is an archive written by an archive job.
+	DownloadAuditArchiveJob DownloadAuditSource = "archive-job"
+)
+
+// DownloadIssuance is a set of download URLs, or an archive, issued for files of a dataset. Workspace
+// datasets are identified by DatasetNodeId, and published datasets, which are downloaded anonymously,
+// by PublishedDatasetId and PublishedVersion. RequestId is the API request id, or the id of the job.
+type DownloadIssuance struct {
+	OrgId              int
+	DatasetNodeId      string
+	PublishedDatasetId int64
+	PublishedVersion   int
+	UserNodeId         string
+	Source             DownloadAuditSource
+	RequestId          string
+	IssuedAt           time.Time
+	Buckets            []DownloadIssuanceBucket
+}
+
+// DownloadIssuanceBucket is the part of a DownloadIssuance for the files of one bucket.
+// RequesterPays is set when the bucket's owner is not billed for the download.
+type DownloadIssuanceBucket struct {
+	Bucket        string
+	RequesterPays bool
+	FileIds       []int64
+	Bytes         int64
+}
+
+// DownloadAuditRecord is a stored record of the files of one bucket that download URLs were issued for.
+// Issuances for more files than fit in one item are split over several records. DatasetKey is the
+// DatasetNodeId, or published/{PublishedDatasetId} for published datasets, and RecordId starts
+// with the issue time, so that the records of a dataset are listed in the order they were issued.
+type DownloadAuditRecord struct {
+	DatasetKey         string              `dynamodbav:"DatasetKey"`
+	RecordId           string              `dynamodbav:"RecordId"`
+	OrgId              int                 `dynamodbav:"OrgId"`
+	DatasetNodeId      string              `dynamodbav:"DatasetNodeId,omitempty"`
+	PublishedDatasetId int64               `dynamodbav:"PublishedDatasetId,omitempty"`
+	PublishedVersion   int                 `dynamodbav:"PublishedVersion,omitempty"`
+	UserNodeId         string              `dynamodbav:"UserNodeId,omitempty"`
+	Source             DownloadAuditSource `dynamodbav:"Source"`
+	RequestId          string              `dynamodbav:"RequestId"`
+	Bucket             string              `dynamodbav:"Bucket"`
+	RequesterPays      bool                `dynamodbav:"RequesterPays"`
+	FileIds            []int64             `dynamodbav:"FileIds,numberset"`
+	Bytes              int64               `dynamodbav:"Bytes"`
+	IssuedAt           time.Time           `dynamodbav:"IssuedAt"`
+}
+
+// DownloadUsage totals the files that download URLs were issued for to one user, for one dataset, in
+// one month (YYYY-MM, UTC). UserNodeId is empty for anonymous downloads of published datasets.
+// RequesterPaysBytes is the part of Bytes in buckets whose owner is not billed for the download.
+type DownloadUsage struct {
+	Month              string `json:"month" dynamodbav:"Month"`
+	UserNodeId         string `json:"userNodeId,omitempty" dynamodbav:"UserNodeId,omitempty"`
+	Files              int64  `json:"files" dynamodbav:"Files"`
+	Bytes              int64  `json:"bytes" dynamodbav:"Bytes"`
+	RequesterPaysBytes int64  `json:"requesterPaysBytes,omitempty" dynamodbav:"RequesterPaysBytes,omitempty"`
+}
+
+// DownloadUsageResponse is the response for GET /download-usage. Usage is ordered by month,
+// then user, and Total sums it.
+type DownloadUsageResponse struct {
+	DatasetNodeId string             `json:"datasetNodeId"`
+	From          string             `json:"from"`
+	To            string             `json:"to"`
+	Usage         []DownloadUsage    `json:"usage"`
+	Total         DownloadUsageTotal `json:"total"`
+}
+
+// DownloadUsageTotal sums the DownloadUsage of a DownloadUsageResponse.
+type DownloadUsageTotal struct {
+	Files              int64 `json:"files"`
+	Bytes              int64 `json:"bytes"`
+	RequesterPaysBytes int64 `json:"requesterPaysBytes,omitempty"`
+}
@@ -1,10 +1,50 @@
 package models
 
-import "database/sql"
+import (
+	"database/sql"
+	"time"
+)
 
 // DownloadRequest is the request body for POST /download-manifest.
+// Empty NodeIds means every package of the dataset.
 type DownloadRequest struct {
 	NodeIds []string `json:"nodeIds"`
+	// Filter, if set, narrows the files of the requested packages down to
+	// those matching every one of its criteria.
+	Filter *DownloadFilter `json:"filter,omitempty"`
+	// ObjectTypes are the object types of the files to include: "source",
+	// "view" and "file". Empty means source files only.
+	ObjectTypes []string `json:"objectTypes,omitempty"`
+}
+
+// DownloadFilter selects files of a download request. Criteria left empty
+// match every file, and list criteria match a file that matches any item.
+type DownloadFilter struct {
+	// Extensions are file extensions, as in DownloadManifestEntry.FileExtension.
+	// A leading dot is ignored and matching is case-insensitive.
+	Extensions []string `json:"extensions,omitempty" dynamodbav:"Extensions,omitempty"`
+	// FormatIds are ids of the GET /formats registry. A file is of a format if
+	// its file type or its extension is one of the format's.
+	FormatIds []string `json:"formatIds,omitempty" dynamodbav:"FormatIds,omitempty"`
+	// MinSize and MaxSize bound the file size in bytes, inclusive.
+	MinSize *int64 `json:"minSize,omitempty" dynamodbav:"MinSize,omitempty"`
+	MaxSize *int64 `json:"maxSize,omitempty" dynamodbav:"MaxSize,omitempty"`
+	// Path is a glob matched against the manifest path of a file, joined with "/".
+	// "*" and "?" do not match "/", "**" matches any number of directories.
+	Path string `json:"path,omitempty" dynamodbav:"Path,omitempty"`
+	// PackageTypes are package types, such as "TimeSeries" or "Image".
+	PackageTypes []string `json:"packageTypes,omitempty" dynamodbav:"PackageTypes,omitempty"`
+
+	// Formats are the registry entries of FormatIds. The registry is only
+	// compiled into the service, so they are resolved there and recorded with
+	// the download job for the download jobs lambda.
+	Formats []DownloadFilterFormat `json:"-" dynamodbav:"Formats,omitempty"`
+}
+
+// DownloadFilterFormat is the part of a formats registry entry that a DownloadFilter matches files on.
+type DownloadFilterFormat struct {
+	FileTypes  []string `dynamodbav:"FileTypes,omitempty"`
+	Extensions []string `dynamodbav:"Extensions,omitempty"`
 }
 
 // DownloadManifestResponse is the response for POST /download-manifest.
@@ -12,19 +52,76 @@ type DownloadRequest struct {
 // their scan status (currently: infected or failed). Clients should
 // surface both arrays — Data entries are directly downloadable, and
 // Blocked entries explain why the listed files were withheld.
+//
+// When the request sets a limit, Data and Blocked hold one page of the
+// manifest and NextCursor is the cursor of the following page, or empty
+// on the last page. The Header always describes the whole manifest.
+//
+// Tree summarises the manifest by folder. It is only returned for the whole
+// dataset, and only on the first page.
+//
+// A manifest of the changes since a previous manifest only has the files
+// added or changed since then in Data, and lists the files of the previous
+// manifest to delete in Removed, on the first page.
+//
+// Unavailable lists the requested node ids that none of Data comes from,
+// because they are not in the dataset or their package cannot be downloaded
+// in its current state. It is only returned on the first page.
 type DownloadManifestResponse struct {
-	Header  DownloadManifestHeader         `json:"header"`
-	Data    []DownloadManifestEntry        `json:"data"`
-	Blocked []DownloadManifestBlockedEntry `json:"blocked,omitempty"`
+	Header      DownloadManifestHeader             `json:"header"`
+	Tree        *DownloadManifestFolder            `json:"tree,omitempty"`
+	Data        []DownloadManifestEntry            `json:"data"`
+	Blocked     []DownloadManifestBlockedEntry     `json:"blocked,omitempty"`
+	Unavailable []DownloadManifestUnavailableEntry `json:"unavailable,omitempty"`
+	Removed     []DownloadManifestRemovedEntry     `json:"removed,omitempty"`
+	NextCursor  string                             `json:"nextCursor,omitempty"`
+}
+
+// DownloadManifestFolder is a folder of the manifest paths of a download
+// manifest. Count and Size total the downloadable files under the folder,
+// including those in its subfolders.
+type DownloadManifestFolder struct {
+	Name    string                   `json:"name"`
+	Count   int                      `json:"count"`
+	Size    int64                    `json:"size"`
+	Folders []DownloadManifestFolder `json:"folders,omitempty"`
 }
 
 type DownloadManifestHeader struct {
 	Count        int   `json:"count"`
 	Size         int64 `json:"size"`
 	BlockedCount int   `json:"blockedCount,omitempty"`
+	// UnavailableCount is the number of packages inside the requested
+	// collections, or the dataset if the whole dataset was requested, whose
+	// files are left out because of the state of the package, as for
+	// DownloadManifestResponse.Unavailable. Requested node ids are listed in
+	// Unavailable instead of being counted.
+	UnavailableCount int `json:"unavailableCount,omitempty"`
+	// Quota is the download quota left once the URLs of the response are
+	// used up. It is omitted when no quota applies to the request.
+	Quota *DownloadManifestQuota `json:"quota,omitempty"`
+	// SnapshotToken is set on the first page of a manifest requested with
+	// snapshot or changed_since. Pass it as changed_since to get only the
+	// changes since this manifest.
+	SnapshotToken string `json:"snapshotToken,omitempty"`
+}
+
+// DownloadManifestQuota is the number of bytes that may still be issued
+// under each download quota that applies to a request. A quota that does
+// not apply is omitted.
+type DownloadManifestQuota struct {
+	// UserDailyRemainingBytes is left of the user's quota for the current
+	// UTC day, across datasets.
+	UserDailyRemainingBytes *int64 `json:"userDailyRemainingBytes,omitempty"`
+	// DatasetMonthlyRemainingBytes is left of the dataset's quota for the
+	// current UTC month, across users.
+	DatasetMonthlyRemainingBytes *int64 `json:"datasetMonthlyRemainingBytes,omitempty"`
 }
 
 type DownloadManifestEntry struct {
+	// FileId is the id of the file, for POST /download-manifest/resign. It is
+	// omitted from manifests of published datasets.
+	FileId        int64    `json:"fileId,omitempty"`
 	NodeId        string   `json:"nodeId"`
 	FileName      string   `json:"fileName"`
 	PackageName   string   `json:"packageName"`
@@ -39,16 +136,141 @@ type DownloadManifestEntry struct {
 	// surfaced here so the UI can render an appropriate indicator;
 	// "infected" / "failed" never appear in Data (they're in Blocked).
 	ScanStatus string `json:"scanStatus,omitempty"`
+	// Checksum is the lower-case hex digest of the file and ChecksumAlgorithm
+	// the algorithm that produced it, "sha256" or "md5". Both are omitted
+	// when no checksum is known for the file.
+	Checksum          string `json:"checksum,omitempty"`
+	ChecksumAlgorithm string `json:"checksumAlgorithm,omitempty"`
+	// ObjectType is the object type of the file: "source" for the file as
+	// uploaded, "view" or "file" for files the platform derived from it.
+	ObjectType string `json:"objectType,omitempty"`
+	// TargetPath is the relative path, joined with "/", that the file should be
+	// saved to. It is Path followed by FileName, made safe for file systems and
+	// disambiguated with a " (n)" suffix if another file of the manifest would be
+	// saved to the same path. Path and FileName keep the original names for display.
+	TargetPath string `json:"targetPath,omitempty"`
+	// ExpiresAt is when URL expires. Resignable is set when URL expires sooner
+	// than the client asked for, because the credentials that signed it do not
+	// last any longer. POST /download-manifest/resign gives fresh URLs by
+	// FileId, as does requesting the same manifest page again.
+	ExpiresAt  time.Time `json:"expiresAt"`
+	Resignable bool      `json:"resignable,omitempty"`
+	// Delivery is how URL is served: "s3" for an S3 presigned URL, or
+	// "cloudfront" for a CloudFront signed URL.
+	Delivery string `json:"delivery,omitempty"`
+	// Change is set in manifests of the changes since a previous manifest:
+	// DownloadChangeAdded or DownloadChangeModified.
+	Change string `json:"change,omitempty"`
+	// Parts are the byte ranges that a very large file can be fetched in, in
+	// parallel and resuming part by part, with Range requests to URL. Omitted
+	// for smaller files.
+	Parts []DownloadManifestPart `json:"parts,omitempty"`
+}
+
+// DownloadResignRequest is the request body for POST /download-manifest/resign.
+// FileIds are the DownloadManifestEntry.FileId of the files to re-sign.
+type DownloadResignRequest struct {
+	FileIds []int64 `json:"fileIds"`
+}
+
+// DownloadResignResponse is the response for POST /download-manifest/resign.
+// Data has fresh URLs for the requested files that can still be downloaded.
+// Blocked lists those now withheld because of their scan status or a
+// download quota, and Missing the file ids that are no longer downloadable
+// files of the dataset, because they or their package were deleted or are
+// in a state that files cannot be downloaded in. Quota is as in
+// DownloadManifestHeader.
+type DownloadResignResponse struct {
+	Data    []DownloadResignedEntry        `json:"data"`
+	Blocked []DownloadManifestBlockedEntry `json:"blocked,omitempty"`
+	Missing []int64                        `json:"missing,omitempty"`
+	Quota   *DownloadManifestQuota         `json:"quota,omitempty"`
+}
+
+// DownloadResignedEntry is the fresh URL of a file of a manifest, with the
+// fields of DownloadManifestEntry that change when it is signed again. The
+// rest, such as TargetPath, depend on the manifest request and are left to
+// the manifest the file came from.
+type DownloadResignedEntry struct {
+	FileId     int64     `json:"fileId"`
+	NodeId     string    `json:"nodeId"`
+	URL        string    `json:"url"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	Resignable bool      `json:"resignable,omitempty"`
+	Delivery   string    `json:"delivery,omitempty"`
+}
+
+// Changes of the files of a manifest since a previous one, as in DownloadManifestEntry.Change.
+const (
+	DownloadChangeAdded    = "added"
+	DownloadChangeModified = "changed"
+)
+
+// DownloadManifestRemovedEntry is a file that was in a previous manifest at
+// TargetPath, and is no longer there. The file was deleted, left the
+// selection, is now withheld from download, or moved to another path.
+type DownloadManifestRemovedEntry struct {
+	NodeId     string `json:"nodeId"`
+	TargetPath string `json:"targetPath"`
 }
 
+// DownloadManifestPart is the byte range of a part of a file, for a Range
+// header of "bytes=<Start>-<End>". End is inclusive.
+type DownloadManifestPart struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+// Reasons that files are excluded from Data, as in DownloadManifestBlockedEntry.Reason.
+const (
+	// DownloadBlockedReasonScanStatus is for files with a blocking scan status.
+	DownloadBlockedReasonScanStatus = "scan_status"
+	// DownloadBlockedReasonQuotaExceeded is for files that would take the
+	// request over a download quota.
+	DownloadBlockedReasonQuotaExceeded = "quota_exceeded"
+)
+
 // DownloadManifestBlockedEntry is returned for files that were
-// excluded from Data because of a blocking scan status. It omits the
-// presigned URL by design — the client should not attempt download.
+// excluded from Data because of a blocking scan status or a download
+// quota, as Reason says. It omits the presigned URL by design — the
+// client should not attempt download. Message explains why the file
+// was withheld and Remediation what can be done about it, both for
+// display to users.
 type DownloadManifestBlockedEntry struct {
+	FileId      int64  `json:"fileId,omitempty"`
 	NodeId      string `json:"nodeId"`
 	FileName    string `json:"fileName"`
 	PackageName string `json:"packageName"`
-	ScanStatus  string `json:"scanStatus"`
+	ScanStatus  string `json:"scanStatus,omitempty"`
+	Reason      string `json:"reason"`
+	Message     string `json:"message,omitempty"`
+	Remediation string `json:"remediation,omitempty"`
+}
+
+// Reasons that requested packages are left out of a manifest, as in
+// DownloadManifestUnavailableEntry.Reason.
+const (
+	// DownloadUnavailableNotFound is for node ids of no package of the dataset.
+	DownloadUnavailableNotFound = "not_found"
+	// DownloadUnavailableDeleted is for packages that are being or have been deleted.
+	DownloadUnavailableDeleted = "deleted"
+	// DownloadUnavailableRestoring is for deleted packages that are being restored.
+	DownloadUnavailableRestoring = "restoring"
+	// DownloadUnavailableUploading is for packages whose files are still being uploaded.
+	DownloadUnavailableUploading = "uploading"
+	// DownloadUnavailableUploadFailed is for packages whose upload failed.
+	DownloadUnavailableUploadFailed = "upload_failed"
+)
+
+// DownloadManifestUnavailableEntry is a requested node id that the manifest
+// has no files of, for the reason given by Reason. State is the state of the
+// package, omitted if there is no such package. Message explains the reason
+// for display to users.
+type DownloadManifestUnavailableEntry struct {
+	NodeId  string `json:"nodeId"`
+	Reason  string `json:"reason"`
+	State   string `json:"state,omitempty"`
+	Message string `json:"message,omitempty"`
 }
 
 // PackageHierarchyRow represents a single row from the recursive package hierarchy query.
@@ -70,4 +292,10 @@ type PackageHierarchyRow struct {
 	S3Key                string
 	PublishedS3VersionId *string
 	ScanStatus           sql.NullString
+	Checksum             sql.NullString
+	ObjectType           string
+	// TargetPath is set by manifest.AssignTargetPaths.
+	TargetPath string
+	// Change is set by manifest.Changes.
+	Change string
 }
@@ -0,0 +1,77 @@
+package models
+
+import "time"
+
+type DownloadJobKind string
+
+const (
+	// DownloadJobKindManifest jobs write the download manifest of a selection to S3 as JSON Lines.
+	DownloadJobKindManifest DownloadJobKind = "manifest"
+	// DownloadJobKindArchive jobs write the files of a selection to S3 as a single ZIP archive.
+	DownloadJobKindArchive DownloadJobKind = "archive"
+)
+
+type DownloadJobStatus string
+
+const (
+	DownloadJobQueued    DownloadJobStatus = "queued"
+	DownloadJobRunning   DownloadJobStatus = "running"
+	DownloadJobCompleted DownloadJobStatus = "completed"
+	DownloadJobFailed    DownloadJobStatus = "failed"
+)
+
+// DownloadJob is the stored record of an asynchronous download job. The request
+// fields are recorded when the job is queued, and the result fields are filled in by
+// the download jobs lambda when the job completes or fails. Filter is the request filter, with
+// its formats resolved, and ObjectTypes the validated request object types. Format is the manifest.Format of a manifest job, where empty means JSON Lines.
+// PresignExpirySeconds is the expires_in of a manifest job, where zero means the longest expiry the policy allows.
+type DownloadJob struct {
+	JobId                string            `dynamodbav:"JobId"`
+	Kind                 DownloadJobKind   `dynamodbav:"Kind"`
+	Status               DownloadJobStatus `dynamodbav:"Status"`
+	OrgId                int               `dynamodbav:"OrgId"`
+	DatasetNodeId        string            `dynamodbav:"DatasetNodeId"`
+	UserNodeId           string            `dynamodbav:"UserNodeId"`
+	NodeIds              []string          `dynamodbav:"NodeIds"`
+	Filter               *DownloadFilter   `dynamodbav:"Filter,omitempty"`
+	ObjectTypes          []string          `dynamodbav:"ObjectTypes,omitempty"`
+	Format               string            `dynamodbav:"Format,omitempty"`
+	PresignExpirySeconds int64             `dynamodbav:"PresignExpirySeconds,omitempty"`
+	CreatedAt            time.Time         `dynamodbav:"CreatedAt"`
+	UpdatedAt            time.Time         `dynamodbav:"UpdatedAt"`
+	// ExpiresAt is the DynamoDB TTL of the record, in epoch seconds. Result objects
+	// are expired from the download jobs bucket on a matching lifecycle rule.
+	ExpiresAt int64 `dynamodbav:"ExpiresAt"`
+	// Unavailable are the requested node ids that the job has no files of, as of when it was queued.
+	Unavailable []DownloadManifestUnavailableEntry `dynamodbav:"Unavailable,omitempty"`
+
+	Header *DownloadManifestHeader `dynamodbav:"Header,omitempty"`
+	// ResultKey and BlockedKey are the keys of the job's result objects in the download jobs bucket.
+	// BlockedKey is empty if no files were blocked.
+	ResultKey  string `dynamodbav:"ResultKey,omitempty"`
+	BlockedKey string `dynamodbav:"BlockedKey,omitempty"`
+	Error      string `dynamodbav:"Error,omitempty"`
+}
+
+// DownloadJobMessage is the SQS message that asks the download jobs lambda to run a queued job.
+type DownloadJobMessage struct {
+	JobId string `json:"jobId"`
+}
+
+// DownloadJobResponse is the response for POST /download-manifest?async=true, POST /download-archive and GET /download-jobs/{jobId}.
+// URL is a presigned link to the job's result, and BlockedURL a presigned link to the JSON Lines list
+// of files withheld because of their scan status. Both are only set once the job has completed.
+// Unavailable lists the requested node ids that the job has no files of, as in DownloadManifestResponse.
+type DownloadJobResponse struct {
+	JobId       string                             `json:"jobId"`
+	Kind        DownloadJobKind                    `json:"kind"`
+	Status      DownloadJobStatus                  `json:"status"`
+	Format      string                             `json:"format,omitempty"`
+	CreatedAt   time.Time                          `json:"createdAt"`
+	UpdatedAt   time.Time                          `json:"updatedAt"`
+	Header      *DownloadManifestHeader            `json:"header,omitempty"`
+	Unavailable []DownloadManifestUnavailableEntry `json:"unavailable,omitempty"`
+	URL         string                             `json:"url,omitempty"`
+	BlockedURL  string                             `json:"blockedUrl,omitempty"`
+	Error       string                             `json:"error,omitempty"`
+}
@@ -0,0 +1,22 @@
+package models
+
+type ScanPolicyMode string
+
+const (
+	// ScanPolicyPermissive withholds files whose malware scan found malware or failed, and lets every other
+	// file through, including those not scanned yet.
+	ScanPolicyPermissive ScanPolicyMode = "permissive"
+	// ScanPolicyStrict withholds every file whose malware scan has not come back clean.
+	ScanPolicyStrict ScanPolicyMode = "strict"
+)
+
+// ScanPolicyScopeOrg is the Scope of the scan policy of a whole organization.
+const ScanPolicyScopeOrg = "org"
+
+// ScanPolicy is the stored scan-status download policy of an organization, or of one of its datasets, which
+// overrides that of the organization. Scope is ScanPolicyScopeOrg or the node id of the dataset.
+type ScanPolicy struct {
+	OrgId int            `dynamodbav:"OrgId"`
+	Scope string         `dynamodbav:"Scope"`
+	Mode  ScanPolicyMode `dynamodbav:"Mode"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// ManifestSnapshot is what a manifest held when it was issued, for telling which files changed since then.
+// Its Id is the token that a later manifest request passes as changed_since.
+type ManifestSnapshot struct {
+	Id            string                 `json:"id"`
+	OrgId         int                    `json:"orgId"`
+	DatasetNodeId string                 `json:"datasetNodeId"`
+	CreatedAt     time.Time              `json:"createdAt"`
+	Files         []ManifestSnapshotFile `json:"files"`
+}
+
+// ManifestSnapshotFile is a file of a ManifestSnapshot. Fingerprint changes when the content of the file
+// may have: when it is replaced by another object or version, or its size or checksum change.
+type ManifestSnapshotFile struct {
+	FileId      int64  `json:"fileId"`
+	NodeId      string `json:"nodeId"`
+	TargetPath  string `json:"targetPath"`
+	Fingerprint string `json:"fingerprint"`
+}
@@ -1,15 +1,111 @@
 package regions
 
-import "strings"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
 
-func ForBucket(bucketName string) string {
-	if strings.HasSuffix(bucketName, "-use1") {
-		return "us-east-1"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// BucketRegionMapEnvKey is the environment variable holding a JSON object that maps bucket names to AWS regions.
+// Buckets listed here are never looked up with GetBucketLocation.
+const BucketRegionMapEnvKey = "BUCKET_REGION_MAP"
+
+// defaultRegion is the region S3 reports as an empty LocationConstraint.
+const defaultRegion = "us-east-1"
+
+// BucketLocationAPIClient is the subset of the S3 client needed to look up a bucket's region.
+type BucketLocationAPIClient interface {
+	GetBucketLocation(ctx context.Context, params *s3.GetBucketLocationInput, optFns ...func(*s3.Options)) (*s3.GetBucketLocationOutput, error)
+}
+
+// Resolver maps bucket names to AWS regions. Regions come from an explicit configured map first,
+// then from S3 GetBucketLocation. Lookup results are cached, so a Resolver created at cold start
+// only looks up each bucket once for the life of the Lambda container. A Resolver is safe for concurrent use.
+type Resolver struct {
+	client BucketLocationAPIClient
+
+	mu      sync.RWMutex
+	regions map[string]string
+}
+
+// NewResolver returns a Resolver that uses configured before falling back to client. client may be nil,
+// in which case ForBucket returns an error for any bucket not in configured.
+func NewResolver(client BucketLocationAPIClient, configured map[string]string) *Resolver {
+	regions := make(map[string]string, len(configured))
+	for bucket, region := range configured {
+		regions[bucket] = region
+	}
+	return &Resolver{client: client, regions: regions}
+}
+
+// NewResolverFromEnv returns a Resolver configured from the BucketRegionMapEnvKey environment variable.
+// If the variable is unset or empty, every bucket is looked up with client.
+func NewResolverFromEnv(client BucketLocationAPIClient) (*Resolver, error) {
+	configured, err := ParseBucketRegionMap(os.Getenv(BucketRegionMapEnvKey))
+	if err != nil {
+		return nil, err
 	}
-	if strings.HasSuffix(bucketName, "-afs1") {
-		return "af-south-1"
+	return NewResolver(client, configured), nil
+}
+
+// ParseBucketRegionMap parses a JSON object of bucket name to region. An empty string is an empty map.
+func ParseBucketRegionMap(raw string) (map[string]string, error) {
+	configured := map[string]string{}
+	if raw == "" {
+		return configured, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &configured); err != nil {
+		return nil, fmt.Errorf("parsing %s value [%s]: %w", BucketRegionMapEnvKey, raw, err)
 	}
+	for bucket, region := range configured {
+		if bucket == "" || region == "" {
+			return nil, fmt.Errorf("invalid %s entry: bucket %q, region %q", BucketRegionMapEnvKey, bucket, region)
+		}
+	}
+	return configured, nil
+}
 
-	return "us-east-1"
+// ForBucket returns the region of bucketName, or an error if it is not configured and cannot be looked up.
+// Failed lookups are not cached, so the bucket is looked up again on a later call.
+func (r *Resolver) ForBucket(ctx context.Context, bucketName string) (string, error) {
+	r.mu.RLock()
+	region, found := r.regions[bucketName]
+	r.mu.RUnlock()
+	if found {
+		return region, nil
+	}
+	if r.client == nil {
+		return "", fmt.Errorf("no region configured for bucket %s", bucketName)
+	}
+	output, err := r.client.GetBucketLocation(ctx, &s3.GetBucketLocationInput{Bucket: aws.String(bucketName)}, func(options *s3.Options) {
+		// GetBucketLocation is answered from us-east-1 for buckets in any region.
+		options.Region = defaultRegion
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to look up region of bucket %s: %w", bucketName, err)
+	}
+	region = fromLocationConstraint(string(output.LocationConstraint))
 
+	r.mu.Lock()
+	r.regions[bucketName] = region
+	r.mu.Unlock()
+	return region, nil
+}
+
+// fromLocationConstraint converts a GetBucketLocation LocationConstraint into a region name.
+// S3 returns an empty constraint for us-east-1 and the legacy value "EU" for some eu-west-1 buckets.
+func fromLocationConstraint(constraint string) string {
+	switch constraint {
+	case "":
+		return defaultRegion
+	case "EU":
+		return "eu-west-1"
+	default:
+		return constraint
+	}
 }
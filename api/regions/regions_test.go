@@ -1,21 +1,96 @@
 package regions
 
 import (
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
 	"testing"
 )
 
-func TestForBucket(t *testing.T) {
+type stubBucketLocationClient struct {
+	mu          sync.Mutex
+	constraints map[string]string
+	calls       map[string]int
+}
+
+func newStubBucketLocationClient(constraints map[string]string) *stubBucketLocationClient {
+	return &stubBucketLocationClient{constraints: constraints, calls: map[string]int{}}
+}
+
+func (c *stubBucketLocationClient) GetBucketLocation(_ context.Context, params *s3.GetBucketLocationInput, _ ...func(*s3.Options)) (*s3.GetBucketLocationOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	bucket := aws.ToString(params.Bucket)
+	c.calls[bucket]++
+	constraint, ok := c.constraints[bucket]
+	if !ok {
+		return nil, errors.New("NoSuchBucket")
+	}
+	return &s3.GetBucketLocationOutput{LocationConstraint: types.BucketLocationConstraint(constraint)}, nil
+}
+
+func TestResolver_ForBucket(t *testing.T) {
+	client := newStubBucketLocationClient(map[string]string{
+		"looked-up-use1":  "",
+		"looked-up-euw1":  "EU",
+		"looked-up-apse2": "ap-southeast-2",
+		"configured-afs1": "us-west-2",
+	})
+	resolver := NewResolver(client, map[string]string{"configured-afs1": "af-south-1"})
+
 	for name, tt := range map[string]struct {
 		bucket   string
 		expected string
 	}{
-		"us-east-1 suffix":     {bucket: "pennsieve-dev-storage-use1", expected: "us-east-1"},
-		"af-south-1 suffix":    {bucket: "pennsieve-dev-storage-afs1", expected: "af-south-1"},
-		"no recognized suffix": {bucket: "pennsieve-dev-storage", expected: "us-east-1"},
+		"configured":            {bucket: "configured-afs1", expected: "af-south-1"},
+		"empty constraint":      {bucket: "looked-up-use1", expected: "us-east-1"},
+		"legacy EU constraint":  {bucket: "looked-up-euw1", expected: "eu-west-1"},
+		"regional constraint":   {bucket: "looked-up-apse2", expected: "ap-southeast-2"},
+		"repeat is from cache":  {bucket: "looked-up-apse2", expected: "ap-southeast-2"},
+		"configured not called": {bucket: "configured-afs1", expected: "af-south-1"},
 	} {
 		t.Run(name, func(t *testing.T) {
-			assert.Equal(t, tt.expected, ForBucket(tt.bucket))
+			region, err := resolver.ForBucket(context.Background(), tt.bucket)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, region)
 		})
 	}
+	assert.Equal(t, 1, client.calls["looked-up-apse2"])
+	assert.Zero(t, client.calls["configured-afs1"])
+}
+
+func TestResolver_ForBucketError(t *testing.T) {
+	client := newStubBucketLocationClient(nil)
+	resolver := NewResolver(client, nil)
+	_, err := resolver.ForBucket(context.Background(), "unknown-bucket")
+	assert.ErrorContains(t, err, "unknown-bucket")
+	_, err = resolver.ForBucket(context.Background(), "unknown-bucket")
+	assert.ErrorContains(t, err, "unknown-bucket")
+	assert.Equal(t, 2, client.calls["unknown-bucket"], "a failed lookup is not cached")
+
+	noClientResolver := NewResolver(nil, nil)
+	_, err = noClientResolver.ForBucket(context.Background(), "unknown-bucket")
+	assert.ErrorContains(t, err, "no region configured")
+}
+
+func TestNewResolverFromEnv(t *testing.T) {
+	t.Setenv(BucketRegionMapEnvKey, `{"pennsieve-dev-storage-euw1": "eu-west-1"}`)
+	resolver, err := NewResolverFromEnv(nil)
+	require.NoError(t, err)
+	region, err := resolver.ForBucket(context.Background(), "pennsieve-dev-storage-euw1")
+	require.NoError(t, err)
+	assert.Equal(t, "eu-west-1", region)
+
+	t.Setenv(BucketRegionMapEnvKey, `{"pennsieve-dev-storage-euw1": ""}`)
+	_, err = NewResolverFromEnv(nil)
+	assert.Error(t, err)
+
+	t.Setenv(BucketRegionMapEnvKey, `not json`)
+	_, err = NewResolverFromEnv(nil)
+	assert.Error(t, err)
 }
@@ -8,8 +8,10 @@ import (
 	"github.com/pennsieve/packages-service/api/logging"
 	"github.com/pennsieve/packages-service/api/models"
 	"github.com/pennsieve/packages-service/api/store"
+	"github.com/pennsieve/packages-service/api/tracing"
 	"github.com/pennsieve/pennsieve-go-core/pkg/models/packageInfo/packageState"
 	"github.com/pennsieve/pennsieve-go-core/pkg/models/pgdb"
+	"go.opentelemetry.io/otel/attribute"
 	"os"
 )
 
@@ -41,6 +43,10 @@ func NewPackagesService(db *sql.DB, sqsClient *sqs.Client, orgId int, logger log
 }
 
 func (s *packagesService) RestorePackages(ctx context.Context, datasetId string, request models.RestoreRequest) (*models.RestoreResponse, error) {
+	ctx, span := tracing.Start(ctx, "PackagesService.RestorePackages",
+		attribute.Int("pennsieve.org_id", s.OrgId),
+		attribute.String("pennsieve.dataset_id", datasetId),
+		attribute.Int("pennsieve.requested_count", len(request.NodeIds)))
 	response := models.RestoreResponse{Success: []string{}, Failures: []models.Failure{}}
 	err := s.SQLStoreFactory.ExecStoreTx(ctx, s.OrgId, func(store store.SQLStore) error {
 		dataset, err := store.GetDatasetByNodeId(ctx, datasetId)
@@ -76,5 +82,7 @@ func (s *packagesService) RestorePackages(ctx context.Context, datasetId string,
 		}
 		return nil
 	})
+	span.SetAttributes(attribute.Int("pennsieve.restoring_count", len(response.Success)))
+	tracing.End(span, err)
 	return &response, err
 }
@@ -0,0 +1,267 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"github.com/pennsieve/packages-service/api/logging"
+	"github.com/pennsieve/packages-service/api/models"
+)
+
+const (
+	DownloadAuditTableNameEnvKey = "DOWNLOAD_AUDIT_DYNAMODB_TABLE_NAME"
+	DownloadUsageTableNameEnvKey = "DOWNLOAD_USAGE_DYNAMODB_TABLE_NAME"
+)
+
+// maxAuditRecordFiles is the most file ids kept in one audit record, which keeps records well
+// within the DynamoDB item size limit.
+const maxAuditRecordFiles = 5000
+
+// auditRecordTimeLayout is the time layout that audit record ids start with. Unlike time.RFC3339Nano it is
+// fixed width, so that record ids sort in time order.
+const auditRecordTimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+// UsageMonthLayout is the time layout of the months of models.DownloadUsage.
+const UsageMonthLayout = "2006-01"
+
+// usageDayLayout is the time layout of the days of the daily usage of users.
+const usageDayLayout = "2006-01-02"
+
+// userUsageKeyPrefix starts the keys that the daily usage of users is stored under in the usage table,
+// alongside the usage of datasets. Dataset keys are node ids or published dataset keys, so they never start with it.
+const userUsageKeyPrefix = "user/"
+
+// DownloadAuditStore records download issuances in the audit table, and totals them by dataset, user and month in the usage table.
+type DownloadAuditStore struct {
+	Client         *dynamodb.Client
+	auditTableName string
+	usageTableName string
+}
+
+func NewDownloadAuditStore(client *dynamodb.Client, auditTableName, usageTableName string) *DownloadAuditStore {
+	return &DownloadAuditStore{Client: client, auditTableName: auditTableName, usageTableName: usageTableName}
+}
+
+// NewDownloadAuditStoreFromEnv returns a store for the tables named by DownloadAuditTableNameEnvKey and
+// DownloadUsageTableNameEnvKey, or nil if either is not set.
+func NewDownloadAuditStoreFromEnv(client *dynamodb.Client) *DownloadAuditStore {
+	auditTableName, usageTableName := os.Getenv(DownloadAuditTableNameEnvKey), os.Getenv(DownloadUsageTableNameEnvKey)
+	if auditTableName == "" || usageTableName == "" {
+		return nil
+	}
+	return NewDownloadAuditStore(client, auditTableName, usageTableName)
+}
+
+func (d *DownloadAuditStore) WithLogging(log logging.Logger) DownloadAudit {
+	return &downloadAuditStore{
+		DownloadAuditStore: d,
+		Logger:             log,
+	}
+}
+
+type downloadAuditStore struct {
+	*DownloadAuditStore
+	logging.Logger
+}
+
+type DownloadAudit interface {
+	// RecordIssuance records the files of issuance in the audit table and adds them to the usage of the
+	// dataset by the user in the month they were issued.
+	RecordIssuance(ctx context.Context, issuance models.DownloadIssuance) error
+	// GetUsage returns the usage of the dataset with datasetKey in the months from through to, inclusive,
+	// ordered by month and then user node id.
+	GetUsage(ctx context.Context, datasetKey string, from, to time.Time) ([]models.DownloadUsage, error)
+	// GetUserDailyBytes returns the bytes issued to the user, across datasets, on the UTC day of day.
+	GetUserDailyBytes(ctx context.Context, userNodeId string, day time.Time) (int64, error)
+	// GetDatasetMonthlyBytes returns the bytes issued from the dataset with datasetKey, across users, in the
+	// UTC month of month.
+	GetDatasetMonthlyBytes(ctx context.Context, datasetKey string, month time.Time) (int64, error)
+	logging.Logger
+}
+
+// DownloadAuditDatasetKey returns the key that the records and usage of the dataset of issuance are stored under.
+func DownloadAuditDatasetKey(issuance models.DownloadIssuance) string {
+	if issuance.DatasetNodeId != "" {
+		return issuance.DatasetNodeId
+	}
+	return PublishedDatasetAuditKey(issuance.PublishedDatasetId)
+}
+
+// PublishedDatasetAuditKey returns the key that the records and usage of a published dataset are stored under.
+func PublishedDatasetAuditKey(publishedDatasetId int64) string {
+	return "published/" + strconv.FormatInt(publishedDatasetId, 10)
+}
+
+func (d *downloadAuditStore) RecordIssuance(ctx context.Context, issuance models.DownloadIssuance) error {
+	datasetKey := DownloadAuditDatasetKey(issuance)
+	issuedAt := issuance.IssuedAt.UTC()
+	var files, bytes, requesterPaysBytes int64
+	for _, bucket := range issuance.Buckets {
+		for i := 0; i < len(bucket.FileIds); i += maxAuditRecordFiles {
+			fileIds := bucket.FileIds[i:min(i+maxAuditRecordFiles, len(bucket.FileIds))]
+			record := models.DownloadAuditRecord{
+				DatasetKey:         datasetKey,
+				RecordId:           issuedAt.Format(auditRecordTimeLayout) + "#" + uuid.NewString(),
+				OrgId:              issuance.OrgId,
+				DatasetNodeId:      issuance.DatasetNodeId,
+				PublishedDatasetId: issuance.PublishedDatasetId,
+				PublishedVersion:   issuance.PublishedVersion,
+				UserNodeId:         issuance.UserNodeId,
+				Source:             issuance.Source,
+				RequestId:          issuance.RequestId,
+				Bucket:             bucket.Bucket,
+				RequesterPays:      bucket.RequesterPays,
+				FileIds:            fileIds,
+				IssuedAt:           issuedAt,
+			}
+			// Bytes are only known per bucket, so they are recorded with the first record of the bucket.
+			if i == 0 {
+				record.Bytes = bucket.Bytes
+			}
+			item, err := attributevalue.MarshalMap(record)
+			if err != nil {
+				return fmt.Errorf("error marshalling download audit record of request %s: %w", issuance.RequestId, err)
+			}
+			if _, err := d.Client.PutItem(ctx, &dynamodb.PutItemInput{
+				TableName: aws.String(d.auditTableName),
+				Item:      item,
+			}); err != nil {
+				return fmt.Errorf("error recording download audit record of request %s in %s: %w", issuance.RequestId, d.auditTableName, err)
+			}
+		}
+		files += int64(len(bucket.FileIds))
+		bytes += bucket.Bytes
+		if bucket.RequesterPays {
+			requesterPaysBytes += bucket.Bytes
+		}
+	}
+	if files == 0 {
+		return nil
+	}
+
+	month := issuedAt.Format(UsageMonthLayout)
+	values := map[string]types.AttributeValue{
+		":month": &types.AttributeValueMemberS{Value: month},
+		":org":   &types.AttributeValueMemberN{Value: strconv.Itoa(issuance.OrgId)},
+		":now":   &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339Nano)},
+		":files": &types.AttributeValueMemberN{Value: strconv.FormatInt(files, 10)},
+		":bytes": &types.AttributeValueMemberN{Value: strconv.FormatInt(bytes, 10)},
+		":rp":    &types.AttributeValueMemberN{Value: strconv.FormatInt(requesterPaysBytes, 10)},
+	}
+	update := "SET #month = :month, OrgId = :org, UpdatedAt = :now"
+	if issuance.UserNodeId != "" {
+		values[":user"] = &types.AttributeValueMemberS{Value: issuance.UserNodeId}
+		update += ", UserNodeId = :user"
+	}
+	update += " ADD #files :files, #bytes :bytes, RequesterPaysBytes :rp"
+	if _, err := d.Client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(d.usageTableName),
+		Key:                       downloadUsageKey(datasetKey, month, issuance.UserNodeId),
+		UpdateExpression:          aws.String(update),
+		ExpressionAttributeNames:  map[string]string{"#month": "Month", "#files": "Files", "#bytes": "Bytes"},
+		ExpressionAttributeValues: values,
+	}); err != nil {
+		return fmt.Errorf("error adding request %s to download usage in %s: %w", issuance.RequestId, d.usageTableName, err)
+	}
+
+	// The daily usage of users is kept for download quotas.
+	if issuance.UserNodeId == "" {
+		return nil
+	}
+	if _, err := d.Client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                aws.String(d.usageTableName),
+		Key:                      userDailyUsageKey(issuance.UserNodeId, issuedAt),
+		UpdateExpression:         aws.String("SET UserNodeId = :user, UpdatedAt = :now ADD #files :files, #bytes :bytes, RequesterPaysBytes :rp"),
+		ExpressionAttributeNames: map[string]string{"#files": "Files", "#bytes": "Bytes"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":user":  values[":user"],
+			":now":   values[":now"],
+			":files": values[":files"],
+			":bytes": values[":bytes"],
+			":rp":    values[":rp"],
+		},
+	}); err != nil {
+		return fmt.Errorf("error adding request %s to daily usage of %s in %s: %w", issuance.RequestId, issuance.UserNodeId, d.usageTableName, err)
+	}
+	return nil
+}
+
+func (d *downloadAuditStore) GetUserDailyBytes(ctx context.Context, userNodeId string, day time.Time) (int64, error) {
+	output, err := d.Client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:                aws.String(d.usageTableName),
+		Key:                      userDailyUsageKey(userNodeId, day),
+		ProjectionExpression:     aws.String("#bytes"),
+		ExpressionAttributeNames: map[string]string{"#bytes": "Bytes"},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error getting daily usage of %s from %s: %w", userNodeId, d.usageTableName, err)
+	}
+	var usage models.DownloadUsage
+	if err := attributevalue.UnmarshalMap(output.Item, &usage); err != nil {
+		return 0, fmt.Errorf("error unmarshalling daily usage of %s: %w", userNodeId, err)
+	}
+	return usage.Bytes, nil
+}
+
+func (d *downloadAuditStore) GetDatasetMonthlyBytes(ctx context.Context, datasetKey string, month time.Time) (int64, error) {
+	usage, err := d.GetUsage(ctx, datasetKey, month.UTC(), month.UTC())
+	if err != nil {
+		return 0, err
+	}
+	var bytes int64
+	for _, u := range usage {
+		bytes += u.Bytes
+	}
+	return bytes, nil
+}
+
+func (d *downloadAuditStore) GetUsage(ctx context.Context, datasetKey string, from, to time.Time) ([]models.DownloadUsage, error) {
+	// Usage keys start with the month, so "~", which sorts after the "#" that follows it, ends the range at the end of to.
+	paginator := dynamodb.NewQueryPaginator(d.Client, &dynamodb.QueryInput{
+		TableName:              aws.String(d.usageTableName),
+		KeyConditionExpression: aws.String("DatasetKey = :dataset AND UsageKey BETWEEN :from AND :to"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":dataset": &types.AttributeValueMemberS{Value: datasetKey},
+			":from":    &types.AttributeValueMemberS{Value: from.Format(UsageMonthLayout)},
+			":to":      &types.AttributeValueMemberS{Value: to.Format(UsageMonthLayout) + "~"},
+		},
+	})
+	usage := []models.DownloadUsage{}
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error querying download usage of %s in %s: %w", datasetKey, d.usageTableName, err)
+		}
+		var pageUsage []models.DownloadUsage
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageUsage); err != nil {
+			return nil, fmt.Errorf("error unmarshalling download usage of %s: %w", datasetKey, err)
+		}
+		usage = append(usage, pageUsage...)
+	}
+	return usage, nil
+}
+
+// downloadUsageKey returns the key of the usage of a dataset by a user in a month. The sort key starts with
+// the month, so that the usage of a range of months can be queried.
+func downloadUsageKey(datasetKey, month, userNodeId string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"DatasetKey": &types.AttributeValueMemberS{Value: datasetKey},
+		"UsageKey":   &types.AttributeValueMemberS{Value: month + "#" + userNodeId},
+	}
+}
+
+// userDailyUsageKey returns the key of the usage of a user, across datasets, on the UTC day of day.
+func userDailyUsageKey(userNodeId string, day time.Time) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"DatasetKey": &types.AttributeValueMemberS{Value: userUsageKeyPrefix + userNodeId},
+		"UsageKey":   &types.AttributeValueMemberS{Value: day.UTC().Format(usageDayLayout)},
+	}
+}
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/pennsieve/packages-service/api/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadAuditStore(t *testing.T) {
+	ctx := context.Background()
+	dyClient := dynamodb.NewFromConfig(GetTestAWSConfig(t), func(options *dynamodb.Options) {
+		options.BaseEndpoint = aws.String(GetTestDynamoDBURL())
+	})
+	auditTableName := "download-audit-" + RandString(8)
+	usageTableName := "download-usage-" + RandString(8)
+	auditTableInput := TestCreateDownloadAuditTableInput(auditTableName)
+	usageTableInput := TestCreateDownloadUsageTableInput(usageTableName)
+	dyFixture := NewDynamoDBFixture(t, dyClient, &auditTableInput, &usageTableInput)
+	t.Cleanup(dyFixture.Teardown)
+
+	audit := NewDownloadAuditStore(dyClient, auditTableName, usageTableName).WithLogging(NoLogger{})
+
+	manyFileIds := make([]int64, maxAuditRecordFiles+1)
+	for i := range manyFileIds {
+		manyFileIds[i] = int64(i + 1)
+	}
+	october := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+	issuances := []models.DownloadIssuance{
+		{
+			OrgId: 2, DatasetNodeId: "N:dataset:audit", UserNodeId: "N:user:101", Source: models.DownloadAuditManifest,
+			RequestId: "req-1", IssuedAt: october,
+			Buckets: []models.DownloadIssuanceBucket{
+				{Bucket: "storage", FileIds: []int64{1, 2}, Bytes: 300},
+				{Bucket: "external", RequesterPays: true, FileIds: []int64{3}, Bytes: 700},
+			},
+		},
+		{
+			OrgId: 2, DatasetNodeId: "N:dataset:audit", UserNodeId: "N:user:101", Source: models.DownloadAuditManifestJob,
+			RequestId: "job-1", IssuedAt: october.Add(time.Hour),
+			Buckets: []models.DownloadIssuanceBucket{{Bucket: "storage", FileIds: manyFileIds, Bytes: 5000}},
+		},
+		{
+			OrgId: 2, DatasetNodeId: "N:dataset:audit", UserNodeId: "N:user:202", Source: models.DownloadAuditManifest,
+			RequestId: "req-2", IssuedAt: october.AddDate(0, -1, 0),
+			Buckets: []models.DownloadIssuanceBucket{{Bucket: "storage", FileIds: []int64{1}, Bytes: 100}},
+		},
+		{
+			PublishedDatasetId: 7, PublishedVersion: 1, Source: models.DownloadAuditPublishedManifest,
+			RequestId: "req-3", IssuedAt: october,
+			Buckets: []models.DownloadIssuanceBucket{{Bucket: "publish", FileIds: []int64{9}, Bytes: 900}},
+		},
+	}
+	for _, issuance := range issuances {
+		require.NoError(t, audit.RecordIssuance(ctx, issuance))
+	}
+
+	records, err := dyClient.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(auditTableName),
+		KeyConditionExpression: aws.String("DatasetKey = :dataset"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":dataset": &types.AttributeValueMemberS{Value: "N:dataset:audit"},
+		},
+	})
+	require.NoError(t, err)
+	var auditRecords []models.DownloadAuditRecord
+	require.NoError(t, attributevalue.UnmarshalListOfMaps(records.Items, &auditRecords))
+	// One record per bucket of the first and last issuances, and two for the large one.
+	require.Len(t, auditRecords, 5)
+	assert.Equal(t, "req-2", auditRecords[0].RequestId, "records are ordered by issue time")
+	var recordedFiles int
+	var recordedBytes int64
+	for _, record := range auditRecords {
+		recordedFiles += len(record.FileIds)
+		recordedBytes += record.Bytes
+		if record.Bucket == "external" {
+			assert.True(t, record.RequesterPays)
+		}
+	}
+	assert.Equal(t, 3+len(manyFileIds)+1, recordedFiles)
+	assert.Equal(t, int64(300+700+5000+100), recordedBytes)
+
+	usage, err := audit.GetUsage(ctx, "N:dataset:audit", october.AddDate(0, -1, 0), october)
+	require.NoError(t, err)
+	assert.Equal(t, []models.DownloadUsage{
+		{Month: "2026-09", UserNodeId: "N:user:202", Files: 1, Bytes: 100},
+		{Month: "2026-10", UserNodeId: "N:user:101", Files: int64(3 + len(manyFileIds)), Bytes: 6000, RequesterPaysBytes: 700},
+	}, usage)
+
+	usage, err = audit.GetUsage(ctx, "N:dataset:audit", october, october)
+	require.NoError(t, err)
+	require.Len(t, usage, 1)
+	assert.Equal(t, "2026-10", usage[0].Month)
+
+	usage, err = audit.GetUsage(ctx, PublishedDatasetAuditKey(7), october, october)
+	require.NoError(t, err)
+	assert.Equal(t, []models.DownloadUsage{{Month: "2026-10", Files: 1, Bytes: 900}}, usage)
+
+	userBytes, err := audit.GetUserDailyBytes(ctx, "N:user:101", october)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6000), userBytes)
+	userBytes, err = audit.GetUserDailyBytes(ctx, "N:user:101", october.AddDate(0, 0, 1))
+	require.NoError(t, err)
+	assert.Zero(t, userBytes)
+
+	datasetBytes, err := audit.GetDatasetMonthlyBytes(ctx, "N:dataset:audit", october)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6000), datasetBytes)
+	datasetBytes, err = audit.GetDatasetMonthlyBytes(ctx, "N:dataset:audit", october.AddDate(0, -1, 0))
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), datasetBytes)
+}
@@ -0,0 +1,221 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/pennsieve/packages-service/api/logging"
+	"github.com/pennsieve/packages-service/api/models"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DownloadJobsTableNameEnvKey = "DOWNLOAD_JOBS_DYNAMODB_TABLE_NAME"
+	DownloadJobsQueueURLEnvKey  = "DOWNLOAD_JOBS_QUEUE_URL"
+	DownloadJobsBucketEnvKey    = "DOWNLOAD_JOBS_BUCKET"
+)
+
+// DownloadJobRetention is how long job records are kept. The download jobs bucket
+// expires result objects on the same schedule.
+const DownloadJobRetention = 7 * 24 * time.Hour
+
+// ErrDownloadJobStateConflict is returned when a job is not in the state an update expects,
+// for example when a redelivered SQS message asks for a job that has already completed.
+var ErrDownloadJobStateConflict = errors.New("download job is not in the expected state")
+
+type DownloadJobStore struct {
+	Client    *dynamodb.Client
+	SQSClient *sqs.Client
+	tableName string
+	queueURL  string
+}
+
+// NewDownloadJobStore returns a store for the job records in tableName. queueURL is only needed
+// to submit jobs, so the download jobs lambda, which only updates records, may pass a nil sqsClient and empty queueURL.
+func NewDownloadJobStore(client *dynamodb.Client, sqsClient *sqs.Client, tableName, queueURL string) *DownloadJobStore {
+	return &DownloadJobStore{Client: client, SQSClient: sqsClient, tableName: tableName, queueURL: queueURL}
+}
+
+func (d *DownloadJobStore) WithLogging(log logging.Logger) DownloadJobs {
+	return &downloadJobStore{
+		DownloadJobStore: d,
+		Logger:           log,
+	}
+}
+
+type downloadJobStore struct {
+	*DownloadJobStore
+	logging.Logger
+}
+
+type DownloadJobs interface {
+	// SubmitJob records job as queued and sends it to the download jobs queue.
+	SubmitJob(ctx context.Context, job models.DownloadJob) error
+	// GetJob returns the job with the given id, or nil if there is no such job.
+	GetJob(ctx context.Context, jobId string) (*models.DownloadJob, error)
+	// StartJob moves a queued job to running and returns it.
+	StartJob(ctx context.Context, jobId string) (*models.DownloadJob, error)
+	// CompleteJob records the result of a running job.
+	CompleteJob(ctx context.Context, jobId string, header models.DownloadManifestHeader, resultKey, blockedKey string) error
+	// FailJob records the error that stopped a queued or running job.
+	FailJob(ctx context.Context, jobId string, cause error) error
+	logging.Logger
+}
+
+func (d *downloadJobStore) SubmitJob(ctx context.Context, job models.DownloadJob) error {
+	now := time.Now().UTC()
+	job.Status = models.DownloadJobQueued
+	job.CreatedAt = now
+	job.UpdatedAt = now
+	job.ExpiresAt = now.Add(DownloadJobRetention).Unix()
+	item, err := attributevalue.MarshalMap(job)
+	if err != nil {
+		return fmt.Errorf("error marshalling download job %s: %w", job.JobId, err)
+	}
+	if _, err := d.Client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(d.tableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(JobId)"),
+	}); err != nil {
+		return fmt.Errorf("error recording download job %s in %s: %w", job.JobId, d.tableName, err)
+	}
+
+	body, err := json.Marshal(models.DownloadJobMessage{JobId: job.JobId})
+	if err != nil {
+		return fmt.Errorf("error marshalling download job message %s: %w", job.JobId, err)
+	}
+	if _, err := d.SQSClient.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:          aws.String(d.queueURL),
+		MessageBody:       aws.String(string(body)),
+		MessageAttributes: traceMessageAttributes(ctx),
+	}); err != nil {
+		if failErr := d.FailJob(ctx, job.JobId, fmt.Errorf("unable to queue job: %w", err)); failErr != nil {
+			d.LogWarnWithFields(log.Fields{"jobId": job.JobId, "error": failErr}, "unable to mark unqueued download job as failed")
+		}
+		return fmt.Errorf("error adding download job %s to the download jobs queue: %w", job.JobId, err)
+	}
+	return nil
+}
+
+func (d *downloadJobStore) GetJob(ctx context.Context, jobId string) (*models.DownloadJob, error) {
+	output, err := d.Client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(d.tableName),
+		Key:            downloadJobKey(jobId),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading download job %s from %s: %w", jobId, d.tableName, err)
+	}
+	if output.Item == nil {
+		return nil, nil
+	}
+	var job models.DownloadJob
+	if err := attributevalue.UnmarshalMap(output.Item, &job); err != nil {
+		return nil, fmt.Errorf("error unmarshalling download job %s: %w", jobId, err)
+	}
+	return &job, nil
+}
+
+func (d *downloadJobStore) StartJob(ctx context.Context, jobId string) (*models.DownloadJob, error) {
+	output, err := d.updateJob(ctx, jobId, "SET #status = :running, UpdatedAt = :now", []models.DownloadJobStatus{models.DownloadJobQueued},
+		map[string]types.AttributeValue{":running": &types.AttributeValueMemberS{Value: string(models.DownloadJobRunning)}},
+		types.ReturnValueAllNew)
+	if err != nil {
+		return nil, err
+	}
+	var job models.DownloadJob
+	if err := attributevalue.UnmarshalMap(output.Attributes, &job); err != nil {
+		return nil, fmt.Errorf("error unmarshalling download job %s: %w", jobId, err)
+	}
+	return &job, nil
+}
+
+func (d *downloadJobStore) CompleteJob(ctx context.Context, jobId string, header models.DownloadManifestHeader, resultKey, blockedKey string) error {
+	headerValue, err := attributevalue.Marshal(header)
+	if err != nil {
+		return fmt.Errorf("error marshalling header of download job %s: %w", jobId, err)
+	}
+	values := map[string]types.AttributeValue{
+		":completed": &types.AttributeValueMemberS{Value: string(models.DownloadJobCompleted)},
+		":header":    headerValue,
+		":result":    &types.AttributeValueMemberS{Value: resultKey},
+	}
+	update := "SET #status = :completed, UpdatedAt = :now, #header = :header, ResultKey = :result"
+	if blockedKey != "" {
+		values[":blocked"] = &types.AttributeValueMemberS{Value: blockedKey}
+		update += ", BlockedKey = :blocked"
+	}
+	_, err = d.updateJob(ctx, jobId, update, []models.DownloadJobStatus{models.DownloadJobRunning}, values, types.ReturnValueNone)
+	return err
+}
+
+func (d *downloadJobStore) FailJob(ctx context.Context, jobId string, cause error) error {
+	_, err := d.updateJob(ctx, jobId, "SET #status = :failed, UpdatedAt = :now, #error = :error",
+		[]models.DownloadJobStatus{models.DownloadJobQueued, models.DownloadJobRunning},
+		map[string]types.AttributeValue{
+			":failed": &types.AttributeValueMemberS{Value: string(models.DownloadJobFailed)},
+			":error":  &types.AttributeValueMemberS{Value: cause.Error()},
+		}, types.ReturnValueNone)
+	return err
+}
+
+// downloadJobAttributeNames aliases attribute names that are, or may become, DynamoDB reserved words.
+var downloadJobAttributeNames = map[string]string{
+	"#status": "Status",
+	"#error":  "Error",
+	"#header": "Header",
+}
+
+// updateJob applies update to the job if it is in one of the from states. The update may refer
+// to the placeholders in downloadJobAttributeNames and to :now, which are supplied here.
+func (d *downloadJobStore) updateJob(ctx context.Context, jobId string, update string, from []models.DownloadJobStatus, values map[string]types.AttributeValue, returnValues types.ReturnValue) (*dynamodb.UpdateItemOutput, error) {
+	condition := "attribute_exists(JobId) AND #status IN ("
+	for i, status := range from {
+		placeholder := fmt.Sprintf(":from%d", i)
+		if i > 0 {
+			condition += ", "
+		}
+		condition += placeholder
+		values[placeholder] = &types.AttributeValueMemberS{Value: string(status)}
+	}
+	condition += ")"
+	values[":now"] = &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339Nano)}
+
+	// DynamoDB rejects unused attribute names, so only alias the ones the expressions refer to.
+	names := map[string]string{}
+	for placeholder, name := range downloadJobAttributeNames {
+		if strings.Contains(update+condition, placeholder) {
+			names[placeholder] = name
+		}
+	}
+	output, err := d.Client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(d.tableName),
+		Key:                       downloadJobKey(jobId),
+		UpdateExpression:          aws.String(update),
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+		ReturnValues:              returnValues,
+	})
+	if err != nil {
+		var conditionFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			return nil, fmt.Errorf("download job %s: %w", jobId, ErrDownloadJobStateConflict)
+		}
+		return nil, fmt.Errorf("error updating download job %s in %s: %w", jobId, d.tableName, err)
+	}
+	return output, nil
+}
+
+func downloadJobKey(jobId string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{"JobId": &types.AttributeValueMemberS{Value: jobId}}
+}
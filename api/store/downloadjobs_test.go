@@ -0,0 +1,76 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/google/uuid"
+	"github.com/pennsieve/packages-service/api/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestDownloadJobStore_Lifecycle(t *testing.T) {
+	ctx := context.Background()
+	dyClient := dynamodb.NewFromConfig(GetTestAWSConfig(t), func(options *dynamodb.Options) {
+		options.BaseEndpoint = aws.String(GetTestDynamoDBURL())
+	})
+	tableName := "download-jobs-" + RandString(8)
+	createTableInput := TestCreateDownloadJobTableInput(tableName)
+
+	queued := models.DownloadJob{
+		JobId:         uuid.NewString(),
+		Kind:          models.DownloadJobKindManifest,
+		Status:        models.DownloadJobQueued,
+		OrgId:         2,
+		DatasetNodeId: "N:dataset:dl-test",
+		UserNodeId:    "N:user:test-101",
+		NodeIds:       []string{"N:collection:dl-root"},
+	}
+	toFail := queued
+	toFail.JobId = uuid.NewString()
+	putItemInputs := make([]*dynamodb.PutItemInput, 0, 2)
+	for _, job := range []models.DownloadJob{queued, toFail} {
+		item, err := attributevalue.MarshalMap(job)
+		require.NoError(t, err)
+		putItemInputs = append(putItemInputs, &dynamodb.PutItemInput{TableName: aws.String(tableName), Item: item})
+	}
+	dyFixture := NewDynamoDBFixture(t, dyClient, &createTableInput).WithItems(putItemInputs...)
+	t.Cleanup(dyFixture.Teardown)
+
+	jobs := NewDownloadJobStore(dyClient, nil, tableName, "").WithLogging(NoLogger{})
+
+	started, err := jobs.StartJob(ctx, queued.JobId)
+	require.NoError(t, err)
+	assert.Equal(t, models.DownloadJobRunning, started.Status)
+	assert.Equal(t, queued.NodeIds, started.NodeIds)
+
+	_, err = jobs.StartJob(ctx, queued.JobId)
+	assert.True(t, errors.Is(err, ErrDownloadJobStateConflict), "a running job must not be started again: %v", err)
+
+	header := models.DownloadManifestHeader{Count: 3, Size: 7168, BlockedCount: 1}
+	require.NoError(t, jobs.CompleteJob(ctx, queued.JobId, header, "jobs/a/manifest.jsonl", "jobs/a/blocked.jsonl"))
+
+	completed, err := jobs.GetJob(ctx, queued.JobId)
+	require.NoError(t, err)
+	require.NotNil(t, completed)
+	assert.Equal(t, models.DownloadJobCompleted, completed.Status)
+	assert.Equal(t, &header, completed.Header)
+	assert.Equal(t, "jobs/a/manifest.jsonl", completed.ResultKey)
+	assert.Equal(t, "jobs/a/blocked.jsonl", completed.BlockedKey)
+
+	assert.ErrorIs(t, jobs.FailJob(ctx, queued.JobId, errors.New("too late")), ErrDownloadJobStateConflict)
+
+	require.NoError(t, jobs.FailJob(ctx, toFail.JobId, errors.New("hierarchy query failed")))
+	failed, err := jobs.GetJob(ctx, toFail.JobId)
+	require.NoError(t, err)
+	assert.Equal(t, models.DownloadJobFailed, failed.Status)
+	assert.Equal(t, "hierarchy query failed", failed.Error)
+
+	missing, err := jobs.GetJob(ctx, uuid.NewString())
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+}
@@ -9,9 +9,7 @@ import (
 	"github.com/pennsieve/packages-service/api/logging"
 	"github.com/pennsieve/packages-service/api/models"
 	log "github.com/sirupsen/logrus"
-	"math/rand"
 	"strconv"
-	"time"
 )
 
 const (
@@ -26,11 +24,12 @@ var (
 
 type DynamoDBStore struct {
 	Client                *dynamodb.Client
+	RetryPolicy           RetryPolicy
 	deleteRecordTableName string
 }
 
 func NewDynamoDBStore(client *dynamodb.Client, deleteRecordTableName string) *DynamoDBStore {
-	return &DynamoDBStore{Client: client, deleteRecordTableName: deleteRecordTableName}
+	return &DynamoDBStore{Client: client, RetryPolicy: DefaultRetryPolicy, deleteRecordTableName: deleteRecordTableName}
 }
 
 func (d *DynamoDBStore) WithLogging(log *logging.Log) NoSQLStore {
@@ -121,17 +120,23 @@ func (d *dynamodbStore) getBatchItemsSingleTable(ctx context.Context, tableName
 	if err != nil {
 		return nil, err
 	}
-	retryCount := 1
-	for len(unprocessed.Keys) > 0 {
-		waitDuration := time.Duration(retryCount)*time.Second + (time.Duration(rand.Intn(1000)) * time.Millisecond)
-		time.Sleep(waitDuration)
-		log.Infof("retrying %d unprocessed items out of an original %d after a wait of %s", len(unprocessed.Keys), len(keys), waitDuration)
+	for retry := 1; len(unprocessed.Keys) > 0; retry++ {
+		if err := d.RetryPolicy.Wait(ctx, retry); err != nil {
+			return items, PartialResultError{
+				Operation:   "BatchGetItem",
+				Resource:    tableName,
+				Processed:   len(keys) - len(unprocessed.Keys),
+				Unprocessed: len(unprocessed.Keys),
+				Attempts:    retry,
+				Cause:       err,
+			}
+		}
+		log.Infof("retrying %d unprocessed items out of an original %d (retry %d)", len(unprocessed.Keys), len(keys), retry)
 		input := dynamodb.BatchGetItemInput{RequestItems: map[string]types.KeysAndAttributes{tableName: unprocessed}}
 		unprocessed, err = makeOneRequest(ctx, &input)
 		if err != nil {
 			return nil, err
 		}
-		retryCount++
 	}
 	return items, nil
 }
@@ -169,17 +174,23 @@ func (d *dynamodbStore) deleteBatchItemsSingleTable(ctx context.Context, tableNa
 	if err != nil {
 		return err
 	}
-	retryCount := 1
-	for unprocessed != nil && len(unprocessed) > 0 {
-		waitDuration := time.Duration(retryCount)*time.Second + (time.Duration(rand.Intn(1000)) * time.Millisecond)
-		time.Sleep(waitDuration)
-		log.Infof("retrying %d unprocessed items out of an original %d after a wait of %s", len(unprocessed), len(writeRequests), waitDuration)
+	for retry := 1; len(unprocessed) > 0; retry++ {
+		if err := d.RetryPolicy.Wait(ctx, retry); err != nil {
+			return PartialResultError{
+				Operation:   "BatchWriteItem",
+				Resource:    tableName,
+				Processed:   len(writeRequests) - len(unprocessed),
+				Unprocessed: len(unprocessed),
+				Attempts:    retry,
+				Cause:       err,
+			}
+		}
+		log.Infof("retrying %d unprocessed items out of an original %d (retry %d)", len(unprocessed), len(writeRequests), retry)
 		input := dynamodb.BatchWriteItemInput{RequestItems: map[string][]types.WriteRequest{tableName: unprocessed}}
 		unprocessed, err = makeOneRequest(ctx, &input)
 		if err != nil {
 			return err
 		}
-		retryCount++
 	}
 	return nil
 }
@@ -0,0 +1,103 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/pennsieve/packages-service/api/logging"
+	"github.com/pennsieve/packages-service/api/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// ManifestSnapshotsPrefix is the prefix of the keys of manifest snapshots in the download jobs bucket. The bucket
+// expires them after ManifestSnapshotRetentionDays.
+const ManifestSnapshotsPrefix = "manifest-snapshots/"
+
+const ManifestSnapshotRetentionDays = 30
+
+// ManifestSnapshotStore keeps manifest snapshots as JSON objects in the download jobs bucket.
+type ManifestSnapshotStore struct {
+	Client *s3.Client
+	bucket string
+}
+
+func NewManifestSnapshotStore(client *s3.Client, bucket string) *ManifestSnapshotStore {
+	return &ManifestSnapshotStore{Client: client, bucket: bucket}
+}
+
+// NewManifestSnapshotStoreFromEnv returns a store in the bucket named by DownloadJobsBucketEnvKey, or nil if it is not set.
+func NewManifestSnapshotStoreFromEnv(client *s3.Client) *ManifestSnapshotStore {
+	bucket := os.Getenv(DownloadJobsBucketEnvKey)
+	if bucket == "" {
+		return nil
+	}
+	return NewManifestSnapshotStore(client, bucket)
+}
+
+func (s *ManifestSnapshotStore) WithLogging(log logging.Logger) ManifestSnapshots {
+	return &manifestSnapshotStore{
+		ManifestSnapshotStore: s,
+		Logger:                log,
+	}
+}
+
+type manifestSnapshotStore struct {
+	*ManifestSnapshotStore
+	logging.Logger
+}
+
+type ManifestSnapshots interface {
+	PutManifestSnapshot(ctx context.Context, snapshot models.ManifestSnapshot) error
+	// GetManifestSnapshot returns the snapshot with the id, or nil if there is none, as when it has expired.
+	GetManifestSnapshot(ctx context.Context, id string) (*models.ManifestSnapshot, error)
+	logging.Logger
+}
+
+func manifestSnapshotKey(id string) string {
+	return ManifestSnapshotsPrefix + id + ".json"
+}
+
+func (s *manifestSnapshotStore) PutManifestSnapshot(ctx context.Context, snapshot models.ManifestSnapshot) error {
+	body, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("error marshalling manifest snapshot %s: %w", snapshot.Id, err)
+	}
+	key := manifestSnapshotKey(snapshot.Id)
+	if _, err := s.Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/json"),
+	}); err != nil {
+		return fmt.Errorf("error putting manifest snapshot %s to %s: %w", key, s.bucket, err)
+	}
+	s.LogDebugWithFields(log.Fields{"key": key, "files": len(snapshot.Files)}, "put manifest snapshot")
+	return nil
+}
+
+func (s *manifestSnapshotStore) GetManifestSnapshot(ctx context.Context, id string) (*models.ManifestSnapshot, error) {
+	key := manifestSnapshotKey(id)
+	output, err := s.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if noSuchKey := new(types.NoSuchKey); errors.As(err, &noSuchKey) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting manifest snapshot %s from %s: %w", key, s.bucket, err)
+	}
+	defer output.Body.Close()
+	var snapshot models.ManifestSnapshot
+	if err := json.NewDecoder(output.Body).Decode(&snapshot); err != nil {
+		return nil, fmt.Errorf("error unmarshalling manifest snapshot %s: %w", key, err)
+	}
+	return &snapshot, nil
+}
@@ -0,0 +1,48 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/uuid"
+	"github.com/pennsieve/packages-service/api/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifestSnapshotStore(t *testing.T) {
+	ctx := context.Background()
+	s3Client := s3.NewFromConfig(GetTestAWSConfig(t), func(options *s3.Options) {
+		options.BaseEndpoint = aws.String(GetTestMinioURL())
+		options.UsePathStyle = true
+	})
+	bucket := "download-jobs-" + strings.ToLower(RandString(8))
+	s3Fixture := NewS3Fixture(t, s3Client, &s3.CreateBucketInput{Bucket: aws.String(bucket)})
+	t.Cleanup(s3Fixture.Teardown)
+
+	snapshots := NewManifestSnapshotStore(s3Client, bucket).WithLogging(NoLogger{})
+	snapshot := models.ManifestSnapshot{
+		Id:            uuid.NewString(),
+		OrgId:         2,
+		DatasetNodeId: "N:dataset:snapshot",
+		CreatedAt:     time.Now().UTC().Truncate(time.Second),
+		Files: []models.ManifestSnapshotFile{
+			{FileId: 1, NodeId: "N:package:1", TargetPath: "data/one.csv", Fingerprint: "f1"},
+			{FileId: 2, NodeId: "N:package:2", TargetPath: "two.csv", Fingerprint: "f2"},
+		},
+	}
+	require.NoError(t, snapshots.PutManifestSnapshot(ctx, snapshot))
+
+	stored, err := snapshots.GetManifestSnapshot(ctx, snapshot.Id)
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+	assert.Equal(t, snapshot, *stored)
+
+	missing, err := snapshots.GetManifestSnapshot(ctx, uuid.NewString())
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+}
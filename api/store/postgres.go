@@ -8,12 +8,15 @@ import (
 	"github.com/lib/pq"
 	"github.com/pennsieve/packages-service/api/logging"
 	"github.com/pennsieve/packages-service/api/models"
+	"github.com/pennsieve/packages-service/api/tracing"
 	"github.com/pennsieve/pennsieve-go-core/pkg/models/fileInfo/objectType"
 	"github.com/pennsieve/pennsieve-go-core/pkg/models/packageInfo/packageState"
 	"github.com/pennsieve/pennsieve-go-core/pkg/models/packageInfo/packageType"
 	"github.com/pennsieve/pennsieve-go-core/pkg/models/pgdb"
 	pg "github.com/pennsieve/pennsieve-go-core/pkg/queries/pgdb"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"strings"
 )
 
@@ -89,7 +92,16 @@ func NewQueries(db pg.DBTX, orgId int, logger logging.Logger) *Queries {
 	return &Queries{db: db, OrgId: orgId, Logger: logger}
 }
 
-func (q *Queries) UpdatePackageName(ctx context.Context, packageId int64, newName string) error {
+// startSpan starts a tracing span for a Queries method, tagged with the organization schema it runs against.
+func (q *Queries) startSpan(ctx context.Context, method string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "Queries."+method, attribute.Int("pennsieve.org_id", q.OrgId))
+}
+
+func (q *Queries) UpdatePackageName(ctx context.Context, packageId int64, newName string) (err error) {
+	ctx, span := q.startSpan(ctx, "UpdatePackageName")
+	defer func() {
+		tracing.End(span, err)
+	}()
 	query := fmt.Sprintf(`UPDATE "%d".packages SET name = $1 WHERE id = $2`, q.OrgId)
 	res, err := q.db.ExecContext(ctx, query, newName, packageId)
 	if err != nil {
@@ -142,7 +154,11 @@ func (t PackageStateTransition) insertPlaceHolderAt(insertionIndex int, placeHol
 	return
 }
 
-func (q *Queries) TransitionPackageStateBulk(ctx context.Context, datasetId int64, transitions []PackageStateTransition) ([]*pgdb.Package, error) {
+func (q *Queries) TransitionPackageStateBulk(ctx context.Context, datasetId int64, transitions []PackageStateTransition) (_ []*pgdb.Package, err error) {
+	ctx, span := q.startSpan(ctx, "TransitionPackageStateBulk")
+	defer func() {
+		tracing.End(span, err)
+	}()
 	var updated []*pgdb.Package
 	if len(transitions) == 0 {
 		return updated, nil
@@ -185,7 +201,11 @@ func (q *Queries) TransitionPackageStateBulk(ctx context.Context, datasetId int6
 	return updated, nil
 }
 
-func (q *Queries) TransitionPackageState(ctx context.Context, datasetId int64, packageId string, expectedState, targetState packageState.State) (*pgdb.Package, error) {
+func (q *Queries) TransitionPackageState(ctx context.Context, datasetId int64, packageId string, expectedState, targetState packageState.State) (_ *pgdb.Package, err error) {
+	ctx, span := q.startSpan(ctx, "TransitionPackageState")
+	defer func() {
+		tracing.End(span, err)
+	}()
 	query := fmt.Sprintf(`UPDATE "%d".packages SET state = $1 WHERE node_id = $2 AND dataset_id = $3 AND state = $4 RETURNING %s`, q.OrgId, packageScanner.ColumnNamesString)
 	var pkg pgdb.Package
 	if err := packageScanner.Scan(q.db.QueryRowContext(ctx, query, targetState, packageId, datasetId, expectedState), &pkg); errors.Is(err, sql.ErrNoRows) {
@@ -195,7 +215,11 @@ func (q *Queries) TransitionPackageState(ctx context.Context, datasetId int64, p
 	}
 }
 
-func (q *Queries) GetPackageByNodeId(ctx context.Context, packageId string) (*pgdb.Package, error) {
+func (q *Queries) GetPackageByNodeId(ctx context.Context, packageId string) (_ *pgdb.Package, err error) {
+	ctx, span := q.startSpan(ctx, "GetPackageByNodeId")
+	defer func() {
+		tracing.End(span, err)
+	}()
 	query := fmt.Sprintf(`SELECT %s FROM "%d".packages WHERE node_id = $1`, packageScanner.ColumnNamesString, q.OrgId)
 	var pkg pgdb.Package
 	row := q.db.QueryRowContext(ctx, query, packageId)
@@ -206,7 +230,11 @@ func (q *Queries) GetPackageByNodeId(ctx context.Context, packageId string) (*pg
 	}
 }
 
-func (q *Queries) GetSourceFilesByPackageId(ctx context.Context, packageId int64) ([]File, error) {
+func (q *Queries) GetSourceFilesByPackageId(ctx context.Context, packageId int64) (_ []File, err error) {
+	ctx, span := q.startSpan(ctx, "GetSourceFilesByPackageId")
+	defer func() {
+		tracing.End(span, err)
+	}()
 	query := fmt.Sprintf(`SELECT %s from "%d".files WHERE package_id = $1 AND object_type = $2`, filesScanner.ColumnNamesString, q.OrgId)
 	rows, err := q.db.QueryContext(ctx, query, packageId, objectType.Source.String())
 	if err != nil {
@@ -229,7 +257,11 @@ func (q *Queries) GetSourceFilesByPackageId(ctx context.Context, packageId int64
 	return files, nil
 }
 
-func (q *Queries) GetSourceFilesByNodeIds(ctx context.Context, packageNodeIds []string) (map[string][]File, error) {
+func (q *Queries) GetSourceFilesByNodeIds(ctx context.Context, packageNodeIds []string) (_ map[string][]File, err error) {
+	ctx, span := q.startSpan(ctx, "GetSourceFilesByNodeIds")
+	defer func() {
+		tracing.End(span, err)
+	}()
 	if len(packageNodeIds) == 0 {
 		return map[string][]File{}, nil
 	}
@@ -265,7 +297,11 @@ func (q *Queries) closeRows(rows *sql.Rows) {
 	}
 }
 
-func (q *Queries) TransitionDescendantPackageState(ctx context.Context, datasetId, packageId int64, expectedState, targetState packageState.State) ([]*pgdb.Package, error) {
+func (q *Queries) TransitionDescendantPackageState(ctx context.Context, datasetId, packageId int64, expectedState, targetState packageState.State) (_ []*pgdb.Package, err error) {
+	ctx, span := q.startSpan(ctx, "TransitionDescendantPackageState")
+	defer func() {
+		tracing.End(span, err)
+	}()
 	query := fmt.Sprintf(`WITH RECURSIVE nodes(id) AS (
 							SELECT id FROM "%[1]d".packages
                              	WHERE parent_id = $1
@@ -299,7 +335,11 @@ func (q *Queries) TransitionDescendantPackageState(ctx context.Context, datasetI
 	return updated, nil
 }
 
-func (q *Queries) TransitionAncestorPackageState(ctx context.Context, parentId int64, expectedState, targetState packageState.State) ([]*pgdb.Package, error) {
+func (q *Queries) TransitionAncestorPackageState(ctx context.Context, parentId int64, expectedState, targetState packageState.State) (_ []*pgdb.Package, err error) {
+	ctx, span := q.startSpan(ctx, "TransitionAncestorPackageState")
+	defer func() {
+		tracing.End(span, err)
+	}()
 	query := fmt.Sprintf(`WITH RECURSIVE ancestors(id, parent_id) AS (
 							SELECT id, parent_id FROM "%[1]d".packages
                              	WHERE type = $1
@@ -334,7 +374,11 @@ func (q *Queries) TransitionAncestorPackageState(ctx context.Context, parentId i
 	return updated, nil
 }
 
-func (q *Queries) GetDatasetByNodeId(ctx context.Context, dsNodeId string) (*pgdb.Dataset, error) {
+func (q *Queries) GetDatasetByNodeId(ctx context.Context, dsNodeId string) (_ *pgdb.Dataset, err error) {
+	ctx, span := q.startSpan(ctx, "GetDatasetByNodeId")
+	defer func() {
+		tracing.End(span, err)
+	}()
 	const datasetColumns = "id, name, state, description, updated_at, created_at, node_id, permission_bit, type, role, status, automatically_process_packages, license, tags, contributors, banner_id, readme_id, status_id, size, etag, data_use_agreement_id, changelog_id"
 	var ds pgdb.Dataset
 	query := fmt.Sprintf(`SELECT %s FROM "%d".datasets WHERE node_id = $1`, datasetColumns, q.OrgId)
@@ -367,32 +411,48 @@ func (q *Queries) GetDatasetByNodeId(ctx context.Context, dsNodeId string) (*pgd
 	}
 }
 
-func (q *Queries) IncrementPackageStorage(ctx context.Context, packageId int64, sizeIncrement int64) error {
+func (q *Queries) IncrementPackageStorage(ctx context.Context, packageId int64, sizeIncrement int64) (err error) {
+	ctx, span := q.startSpan(ctx, "IncrementPackageStorage")
+	defer func() {
+		tracing.End(span, err)
+	}()
 	query := fmt.Sprintf(`INSERT INTO "%d".package_storage as package_storage (package_id, size) VALUES ($1, $2)
 							ON CONFLICT (package_id) DO UPDATE 
 							SET size = COALESCE(package_storage.size, 0) + EXCLUDED.size`, q.OrgId)
-	_, err := q.db.ExecContext(ctx, query, packageId, sizeIncrement)
+	_, err = q.db.ExecContext(ctx, query, packageId, sizeIncrement)
 	return err
 }
 
-func (q *Queries) IncrementDatasetStorage(ctx context.Context, datasetId int64, sizeIncrement int64) error {
+func (q *Queries) IncrementDatasetStorage(ctx context.Context, datasetId int64, sizeIncrement int64) (err error) {
+	ctx, span := q.startSpan(ctx, "IncrementDatasetStorage")
+	defer func() {
+		tracing.End(span, err)
+	}()
 	query := fmt.Sprintf(`INSERT INTO "%d".dataset_storage as dataset_storage (dataset_id, size) VALUES ($1, $2)
 							ON CONFLICT (dataset_id) DO UPDATE 
 							SET size = COALESCE(dataset_storage.size, 0) + EXCLUDED.size`, q.OrgId)
-	_, err := q.db.ExecContext(ctx, query, datasetId, sizeIncrement)
+	_, err = q.db.ExecContext(ctx, query, datasetId, sizeIncrement)
 	return err
 }
 
-func (q *Queries) IncrementOrganizationStorage(ctx context.Context, organizationId int64, sizeIncrement int64) error {
+func (q *Queries) IncrementOrganizationStorage(ctx context.Context, organizationId int64, sizeIncrement int64) (err error) {
+	ctx, span := q.startSpan(ctx, "IncrementOrganizationStorage")
+	defer func() {
+		tracing.End(span, err)
+	}()
 	query := `INSERT INTO pennsieve.organization_storage as organization_storage (organization_id, size) VALUES ($1, $2)
 							ON CONFLICT (organization_id) DO UPDATE 
 							SET size = COALESCE(organization_storage.size, 0) + EXCLUDED.size`
-	_, err := q.db.ExecContext(ctx, query, organizationId, sizeIncrement)
+	_, err = q.db.ExecContext(ctx, query, organizationId, sizeIncrement)
 	return err
 }
 
 // IncrementPackageStorageAncestors increases the storage associated with the parents of the provided package.
-func (q *Queries) IncrementPackageStorageAncestors(ctx context.Context, parentId int64, size int64) error {
+func (q *Queries) IncrementPackageStorageAncestors(ctx context.Context, parentId int64, size int64) (err error) {
+	ctx, span := q.startSpan(ctx, "IncrementPackageStorageAncestors")
+	defer func() {
+		tracing.End(span, err)
+	}()
 
 	queryStr := fmt.Sprintf(`WITH RECURSIVE ancestors(id, parent_id) AS (
 		SELECT 
@@ -411,25 +471,37 @@ func (q *Queries) IncrementPackageStorageAncestors(ctx context.Context, parentId
 		ON CONFLICT (package_id)
 		DO UPDATE SET size = COALESCE(package_storage.size, 0) + EXCLUDED.size`, q.OrgId)
 
-	_, err := q.db.ExecContext(ctx, queryStr, parentId, size)
+	_, err = q.db.ExecContext(ctx, queryStr, parentId, size)
 	return err
 }
 
-func (q *Queries) NewSavepoint(ctx context.Context, name string) error {
+func (q *Queries) NewSavepoint(ctx context.Context, name string) (err error) {
+	ctx, span := q.startSpan(ctx, "NewSavepoint")
+	defer func() {
+		tracing.End(span, err)
+	}()
 	stmt := fmt.Sprintf("SAVEPOINT %s", name)
-	_, err := q.db.ExecContext(ctx, stmt)
+	_, err = q.db.ExecContext(ctx, stmt)
 	return err
 }
 
-func (q *Queries) RollbackToSavepoint(ctx context.Context, name string) error {
+func (q *Queries) RollbackToSavepoint(ctx context.Context, name string) (err error) {
+	ctx, span := q.startSpan(ctx, "RollbackToSavepoint")
+	defer func() {
+		tracing.End(span, err)
+	}()
 	stmt := fmt.Sprintf("ROLLBACK TO SAVEPOINT %s", name)
-	_, err := q.db.ExecContext(ctx, stmt)
+	_, err = q.db.ExecContext(ctx, stmt)
 	return err
 }
 
-func (q *Queries) ReleaseSavepoint(ctx context.Context, name string) error {
+func (q *Queries) ReleaseSavepoint(ctx context.Context, name string) (err error) {
+	ctx, span := q.startSpan(ctx, "ReleaseSavepoint")
+	defer func() {
+		tracing.End(span, err)
+	}()
 	stmt := fmt.Sprintf("RELEASE SAVEPOINT %s", name)
-	_, err := q.db.ExecContext(ctx, stmt)
+	_, err = q.db.ExecContext(ctx, stmt)
 	return err
 }
 
@@ -6,6 +6,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/google/uuid"
 	"github.com/pennsieve/packages-service/api/logging"
+	"github.com/pennsieve/packages-service/api/tracing"
 	"github.com/pennsieve/pennsieve-go-core/pkg/changelog"
 	"time"
 )
@@ -48,12 +49,17 @@ func (s *sqsChangelogStore) LogRestores(ctx context.Context, orgId, datasetId in
 			Timestamp:   now,
 		}
 	}
+	// Share the trace ID of the restore so that changelog entries can be correlated with its spans.
+	traceId := tracing.TraceID(ctx)
+	if traceId == "" {
+		traceId = uuid.NewString()
+	}
 	params := changelog.MessageParams{
 		OrganizationId: orgId,
 		DatasetId:      datasetId,
 		UserId:         userId,
 		Events:         events,
-		TraceId:        uuid.NewString(),
+		TraceId:        traceId,
 		Id:             uuid.NewString(),
 	}
 
@@ -0,0 +1,99 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// ErrRetryAttemptsExhausted is the cause of a PartialResultError when the
+// RetryPolicy ran out of attempts before every item was processed.
+var ErrRetryAttemptsExhausted = errors.New("retry attempts exhausted")
+
+// RetryPolicy controls how batch helpers retry items that AWS reports as unprocessed
+// (DynamoDB UnprocessedKeys/UnprocessedItems, or throttled S3 DeleteObjects entries).
+type RetryPolicy struct {
+	// MaxAttempts is the total number of requests made for a batch, including the first.
+	MaxAttempts int
+	// BaseDelay is the backoff ceiling for the first retry. It doubles on each subsequent retry.
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff ceiling.
+	MaxDelay time.Duration
+	// DeadlineReserve is the time left on the context deadline that a retry must not eat into,
+	// so that there is still room to make the request after waiting and to report the result.
+	DeadlineReserve time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:     6,
+	BaseDelay:       250 * time.Millisecond,
+	MaxDelay:        8 * time.Second,
+	DeadlineReserve: 2 * time.Second,
+}
+
+// Backoff returns the wait before the given retry (1 for the first retry). It uses
+// "equal jitter": a random duration between half and all of the exponential ceiling.
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	ceiling := p.MaxDelay
+	if retry < 1 {
+		retry = 1
+	}
+	// Guard the shift against overflow for large retry counts.
+	if shift := retry - 1; shift < 32 {
+		if d := p.BaseDelay << shift; d > 0 && d < p.MaxDelay {
+			ceiling = d
+		}
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	half := ceiling / 2
+	return half + time.Duration(rand.Int63n(int64(ceiling-half)+1))
+}
+
+// Wait blocks before the given retry. It returns ErrRetryAttemptsExhausted without waiting if
+// the retry would exceed MaxAttempts, and context.DeadlineExceeded without waiting if the wait
+// would run past ctx's deadline less DeadlineReserve. If ctx is cancelled while waiting, ctx.Err() is returned.
+func (p RetryPolicy) Wait(ctx context.Context, retry int) error {
+	if retry >= p.MaxAttempts {
+		return ErrRetryAttemptsExhausted
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	delay := p.Backoff(retry)
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline)-p.DeadlineReserve < delay {
+		return context.DeadlineExceeded
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// PartialResultError is returned by the batch helpers when the RetryPolicy budget runs out
+// before every item was processed. Any results for the Processed items are still returned
+// alongside the error. Cause is ErrRetryAttemptsExhausted or the context error that stopped the retries.
+type PartialResultError struct {
+	Operation   string
+	Resource    string
+	Processed   int
+	Unprocessed int
+	Attempts    int
+	Cause       error
+}
+
+func (e PartialResultError) Error() string {
+	return fmt.Sprintf("%s on %s incomplete after %d attempts: %d of %d items unprocessed: %v",
+		e.Operation, e.Resource, e.Attempts, e.Unprocessed, e.Processed+e.Unprocessed, e.Cause)
+}
+
+func (e PartialResultError) Unwrap() error {
+	return e.Cause
+}
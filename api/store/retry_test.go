@@ -0,0 +1,85 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for name, tt := range map[string]struct {
+		retry   int
+		ceiling time.Duration
+	}{
+		"first retry":    {retry: 1, ceiling: 100 * time.Millisecond},
+		"second retry":   {retry: 2, ceiling: 200 * time.Millisecond},
+		"capped":         {retry: 5, ceiling: time.Second},
+		"shift overflow": {retry: 100, ceiling: time.Second},
+		"zero retry":     {retry: 0, ceiling: 100 * time.Millisecond},
+	} {
+		t.Run(name, func(t *testing.T) {
+			for i := 0; i < 20; i++ {
+				backoff := policy.Backoff(tt.retry)
+				assert.GreaterOrEqual(t, backoff, tt.ceiling/2)
+				assert.LessOrEqual(t, backoff, tt.ceiling)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_Wait(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond}
+
+	t.Run("within budget", func(t *testing.T) {
+		assert.NoError(t, policy.Wait(context.Background(), 1))
+		assert.NoError(t, policy.Wait(context.Background(), 2))
+	})
+
+	t.Run("attempts exhausted", func(t *testing.T) {
+		assert.ErrorIs(t, policy.Wait(context.Background(), 3), ErrRetryAttemptsExhausted)
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.ErrorIs(t, policy.Wait(ctx, 1), context.Canceled)
+	})
+
+	t.Run("deadline too close", func(t *testing.T) {
+		slowPolicy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Minute}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		start := time.Now()
+		assert.ErrorIs(t, slowPolicy.Wait(ctx, 1), context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), time.Second, "should give up without waiting")
+	})
+
+	t.Run("deadline reserve", func(t *testing.T) {
+		reservePolicy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, DeadlineReserve: time.Minute}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		assert.ErrorIs(t, reservePolicy.Wait(ctx, 1), context.DeadlineExceeded)
+	})
+}
+
+func TestPartialResultError(t *testing.T) {
+	var err error = PartialResultError{
+		Operation:   "BatchWriteItem",
+		Resource:    "delete-records",
+		Processed:   20,
+		Unprocessed: 5,
+		Attempts:    6,
+		Cause:       ErrRetryAttemptsExhausted,
+	}
+	wrapped := errors.Join(errors.New("outer"), err)
+
+	var partial PartialResultError
+	if assert.ErrorAs(t, wrapped, &partial) {
+		assert.Equal(t, 5, partial.Unprocessed)
+	}
+	assert.ErrorIs(t, wrapped, ErrRetryAttemptsExhausted)
+	assert.Contains(t, err.Error(), "5 of 25 items unprocessed")
+}
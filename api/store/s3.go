@@ -2,22 +2,35 @@ package store
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/pennsieve/packages-service/api/logging"
 	"github.com/pennsieve/packages-service/api/regions"
+	log "github.com/sirupsen/logrus"
+	"slices"
+	"strings"
 )
 
 const maxDeleteObjects = 1000
 
+// retryableS3ErrorCodes are the per-object DeleteObjects error codes that are worth retrying.
+var retryableS3ErrorCodes = map[string]bool{
+	"InternalError":      true,
+	"ServiceUnavailable": true,
+	"SlowDown":           true,
+}
+
 type S3Store struct {
-	Client *s3.Client
+	Client      *s3.Client
+	Regions     *regions.Resolver
+	RetryPolicy RetryPolicy
 }
 
-func NewS3Store(s3Client *s3.Client) *S3Store {
-	return &S3Store{Client: s3Client}
+func NewS3Store(s3Client *s3.Client, bucketRegions *regions.Resolver) *S3Store {
+	return &S3Store{Client: s3Client, Regions: bucketRegions, RetryPolicy: DefaultRetryPolicy}
 }
 
 func (s *S3Store) WithLogging(log *logging.Log) ObjectStore {
@@ -101,33 +114,96 @@ func (s *s3Store) DeleteObjectsVersion(ctx context.Context, objInfos ...S3Object
 			byBucket[bucket] = append(byBucket[bucket], []types.ObjectIdentifier{objectId})
 		}
 	}
+	var partialErr *PartialResultError
+	var partialBuckets []string
 	for bucket, batches := range byBucket {
-		bucketRegion := regions.ForBucket(bucket)
+		bucketRegion, err := s.Regions.ForBucket(ctx, bucket)
+		if err != nil {
+			return response, fmt.Errorf("api/store/s3: error deleting objects from bucket %s: %w", bucket, err)
+		}
 		for i, batch := range batches {
-			input := s3.DeleteObjectsInput{
-				Bucket: aws.String(bucket),
-				Delete: &types.Delete{
-					Objects: batch,
-				},
+			deleted, awsErrors, err := s.deleteObjectsBatch(ctx, bucket, bucketRegion, batch)
+			for _, success := range deleted {
+				nodeId := bucketToKeyToNodeId[bucket][aws.ToString(success.Key)]
+				deletedPackage := DeletedPackage{
+					NodeId:       nodeId,
+					DeleteMarker: aws.ToBool(success.DeleteMarker),
+				}
+				response.Deleted = append(response.Deleted, deletedPackage)
 			}
-			if output, err := s.Client.DeleteObjects(ctx, &input, func(options *s3.Options) {
-				options.Region = bucketRegion
-			}); err != nil {
-				return response, fmt.Errorf("api/store/s3: error deleting batch %d of %d for bucket %s: %w", i, len(batches), bucket, err)
-			} else {
-				for _, success := range output.Deleted {
-					nodeId := bucketToKeyToNodeId[bucket][aws.ToString(success.Key)]
-					deletedPackage := DeletedPackage{
-						NodeId:       nodeId,
-						DeleteMarker: aws.ToBool(success.DeleteMarker),
-					}
-					response.Deleted = append(response.Deleted, deletedPackage)
+			for _, awsError := range awsErrors {
+				response.AWSErrors = append(response.AWSErrors, NewAWSError(bucket, awsError))
+			}
+			if err != nil {
+				var partial PartialResultError
+				if !errors.As(err, &partial) {
+					return response, fmt.Errorf("api/store/s3: error deleting batch %d of %d for bucket %s: %w", i, len(batches), bucket, err)
+				}
+				if partialErr == nil {
+					partialErr = &PartialResultError{Operation: partial.Operation, Cause: partial.Cause}
 				}
-				for _, awsError := range output.Errors {
-					response.AWSErrors = append(response.AWSErrors, NewAWSError(bucket, awsError))
+				if !slices.Contains(partialBuckets, bucket) {
+					partialBuckets = append(partialBuckets, bucket)
 				}
+				partialErr.Processed += partial.Processed
+				partialErr.Unprocessed += partial.Unprocessed
+				partialErr.Attempts = max(partialErr.Attempts, partial.Attempts)
 			}
 		}
 	}
+	if partialErr != nil {
+		partialErr.Resource = strings.Join(partialBuckets, ", ")
+		return response, *partialErr
+	}
 	return response, nil
 }
+
+// deleteObjectsBatch deletes a single batch of objects from bucket, retrying any objects that fail with a
+// retryable error code according to the store's RetryPolicy. If objects are still failing with a retryable error
+// when the policy gives up, their errors are included in the returned errors along with a PartialResultError.
+func (s *s3Store) deleteObjectsBatch(ctx context.Context, bucket, bucketRegion string, batch []types.ObjectIdentifier) ([]types.DeletedObject, []types.Error, error) {
+	var deleted []types.DeletedObject
+	var failed []types.Error
+	pending := batch
+	for attempt := 1; ; attempt++ {
+		input := s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &types.Delete{
+				Objects: pending,
+			},
+		}
+		output, err := s.Client.DeleteObjects(ctx, &input, func(options *s3.Options) {
+			options.Region = bucketRegion
+		})
+		if err != nil {
+			return deleted, failed, err
+		}
+		deleted = append(deleted, output.Deleted...)
+		var retryable []types.Error
+		for _, e := range output.Errors {
+			if retryableS3ErrorCodes[aws.ToString(e.Code)] {
+				retryable = append(retryable, e)
+			} else {
+				failed = append(failed, e)
+			}
+		}
+		if len(retryable) == 0 {
+			return deleted, failed, nil
+		}
+		if waitErr := s.RetryPolicy.Wait(ctx, attempt); waitErr != nil {
+			return deleted, append(failed, retryable...), PartialResultError{
+				Operation:   "DeleteObjects",
+				Resource:    bucket,
+				Processed:   len(batch) - len(retryable),
+				Unprocessed: len(retryable),
+				Attempts:    attempt,
+				Cause:       waitErr,
+			}
+		}
+		s.LogInfoWithFields(log.Fields{"bucket": bucket, "retry": attempt}, fmt.Sprintf("retrying %d objects out of an original %d", len(retryable), len(batch)))
+		pending = make([]types.ObjectIdentifier, len(retryable))
+		for i, e := range retryable {
+			pending[i] = types.ObjectIdentifier{Key: e.Key, VersionId: e.VersionId}
+		}
+	}
+}
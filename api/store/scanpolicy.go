@@ -0,0 +1,83 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/pennsieve/packages-service/api/logging"
+	"github.com/pennsieve/packages-service/api/models"
+)
+
+const ScanPoliciesTableNameEnvKey = "SCAN_POLICIES_DYNAMODB_TABLE_NAME"
+
+// ScanPolicyStore reads the scan-status download policies of organizations and datasets.
+type ScanPolicyStore struct {
+	Client    *dynamodb.Client
+	tableName string
+}
+
+func NewScanPolicyStore(client *dynamodb.Client, tableName string) *ScanPolicyStore {
+	return &ScanPolicyStore{Client: client, tableName: tableName}
+}
+
+// NewScanPolicyStoreFromEnv returns a store for the table named by ScanPoliciesTableNameEnvKey, which must be set,
+// since without it datasets with a strict policy would be downloaded as if they had the permissive one.
+func NewScanPolicyStoreFromEnv(client *dynamodb.Client) (*ScanPolicyStore, error) {
+	tableName := os.Getenv(ScanPoliciesTableNameEnvKey)
+	if tableName == "" {
+		return nil, fmt.Errorf("%s not set", ScanPoliciesTableNameEnvKey)
+	}
+	return NewScanPolicyStore(client, tableName), nil
+}
+
+func (s *ScanPolicyStore) WithLogging(log logging.Logger) ScanPolicies {
+	return &scanPolicyStore{
+		ScanPolicyStore: s,
+		Logger:          log,
+	}
+}
+
+type scanPolicyStore struct {
+	*ScanPolicyStore
+	logging.Logger
+}
+
+type ScanPolicies interface {
+	// GetScanPolicy returns the scan policy of the dataset if it has one, or else that of the organization,
+	// or nil if neither has one.
+	GetScanPolicy(ctx context.Context, orgId int, datasetNodeId string) (*models.ScanPolicy, error)
+	logging.Logger
+}
+
+func (s *scanPolicyStore) GetScanPolicy(ctx context.Context, orgId int, datasetNodeId string) (*models.ScanPolicy, error) {
+	for _, scope := range []string{datasetNodeId, models.ScanPolicyScopeOrg} {
+		if scope == "" {
+			continue
+		}
+		output, err := s.Client.GetItem(ctx, &dynamodb.GetItemInput{
+			TableName: aws.String(s.tableName),
+			Key: map[string]types.AttributeValue{
+				"OrgId": &types.AttributeValueMemberN{Value: strconv.Itoa(orgId)},
+				"Scope": &types.AttributeValueMemberS{Value: scope},
+			},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error getting %s scan policy of org %d from %s: %w", scope, orgId, s.tableName, err)
+		}
+		if output.Item == nil {
+			continue
+		}
+		var policy models.ScanPolicy
+		if err := attributevalue.UnmarshalMap(output.Item, &policy); err != nil {
+			return nil, fmt.Errorf("error unmarshalling %s scan policy of org %d: %w", scope, orgId, err)
+		}
+		return &policy, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,59 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/pennsieve/packages-service/api/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanPolicyStore_GetScanPolicy(t *testing.T) {
+	ctx := context.Background()
+	dyClient := dynamodb.NewFromConfig(GetTestAWSConfig(t), func(options *dynamodb.Options) {
+		options.BaseEndpoint = aws.String(GetTestDynamoDBURL())
+	})
+	tableName := "scan-policies-" + RandString(8)
+	tableInput := TestCreateScanPolicyTableInput(tableName)
+	dyFixture := NewDynamoDBFixture(t, dyClient, &tableInput)
+	t.Cleanup(dyFixture.Teardown)
+
+	var putInputs []*dynamodb.PutItemInput
+	for _, policy := range []models.ScanPolicy{
+		{OrgId: 2, Scope: models.ScanPolicyScopeOrg, Mode: models.ScanPolicyStrict},
+		{OrgId: 2, Scope: "N:dataset:open", Mode: models.ScanPolicyPermissive},
+		{OrgId: 3, Scope: "N:dataset:clinical", Mode: models.ScanPolicyStrict},
+	} {
+		item, err := attributevalue.MarshalMap(policy)
+		require.NoError(t, err)
+		putInputs = append(putInputs, &dynamodb.PutItemInput{TableName: aws.String(tableName), Item: item})
+	}
+	dyFixture.WithItems(putInputs...)
+
+	policies := NewScanPolicyStore(dyClient, tableName).WithLogging(NoLogger{})
+	for name, test := range map[string]struct {
+		orgId         int
+		datasetNodeId string
+		expectedMode  models.ScanPolicyMode
+	}{
+		"org policy":             {2, "N:dataset:other", models.ScanPolicyStrict},
+		"dataset overrides org":  {2, "N:dataset:open", models.ScanPolicyPermissive},
+		"dataset without an org": {3, "N:dataset:clinical", models.ScanPolicyStrict},
+		"no dataset":             {2, "", models.ScanPolicyStrict},
+	} {
+		t.Run(name, func(t *testing.T) {
+			policy, err := policies.GetScanPolicy(ctx, test.orgId, test.datasetNodeId)
+			require.NoError(t, err)
+			require.NotNil(t, policy)
+			assert.Equal(t, test.expectedMode, policy.Mode)
+		})
+	}
+
+	policy, err := policies.GetScanPolicy(ctx, 3, "N:dataset:other")
+	require.NoError(t, err)
+	assert.Nil(t, policy)
+}
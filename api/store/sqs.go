@@ -4,8 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
 	"github.com/pennsieve/packages-service/api/models"
+	"github.com/pennsieve/packages-service/api/tracing"
 )
 
 const m = "api/store/sqs"
@@ -32,10 +35,23 @@ func (s *sqsStore) SendRestorePackage(ctx context.Context, restoreMessage models
 		return fmt.Errorf("%s: unable to marshal %v: %w", m, restoreMessage, err)
 	}
 	bodyStr := string(body)
-	request := sqs.SendMessageInput{QueueUrl: &s.RestorePackageURL, MessageBody: &bodyStr}
+	request := sqs.SendMessageInput{QueueUrl: &s.RestorePackageURL, MessageBody: &bodyStr, MessageAttributes: traceMessageAttributes(ctx)}
 	_, err = s.Client.SendMessage(ctx, &request)
 	if err != nil {
 		return fmt.Errorf("%s: unable to add %s to the restore package queue: %w", m, bodyStr, err)
 	}
 	return nil
 }
+
+// traceMessageAttributes carries the trace context of ctx to the restore lambda as SQS message attributes.
+func traceMessageAttributes(ctx context.Context) map[string]types.MessageAttributeValue {
+	carrier := tracing.Inject(ctx)
+	if len(carrier) == 0 {
+		return nil
+	}
+	attributes := make(map[string]types.MessageAttributeValue, len(carrier))
+	for key, value := range carrier {
+		attributes[key] = types.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(value)}
+	}
+	return attributes
+}
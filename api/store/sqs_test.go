@@ -0,0 +1,31 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/pennsieve/packages-service/api/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTraceMessageAttributes(t *testing.T) {
+	assert.Nil(t, traceMessageAttributes(context.Background()))
+
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), spanContext)
+
+	attributes := traceMessageAttributes(ctx)
+	require.Contains(t, attributes, "traceparent")
+	assert.Equal(t, "String", aws.ToString(attributes["traceparent"].DataType))
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", aws.ToString(attributes["traceparent"].StringValue))
+
+	carrier := map[string]string{"traceparent": aws.ToString(attributes["traceparent"].StringValue)}
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", tracing.TraceID(tracing.Extract(context.Background(), carrier)))
+}
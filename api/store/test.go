@@ -364,6 +364,82 @@ func TestCreateDeleteRecordTableInput(tableName string) dynamodb.CreateTableInpu
 		BillingMode: dytypes.BillingModePayPerRequest}
 }
 
+func TestCreateDownloadJobTableInput(tableName string) dynamodb.CreateTableInput {
+	return dynamodb.CreateTableInput{TableName: aws.String(tableName),
+		AttributeDefinitions: []dytypes.AttributeDefinition{
+			{
+				AttributeName: aws.String("JobId"),
+				AttributeType: dytypes.ScalarAttributeTypeS,
+			},
+		},
+		KeySchema: []dytypes.KeySchemaElement{
+			{
+				AttributeName: aws.String("JobId"),
+				KeyType:       dytypes.KeyTypeHash,
+			},
+		},
+		BillingMode: dytypes.BillingModePayPerRequest}
+}
+
+func TestCreateDownloadAuditTableInput(tableName string) dynamodb.CreateTableInput {
+	return testCreateDatasetKeyTableInput(tableName, "RecordId")
+}
+
+func TestCreateDownloadUsageTableInput(tableName string) dynamodb.CreateTableInput {
+	return testCreateDatasetKeyTableInput(tableName, "UsageKey")
+}
+
+func TestCreateScanPolicyTableInput(tableName string) dynamodb.CreateTableInput {
+	return dynamodb.CreateTableInput{TableName: aws.String(tableName),
+		AttributeDefinitions: []dytypes.AttributeDefinition{
+			{
+				AttributeName: aws.String("OrgId"),
+				AttributeType: dytypes.ScalarAttributeTypeN,
+			},
+			{
+				AttributeName: aws.String("Scope"),
+				AttributeType: dytypes.ScalarAttributeTypeS,
+			},
+		},
+		KeySchema: []dytypes.KeySchemaElement{
+			{
+				AttributeName: aws.String("OrgId"),
+				KeyType:       dytypes.KeyTypeHash,
+			},
+			{
+				AttributeName: aws.String("Scope"),
+				KeyType:       dytypes.KeyTypeRange,
+			},
+		},
+		BillingMode: dytypes.BillingModePayPerRequest}
+}
+
+// testCreateDatasetKeyTableInput returns the input for a table keyed by DatasetKey and the given sort key.
+func testCreateDatasetKeyTableInput(tableName, sortKey string) dynamodb.CreateTableInput {
+	return dynamodb.CreateTableInput{TableName: aws.String(tableName),
+		AttributeDefinitions: []dytypes.AttributeDefinition{
+			{
+				AttributeName: aws.String("DatasetKey"),
+				AttributeType: dytypes.ScalarAttributeTypeS,
+			},
+			{
+				AttributeName: aws.String(sortKey),
+				AttributeType: dytypes.ScalarAttributeTypeS,
+			},
+		},
+		KeySchema: []dytypes.KeySchemaElement{
+			{
+				AttributeName: aws.String("DatasetKey"),
+				KeyType:       dytypes.KeyTypeHash,
+			},
+			{
+				AttributeName: aws.String(sortKey),
+				KeyType:       dytypes.KeyTypeRange,
+			},
+		},
+		BillingMode: dytypes.BillingModePayPerRequest}
+}
+
 type DynamoDBFixture struct {
 	Fixture
 	Client *dynamodb.Client
@@ -0,0 +1,40 @@
+package tracing
+
+import (
+	"context"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// AppendAWSMiddleware adds a span around every AWS API call made by clients created from the config
+// that owns apiOptions. Pass &cfg.APIOptions before creating any clients.
+func AppendAWSMiddleware(apiOptions *[]func(*middleware.Stack) error) {
+	*apiOptions = append(*apiOptions, addAWSSpan)
+}
+
+func addAWSSpan(stack *middleware.Stack) error {
+	// After, so that the service and operation names have been registered.
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("PackagesServiceTracing", awsSpan), middleware.After)
+}
+
+func awsSpan(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+	service, operation := awsmiddleware.GetServiceID(ctx), awsmiddleware.GetOperationName(ctx)
+	ctx, span := otel.Tracer(instrumentationName).Start(ctx, service+"."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "aws-api"),
+			attribute.String("rpc.service", service),
+			attribute.String("rpc.method", operation),
+			attribute.String("cloud.region", awsmiddleware.GetRegion(ctx)),
+		))
+	out, metadata, err := next.HandleInitialize(ctx, in)
+	if requestID, ok := awsmiddleware.GetRequestIDMetadata(metadata); ok {
+		span.SetAttributes(attribute.String("aws.request_id", requestID))
+	}
+	End(span, err)
+	return out, metadata, err
+}
@@ -0,0 +1,106 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ExporterEnvKey selects where spans are sent: "otlp" for an OTLP/HTTP collector (configured with the standard
+// OTEL_EXPORTER_OTLP_* variables, e.g. OTEL_EXPORTER_OTLP_ENDPOINT=http://localhost:4318), "console" for stdout,
+// or "none". Tracing is off when the variable is unset.
+const ExporterEnvKey = "OTEL_TRACES_EXPORTER"
+
+const instrumentationName = "github.com/pennsieve/packages-service"
+
+var propagator = propagation.TraceContext{}
+
+// provider is set by Init. It is nil when tracing is off, in which case spans are no-ops.
+var provider *sdktrace.TracerProvider
+
+// Init configures the global TracerProvider for serviceName from ExporterEnvKey. Call it once at cold start
+// and call Flush before each invocation returns, since Lambda may freeze the container before a batch is exported.
+func Init(ctx context.Context, serviceName string) error {
+	otel.SetTextMapPropagator(propagator)
+	exporter, err := newExporter(ctx, os.Getenv(ExporterEnvKey))
+	if err != nil || exporter == nil {
+		return err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", serviceName),
+		attribute.String("deployment.environment.name", os.Getenv("ENV")),
+	))
+	if err != nil {
+		return fmt.Errorf("unable to create trace resource: %w", err)
+	}
+	provider = sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	return nil
+}
+
+func newExporter(ctx context.Context, name string) (sdktrace.SpanExporter, error) {
+	switch name {
+	case "", "none":
+		return nil, nil
+	case "console":
+		return stdouttrace.New()
+	case "otlp":
+		return otlptracehttp.New(ctx)
+	default:
+		return nil, fmt.Errorf("unsupported %s value %q", ExporterEnvKey, name)
+	}
+}
+
+// Flush exports any buffered spans. It is a no-op when tracing is off.
+func Flush(ctx context.Context) error {
+	if provider == nil {
+		return nil
+	}
+	return provider.ForceFlush(ctx)
+}
+
+// Start starts a span named name as a child of any span in ctx.
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// End records err, if any, on span and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Inject returns the W3C trace context of ctx as a string map, for sending with a queue message.
+// The map is empty if ctx has no span.
+func Inject(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	return carrier
+}
+
+// Extract returns ctx with the remote span context found in carrier, as produced by Inject.
+func Extract(ctx context.Context, carrier map[string]string) context.Context {
+	return propagator.Extract(ctx, propagation.MapCarrier(carrier))
+}
+
+// TraceID returns the trace ID of the span in ctx, or "" if there is none.
+func TraceID(ctx context.Context) string {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.HasTraceID() {
+		return ""
+	}
+	return spanContext.TraceID().String()
+}
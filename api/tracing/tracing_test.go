@@ -0,0 +1,91 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func setupInMemoryTracing(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+	})
+	return exporter
+}
+
+func TestInjectExtract(t *testing.T) {
+	setupInMemoryTracing(t)
+	ctx, span := Start(context.Background(), "producer")
+	defer span.End()
+
+	carrier := Inject(ctx)
+	assert.Contains(t, carrier, "traceparent")
+
+	consumerCtx := Extract(context.Background(), carrier)
+	assert.Equal(t, TraceID(ctx), TraceID(consumerCtx))
+	assert.Len(t, TraceID(consumerCtx), 32)
+
+	_, childSpan := Start(consumerCtx, "consumer")
+	defer childSpan.End()
+	assert.Equal(t, span.SpanContext().TraceID(), childSpan.SpanContext().TraceID())
+}
+
+func TestNoTraceContext(t *testing.T) {
+	assert.Empty(t, TraceID(context.Background()))
+	assert.Empty(t, Inject(context.Background()))
+	assert.Empty(t, TraceID(Extract(context.Background(), map[string]string{})))
+}
+
+func TestEnd(t *testing.T) {
+	exporter := setupInMemoryTracing(t)
+
+	_, okSpan := Start(context.Background(), "ok")
+	End(okSpan, nil)
+	_, failedSpan := Start(context.Background(), "failed")
+	End(failedSpan, errors.New("boom"))
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	assert.Equal(t, codes.Unset, spans[0].Status.Code)
+	assert.Equal(t, codes.Error, spans[1].Status.Code)
+	assert.Equal(t, "boom", spans[1].Status.Description)
+	assert.Len(t, spans[1].Events, 1, "error should be recorded as an event")
+}
+
+func TestNewExporter(t *testing.T) {
+	for name, tt := range map[string]struct {
+		value       string
+		expectNil   bool
+		expectError bool
+	}{
+		"unset":       {value: "", expectNil: true},
+		"none":        {value: "none", expectNil: true},
+		"console":     {value: "console"},
+		"otlp":        {value: "otlp"},
+		"unsupported": {value: "zipkin", expectNil: true, expectError: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			exporter, err := newExporter(context.Background(), tt.value)
+			if tt.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expectNil, exporter == nil)
+		})
+	}
+}
+
+func TestFlushWithoutInit(t *testing.T) {
+	assert.NoError(t, Flush(context.Background()))
+}
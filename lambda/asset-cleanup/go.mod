@@ -1,14 +1,17 @@
 module github.com/pennsieve/packages-service/asset-cleanup
 
-go 1.23
+go 1.23.0
 
 toolchain go1.23.4
 
+replace github.com/pennsieve/packages-service/api => ../../api
+
 require (
 	github.com/aws/aws-lambda-go v1.38.0
 	github.com/aws/aws-sdk-go-v2 v1.39.6
 	github.com/aws/aws-sdk-go-v2/config v1.31.19
 	github.com/aws/aws-sdk-go-v2/service/s3 v1.90.1
+	github.com/pennsieve/packages-service/api v0.0.0-00010101000000-000000000000
 	github.com/pennsieve/pennsieve-go-core v1.15.0
 	github.com/sirupsen/logrus v1.9.1
 )
@@ -17,7 +20,7 @@ require (
 	github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream v1.7.3 // indirect
 	github.com/aws/aws-sdk-go-v2/credentials v1.18.23 // indirect
 	github.com/aws/aws-sdk-go-v2/feature/ec2/imds v1.18.13 // indirect
-	github.com/aws/aws-sdk-go-v2/feature/rds/auth v1.2.7 // indirect
+	github.com/aws/aws-sdk-go-v2/feature/rds/auth v1.6.13 // indirect
 	github.com/aws/aws-sdk-go-v2/internal/configsources v1.4.13 // indirect
 	github.com/aws/aws-sdk-go-v2/internal/endpoints/v2 v2.7.13 // indirect
 	github.com/aws/aws-sdk-go-v2/internal/ini v1.8.4 // indirect
@@ -30,7 +33,7 @@ require (
 	github.com/aws/aws-sdk-go-v2/service/ssooidc v1.35.6 // indirect
 	github.com/aws/aws-sdk-go-v2/service/sts v1.40.1 // indirect
 	github.com/aws/smithy-go v1.23.2 // indirect
-	github.com/google/uuid v1.3.0 // indirect
+	github.com/google/uuid v1.6.0 // indirect
 	github.com/lib/pq v1.10.7 // indirect
-	golang.org/x/sys v0.15.0 // indirect
+	golang.org/x/sys v0.35.0 // indirect
 )
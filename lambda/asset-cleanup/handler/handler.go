@@ -8,12 +8,14 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/pennsieve/packages-service/api/metrics"
 	log "github.com/sirupsen/logrus"
 )
 
 var (
 	PennsieveDB *sql.DB
 	S3Client    *s3.Client
+	Metrics     *metrics.Recorder
 )
 
 type cleanupEntry struct {
@@ -23,6 +25,11 @@ type cleanupEntry struct {
 }
 
 func HandleCleanup(ctx context.Context) error {
+	defer func() {
+		if err := Metrics.Flush(); err != nil {
+			log.Warnf("unable to flush metrics: %v", err)
+		}
+	}()
 	for {
 		entries, err := fetchCleanupEntries(ctx)
 		if err != nil {
@@ -44,15 +51,18 @@ func HandleCleanup(ctx context.Context) error {
 			}).Info("cleaning up S3 objects for deleted viewer asset")
 
 			if err := deleteS3Prefix(ctx, entry.S3Bucket, entry.S3Prefix); err != nil {
+				Metrics.Count("CleanupEntriesFailed", 1, metrics.Dim("Stage", "DeleteObjects"))
 				log.WithError(err).WithField("entryID", entry.ID).Error("failed to delete S3 objects, will retry next run")
 				continue
 			}
 
 			if err := removeCleanupEntry(ctx, entry.ID); err != nil {
+				Metrics.Count("CleanupEntriesFailed", 1, metrics.Dim("Stage", "RemoveEntry"))
 				log.WithError(err).WithField("entryID", entry.ID).Error("failed to remove cleanup entry")
 				continue
 			}
 
+			Metrics.Count("CleanupEntriesProcessed", 1)
 			log.WithField("entryID", entry.ID).Info("cleanup complete")
 		}
 	}
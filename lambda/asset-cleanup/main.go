@@ -8,6 +8,7 @@ import (
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/pennsieve/packages-service/api/metrics"
 	"github.com/pennsieve/packages-service/asset-cleanup/handler"
 	"github.com/pennsieve/pennsieve-go-core/pkg/queries/pgdb"
 	log "github.com/sirupsen/logrus"
@@ -35,6 +36,7 @@ func init() {
 	}
 	log.Info("connected to RDS database")
 	handler.PennsieveDB = db
+	handler.Metrics = metrics.NewFromEnv("viewer-asset-cleanup")
 
 	region := os.Getenv("REGION")
 	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(region))
@@ -0,0 +1,223 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/pennsieve/packages-service/api/manifest"
+	"github.com/pennsieve/packages-service/api/metrics"
+	"github.com/pennsieve/packages-service/api/models"
+	"github.com/pennsieve/packages-service/api/store"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxArchiveSize is the largest selection, in bytes, that an archive job will accept. The archive is
+// written by a single Lambda invocation that reads, compresses and uploads one part at a time, at a few
+// tens of MB/s, so this leaves room for slow buckets within its 15 minute timeout. Larger selections can
+// still be downloaded with a manifest.
+const maxArchiveSize int64 = 5 * 1024 * 1024 * 1024
+
+// archiveAbortMargin is how long before the Lambda times out that an archive job stops writing, so that
+// its multipart upload can be aborted and the job failed rather than left running when the Lambda is stopped.
+const archiveAbortMargin = 30 * time.Second
+
+const (
+	archiveFileName    = "archive.zip"
+	archiveContentType = "application/zip"
+)
+
+// archiveSource opens the source file of a manifest row for reading.
+type archiveSource interface {
+	Open(ctx context.Context, row models.PackageHierarchyRow) (io.ReadCloser, error)
+}
+
+// s3ArchiveSource reads source files from their storage buckets, using the same bucket regions and
+// external bucket roles as the presigned URLs of a manifest. It tallies the files it opens for the download audit log.
+type s3ArchiveSource struct {
+	client        *s3.Client
+	bucketOptions *manifest.BucketOptionsCache
+	issued        manifest.Issued
+}
+
+func (s *s3ArchiveSource) Open(ctx context.Context, row models.PackageHierarchyRow) (io.ReadCloser, error) {
+	bucketOptions, err := s.bucketOptions.Get(ctx, row.S3Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bucket options for bucket=%s: %w", row.S3Bucket, err)
+	}
+	output, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket:       aws.String(row.S3Bucket),
+		Key:          aws.String(row.S3Key),
+		VersionId:    row.PublishedS3VersionId,
+		RequestPayer: bucketOptions.RequestPayer,
+	}, bucketOptions.S3Options())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bucket=%s key=%s: %w", row.S3Bucket, row.S3Key, err)
+	}
+	s.issued.Add(row, bucketOptions)
+	return output.Body, nil
+}
+
+// runArchiveJob streams the source files of the job's selection into a ZIP archive in the download jobs
+// bucket, each at the target path of its manifest entry. Files withheld because of their scan
+// status or the download quotas are left out of the archive and listed in a JSON Lines object as
+// for a manifest job.
+func (h *MessageHandler) runArchiveJob(ctx context.Context, job *models.DownloadJob) (header models.DownloadManifestHeader, resultKey, blockedKey string, err error) {
+	bucket := os.Getenv(store.DownloadJobsBucketEnvKey)
+	if bucket == "" {
+		return header, "", "", fmt.Errorf("%s not set", store.DownloadJobsBucketEnvKey)
+	}
+	filter, err := manifest.NewFilter(job.Filter)
+	if err != nil {
+		return header, "", "", err
+	}
+
+	objectTypes, err := manifest.ParseObjectTypes(job.ObjectTypes)
+	if err != nil {
+		return header, "", "", err
+	}
+	rows, err := manifest.GetPackageHierarchy(ctx, PennsieveDB, job.OrgId, job.DatasetNodeId, job.NodeIds, objectTypes)
+	if err != nil {
+		return header, "", "", err
+	}
+	rows = filter.Apply(rows)
+	scanPolicy, err := h.scanPolicy(ctx, job)
+	if err != nil {
+		return header, "", "", err
+	}
+	var size int64
+	for _, row := range rows {
+		if !scanPolicy.Blocks(row) {
+			size += row.Size
+		}
+	}
+	if size > maxArchiveSize {
+		return header, "", "", fmt.Errorf("selection is %d bytes, more than the %d byte limit for an archive; download it with a manifest instead", size, maxArchiveSize)
+	}
+	quota, err := h.downloadQuota(ctx, job)
+	if err != nil {
+		return header, "", "", err
+	}
+
+	ctx, cancel := archiveContext(ctx)
+	defer cancel()
+	resultKey = downloadJobKey(job.JobId, archiveFileName)
+	archive, err := newResultWriter(ctx, bucket, resultKey, archiveFileName, archiveContentType)
+	if err != nil {
+		return header, "", "", err
+	}
+	source := &s3ArchiveSource{
+		client:        S3Client,
+		bucketOptions: BucketOptions,
+	}
+	var blocked bytes.Buffer
+	header, err = writeArchive(ctx, source, scanPolicy, quota, job.CreatedAt, rows, archive, &blocked)
+	if err == nil {
+		err = archive.Close()
+	}
+	if err != nil {
+		if abortErr := archive.Abort(); abortErr != nil {
+			h.LogWarnWithFields(log.Fields{"error": abortErr}, "unable to abort archive upload")
+		}
+		return header, "", "", err
+	}
+	if err := h.recordIssuance(ctx, job, models.DownloadAuditArchiveJob, source.issued.Buckets()); err != nil {
+		return header, "", "", err
+	}
+	if header.UnavailableCount, err = manifest.CountUnavailableDescendants(ctx, PennsieveDB, job.OrgId, job.DatasetNodeId, job.NodeIds); err != nil {
+		return header, "", "", err
+	}
+
+	if header.BlockedCount > 0 {
+		blockedKey = downloadJobKey(job.JobId, blockedFileName)
+		if err := putResult(ctx, bucket, blockedKey, blockedFileName, jsonLinesContentType, &blocked); err != nil {
+			return header, "", "", err
+		}
+	}
+	Metrics.Count("ArchiveFiles", header.Count)
+	Metrics.Bytes("ArchiveBytes", header.Size)
+	return header, resultKey, blockedKey, nil
+}
+
+// archiveContext returns ctx with a deadline archiveAbortMargin before that of ctx, if it has one.
+func archiveContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadline(ctx, deadline.Add(-archiveAbortMargin))
+}
+
+// writeArchive writes a ZIP archive of the source file of each downloadable row, at its target path,
+// to archive, and a JSON Lines blocked entry for each row that scanPolicy withholds or that does not
+// fit in quota to blocked. A nil quota has no limits. Entries are given modified as their modification time.
+func writeArchive(ctx context.Context, source archiveSource, scanPolicy manifest.ScanPolicy, quota *manifest.Quota, modified time.Time, rows []models.PackageHierarchyRow, archive, blocked io.Writer) (models.DownloadManifestHeader, error) {
+	header := models.DownloadManifestHeader{}
+	zipWriter := zip.NewWriter(archive)
+	// Most research data is already compressed, so favour throughput over ratio.
+	zipWriter.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(out, flate.BestSpeed)
+	})
+	blockedEncoder := json.NewEncoder(blocked)
+	manifest.AssignTargetPaths(rows, scanPolicy)
+	for _, row := range rows {
+		if scanPolicy.Blocks(row) {
+			blockedEntry := scanPolicy.BlockedEntry(row)
+			Metrics.Count("BlockedByScan", 1, metrics.Dim("ScanStatus", blockedEntry.ScanStatus))
+			if err := blockedEncoder.Encode(blockedEntry); err != nil {
+				return header, fmt.Errorf("failed to write blocked entry for %s: %w", row.NodeId, err)
+			}
+			header.BlockedCount++
+			continue
+		}
+		if !quota.Take(row.Size) {
+			Metrics.Count("BlockedByQuota", 1)
+			if err := blockedEncoder.Encode(manifest.NewQuotaBlockedEntry(row)); err != nil {
+				return header, fmt.Errorf("failed to write blocked entry for %s: %w", row.NodeId, err)
+			}
+			header.BlockedCount++
+			continue
+		}
+		written, err := writeArchiveEntry(ctx, zipWriter, source, modified, row)
+		if err != nil {
+			return header, err
+		}
+		header.Count++
+		header.Size += written
+	}
+	if err := zipWriter.Close(); err != nil {
+		return header, fmt.Errorf("failed to finish archive: %w", err)
+	}
+	header.Quota = quota.Remaining()
+	return header, nil
+}
+
+func writeArchiveEntry(ctx context.Context, zipWriter *zip.Writer, source archiveSource, modified time.Time, row models.PackageHierarchyRow) (int64, error) {
+	name := row.TargetPath
+	entryWriter, err := zipWriter.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modified,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to add %s to archive: %w", name, err)
+	}
+	reader, err := source.Open(ctx, row)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+	written, err := io.Copy(entryWriter, reader)
+	if err != nil {
+		return written, fmt.Errorf("failed to copy bucket=%s key=%s into archive: %w", row.S3Bucket, row.S3Key, err)
+	}
+	return written, nil
+}
@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pennsieve/packages-service/api/manifest"
+	"github.com/pennsieve/packages-service/api/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mapArchiveSource serves source files from memory, keyed by S3 key.
+type mapArchiveSource map[string]string
+
+func (s mapArchiveSource) Open(_ context.Context, row models.PackageHierarchyRow) (io.ReadCloser, error) {
+	content, ok := s[row.S3Key]
+	if !ok {
+		return nil, fmt.Errorf("no such key: %s", row.S3Key)
+	}
+	return io.NopCloser(strings.NewReader(content)), nil
+}
+
+func TestWriteArchive(t *testing.T) {
+	rows := []models.PackageHierarchyRow{
+		{
+			NodeId: "N:package:single", PackageName: "data.csv", PackageFileCount: 1, PackageNamePath: []string{"root"},
+			FileId: 1, FileName: "data.csv", S3Bucket: "pennsieve-test-storage", S3Key: "org2/data.csv",
+			ScanStatus: sql.NullString{String: "clean", Valid: true},
+		},
+		{
+			NodeId: "N:package:infected", PackageName: "bad.exe", PackageFileCount: 1,
+			FileId: 2, FileName: "bad.exe", S3Bucket: "pennsieve-test-storage", S3Key: "org2/bad.exe",
+			ScanStatus: sql.NullString{String: "infected", Valid: true},
+		},
+		{
+			NodeId: "N:package:multi", PackageName: "recording", PackageFileCount: 2, PackageNamePath: []string{"root"},
+			FileId: 3, FileName: "part1.ome.tiff", S3Bucket: "pennsieve-test-storage", S3Key: "org2/part1.ome.tiff",
+		},
+		{
+			NodeId: "N:package:multi", PackageName: "recording", PackageFileCount: 2, PackageNamePath: []string{"root"},
+			FileId: 4, FileName: "part2.ome.tiff", S3Bucket: "pennsieve-test-storage", S3Key: "org2/part2.ome.tiff",
+		},
+	}
+	source := mapArchiveSource{
+		"org2/data.csv":       "a,b\n1,2\n",
+		"org2/part1.ome.tiff": strings.Repeat("part one ", 1000),
+		"org2/part2.ome.tiff": "part two",
+	}
+	modified := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	var archive, blocked bytes.Buffer
+	header, err := writeArchive(context.Background(), source, manifest.ScanPolicy{}, nil, modified, rows, &archive, &blocked)
+	require.NoError(t, err)
+	expectedSize := int64(len(source["org2/data.csv"]) + len(source["org2/part1.ome.tiff"]) + len(source["org2/part2.ome.tiff"]))
+	assert.Equal(t, models.DownloadManifestHeader{Count: 3, Size: expectedSize, BlockedCount: 1}, header)
+
+	zipReader, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	require.NoError(t, err)
+	contents := map[string]string{}
+	for _, file := range zipReader.File {
+		reader, err := file.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		require.NoError(t, reader.Close())
+		contents[file.Name] = string(content)
+		assert.True(t, modified.Equal(file.Modified), "entry %s has modified time %s", file.Name, file.Modified)
+	}
+	assert.Equal(t, map[string]string{
+		"root/data.csv":                 source["org2/data.csv"],
+		"root/recording/part1.ome.tiff": source["org2/part1.ome.tiff"],
+		"root/recording/part2.ome.tiff": source["org2/part2.ome.tiff"],
+	}, contents)
+
+	blockedLines := decodeLines[models.DownloadManifestBlockedEntry](t, &blocked)
+	require.Len(t, blockedLines, 1)
+	assert.Equal(t, "N:package:infected", blockedLines[0].NodeId)
+}
+
+func TestWriteArchive_Quota(t *testing.T) {
+	rows := []models.PackageHierarchyRow{
+		{NodeId: "N:package:one", PackageName: "one.csv", PackageFileCount: 1, FileId: 1, FileName: "one.csv", Size: 3, S3Key: "org2/one.csv"},
+		{NodeId: "N:package:two", PackageName: "two.csv", PackageFileCount: 1, FileId: 2, FileName: "two.csv", Size: 3, S3Key: "org2/two.csv"},
+	}
+	source := mapArchiveSource{"org2/one.csv": "one", "org2/two.csv": "two"}
+	quota := manifest.NewQuota(manifest.QuotaLimits{DatasetMonthlyBytes: 10}, 0, 5)
+
+	var archive, blocked bytes.Buffer
+	header, err := writeArchive(context.Background(), source, manifest.ScanPolicy{}, quota, time.Now(), rows, &archive, &blocked)
+	require.NoError(t, err)
+	assert.Equal(t, 1, header.Count)
+	assert.Equal(t, 1, header.BlockedCount)
+	require.NotNil(t, header.Quota)
+	assert.Equal(t, int64(2), *header.Quota.DatasetMonthlyRemainingBytes)
+
+	zipReader, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	require.NoError(t, err)
+	require.Len(t, zipReader.File, 1)
+	assert.Equal(t, "one.csv", zipReader.File[0].Name)
+	blockedLines := decodeLines[models.DownloadManifestBlockedEntry](t, &blocked)
+	require.Len(t, blockedLines, 1)
+	assert.Equal(t, "N:package:two", blockedLines[0].NodeId)
+	assert.Equal(t, models.DownloadBlockedReasonQuotaExceeded, blockedLines[0].Reason)
+}
+
+func TestWriteArchive_SourceError(t *testing.T) {
+	rows := []models.PackageHierarchyRow{
+		{NodeId: "N:package:missing", PackageName: "missing.csv", PackageFileCount: 1, FileId: 1, S3Key: "org2/missing.csv"},
+	}
+	var archive, blocked bytes.Buffer
+	_, err := writeArchive(context.Background(), mapArchiveSource{}, manifest.ScanPolicy{}, nil, time.Now(), rows, &archive, &blocked)
+	assert.ErrorContains(t, err, "org2/missing.csv")
+}
+
+func TestWriteArchive_CollidingPaths(t *testing.T) {
+	rows := []models.PackageHierarchyRow{
+		{NodeId: "N:package:one", PackageName: "data.csv", PackageFileCount: 1, FileId: 1, FileName: "data.csv", S3Key: "org2/one.csv"},
+		{NodeId: "N:package:two", PackageName: "data.csv", PackageFileCount: 1, FileId: 2, FileName: "data.csv", S3Key: "org2/two.csv"},
+	}
+	source := mapArchiveSource{"org2/one.csv": "one", "org2/two.csv": "two"}
+
+	var archive, blocked bytes.Buffer
+	_, err := writeArchive(context.Background(), source, manifest.ScanPolicy{}, nil, time.Now(), rows, &archive, &blocked)
+	require.NoError(t, err)
+
+	zipReader, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	require.NoError(t, err)
+	var names []string
+	for _, file := range zipReader.File {
+		names = append(names, file.Name)
+	}
+	assert.Equal(t, []string{"data.csv", "data (1).csv"}, names)
+}
+
+func TestArchiveContext(t *testing.T) {
+	deadline := time.Now().Add(time.Minute)
+	lambdaCtx, cancelLambda := context.WithDeadline(context.Background(), deadline)
+	defer cancelLambda()
+	ctx, cancel := archiveContext(lambdaCtx)
+	defer cancel()
+	archiveDeadline, ok := ctx.Deadline()
+	require.True(t, ok)
+	assert.Equal(t, deadline.Add(-archiveAbortMargin), archiveDeadline)
+
+	noDeadlineCtx, cancel := archiveContext(context.Background())
+	defer cancel()
+	_, ok = noDeadlineCtx.Deadline()
+	assert.False(t, ok)
+}
@@ -0,0 +1,397 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	pennsievelog "github.com/pennsieve/packages-service/api/logging"
+	"github.com/pennsieve/packages-service/api/manifest"
+	"github.com/pennsieve/packages-service/api/metrics"
+	"github.com/pennsieve/packages-service/api/models"
+	"github.com/pennsieve/packages-service/api/regions"
+	"github.com/pennsieve/packages-service/api/store"
+	"github.com/pennsieve/packages-service/api/tracing"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const m = "download-jobs/handler"
+
+// jsonLinesContentType is the content type of the JSON Lines list of blocked files.
+const jsonLinesContentType = "application/x-ndjson"
+
+// blockedFileName is the name of the list of blocked files of a job, under jobs/{jobId}/ in the download jobs bucket.
+const blockedFileName = "blocked.jsonl"
+
+var PennsieveDB *sql.DB
+var S3Client *s3.Client
+var AssumeRoleClient stscreds.AssumeRoleAPIClient
+var DyDBClient *dynamodb.Client
+var BucketRegions *regions.Resolver
+var BucketOptions *manifest.BucketOptionsCache
+var ScanPolicies *store.ScanPolicyStore
+var Metrics *metrics.Recorder
+
+func DownloadJobsHandler(ctx context.Context, event events.SQSEvent) (events.SQSEventResponse, error) {
+	defer func() {
+		if err := Metrics.Flush(); err != nil {
+			log.Warnf("unable to flush metrics: %v", err)
+		}
+		if err := tracing.Flush(ctx); err != nil {
+			log.Warnf("unable to flush traces: %v", err)
+		}
+	}()
+	jobStore := store.NewDownloadJobStore(DyDBClient, nil, os.Getenv(store.DownloadJobsTableNameEnvKey), "")
+	response := events.SQSEventResponse{
+		BatchItemFailures: []events.SQSBatchItemFailure{},
+	}
+	for _, r := range event.Records {
+		handler := NewMessageHandler(r, jobStore)
+		if err := handler.handleMessage(ctx); err != nil {
+			handler.LogError(err)
+			response.BatchItemFailures = append(response.BatchItemFailures, handler.newBatchItemFailure())
+		}
+	}
+	return response, nil
+}
+
+type MessageHandler struct {
+	Message events.SQSMessage
+	Jobs    store.DownloadJobs
+	*pennsievelog.Log
+}
+
+func NewMessageHandler(message events.SQSMessage, jobStore *store.DownloadJobStore) *MessageHandler {
+	plog := pennsievelog.NewLogWithFields(log.Fields{
+		"messageId": message.MessageId,
+	})
+	handler := MessageHandler{
+		Message: message,
+		Jobs:    jobStore.WithLogging(plog),
+		Log:     plog,
+	}
+	handler.LogInfoWithFields(log.Fields{"body": message.Body}, "received message")
+	return &handler
+}
+
+// handleMessage runs the job named in the message. An error is only returned, and so the message only
+// retried, if the job's record could not be read or updated. Errors running the job itself are recorded
+// on the job as a failure for the client to see, since a retry would most likely fail the same way.
+func (h *MessageHandler) handleMessage(ctx context.Context) (err error) {
+	// Continue the trace of the service lambda request that queued this message.
+	ctx, span := tracing.Start(tracing.Extract(ctx, h.traceCarrier()), "DownloadJobMessage",
+		attribute.String("messaging.message.id", h.Message.MessageId))
+	defer func() {
+		tracing.End(span, err)
+	}()
+	message := models.DownloadJobMessage{}
+	if err := json.Unmarshal([]byte(h.Message.Body), &message); err != nil {
+		return h.errorf("could not unmarshal message [%s]: %w", h.Message.Body, err)
+	}
+	span.SetAttributes(attribute.String("pennsieve.download_job_id", message.JobId))
+
+	job, err := h.Jobs.StartJob(ctx, message.JobId)
+	if err != nil {
+		if errors.Is(err, store.ErrDownloadJobStateConflict) {
+			// A redelivered message for a job that has already been picked up.
+			h.LogWarnWithFields(log.Fields{"jobId": message.JobId, "error": err}, "skipping download job")
+			return nil
+		}
+		return h.errorf("could not start download job %s: %w", message.JobId, err)
+	}
+	h.Log = &pennsievelog.Log{Entry: h.WithFields(log.Fields{"jobId": job.JobId, "orgId": job.OrgId, "datasetId": job.DatasetNodeId})}
+
+	kind := metrics.Dim("Kind", string(job.Kind))
+	start := time.Now()
+	header, resultKey, blockedKey, runErr := h.runJob(ctx, job)
+	if runErr != nil {
+		Metrics.Count("DownloadJobFailures", 1, kind)
+		h.LogErrorWithFields(log.Fields{"error": runErr}, "download job failed")
+		if err := h.Jobs.FailJob(ctx, job.JobId, runErr); err != nil {
+			return h.errorf("could not record failure of download job %s: %w", job.JobId, err)
+		}
+		return nil
+	}
+	Metrics.Duration("DownloadJobDuration", time.Since(start), kind)
+	if err := h.Jobs.CompleteJob(ctx, job.JobId, header, resultKey, blockedKey); err != nil {
+		return h.errorf("could not record completion of download job %s: %w", job.JobId, err)
+	}
+	h.LogInfoWithFields(log.Fields{"count": header.Count, "size": header.Size, "blockedCount": header.BlockedCount}, "download job completed")
+	return nil
+}
+
+func (h *MessageHandler) runJob(ctx context.Context, job *models.DownloadJob) (header models.DownloadManifestHeader, resultKey, blockedKey string, err error) {
+	switch job.Kind {
+	case models.DownloadJobKindManifest:
+		return h.runManifestJob(ctx, job)
+	case models.DownloadJobKindArchive:
+		return h.runArchiveJob(ctx, job)
+	default:
+		return models.DownloadManifestHeader{}, "", "", fmt.Errorf("unknown download job kind %q", job.Kind)
+	}
+}
+
+// runManifestJob writes the manifest of the job's selection to the download jobs bucket in the job's format:
+// JSON Lines of models.DownloadManifestEntry unless another was requested. Files withheld because of their scan
+// status or the download quotas are written to a second object of models.DownloadManifestBlockedEntry lines,
+// which is omitted if there are none.
+func (h *MessageHandler) runManifestJob(ctx context.Context, job *models.DownloadJob) (header models.DownloadManifestHeader, resultKey, blockedKey string, err error) {
+	bucket := os.Getenv(store.DownloadJobsBucketEnvKey)
+	if bucket == "" {
+		return header, "", "", fmt.Errorf("%s not set", store.DownloadJobsBucketEnvKey)
+	}
+	format := manifest.FormatJSON
+	if job.Format != "" {
+		if format, err = manifest.ParseFormat(job.Format); err != nil {
+			return header, "", "", err
+		}
+	}
+	expiryPolicy, err := manifest.LoadPresignExpiryPolicyFromEnv()
+	if err != nil {
+		return header, "", "", err
+	}
+	filter, err := manifest.NewFilter(job.Filter)
+	if err != nil {
+		return header, "", "", err
+	}
+
+	objectTypes, err := manifest.ParseObjectTypes(job.ObjectTypes)
+	if err != nil {
+		return header, "", "", err
+	}
+	rows, err := manifest.GetPackageHierarchy(ctx, PennsieveDB, job.OrgId, job.DatasetNodeId, job.NodeIds, objectTypes)
+	if err != nil {
+		return header, "", "", err
+	}
+	rows = filter.Apply(rows)
+	scanPolicy, err := h.scanPolicy(ctx, job)
+	if err != nil {
+		return header, "", "", err
+	}
+
+	quota, err := h.downloadQuota(ctx, job)
+	if err != nil {
+		return header, "", "", err
+	}
+
+	presigner := manifest.NewPresigner(S3Client, BucketOptions).
+		WithETagChecksums().
+		WithExpiry(manifest.PresignExpiry{
+			Policy:    expiryPolicy,
+			OrgId:     job.OrgId,
+			Requested: time.Duration(job.PresignExpirySeconds) * time.Second,
+		})
+	// The manifest and blocked entries are streamed to S3 as they are written, since jobs are for selections
+	// too large to render in memory. Neither object appears until its upload completes.
+	resultKey = downloadJobKey(job.JobId, format.FileName())
+	entries, err := newResultWriter(ctx, bucket, resultKey, format.FileName(), format.ContentType())
+	if err != nil {
+		return header, "", "", err
+	}
+	defer h.abortUpload(entries)
+	blocked, err := newResultWriter(ctx, bucket, downloadJobKey(job.JobId, blockedFileName), blockedFileName, jsonLinesContentType)
+	if err != nil {
+		return header, "", "", err
+	}
+	defer h.abortUpload(blocked)
+
+	header, err = writeManifest(ctx, presigner, scanPolicy, quota, rows, format.NewEntryWriter(entries), blocked)
+	if err != nil {
+		return header, "", "", err
+	}
+	if header.UnavailableCount, err = manifest.CountUnavailableDescendants(ctx, PennsieveDB, job.OrgId, job.DatasetNodeId, job.NodeIds); err != nil {
+		return header, "", "", err
+	}
+	if err := h.recordIssuance(ctx, job, models.DownloadAuditManifestJob, presigner.Issued()); err != nil {
+		return header, "", "", err
+	}
+
+	if err := entries.Close(); err != nil {
+		return header, "", "", err
+	}
+	if header.BlockedCount > 0 {
+		if err := blocked.Close(); err != nil {
+			return header, "", "", err
+		}
+		blockedKey = blocked.key
+	}
+	Metrics.Count("ManifestFiles", header.Count)
+	Metrics.Bytes("ManifestBytes", header.Size)
+	return header, resultKey, blockedKey, nil
+}
+
+// writeManifest writes a manifest entry for each downloadable row to entries, and a JSON Lines
+// blocked entry for each row that scanPolicy withholds or that does not fit in quota to blocked.
+// A nil quota has no limits.
+func writeManifest(ctx context.Context, presigner *manifest.Presigner, scanPolicy manifest.ScanPolicy, quota *manifest.Quota, rows []models.PackageHierarchyRow, entries manifest.EntryWriter, blocked io.Writer) (models.DownloadManifestHeader, error) {
+	header := models.DownloadManifestHeader{}
+	blockedEncoder := json.NewEncoder(blocked)
+	manifest.AssignTargetPaths(rows, scanPolicy)
+	for _, row := range rows {
+		if scanPolicy.Blocks(row) {
+			blockedEntry := scanPolicy.BlockedEntry(row)
+			Metrics.Count("BlockedByScan", 1, metrics.Dim("ScanStatus", blockedEntry.ScanStatus))
+			if err := blockedEncoder.Encode(blockedEntry); err != nil {
+				return header, fmt.Errorf("failed to write blocked entry for %s: %w", row.NodeId, err)
+			}
+			header.BlockedCount++
+			continue
+		}
+		if !quota.Take(row.Size) {
+			Metrics.Count("BlockedByQuota", 1)
+			if err := blockedEncoder.Encode(manifest.NewQuotaBlockedEntry(row)); err != nil {
+				return header, fmt.Errorf("failed to write blocked entry for %s: %w", row.NodeId, err)
+			}
+			header.BlockedCount++
+			continue
+		}
+		entry, err := presigner.Entry(ctx, row)
+		if err != nil {
+			Metrics.Count("PresignFailures", 1, metrics.Dim("Bucket", row.S3Bucket))
+			return header, err
+		}
+		if err := entries.Write(entry); err != nil {
+			return header, fmt.Errorf("failed to write manifest entry for %s: %w", row.NodeId, err)
+		}
+		header.Count++
+		header.Size += row.Size
+	}
+	if err := entries.Flush(); err != nil {
+		return header, fmt.Errorf("failed to write manifest: %w", err)
+	}
+	header.Quota = quota.Remaining()
+	return header, nil
+}
+
+// scanPolicy returns the scan policy of the job's dataset, which is the permissive policy unless the dataset or
+// its organization has another.
+func (h *MessageHandler) scanPolicy(ctx context.Context, job *models.DownloadJob) (manifest.ScanPolicy, error) {
+	// Without the store, the job fails rather than treating every dataset as permissive.
+	if ScanPolicies == nil {
+		return manifest.ScanPolicy{}, fmt.Errorf("scan policies not configured")
+	}
+	stored, err := ScanPolicies.WithLogging(h.Log).GetScanPolicy(ctx, job.OrgId, job.DatasetNodeId)
+	if err != nil {
+		return manifest.ScanPolicy{}, fmt.Errorf("failed to get scan policy: %w", err)
+	}
+	return manifest.NewScanPolicy(stored)
+}
+
+// recordIssuance records the files that the job issued download URLs, or an archive, for in the download
+// audit log. The job fails if they cannot be recorded, so that its result is never handed out unrecorded.
+func (h *MessageHandler) recordIssuance(ctx context.Context, job *models.DownloadJob, source models.DownloadAuditSource, buckets []models.DownloadIssuanceBucket) error {
+	if len(buckets) == 0 {
+		return nil
+	}
+	auditStore := store.NewDownloadAuditStoreFromEnv(DyDBClient)
+	if auditStore == nil {
+		h.LogWarn(fmt.Sprintf("%s or %s not set; not recording download issuance", store.DownloadAuditTableNameEnvKey, store.DownloadUsageTableNameEnvKey))
+		return nil
+	}
+	if err := auditStore.WithLogging(h.Log).RecordIssuance(ctx, models.DownloadIssuance{
+		OrgId:         job.OrgId,
+		DatasetNodeId: job.DatasetNodeId,
+		UserNodeId:    job.UserNodeId,
+		Source:        source,
+		RequestId:     job.JobId,
+		IssuedAt:      time.Now(),
+		Buckets:       buckets,
+	}); err != nil {
+		return fmt.Errorf("failed to record download issuance: %w", err)
+	}
+	return nil
+}
+
+// downloadQuota returns what is left of the download quotas of the job's user and dataset, or nil if no quota
+// applies to the job's organization. Quotas are taken from as of when the job runs, since that is when its
+// files are issued. Usage is read from the download audit, so quotas are not enforced if it is not configured.
+func (h *MessageHandler) downloadQuota(ctx context.Context, job *models.DownloadJob) (*manifest.Quota, error) {
+	policy, err := manifest.LoadDownloadQuotaPolicyFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	limits := policy.Limits(job.OrgId)
+	if limits == (manifest.QuotaLimits{}) {
+		return nil, nil
+	}
+	auditStore := store.NewDownloadAuditStoreFromEnv(DyDBClient)
+	if auditStore == nil {
+		h.LogWarn(fmt.Sprintf("%s or %s not set; not enforcing download quotas", store.DownloadAuditTableNameEnvKey, store.DownloadUsageTableNameEnvKey))
+		return nil, nil
+	}
+	quota, err := manifest.GetQuota(ctx, auditStore.WithLogging(h.Log), limits, job.UserNodeId, job.DatasetNodeId, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get download quota usage: %w", err)
+	}
+	return quota, nil
+}
+
+func downloadJobKey(jobId, name string) string {
+	return fmt.Sprintf("jobs/%s/%s", jobId, name)
+}
+
+// newResultWriter starts the multipart upload of a job result to key, which is downloaded as fileName.
+func newResultWriter(ctx context.Context, bucket, key, fileName, contentType string) (*multipartWriter, error) {
+	return newMultipartWriter(ctx, S3Client, &s3.CreateMultipartUploadInput{
+		Bucket:             aws.String(bucket),
+		Key:                aws.String(key),
+		ContentType:        aws.String(contentType),
+		ContentDisposition: aws.String(fmt.Sprintf(`attachment; filename="%s"`, fileName)),
+	}, multipartPartSize)
+}
+
+// abortUpload discards upload unless it completed, logging rather than returning failures, since the parts of
+// an abandoned upload are only storage to clean up.
+func (h *MessageHandler) abortUpload(upload *multipartWriter) {
+	if err := upload.Abort(); err != nil {
+		h.LogWarnWithFields(log.Fields{"error": err}, "unable to abort result upload")
+	}
+}
+
+func putResult(ctx context.Context, bucket, key, fileName, contentType string, body *bytes.Buffer) error {
+	if _, err := S3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:             aws.String(bucket),
+		Key:                aws.String(key),
+		Body:               bytes.NewReader(body.Bytes()),
+		ContentType:        aws.String(contentType),
+		ContentDisposition: aws.String(fmt.Sprintf(`attachment; filename="%s"`, fileName)),
+	}); err != nil {
+		return fmt.Errorf("failed to write s3://%s/%s: %w", bucket, key, err)
+	}
+	return nil
+}
+
+// traceCarrier returns the string message attributes of the SQS message, which carry the trace context
+// added by the service lambda.
+func (h *MessageHandler) traceCarrier() map[string]string {
+	carrier := make(map[string]string, len(h.Message.MessageAttributes))
+	for key, value := range h.Message.MessageAttributes {
+		if value.StringValue != nil {
+			carrier[key] = *value.StringValue
+		}
+	}
+	return carrier
+}
+
+func (h *MessageHandler) newBatchItemFailure() events.SQSBatchItemFailure {
+	return events.SQSBatchItemFailure{ItemIdentifier: h.Message.MessageId}
+}
+
+func (h *MessageHandler) errorf(format string, args ...any) error {
+	expanded := make([]any, len(args)+1)
+	expanded[0] = m
+	copy(expanded[1:], args)
+	return fmt.Errorf("%s: "+format, expanded...)
+}
@@ -0,0 +1,219 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/pennsieve/packages-service/api/manifest"
+	"github.com/pennsieve/packages-service/api/models"
+	"github.com/pennsieve/packages-service/api/regions"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func testPresigner() *manifest.Presigner {
+	s3Client := s3.NewFromConfig(aws.Config{
+		Region:      "us-east-1",
+		Credentials: credentials.NewStaticCredentialsProvider("awstestkey", "awstestsecret", ""),
+	})
+	bucketRegions := regions.NewResolver(nil, map[string]string{"pennsieve-test-storage": "us-east-1"})
+	return manifest.NewPresigner(s3Client, manifest.NewBucketOptionsCache(nil, bucketRegions, manifest.STSCredentialsDuration, nil))
+}
+
+func decodeLines[T any](t *testing.T, r io.Reader) []T {
+	t.Helper()
+	var lines []T
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var line T
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		lines = append(lines, line)
+	}
+	require.NoError(t, scanner.Err())
+	return lines
+}
+
+func TestWriteManifest(t *testing.T) {
+	rows := []models.PackageHierarchyRow{
+		{
+			NodeId: "N:package:single", PackageName: "data.csv", PackageFileCount: 1, PackageNamePath: []string{"root"},
+			FileId: 1, FileName: "data.csv", Size: 1024, S3Bucket: "pennsieve-test-storage", S3Key: "org2/data.csv",
+			ScanStatus: sql.NullString{String: "clean", Valid: true},
+		},
+		{
+			NodeId: "N:package:infected", PackageName: "bad.exe", PackageFileCount: 1,
+			FileId: 2, FileName: "bad.exe", Size: 4096, S3Bucket: "pennsieve-test-storage", S3Key: "org2/bad.exe",
+			ScanStatus: sql.NullString{String: "infected", Valid: true},
+		},
+		{
+			NodeId: "N:package:multi", PackageName: "recording", PackageFileCount: 2, PackageNamePath: []string{"root"},
+			FileId: 3, FileName: "part1.ome.tiff", Size: 2048, S3Bucket: "pennsieve-test-storage", S3Key: "org2/part1.ome.tiff",
+		},
+	}
+
+	var entries, blocked bytes.Buffer
+	presigner := testPresigner()
+	header, err := writeManifest(context.Background(), presigner, manifest.ScanPolicy{}, nil, rows, manifest.FormatJSON.NewEntryWriter(&entries), &blocked)
+	require.NoError(t, err)
+	assert.Equal(t, models.DownloadManifestHeader{Count: 2, Size: 1024 + 2048, BlockedCount: 1}, header)
+	assert.Equal(t, []models.DownloadIssuanceBucket{
+		{Bucket: "pennsieve-test-storage", FileIds: []int64{1, 3}, Bytes: 1024 + 2048},
+	}, presigner.Issued())
+
+	entryLines := decodeLines[models.DownloadManifestEntry](t, &entries)
+	require.Len(t, entryLines, 2)
+	assert.Equal(t, "N:package:single", entryLines[0].NodeId)
+	assert.Equal(t, []string{"root"}, entryLines[0].Path)
+	assert.Equal(t, "clean", entryLines[0].ScanStatus)
+	assert.Equal(t, "N:package:multi", entryLines[1].NodeId)
+	assert.Equal(t, []string{"root", "recording"}, entryLines[1].Path)
+	assert.Equal(t, "ome.tiff", entryLines[1].FileExtension)
+	for _, entry := range entryLines {
+		presignedURL, err := url.Parse(entry.URL)
+		require.NoError(t, err)
+		assert.NotEmpty(t, presignedURL.Query().Get("X-Amz-Signature"), "entry %s must have a presigned URL", entry.NodeId)
+	}
+
+	blockedLines := decodeLines[models.DownloadManifestBlockedEntry](t, &blocked)
+	require.Len(t, blockedLines, 1)
+	assert.Equal(t, models.DownloadManifestBlockedEntry{
+		FileId:      2,
+		NodeId:      "N:package:infected",
+		FileName:    "bad.exe",
+		PackageName: "bad.exe",
+		ScanStatus:  "infected",
+		Reason:      models.DownloadBlockedReasonScanStatus,
+		Message:     "Malware was found in this file.",
+		Remediation: "Contact the dataset owner about replacing the file.",
+	}, blockedLines[0])
+}
+
+func TestWriteManifest_StrictScanPolicy(t *testing.T) {
+	rows := []models.PackageHierarchyRow{
+		{NodeId: "N:package:clean", PackageName: "clean.csv", PackageFileCount: 1, FileId: 1, FileName: "clean.csv", S3Bucket: "pennsieve-test-storage", S3Key: "org2/clean.csv", ScanStatus: sql.NullString{String: "clean", Valid: true}},
+		{NodeId: "N:package:pending", PackageName: "pending.csv", PackageFileCount: 1, FileId: 2, FileName: "pending.csv", S3Bucket: "pennsieve-test-storage", S3Key: "org2/pending.csv", ScanStatus: sql.NullString{String: "pending", Valid: true}},
+		{NodeId: "N:package:unscanned", PackageName: "unscanned.csv", PackageFileCount: 1, FileId: 3, FileName: "unscanned.csv", S3Bucket: "pennsieve-test-storage", S3Key: "org2/unscanned.csv"},
+	}
+	var entries, blocked bytes.Buffer
+	header, err := writeManifest(context.Background(), testPresigner(), manifest.ScanPolicy{Mode: models.ScanPolicyStrict}, nil, rows, manifest.FormatJSON.NewEntryWriter(&entries), &blocked)
+	require.NoError(t, err)
+	assert.Equal(t, 1, header.Count)
+	assert.Equal(t, 2, header.BlockedCount)
+
+	entryLines := decodeLines[models.DownloadManifestEntry](t, &entries)
+	require.Len(t, entryLines, 1)
+	assert.Equal(t, "N:package:clean", entryLines[0].NodeId)
+	blockedLines := decodeLines[models.DownloadManifestBlockedEntry](t, &blocked)
+	require.Len(t, blockedLines, 2)
+	assert.Equal(t, "Try again once the scan has finished.", blockedLines[0].Remediation)
+	assert.Equal(t, "N:package:unscanned", blockedLines[1].NodeId)
+	assert.Contains(t, blockedLines[1].Message, "has not been scanned")
+}
+
+func TestWriteManifest_Quota(t *testing.T) {
+	rows := []models.PackageHierarchyRow{
+		{NodeId: "N:package:first", PackageName: "first.csv", PackageFileCount: 1, FileId: 1, FileName: "first.csv", Size: 600, S3Bucket: "pennsieve-test-storage", S3Key: "org2/first.csv"},
+		{NodeId: "N:package:second", PackageName: "second.csv", PackageFileCount: 1, FileId: 2, FileName: "second.csv", Size: 600, S3Bucket: "pennsieve-test-storage", S3Key: "org2/second.csv"},
+		{NodeId: "N:package:third", PackageName: "third.csv", PackageFileCount: 1, FileId: 3, FileName: "third.csv", Size: 100, S3Bucket: "pennsieve-test-storage", S3Key: "org2/third.csv"},
+	}
+	quota := manifest.NewQuota(manifest.QuotaLimits{UserDailyBytes: 1000}, 0, 0)
+
+	var entries, blocked bytes.Buffer
+	header, err := writeManifest(context.Background(), testPresigner(), manifest.ScanPolicy{}, quota, rows, manifest.FormatJSON.NewEntryWriter(&entries), &blocked)
+	require.NoError(t, err)
+	assert.Equal(t, 1, header.Count)
+	assert.Equal(t, int64(600), header.Size)
+	assert.Equal(t, 2, header.BlockedCount)
+	require.NotNil(t, header.Quota)
+	assert.Equal(t, int64(400), *header.Quota.UserDailyRemainingBytes)
+
+	// The third file would fit, but once a file does not, no later file is issued either.
+	entryLines := decodeLines[models.DownloadManifestEntry](t, &entries)
+	require.Len(t, entryLines, 1)
+	assert.Equal(t, "N:package:first", entryLines[0].NodeId)
+	blockedLines := decodeLines[models.DownloadManifestBlockedEntry](t, &blocked)
+	require.Len(t, blockedLines, 2)
+	for _, blockedLine := range blockedLines {
+		assert.Equal(t, models.DownloadBlockedReasonQuotaExceeded, blockedLine.Reason)
+	}
+}
+
+func TestWriteManifest_Multipart(t *testing.T) {
+	var rows []models.PackageHierarchyRow
+	for i := 1; i <= 50; i++ {
+		rows = append(rows, models.PackageHierarchyRow{
+			NodeId: fmt.Sprintf("N:package:%d", i), PackageName: fmt.Sprintf("%d.csv", i), PackageFileCount: 1,
+			FileId: int64(i), FileName: fmt.Sprintf("%d.csv", i), Size: 10, S3Bucket: "pennsieve-test-storage", S3Key: fmt.Sprintf("org2/%d.csv", i),
+		})
+	}
+	client := &fakeMultipartUploads{}
+	entries := newTestMultipartWriter(t, client, 1024)
+
+	var blocked bytes.Buffer
+	header, err := writeManifest(context.Background(), testPresigner(), manifest.ScanPolicy{}, nil, rows, manifest.FormatJSON.NewEntryWriter(entries), &blocked)
+	require.NoError(t, err)
+	require.NoError(t, entries.Close())
+	assert.Equal(t, 50, header.Count)
+
+	// The manifest is uploaded a part at a time as it is written, rather than held whole.
+	assert.Greater(t, len(client.parts), 1)
+	entryLines := decodeLines[models.DownloadManifestEntry](t, bytes.NewReader(client.completed))
+	require.Len(t, entryLines, 50)
+	assert.Equal(t, "N:package:1", entryLines[0].NodeId)
+	assert.Equal(t, "N:package:50", entryLines[49].NodeId)
+}
+
+func TestWriteManifest_PresignExpiry(t *testing.T) {
+	rows := []models.PackageHierarchyRow{
+		{NodeId: "N:package:single", PackageName: "data.csv", PackageFileCount: 1, FileId: 1, FileName: "data.csv", S3Bucket: "pennsieve-test-storage", S3Key: "org2/data.csv"},
+	}
+	presigner := testPresigner().WithExpiry(manifest.PresignExpiry{
+		Policy:    manifest.PresignExpiryPolicy{Orgs: map[int]manifest.PresignBounds{2: {MaxSeconds: 2 * 3600}}},
+		OrgId:     2,
+		Requested: 90 * time.Minute,
+	})
+
+	var entries, blocked bytes.Buffer
+	signedAt := time.Now().UTC().Truncate(time.Second)
+	_, err := writeManifest(context.Background(), presigner, manifest.ScanPolicy{}, nil, rows, manifest.FormatJSON.NewEntryWriter(&entries), &blocked)
+	require.NoError(t, err)
+
+	entryLines := decodeLines[models.DownloadManifestEntry](t, &entries)
+	require.Len(t, entryLines, 1)
+	presignedURL, err := url.Parse(entryLines[0].URL)
+	require.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(90*60), presignedURL.Query().Get("X-Amz-Expires"))
+	assert.WithinDuration(t, signedAt.Add(90*time.Minute), entryLines[0].ExpiresAt, 2*time.Second)
+	assert.False(t, entryLines[0].Resignable)
+}
+
+func TestWriteManifest_UnknownBucketRegion(t *testing.T) {
+	rows := []models.PackageHierarchyRow{
+		{NodeId: "N:package:elsewhere", FileId: 1, S3Bucket: "unknown-bucket", S3Key: "key"},
+	}
+	var entries, blocked bytes.Buffer
+	_, err := writeManifest(context.Background(), testPresigner(), manifest.ScanPolicy{}, nil, rows, manifest.FormatJSON.NewEntryWriter(&entries), &blocked)
+	assert.ErrorContains(t, err, "unknown-bucket")
+}
+
+func TestScanPolicy_NotConfigured(t *testing.T) {
+	originalScanPolicies := ScanPolicies
+	ScanPolicies = nil
+	t.Cleanup(func() {
+		ScanPolicies = originalScanPolicies
+	})
+
+	_, err := (&MessageHandler{}).scanPolicy(context.Background(), &models.DownloadJob{OrgId: 2, DatasetNodeId: "N:dataset:1"})
+	assert.ErrorContains(t, err, "scan policies not configured")
+}
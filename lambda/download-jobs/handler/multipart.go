@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// multipartPartSize is the size of each part of a multipart upload but the last. With the S3
+// limit of 10,000 parts this allows objects of up to about 156 GiB.
+const multipartPartSize = 16 * 1024 * 1024
+
+type multipartUploadAPI interface {
+	CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error)
+	UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error)
+	CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
+}
+
+// multipartWriter is an io.WriteCloser that streams what is written to it into an S3 object with a
+// multipart upload, so that objects larger than the Lambda's memory can be written. Parts are uploaded
+// one at a time as they fill. The object only appears once Close succeeds; if any step fails the upload
+// must be discarded with Abort.
+type multipartWriter struct {
+	ctx       context.Context
+	client    multipartUploadAPI
+	bucket    string
+	key       string
+	uploadId  *string
+	partSize  int
+	buf       []byte
+	parts     []types.CompletedPart
+	completed bool
+	err       error
+}
+
+func newMultipartWriter(ctx context.Context, client multipartUploadAPI, input *s3.CreateMultipartUploadInput, partSize int) (*multipartWriter, error) {
+	output, err := client.CreateMultipartUpload(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start multipart upload to s3://%s/%s: %w", aws.ToString(input.Bucket), aws.ToString(input.Key), err)
+	}
+	return &multipartWriter{
+		ctx:      ctx,
+		client:   client,
+		bucket:   aws.ToString(input.Bucket),
+		key:      aws.ToString(input.Key),
+		uploadId: output.UploadId,
+		partSize: partSize,
+		buf:      make([]byte, 0, partSize),
+	}, nil
+}
+
+func (w *multipartWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), w.partSize-len(w.buf))
+		w.buf = append(w.buf, p[:n]...)
+		p = p[n:]
+		written += n
+		if len(w.buf) == w.partSize {
+			if err := w.uploadPart(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Close uploads the last part and completes the upload.
+func (w *multipartWriter) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	// An upload needs at least one part, even if the object is empty.
+	if len(w.buf) > 0 || len(w.parts) == 0 {
+		if err := w.uploadPart(); err != nil {
+			return err
+		}
+	}
+	if _, err := w.client.CompleteMultipartUpload(w.ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(w.bucket),
+		Key:             aws.String(w.key),
+		UploadId:        w.uploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: w.parts},
+	}); err != nil {
+		w.err = fmt.Errorf("failed to complete multipart upload to s3://%s/%s: %w", w.bucket, w.key, err)
+		return w.err
+	}
+	w.completed = true
+	w.err = errors.New("multipart upload already completed")
+	return nil
+}
+
+// Abort discards the parts uploaded so far. It is a no-op after a successful Close.
+func (w *multipartWriter) Abort() error {
+	if w.completed {
+		return nil
+	}
+	if _, err := w.client.AbortMultipartUpload(context.WithoutCancel(w.ctx), &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(w.bucket),
+		Key:      aws.String(w.key),
+		UploadId: w.uploadId,
+	}); err != nil {
+		return fmt.Errorf("failed to abort multipart upload to s3://%s/%s: %w", w.bucket, w.key, err)
+	}
+	return nil
+}
+
+func (w *multipartWriter) uploadPart() error {
+	partNumber := aws.Int32(int32(len(w.parts) + 1))
+	output, err := w.client.UploadPart(w.ctx, &s3.UploadPartInput{
+		Bucket:     aws.String(w.bucket),
+		Key:        aws.String(w.key),
+		UploadId:   w.uploadId,
+		PartNumber: partNumber,
+		Body:       bytes.NewReader(w.buf),
+	})
+	if err != nil {
+		w.err = fmt.Errorf("failed to upload part %d to s3://%s/%s: %w", *partNumber, w.bucket, w.key, err)
+		return w.err
+	}
+	w.parts = append(w.parts, types.CompletedPart{ETag: output.ETag, PartNumber: partNumber})
+	w.buf = w.buf[:0]
+	return nil
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMultipartUploads records a single multipart upload in memory.
+type fakeMultipartUploads struct {
+	parts     [][]byte
+	completed []byte
+	aborted   bool
+	failPart  int32
+}
+
+func (f *fakeMultipartUploads) CreateMultipartUpload(_ context.Context, _ *s3.CreateMultipartUploadInput, _ ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String("upload-1")}, nil
+}
+
+func (f *fakeMultipartUploads) UploadPart(_ context.Context, params *s3.UploadPartInput, _ ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	if aws.ToInt32(params.PartNumber) == f.failPart {
+		return nil, errors.New("slow down")
+	}
+	part, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.parts = append(f.parts, part)
+	return &s3.UploadPartOutput{ETag: aws.String(fmt.Sprintf("etag-%d", aws.ToInt32(params.PartNumber)))}, nil
+}
+
+func (f *fakeMultipartUploads) CompleteMultipartUpload(_ context.Context, params *s3.CompleteMultipartUploadInput, _ ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	for i, part := range params.MultipartUpload.Parts {
+		if aws.ToInt32(part.PartNumber) != int32(i+1) || aws.ToString(part.ETag) != fmt.Sprintf("etag-%d", i+1) {
+			return nil, fmt.Errorf("unexpected part %d: %d %s", i, aws.ToInt32(part.PartNumber), aws.ToString(part.ETag))
+		}
+	}
+	f.completed = bytes.Join(f.parts, nil)
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func (f *fakeMultipartUploads) AbortMultipartUpload(_ context.Context, _ *s3.AbortMultipartUploadInput, _ ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	f.aborted = true
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func newTestMultipartWriter(t *testing.T, client *fakeMultipartUploads, partSize int) *multipartWriter {
+	t.Helper()
+	writer, err := newMultipartWriter(context.Background(), client, &s3.CreateMultipartUploadInput{
+		Bucket: aws.String("pennsieve-test-download-jobs"),
+		Key:    aws.String("jobs/test/archive.zip"),
+	}, partSize)
+	require.NoError(t, err)
+	return writer
+}
+
+func TestMultipartWriter(t *testing.T) {
+	client := &fakeMultipartUploads{}
+	writer := newTestMultipartWriter(t, client, 4)
+
+	for _, chunk := range []string{"ab", "cdefghij", "k"} {
+		n, err := writer.Write([]byte(chunk))
+		require.NoError(t, err)
+		assert.Equal(t, len(chunk), n)
+	}
+	require.NoError(t, writer.Close())
+	require.NoError(t, writer.Abort())
+
+	assert.Equal(t, [][]byte{[]byte("abcd"), []byte("efgh"), []byte("ijk")}, client.parts)
+	assert.Equal(t, "abcdefghijk", string(client.completed))
+	assert.False(t, client.aborted)
+}
+
+func TestMultipartWriter_Empty(t *testing.T) {
+	client := &fakeMultipartUploads{}
+	writer := newTestMultipartWriter(t, client, 4)
+	require.NoError(t, writer.Close())
+	assert.Equal(t, [][]byte{{}}, client.parts)
+}
+
+func TestMultipartWriter_PartFailure(t *testing.T) {
+	client := &fakeMultipartUploads{failPart: 2}
+	writer := newTestMultipartWriter(t, client, 4)
+
+	_, err := writer.Write([]byte("abcdefghij"))
+	assert.ErrorContains(t, err, "failed to upload part 2")
+	_, err = writer.Write([]byte("k"))
+	assert.Error(t, err, "writes after a failure must fail")
+	assert.Error(t, writer.Close())
+	require.NoError(t, writer.Abort())
+	assert.True(t, client.aborted)
+	assert.Nil(t, client.completed)
+}
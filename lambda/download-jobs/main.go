@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/pennsieve/packages-service/api/manifest"
+	"github.com/pennsieve/packages-service/api/metrics"
+	"github.com/pennsieve/packages-service/api/regions"
+	"github.com/pennsieve/packages-service/api/store"
+	"github.com/pennsieve/packages-service/api/tracing"
+	"github.com/pennsieve/packages-service/download-jobs/handler"
+	"github.com/pennsieve/pennsieve-go-core/pkg/queries/pgdb"
+	log "github.com/sirupsen/logrus"
+	"os"
+)
+
+func init() {
+	log.SetFormatter(&log.JSONFormatter{})
+	if level, ok := os.LookupEnv("LOG_LEVEL"); !ok {
+		log.SetLevel(log.InfoLevel)
+	} else {
+		if ll, err := log.ParseLevel(level); err == nil {
+			log.SetLevel(ll)
+		} else {
+			log.SetLevel(log.InfoLevel)
+			log.Warnf("could not set log level to %q: %v", level, err)
+		}
+	}
+
+	// Open DB connection pool here so that it can be reused if lambda handles more than one request
+	db, err := pgdb.ConnectRDS()
+	if err != nil {
+		panic(fmt.Sprintf("unable open connection pool to RDS database: %s", err))
+	}
+	if err := db.Ping(); err != nil {
+		panic(fmt.Sprintf("unable to connect to RDS database: %s", err))
+	}
+	log.Info("connected to RDS database")
+	handler.PennsieveDB = db
+	handler.Metrics = metrics.NewFromEnv("download-jobs")
+
+	// Create AWS config
+	region := os.Getenv("REGION")
+	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(region))
+	if err != nil {
+		log.Fatalf("AWS configuration error: %v\n", err)
+	}
+
+	if err := tracing.Init(context.Background(), "download-jobs"); err != nil {
+		log.Fatalf("tracing configuration error: %v\n", err)
+	}
+	tracing.AppendAWSMiddleware(&cfg.APIOptions)
+
+	handler.S3Client = s3.NewFromConfig(cfg)
+	handler.AssumeRoleClient = sts.NewFromConfig(cfg)
+	handler.BucketRegions, err = regions.NewResolverFromEnv(handler.S3Client)
+	if err != nil {
+		log.Fatalf("bucket region configuration error: %v\n", err)
+	}
+	handler.BucketOptions, err = manifest.NewBucketOptionsCacheFromEnv(handler.AssumeRoleClient, handler.BucketRegions, manifest.STSCredentialsDuration)
+	if err != nil {
+		log.Fatalf("external bucket configuration error: %v\n", err)
+	}
+	handler.DyDBClient = dynamodb.NewFromConfig(cfg)
+	handler.ScanPolicies, err = store.NewScanPolicyStoreFromEnv(handler.DyDBClient)
+	if err != nil {
+		log.Fatalf("scan policy configuration error: %v\n", err)
+	}
+}
+
+func main() {
+	lambda.Start(handler.DownloadJobsHandler)
+}
@@ -87,6 +87,7 @@ func (h *MessageHandler) handleFilePackage(ctx context.Context, orgId int, datas
 			if deleteResponse, err := h.Store.Object.DeleteObjectsVersion(ctx, *deleteMarker); err != nil {
 				return h.errorf("error restoring S3 object %s: %w", deleteMarker, err)
 			} else if len(deleteResponse.AWSErrors) > 0 {
+				countAWSErrors(deleteResponse.AWSErrors)
 				sqlStore.LogErrorWithFields(log.Fields{"nodeId": restoreInfo.NodeId, "s3Info": *deleteMarker}, "AWS error during S3 restore", deleteResponse.AWSErrors)
 				return h.errorf("AWS error restoring S3 object %s: %v", *deleteMarker, deleteResponse.AWSErrors[0])
 			}
@@ -141,6 +142,7 @@ func (h *MessageHandler) restoreName(ctx context.Context, restoreInfo models.Res
 	newName := originalName
 	err = store.UpdatePackageName(ctx, restoreInfo.Id, originalName)
 	for retryCtx = NewRetryContext(originalName, err); retryCtx.TryAgain; retryCtx.Update(err) {
+		Metrics.Count("RenameCollisions", 1)
 		newName = retryCtx.Parts.Next()
 		h.LogDebugWithFields(log.Fields{"previousError": retryCtx.Err, "newName": newName}, "retrying name update")
 		if spErr := store.RollbackToSavepoint(ctx, savepoint); spErr != nil {
@@ -11,6 +11,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/google/uuid"
 	"github.com/pennsieve/packages-service/api/models"
+	"github.com/pennsieve/packages-service/api/regions"
 	"github.com/pennsieve/packages-service/api/store"
 	"github.com/pennsieve/pennsieve-go-core/pkg/models/fileInfo/objectType"
 	"github.com/pennsieve/pennsieve-go-core/pkg/models/packageInfo/packageState"
@@ -284,7 +285,7 @@ func TestMessageHandler_handleFilePackage(t *testing.T) {
 
 			sqlFactory := store.NewPostgresStoreFactory(subDB.DB)
 			dyStore := store.NewDynamoDBStore(dyClient, deleteRecordTableName)
-			objectStore := store.NewS3Store(s3Client)
+			objectStore := store.NewS3Store(s3Client, regions.NewResolver(s3Client, nil))
 			handler := NewMessageHandler(events.SQSMessage{MessageId: uuid.NewString(), Body: "{}"}, NewBaseStore(sqlFactory, dyStore, objectStore, nil))
 			restoreInfo := models.RestorePackageInfo{
 				Id:     tt.sourcePackage.Package.Id,
@@ -125,6 +125,7 @@ func (h *MessageHandler) handleFolderPackage(ctx context.Context, orgId int, dat
 				if deleteResponse, err := h.Store.Object.DeleteObjectsVersion(ctx, objectInfos...); err != nil {
 					return h.errorf("error restoring S3 objects: %w", err)
 				} else if len(deleteResponse.AWSErrors) > 0 {
+					countAWSErrors(deleteResponse.AWSErrors)
 					sqlStore.LogError("AWS errors while restoring S3 objects", deleteResponse.AWSErrors)
 					return h.errorf("AWS error restoring S3 objects: %v. More errors may appear in server logs", deleteResponse.AWSErrors[0])
 				}
@@ -8,6 +8,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/google/uuid"
 	"github.com/pennsieve/packages-service/api/models"
+	"github.com/pennsieve/packages-service/api/regions"
 	"github.com/pennsieve/packages-service/api/store"
 	"github.com/pennsieve/pennsieve-go-core/pkg/models/packageInfo/packageType"
 	"github.com/pennsieve/pennsieve-go-core/pkg/models/pgdb"
@@ -80,7 +81,7 @@ func TestMessageHandler_handleFolderPackage(t *testing.T) {
 
 	sqlFactory := store.NewPostgresStoreFactory(db.DB)
 	dyStore := store.NewDynamoDBStore(dyClient, deleteRecordTableName)
-	objectStore := store.NewS3Store(s3Client)
+	objectStore := store.NewS3Store(s3Client, regions.NewResolver(s3Client, nil))
 	handler := NewMessageHandler(events.SQSMessage{MessageId: uuid.NewString(), Body: "{}"}, NewBaseStore(sqlFactory, dyStore, objectStore, nil))
 	restoreInfo := models.RestorePackageInfo{
 		Id:     folderPackage.Id,
@@ -10,13 +10,18 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	pennsievelog "github.com/pennsieve/packages-service/api/logging"
+	"github.com/pennsieve/packages-service/api/metrics"
 	"github.com/pennsieve/packages-service/api/models"
+	"github.com/pennsieve/packages-service/api/regions"
 	"github.com/pennsieve/packages-service/api/store"
 	"github.com/pennsieve/packages-service/api/store/restore"
+	"github.com/pennsieve/packages-service/api/tracing"
 	changelog2 "github.com/pennsieve/pennsieve-go-core/pkg/changelog"
 	"github.com/pennsieve/pennsieve-go-core/pkg/models/packageInfo/packageType"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 	"os"
+	"time"
 )
 
 const m = "restore/handler"
@@ -25,6 +30,8 @@ var PennsieveDB *sql.DB
 var S3Client *s3.Client
 var DyDBClient *dynamodb.Client
 var SQSClient *sqs.Client
+var BucketRegions *regions.Resolver
+var Metrics *metrics.Recorder
 
 type BaseStore interface {
 	NewStore(log *pennsievelog.Log) *Store
@@ -57,8 +64,16 @@ type Store struct {
 }
 
 func RestorePackagesHandler(ctx context.Context, event events.SQSEvent) (events.SQSEventResponse, error) {
+	defer func() {
+		if err := Metrics.Flush(); err != nil {
+			log.Warnf("unable to flush metrics: %v", err)
+		}
+		if err := tracing.Flush(ctx); err != nil {
+			log.Warnf("unable to flush traces: %v", err)
+		}
+	}()
 	sqlFactory := store.NewPostgresStoreFactory(PennsieveDB)
-	objectStore := store.NewS3Store(S3Client)
+	objectStore := store.NewS3Store(S3Client, BucketRegions)
 	nosqlStore := store.NewDynamoDBStore(DyDBClient, os.Getenv(store.DeleteRecordTableNameEnvKey))
 	changelogStore := restore.NewSQSChangelogStore(SQSClient, os.Getenv(restore.JobsQueueIDEnvKey))
 	base := NewBaseStore(sqlFactory, nosqlStore, objectStore, changelogStore)
@@ -99,29 +114,55 @@ func NewMessageHandler(message events.SQSMessage, base BaseStore) *MessageHandle
 	return &handler
 }
 
-func (h *MessageHandler) handleBatch(ctx context.Context) error {
+func (h *MessageHandler) handleBatch(ctx context.Context) (err error) {
+	// Continue the trace of the service lambda request that queued this message.
+	ctx, span := tracing.Start(tracing.Extract(ctx, h.traceCarrier()), "RestorePackageMessage",
+		attribute.String("messaging.message.id", h.Message.MessageId))
+	defer func() {
+		tracing.End(span, err)
+	}()
 	restoreMessage := models.RestorePackageMessage{}
 	if err := json.Unmarshal([]byte(h.Message.Body), &restoreMessage); err != nil {
 		return h.errorf("could not unmarshal message [%s]: %w", h.Message.Body, err)
 	}
+	span.SetAttributes(
+		attribute.Int("pennsieve.org_id", restoreMessage.OrgId),
+		attribute.Int64("pennsieve.dataset_id", restoreMessage.DatasetId),
+		attribute.String("pennsieve.package_node_id", restoreMessage.Package.NodeId))
 	if err := h.handleMessage(ctx, restoreMessage); err != nil {
 		return h.errorf("error handling message [%v]: %w", restoreMessage, err)
 	}
 	return nil
 }
 
+// traceCarrier returns the string message attributes of the SQS message, which carry the trace context
+// added by the service lambda.
+func (h *MessageHandler) traceCarrier() map[string]string {
+	carrier := make(map[string]string, len(h.Message.MessageAttributes))
+	for key, value := range h.Message.MessageAttributes {
+		if value.StringValue != nil {
+			carrier[key] = *value.StringValue
+		}
+	}
+	return carrier
+}
+
 func (h *MessageHandler) handleMessage(ctx context.Context, message models.RestorePackageMessage) error {
 	var changelog []changelog2.PackageRestoreEvent
 	var err error
 	p := message.Package
+	start := time.Now()
 	if p.Type == packageType.Collection {
 		changelog, err = h.handleFolderPackage(ctx, message.OrgId, message.DatasetId, p)
 	} else {
 		changelog, err = h.handleFilePackage(ctx, message.OrgId, message.DatasetId, p)
 	}
+	packageKind := metrics.Dim("PackageKind", restorePackageKind(p))
 	if err != nil {
+		Metrics.Count("RestoreFailures", 1, packageKind)
 		return h.errorf("could not restore folder %s in org %d: %w", p.NodeId, message.OrgId, err)
 	}
+	Metrics.Duration("RestoreDuration", time.Since(start), packageKind)
 	if err := h.Store.Changelog.LogRestores(ctx, int64(message.OrgId), message.DatasetId, message.UserId, changelog); err != nil {
 		h.LogWarnWithFields(log.Fields{"error": err}, "unable to send changelog events")
 	}
@@ -129,6 +170,21 @@ func (h *MessageHandler) handleMessage(ctx context.Context, message models.Resto
 	return nil
 }
 
+// restorePackageKind is the PackageKind metric dimension: Folder for collections, File for everything else.
+func restorePackageKind(p models.RestorePackageInfo) string {
+	if p.Type == packageType.Collection {
+		return "Folder"
+	}
+	return "File"
+}
+
+// countAWSErrors records the per-object S3 errors returned by DeleteObjectsVersion, by error code.
+func countAWSErrors(awsErrors []store.AWSError) {
+	for _, awsError := range awsErrors {
+		Metrics.Count("S3AWSErrors", 1, metrics.Dim("Code", awsError.Code))
+	}
+}
+
 func (h *MessageHandler) newBatchItemFailure() events.SQSBatchItemFailure {
 	return events.SQSBatchItemFailure{ItemIdentifier: h.Message.MessageId}
 }
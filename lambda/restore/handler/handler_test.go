@@ -13,6 +13,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/pennsieve/packages-service/api/logging"
 	"github.com/pennsieve/packages-service/api/models"
+	"github.com/pennsieve/packages-service/api/regions"
 	"github.com/pennsieve/packages-service/api/store"
 	"github.com/pennsieve/packages-service/api/store/restore"
 	"github.com/pennsieve/pennsieve-go-core/pkg/changelog"
@@ -216,7 +217,7 @@ func TestHandleMessage(t *testing.T) {
 	defer dyFixture.Teardown()
 
 	sqlFactory := store.NewPostgresStoreFactory(db.DB)
-	objectStore := store.NewS3Store(s3Client)
+	objectStore := store.NewS3Store(s3Client, regions.NewResolver(s3Client, nil))
 	nosqlStore := store.NewDynamoDBStore(dyClient, deleteRecordTableName)
 	sqsChangelogStore := restore.NewSQSChangelogStore(sqsClient, jobsQueueID)
 	base := NewBaseStore(sqlFactory, nosqlStore, objectStore, sqsChangelogStore)
@@ -9,6 +9,9 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/google/uuid"
+	"github.com/pennsieve/packages-service/api/metrics"
+	"github.com/pennsieve/packages-service/api/regions"
+	"github.com/pennsieve/packages-service/api/tracing"
 	"github.com/pennsieve/packages-service/restore/handler"
 	"github.com/pennsieve/pennsieve-go-core/pkg/queries/pgdb"
 	log "github.com/sirupsen/logrus"
@@ -39,6 +42,7 @@ func init() {
 	}
 	log.Info("connected to RDS database")
 	handler.PennsieveDB = db
+	handler.Metrics = metrics.NewFromEnv("restore-package")
 
 	// Create AWS config
 	region := os.Getenv("REGION")
@@ -47,7 +51,16 @@ func init() {
 		log.Fatalf("AWS configuration error: %v\n", err)
 	}
 
+	if err := tracing.Init(context.Background(), "restore-package"); err != nil {
+		log.Fatalf("tracing configuration error: %v\n", err)
+	}
+	tracing.AppendAWSMiddleware(&cfg.APIOptions)
+
 	handler.S3Client = s3.NewFromConfig(cfg)
+	handler.BucketRegions, err = regions.NewResolverFromEnv(handler.S3Client)
+	if err != nil {
+		log.Fatalf("bucket region configuration error: %v\n", err)
+	}
 	handler.DyDBClient = dynamodb.NewFromConfig(cfg)
 	handler.SQSClient = sqs.NewFromConfig(cfg)
 }
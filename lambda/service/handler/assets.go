@@ -12,7 +12,6 @@ import (
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
@@ -722,15 +721,7 @@ func (h *ViewerAssetsHandler) generateUploadCredentials(ctx context.Context, buc
 		return nil, fmt.Errorf("UPLOAD_CREDENTIALS_ROLE_ARN not configured")
 	}
 
-	region := os.Getenv("REGION")
-	if region == "" {
-		region = "us-east-1"
-	}
-
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
-	if err != nil {
-		return nil, fmt.Errorf("failed to load AWS config: %w", err)
-	}
+	region := awsClients().Region()
 
 	sessionPolicy := fmt.Sprintf(`{
 		"Version": "2012-10-17",
@@ -751,7 +742,7 @@ func (h *ViewerAssetsHandler) generateUploadCredentials(ctx context.Context, buc
 
 	sessionName := fmt.Sprintf("viewer-asset-%d-%d", h.claims.OrgClaim.IntId, h.claims.UserClaim.Id)
 
-	stsClient := sts.NewFromConfig(cfg)
+	stsClient := STSClientFor(region)
 	durationSeconds := int32(3600)
 	result, err := stsClient.AssumeRole(ctx, &sts.AssumeRoleInput{
 		RoleArn:         aws.String(roleARN),
@@ -775,18 +766,8 @@ func (h *ViewerAssetsHandler) generateUploadCredentials(ctx context.Context, buc
 }
 
 // deleteS3Prefix deletes all S3 objects under the given prefix.
-// Exported as a package function so the cleanup Lambda can reuse it.
 func deleteS3Prefix(ctx context.Context, bucket, prefix string) error {
-	region := os.Getenv("REGION")
-	if region == "" {
-		region = "us-east-1"
-	}
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
-	if err != nil {
-		return fmt.Errorf("failed to load AWS config: %w", err)
-	}
-
-	s3Client := s3.NewFromConfig(cfg)
+	s3Client := S3ClientFor("")
 	paginator := s3.NewListObjectsV2Paginator(s3Client, &s3.ListObjectsV2Input{
 		Bucket: aws.String(bucket),
 		Prefix: aws.String(prefix),
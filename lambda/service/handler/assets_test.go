@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"testing"
 
+	"github.com/pennsieve/packages-service/api/awsclients"
 	"github.com/pennsieve/packages-service/api/store"
 	"github.com/pennsieve/pennsieve-go-core/pkg/authorizer"
 	"github.com/pennsieve/pennsieve-go-core/pkg/models/dataset"
@@ -61,11 +62,14 @@ func setupAssetsTestDB(t *testing.T) *store.TestDB {
 	require.NoError(t, err)
 
 	originalDB := PennsieveDB
+	originalAWSClients := AWSClients
 	PennsieveDB = db.DB
+	AWSClients = awsclients.NewRegistry(store.GetTestAWSConfig(t))
 	ViewerAssetsBucket = "test-storage-bucket"
 
 	t.Cleanup(func() {
 		PennsieveDB = originalDB
+		AWSClients = originalAWSClients
 		db.DB.Exec(`DELETE FROM "2".viewer_asset_packages`)
 		db.DB.Exec(`DELETE FROM "2".viewer_assets`)
 		db.DB.Exec(`DELETE FROM "2".chat_sessions`)
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/pennsieve/packages-service/api/awsclients"
+	log "github.com/sirupsen/logrus"
+)
+
+var awsClientsMu sync.Mutex
+
+// awsClients returns AWSClients, which main sets at cold start. If it is not set, as when the handler package
+// is used without main in tests, it is first set to a Registry of the default config for the REGION
+// environment variable.
+func awsClients() *awsclients.Registry {
+	awsClientsMu.Lock()
+	defer awsClientsMu.Unlock()
+	if AWSClients == nil {
+		region := os.Getenv("REGION")
+		cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(region))
+		if err != nil {
+			log.Warnf("failed to load default AWS config, using an empty config for region %q: %v", region, err)
+			cfg = aws.Config{Region: region}
+		}
+		AWSClients = awsclients.NewRegistry(cfg)
+	}
+	return AWSClients
+}
+
+// S3ClientFor returns the shared S3 client for region. An empty region means the Lambda's region.
+func S3ClientFor(region string) *s3.Client {
+	return awsclients.Get(awsClients(), "s3", region, func(cfg aws.Config) *s3.Client {
+		return s3.NewFromConfig(cfg)
+	})
+}
+
+// STSClientFor returns the shared STS client for region. An empty region means the Lambda's region.
+func STSClientFor(region string) *sts.Client {
+	return awsclients.Get(awsClients(), "sts", region, func(cfg aws.Config) *sts.Client {
+		return sts.NewFromConfig(cfg)
+	})
+}
+
+// SecretsManagerClientFor returns the shared Secrets Manager client for region. An empty region means the Lambda's region.
+func SecretsManagerClientFor(region string) *secretsmanager.Client {
+	return awsclients.Get(awsClients(), "secretsmanager", region, func(cfg aws.Config) *secretsmanager.Client {
+		return secretsmanager.NewFromConfig(cfg)
+	})
+}
@@ -0,0 +1,23 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAWSClients_Default(t *testing.T) {
+	originalAWSClients := AWSClients
+	AWSClients = nil
+	t.Cleanup(func() {
+		AWSClients = originalAWSClients
+	})
+	t.Setenv("REGION", "eu-west-1")
+
+	registry := awsClients()
+	require.NotNil(t, registry)
+	assert.Equal(t, "eu-west-1", registry.Region())
+	assert.Same(t, registry, awsClients())
+	assert.NotNil(t, S3ClientFor(""))
+}
@@ -16,7 +16,6 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/feature/cloudfront/sign"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
 	log "github.com/sirupsen/logrus"
@@ -300,27 +299,15 @@ func (h *CloudFrontSignedURLHandler) extractPolicyInfo(encodedPolicy string, exp
 	}, nil
 }
 
-func (h *CloudFrontSignedURLHandler) loadKeysFromSecretsManager(ctx context.Context, secretName string) error {
+func (h *CloudFrontSignedURLHandler) loadKeysFromSecretsManager(ctx context.Context, secretName string) (err error) {
+	defer func() {
+		if err != nil {
+			Metrics.Count("CloudFrontKeyLoadFailures", 1)
+		}
+	}()
 	log.Infof("Loading CloudFront keys from Secrets Manager: %s", secretName)
 
-	// Create AWS config with explicit region
-	region := os.Getenv("REGION")
-	if region == "" {
-		region = os.Getenv("AWS_REGION")
-	}
-	if region == "" {
-		region = "us-east-1" // fallback
-	}
-
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
-	if err != nil {
-		return fmt.Errorf("failed to load AWS config: %w", err)
-	}
-
-	log.Infof("AWS config loaded with region: %s", cfg.Region)
-
-	// Create Secrets Manager client
-	smClient := secretsmanager.NewFromConfig(cfg)
+	smClient := SecretsManagerClientFor("")
 
 	// Get secret value
 	result, err := smClient.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
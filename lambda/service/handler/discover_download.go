@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pennsieve/packages-service/api/manifest"
+	"github.com/pennsieve/packages-service/api/models"
+)
+
+type DiscoverDownloadManifestHandler struct {
+	RequestHandler
+}
+
+// handleGet returns the download manifest of a published dataset version (unauthenticated). Files are resolved
+// through the Discover database and pinned to their published S3 version. Accepts:
+//   - dataset_id: the published-dataset PK from discover.public_datasets.id
+//   - version: the published version number
+//
+// along with the limit, cursor, format and expires_in params of POST /download-manifest.
+func (h *DiscoverDownloadManifestHandler) handleGet(ctx context.Context) (*events.APIGatewayV2HTTPResponse, error) {
+	publishedDatasetId, err := strconv.ParseInt(h.queryParams["dataset_id"], 10, 64)
+	if err != nil || publishedDatasetId < 1 {
+		return h.logAndBuildError("query param 'dataset_id' must be a positive integer (the published-dataset ID)", http.StatusBadRequest), nil
+	}
+	version, err := strconv.Atoi(h.queryParams["version"])
+	if err != nil || version < 1 {
+		return h.logAndBuildError("query param 'version' must be a positive integer", http.StatusBadRequest), nil
+	}
+	format, err := parseManifestFormat(h.queryParams)
+	if err != nil {
+		return h.logAndBuildError(err.Error(), http.StatusBadRequest), nil
+	}
+	page, err := parseManifestPage(h.queryParams)
+	if err != nil {
+		return h.logAndBuildError(err.Error(), http.StatusBadRequest), nil
+	}
+	presignExpiry, err := parsePresignExpiry(h.queryParams)
+	if err != nil {
+		return h.logAndBuildError(err.Error(), http.StatusBadRequest), nil
+	}
+
+	if DiscoverDB == nil {
+		return h.logAndBuildError("discover database not configured", http.StatusServiceUnavailable), nil
+	}
+	expiryPolicy, err := manifest.LoadPresignExpiryPolicyFromEnv()
+	if err != nil {
+		return h.logAndBuildError(err.Error(), http.StatusInternalServerError), nil
+	}
+
+	published, err := manifest.GetPublishedVersion(ctx, DiscoverDB, publishedDatasetId, version)
+	if errors.Is(err, manifest.ErrPublishedVersionNotFound) {
+		return h.logAndBuildError(fmt.Sprintf("version %d of published dataset %d not found", version, publishedDatasetId), http.StatusNotFound), nil
+	}
+	if errors.Is(err, manifest.ErrPublishedVersionEmbargoed) {
+		return h.logAndBuildError(fmt.Sprintf("version %d of published dataset %d is under embargo", version, publishedDatasetId), http.StatusForbidden), nil
+	}
+	if err != nil {
+		h.logger.Errorf("failed to look up published dataset version: %v", err)
+		return nil, err
+	}
+
+	rows, err := manifest.GetPublishedFiles(ctx, DiscoverDB, published)
+	if err != nil {
+		h.logger.Errorf("failed to query published files: %v", err)
+		return nil, err
+	}
+
+	// Published files are not scanned, so they are held to the permissive scan policy.
+	scanPolicy := manifest.ScanPolicy{}
+	header := manifestHeader(rows, scanPolicy)
+	manifest.AssignTargetPaths(rows, scanPolicy)
+	rows, nextCursor := page.apply(rows)
+
+	// Discover requests are anonymous, so only the default and bucket bounds of the policy apply, and no download quota.
+	presigner := manifest.NewPresigner(S3Client, BucketOptions).
+		WithExpiry(manifest.PresignExpiry{Policy: expiryPolicy, Requested: presignExpiry})
+	entries, blocked, pageSize, err := presignManifestPage(ctx, presigner, scanPolicy, nil, rows)
+	if err != nil {
+		h.logger.Errorf("failed to presign published download manifest entry: %v", err)
+		return nil, err
+	}
+	// The file ids of published files are those of the Discover database, which cannot be re-signed by id.
+	for i := range entries {
+		entries[i].FileId = 0
+	}
+	if err := h.recordDownloadIssuance(ctx, models.DownloadIssuance{
+		PublishedDatasetId: publishedDatasetId,
+		PublishedVersion:   version,
+		Source:             models.DownloadAuditPublishedManifest,
+		RequestId:          h.requestID,
+		IssuedAt:           time.Now(),
+		Buckets:            presigner.Issued(),
+	}); err != nil {
+		h.logger.Errorf("failed to record published download issuance: %v", err)
+		return nil, err
+	}
+
+	Metrics.Count("PublishedManifestFiles", len(entries))
+	Metrics.Bytes("PublishedManifestBytes", pageSize)
+	h.logger.Infof("published download manifest page: %d of %d files (%d bytes) of version %d of published dataset %d",
+		len(entries), header.Count, pageSize, version, publishedDatasetId)
+
+	if format != manifest.FormatJSON {
+		return buildManifestFileResponse(format, entries)
+	}
+	resp := models.DownloadManifestResponse{
+		Header:     header,
+		Data:       entries,
+		Blocked:    blocked,
+		NextCursor: nextCursor,
+	}
+	return h.buildResponse(resp, http.StatusOK)
+}
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDiscoverDownloadManifest_InvalidRequest verifies that the public /discover/download-manifest
+// endpoint validates its query params before any DB lookup.
+func TestDiscoverDownloadManifest_InvalidRequest(t *testing.T) {
+	tests := map[string]struct {
+		params           map[string]string
+		expectedContains string
+	}{
+		"missing dataset_id":  {map[string]string{"version": "1"}, "'dataset_id' must be a positive integer"},
+		"non-numeric dataset": {map[string]string{"dataset_id": "N:dataset:abc", "version": "1"}, "'dataset_id' must be a positive integer"},
+		"missing version":     {map[string]string{"dataset_id": "42"}, "'version' must be a positive integer"},
+		"zero version":        {map[string]string{"dataset_id": "42", "version": "0"}, "'version' must be a positive integer"},
+		"unknown format":      {map[string]string{"dataset_id": "42", "version": "1", "format": "xml"}, "query param 'format' is invalid"},
+		"limit out of range":  {map[string]string{"dataset_id": "42", "version": "1", "limit": "0"}, "query param 'limit' must be an integer"},
+		"csv with cursor":     {map[string]string{"dataset_id": "42", "version": "1", "format": "csv", "cursor": "abc"}, "can only be used with format=json"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := newTestRequest("GET", "/discover/download-manifest", "discover-download-"+name, test.params, "")
+			resp, err := NewDiscoverHandler(req).handleDiscover(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+			assert.Contains(t, resp.Body, test.expectedContains)
+		})
+	}
+}
+
+func TestDiscoverDownloadManifest_DiscoverDBNotConfigured(t *testing.T) {
+	original := DiscoverDB
+	DiscoverDB = nil
+	t.Cleanup(func() { DiscoverDB = original })
+
+	req := newTestRequest("GET", "/discover/download-manifest", "discover-download-no-db",
+		map[string]string{"dataset_id": "42", "version": "1"}, "")
+	resp, err := NewDiscoverHandler(req).handleDiscover(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+func TestDiscoverDownloadManifest_MethodNotAllowed(t *testing.T) {
+	req := newTestRequest("POST", "/discover/download-manifest", "discover-download-post",
+		map[string]string{"dataset_id": "42", "version": "1"}, "")
+	resp, err := NewDiscoverHandler(req).handleDiscover(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
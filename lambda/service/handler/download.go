@@ -2,396 +2,545 @@ package handler
 
 import (
 	"context"
-	"database/sql"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
-	"github.com/aws/aws-sdk-go-v2/service/s3/types"
-	"github.com/pennsieve/packages-service/api/regions"
 	"net/http"
-	"os"
-	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/lib/pq"
+	"github.com/google/uuid"
+	"github.com/pennsieve/packages-service/api/logging"
+	"github.com/pennsieve/packages-service/api/manifest"
+	"github.com/pennsieve/packages-service/api/metrics"
 	"github.com/pennsieve/packages-service/api/models"
+	"github.com/pennsieve/packages-service/service/internal/formats_registry"
 	"github.com/pennsieve/pennsieve-go-core/pkg/authorizer"
 	"github.com/pennsieve/pennsieve-go-core/pkg/models/permissions"
 )
 
-// maxPresignDuration is the maximum duration we will set on a presigned URL.
-// The duration of a presigned URL will be lower than this if the bucket requires us
-// to assume a role for signing. In that case the duration of the presigned URL will be stsCredentialsDuration
-// since the URL will only be usable while the STS credentials used to sign it are valid.
-const maxPresignDuration = 3 * time.Hour
-
-// stsCredentialsDuration is the duration of the STS credentials when we need to assume a role in an external account
-// in order to have the external account pay for a requester pays bucket.
-// The max value for this is one hour since AWS imposes this as a hard limit when one role (Lambda execution role)
-// is assuming another (external publish bucket role).
-const stsCredentialsDuration = 1 * time.Hour
-
-type ExternalBucketConfig map[string]string
-
-const ExternalBucketsRoleMapKey = "EXTERNAL_BUCKETS_ROLE_MAP"
-
-func (h *DownloadManifestHandler) LoadExternalBucketConfigFromEnv() error {
-	raw := os.Getenv(ExternalBucketsRoleMapKey)
-	if raw == "" {
-		return fmt.Errorf("%s not set", ExternalBucketsRoleMapKey)
-	}
-	m := make(map[string]string)
-	if err := json.Unmarshal([]byte(raw), &m); err != nil {
-		return fmt.Errorf("parsing %s value [%s]: %w", ExternalBucketsRoleMapKey, raw, err)
-	}
-	h.externalBucketConfig = m
-	h.logger.Debugf("set %s: %s", ExternalBucketsRoleMapKey, m)
-	return nil
-}
-
 type DownloadManifestHandler struct {
 	RequestHandler
-	externalBucketConfig ExternalBucketConfig
 }
 
 func (h *DownloadManifestHandler) handle(ctx context.Context) (*events.APIGatewayV2HTTPResponse, error) {
 	switch h.method {
 	case "POST":
-		if err := h.LoadExternalBucketConfigFromEnv(); err != nil {
-			return h.logAndBuildError(err.Error(), http.StatusInternalServerError), nil
-		}
 		return h.post(ctx)
 	default:
 		return h.logAndBuildError("method not allowed: "+h.method, http.StatusMethodNotAllowed), nil
 	}
 }
 
-func (h *DownloadManifestHandler) post(ctx context.Context) (*events.APIGatewayV2HTTPResponse, error) {
+// downloadScopeDataset is the value of the scope query param that asks for the whole dataset. It is
+// the same as leaving out nodeIds, but says so explicitly.
+const downloadScopeDataset = "dataset"
+
+// readDownloadRequest checks that the caller may download files of the dataset and parses the
+// models.DownloadRequest body shared by the download endpoints, defaulting its object types and
+// resolving the formats of its filter.
+// If the request is not valid, the error response to return is non-nil.
+func (h *RequestHandler) readDownloadRequest() (string, models.DownloadRequest, *manifest.Filter, *events.APIGatewayV2HTTPResponse) {
+	var request models.DownloadRequest
 	if h.claims.DatasetClaim == nil {
-		return h.logAndBuildError("unauthorized", http.StatusUnauthorized), nil
+		return "", request, nil, h.logAndBuildError("unauthorized", http.StatusUnauthorized)
 	}
 	if authorized := authorizer.HasRole(*h.claims, permissions.ViewFiles); !authorized {
-		return h.logAndBuildError("unauthorized", http.StatusUnauthorized), nil
+		return "", request, nil, h.logAndBuildError("unauthorized", http.StatusUnauthorized)
 	}
 
 	datasetNodeId, ok := h.request.QueryStringParameters["dataset_id"]
 	if !ok {
-		return h.logAndBuildError("query param 'dataset_id' is required", http.StatusBadRequest), nil
+		return "", request, nil, h.logAndBuildError("query param 'dataset_id' is required", http.StatusBadRequest)
 	}
 
-	var request models.DownloadRequest
-	if err := json.Unmarshal([]byte(h.body), &request); err != nil {
-		return h.logAndBuildError(fmt.Sprintf("unable to unmarshal request body: %v", err), http.StatusBadRequest), nil
+	// The body is optional: without one, the request is for every source file of the dataset.
+	if strings.TrimSpace(h.body) != "" {
+		if err := json.Unmarshal([]byte(h.body), &request); err != nil {
+			return "", request, nil, h.logAndBuildError(fmt.Sprintf("unable to unmarshal request body: %v", err), http.StatusBadRequest)
+		}
+	}
+	if scope, ok := h.request.QueryStringParameters["scope"]; ok {
+		if scope != downloadScopeDataset {
+			return "", request, nil, h.logAndBuildError(fmt.Sprintf("query param 'scope' must be '%s'", downloadScopeDataset), http.StatusBadRequest)
+		}
+		if len(request.NodeIds) > 0 {
+			return "", request, nil, h.logAndBuildError(fmt.Sprintf("nodeIds cannot be combined with scope=%s", downloadScopeDataset), http.StatusBadRequest)
+		}
+	}
+	objectTypes, err := manifest.ParseObjectTypes(request.ObjectTypes)
+	if err != nil {
+		return "", request, nil, h.logAndBuildError(err.Error(), http.StatusBadRequest)
+	}
+	request.ObjectTypes = objectTypes
+	if err := resolveFilterFormats(request.Filter); err != nil {
+		return "", request, nil, h.logAndBuildError(err.Error(), http.StatusBadRequest)
+	}
+	filter, err := manifest.NewFilter(request.Filter)
+	if err != nil {
+		return "", request, nil, h.logAndBuildError(err.Error(), http.StatusBadRequest)
+	}
+	return datasetNodeId, request, filter, nil
+}
+
+// scanPolicy returns the scan policy of the dataset, which is the permissive policy unless the dataset or its
+// organization has another.
+func (h *RequestHandler) scanPolicy(ctx context.Context, orgId int, datasetNodeId string) (manifest.ScanPolicy, error) {
+	// Without the store, no download is let through rather than every dataset being treated as permissive.
+	if ScanPolicies == nil {
+		return manifest.ScanPolicy{}, fmt.Errorf("scan policies not configured")
+	}
+	stored, err := ScanPolicies.WithLogging(&logging.Log{Entry: h.logger}).GetScanPolicy(ctx, orgId, datasetNodeId)
+	if err != nil {
+		return manifest.ScanPolicy{}, err
+	}
+	return manifest.NewScanPolicy(stored)
+}
+
+// resolveFilterFormats looks up the FormatIds of filter in the formats registry.
+func resolveFilterFormats(filter *models.DownloadFilter) error {
+	if filter == nil {
+		return nil
+	}
+	filter.Formats = nil
+	for _, id := range filter.FormatIds {
+		format, ok := formatsregistry.Get(id)
+		if !ok {
+			return fmt.Errorf("filter format id %q is not in the formats registry", id)
+		}
+		filter.Formats = append(filter.Formats, models.DownloadFilterFormat{
+			FileTypes:  format.FileTypes,
+			Extensions: format.Extensions,
+		})
+	}
+	return nil
+}
+
+func (h *DownloadManifestHandler) post(ctx context.Context) (*events.APIGatewayV2HTTPResponse, error) {
+	datasetNodeId, request, filter, errResp := h.readDownloadRequest()
+	if errResp != nil {
+		return errResp, nil
+	}
+
+	format, err := parseManifestFormat(h.request.QueryStringParameters)
+	if err != nil {
+		return h.logAndBuildError(err.Error(), http.StatusBadRequest), nil
+	}
+	presignExpiry, err := parsePresignExpiry(h.request.QueryStringParameters)
+	if err != nil {
+		return h.logAndBuildError(err.Error(), http.StatusBadRequest), nil
+	}
+	delivery, err := parseDelivery(h.request.QueryStringParameters)
+	if err != nil {
+		return h.logAndBuildError(err.Error(), http.StatusBadRequest), nil
+	}
+	async, err := parseAsync(h.request.QueryStringParameters)
+	if err != nil {
+		return h.logAndBuildError(err.Error(), http.StatusBadRequest), nil
+	}
+	changes, err := parseManifestChanges(h.request.QueryStringParameters)
+	if err != nil {
+		return h.logAndBuildError(err.Error(), http.StatusBadRequest), nil
+	}
+	// Only the JSON response has room for the snapshot token and removed files.
+	if changes.tracked() && (async || format != manifest.FormatJSON) {
+		return h.logAndBuildError("query params 'snapshot' and 'changed_since' are only supported for synchronous json manifests", http.StatusBadRequest), nil
+	}
+	if async {
+		// The download jobs lambda has no CloudFront signing keys.
+		if delivery == manifest.DeliveryCloudFront {
+			return h.logAndBuildError(fmt.Sprintf("query param 'delivery' cannot be %s with 'async'", delivery), http.StatusBadRequest), nil
+		}
+		return h.submitDownloadJob(ctx, models.DownloadJobKindManifest, datasetNodeId, request, format, presignExpiry)
+	}
+	expiryPolicy, err := manifest.LoadPresignExpiryPolicyFromEnv()
+	if err != nil {
+		return h.logAndBuildError(err.Error(), http.StatusInternalServerError), nil
+	}
+	quotaPolicy, err := manifest.LoadDownloadQuotaPolicyFromEnv()
+	if err != nil {
+		return h.logAndBuildError(err.Error(), http.StatusInternalServerError), nil
 	}
-	if len(request.NodeIds) == 0 {
-		return h.logAndBuildError("nodeIds must not be empty", http.StatusBadRequest), nil
+	urlSigner, errResp, err := h.deliveryURLSigner(ctx, delivery)
+	if errResp != nil {
+		return errResp, nil
+	}
+	if err != nil {
+		h.logger.Error(err)
+		return nil, err
+	}
+
+	page, err := parseManifestPage(h.request.QueryStringParameters)
+	if err != nil {
+		return h.logAndBuildError(err.Error(), http.StatusBadRequest), nil
 	}
 
 	orgId := int(h.claims.OrgClaim.IntId)
 
-	rows, err := h.getPackageHierarchy(ctx, orgId, datasetNodeId, request.NodeIds)
+	rows, err := manifest.GetPackageHierarchy(ctx, PennsieveDB, orgId, datasetNodeId, request.NodeIds, request.ObjectTypes)
 	if err != nil {
 		h.logger.Errorf("failed to query package hierarchy: %v", err)
 		return nil, err
 	}
+	rows = filter.Apply(rows)
+	// Only the JSON response has room to report unavailable packages, on its first page.
+	var unavailable []models.DownloadManifestUnavailableEntry
+	if format == manifest.FormatJSON && page.afterFileId == 0 {
+		if unavailable, err = manifest.GetUnavailablePackages(ctx, PennsieveDB, orgId, datasetNodeId, request.NodeIds); err != nil {
+			h.logger.Errorf("failed to check requested packages: %v", err)
+			return nil, err
+		}
+	}
+	// Packages inside the request that are left out are counted in the header, which only the JSON response has.
+	var unavailableCount int
+	if format == manifest.FormatJSON {
+		if unavailableCount, err = manifest.CountUnavailableDescendants(ctx, PennsieveDB, orgId, datasetNodeId, request.NodeIds); err != nil {
+			h.logger.Errorf("failed to count unavailable packages: %v", err)
+			return nil, err
+		}
+	}
+	scanPolicy, err := h.scanPolicy(ctx, orgId, datasetNodeId)
+	if err != nil {
+		h.logger.Errorf("failed to get scan policy: %v", err)
+		return nil, err
+	}
 
-	if len(rows) == 0 {
+	// A manifest of changes may still have files to remove.
+	if len(rows) == 0 && format == manifest.FormatJSON && !changes.tracked() {
 		resp := models.DownloadManifestResponse{
-			Header: models.DownloadManifestHeader{Count: 0, Size: 0},
-			Data:   []models.DownloadManifestEntry{},
+			Header:      models.DownloadManifestHeader{Count: 0, Size: 0, UnavailableCount: unavailableCount},
+			Data:        []models.DownloadManifestEntry{},
+			Unavailable: unavailable,
+		}
+		if len(request.NodeIds) == 0 && page.afterFileId == 0 {
+			resp.Tree = &models.DownloadManifestFolder{}
 		}
 		return h.buildResponse(resp, http.StatusOK)
 	}
 
-	presignClient := s3.NewPresignClient(S3Client)
+	// The header and target paths describe the whole manifest, so they are worked
+	// out over every row before the rows are cut down to the requested page. Target
+	// paths are assigned over every file, changed or not, so that they match those
+	// of the manifest that changes are since.
+	now := time.Now()
+	manifest.AssignTargetPaths(rows, scanPolicy)
+	var removed []models.DownloadManifestRemovedEntry
+	var snapshot *models.ManifestSnapshot
+	if changes.tracked() {
+		rows, removed, snapshot, errResp, err = h.manifestChangeRows(ctx, changes, orgId, datasetNodeId, rows, scanPolicy, page.afterFileId == 0, now)
+		if errResp != nil {
+			return errResp, nil
+		}
+		if err != nil {
+			h.logger.Errorf("failed to track manifest changes: %v", err)
+			return nil, err
+		}
+	}
+	header := manifestHeader(rows, scanPolicy)
+	if snapshot != nil {
+		header.SnapshotToken = snapshot.Id
+		page.snapshotToken = snapshot.Id
+	}
+	header.UnavailableCount = unavailableCount
+	var tree *models.DownloadManifestFolder
+	if len(request.NodeIds) == 0 && page.afterFileId == 0 && changes.since == "" {
+		folderTree := manifest.FolderTree(rows, scanPolicy)
+		tree = &folderTree
+	}
+	rows, nextCursor := page.apply(rows)
 
-	var entries []models.DownloadManifestEntry
-	var blocked []models.DownloadManifestBlockedEntry
-	var totalSize int64
+	quota, err := h.downloadQuota(ctx, quotaPolicy.Limits(orgId), datasetNodeId, now)
+	if err != nil {
+		h.logger.Errorf("failed to get download quota usage: %v", err)
+		return nil, err
+	}
+	presigner := manifest.NewPresigner(S3Client, BucketOptions).
+		WithExpiry(manifest.PresignExpiry{Policy: expiryPolicy, OrgId: orgId, Requested: presignExpiry})
+	if urlSigner != nil {
+		presigner.WithURLSigner(urlSigner)
+	}
+	entries, blocked, pageSize, err := presignManifestPage(ctx, presigner, scanPolicy, quota, rows)
+	if err != nil {
+		h.logger.Errorf("failed to presign download manifest entry: %v", err)
+		return nil, err
+	}
+	withholdForQuota(&header, rows, blocked)
+	header.Quota = quota.Remaining()
+	errResp, err = h.saveManifestSnapshot(ctx, snapshot, page.snapshotToken, orgId, datasetNodeId, blocked)
+	if errResp != nil {
+		return errResp, nil
+	}
+	if err != nil {
+		h.logger.Errorf("failed to save manifest snapshot: %v", err)
+		return nil, err
+	}
+	if err := h.recordDownloadIssuance(ctx, models.DownloadIssuance{
+		OrgId:         orgId,
+		DatasetNodeId: datasetNodeId,
+		UserNodeId:    h.claims.UserClaim.NodeId,
+		Source:        models.DownloadAuditManifest,
+		RequestId:     h.requestID,
+		IssuedAt:      now,
+		Buckets:       presigner.Issued(),
+	}); err != nil {
+		h.logger.Errorf("failed to record download issuance: %v", err)
+		return nil, err
+	}
 
-	bucketOptionsCache := NewBucketOptionsCache(AssumeRoleClient, stsCredentialsDuration, h.externalBucketConfig)
+	Metrics.Count("ManifestFiles", len(entries))
+	Metrics.Bytes("ManifestBytes", pageSize)
+	if urlSigner != nil {
+		Metrics.Count("CloudFrontManifestFiles", countDelivery(entries, manifest.DeliveryCloudFront))
+	}
+	h.logger.Infof("download manifest page: %d of %d files (%d bytes), %d of %d blocked, for %d requested packages (%d unavailable, %d more inside them)",
+		len(entries), header.Count, pageSize, len(blocked), header.BlockedCount, len(request.NodeIds), len(unavailable), unavailableCount)
 
+	if format != manifest.FormatJSON {
+		return buildManifestFileResponse(format, entries)
+	}
+	resp := models.DownloadManifestResponse{
+		Header:      header,
+		Tree:        tree,
+		Data:        entries,
+		Blocked:     blocked,
+		Unavailable: unavailable,
+		Removed:     removed,
+		NextCursor:  nextCursor,
+	}
+	return h.buildResponse(resp, http.StatusOK)
+}
+
+// presignManifestPage returns the manifest entries of the downloadable rows of a manifest page, the
+// blocked entries of the rows that scanPolicy withholds or that did not fit in quota, and the size of
+// the downloadable files. A nil quota has no limits.
+func presignManifestPage(ctx context.Context, presigner *manifest.Presigner, scanPolicy manifest.ScanPolicy, quota *manifest.Quota, rows []models.PackageHierarchyRow) ([]models.DownloadManifestEntry, []models.DownloadManifestBlockedEntry, int64, error) {
+	entries := []models.DownloadManifestEntry{}
+	var blocked []models.DownloadManifestBlockedEntry
+	var pageSize int64
 	for _, row := range rows {
-		// Gate on scan_status. See pennsieve/scan-service/docs/developer.md
-		// §12 for the permissive-during-scan policy: infected/failed
-		// are blocked (no URL emitted); pending/scanning/clean/unscanned/
-		// not_required pass through with the status surfaced to the
-		// client. Null scan_status (pre-migration rows) is treated as
-		// clean — permissive default.
-		scanStatus := normalizeScanStatus(row.ScanStatus)
-		if scanStatusBlocks(scanStatus) {
-			blocked = append(blocked, models.DownloadManifestBlockedEntry{
-				NodeId:      row.NodeId,
-				FileName:    row.FileName,
-				PackageName: row.PackageName,
-				ScanStatus:  scanStatus,
-			})
+		if scanPolicy.Blocks(row) {
+			blockedEntry := scanPolicy.BlockedEntry(row)
+			Metrics.Count("BlockedByScan", 1, metrics.Dim("ScanStatus", blockedEntry.ScanStatus))
+			blocked = append(blocked, blockedEntry)
+			continue
+		}
+		if !quota.Take(row.Size) {
+			Metrics.Count("BlockedByQuota", 1)
+			blocked = append(blocked, manifest.NewQuotaBlockedEntry(row))
 			continue
 		}
 
-		s3Bucket := row.S3Bucket
-		bucketOptions := bucketOptionsCache.Get(s3Bucket)
-
-		presignResult, err := presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
-			Bucket:                     aws.String(s3Bucket),
-			Key:                        aws.String(row.S3Key),
-			VersionId:                  row.PublishedS3VersionId,
-			RequestPayer:               bucketOptions.RequestPayer,
-			ResponseContentDisposition: aws.String(fmt.Sprintf(`attachment; filename="%s"`, row.PackageName)),
-		}, s3.WithPresignExpires(bucketOptions.PresignDuration),
-			func(options *s3.PresignOptions) {
-				options.ClientOptions = append(options.ClientOptions, bucketOptions.S3Options())
-			})
+		entry, err := presigner.Entry(ctx, row)
 		if err != nil {
-			h.logger.Errorf("failed to generate presigned URL for bucket=%s key=%s: %v", s3Bucket, row.S3Key, err)
-			return nil, fmt.Errorf("failed to generate presigned URL: %w", err)
+			Metrics.Count("PresignFailures", 1, metrics.Dim("Bucket", row.S3Bucket))
+			return nil, nil, 0, err
 		}
+		entries = append(entries, entry)
+		pageSize += row.Size
+	}
+	return entries, blocked, pageSize, nil
+}
 
-		// Path construction: single-file packages use only parent names,
-		// multi-file packages append the package's own name.
-		var path []string
-		if row.PackageFileCount == 1 {
-			path = row.PackageNamePath
-		} else {
-			path = append(row.PackageNamePath, row.PackageName)
-		}
-		if path == nil {
-			path = []string{}
+// parseManifestFormat returns the value of the format query param of POST /download-manifest. Only
+// the JSON format has room for a next page cursor, so the other formats cannot be paged.
+func parseManifestFormat(queryParams map[string]string) (manifest.Format, error) {
+	rawFormat, ok := queryParams["format"]
+	if !ok {
+		return manifest.FormatJSON, nil
+	}
+	format, err := manifest.ParseFormat(rawFormat)
+	if err != nil {
+		return "", fmt.Errorf("query param 'format' is invalid: %w", err)
+	}
+	if format != manifest.FormatJSON {
+		for _, param := range []string{"limit", "cursor"} {
+			if _, ok := queryParams[param]; ok {
+				return "", fmt.Errorf("query param '%s' can only be used with format=json", param)
+			}
 		}
-
-		entries = append(entries, models.DownloadManifestEntry{
-			NodeId:        row.NodeId,
-			FileName:      row.FileName,
-			PackageName:   row.PackageName,
-			Path:          path,
-			URL:           presignResult.URL,
-			Size:          row.Size,
-			FileExtension: getFullExtension(row.S3Key),
-			ScanStatus:    scanStatus,
-		})
-		totalSize += row.Size
 	}
+	return format, nil
+}
 
-	resp := models.DownloadManifestResponse{
-		Header: models.DownloadManifestHeader{
-			Count:        len(entries),
-			Size:         totalSize,
-			BlockedCount: len(blocked),
-		},
-		Data:    entries,
-		Blocked: blocked,
+// parsePresignExpiry returns the value of the expires_in query param: the expiry, in seconds, that the
+// client asks for on presigned URLs, or zero if it is not set. The expiry policy then holds it within
+// the bounds of each bucket.
+func parsePresignExpiry(queryParams map[string]string) (time.Duration, error) {
+	rawExpiresIn, ok := queryParams["expires_in"]
+	if !ok {
+		return 0, nil
 	}
-
-	h.logger.Infof("download manifest: %d files (%d bytes), %d blocked, for %d requested packages", len(entries), totalSize, len(blocked), len(request.NodeIds))
-	return h.buildResponse(resp, http.StatusOK)
+	maxSeconds := int64(manifest.MaxPresignDuration / time.Second)
+	seconds, err := strconv.ParseInt(rawExpiresIn, 10, 64)
+	if err != nil || seconds < 1 || seconds > maxSeconds {
+		return 0, fmt.Errorf("query param 'expires_in' must be a number of seconds between 1 and %d; re-sign URLs that are needed for longer", maxSeconds)
+	}
+	return time.Duration(seconds) * time.Second, nil
 }
 
-// scan_status values that prevent a presigned URL from being issued.
-// See scan-service developer docs §12.
-const (
-	scanStatusInfected = "infected"
-	scanStatusFailed   = "failed"
-)
-
-func scanStatusBlocks(s string) bool {
-	switch s {
-	case scanStatusInfected, scanStatusFailed:
-		return true
+// parseDelivery returns the value of the delivery query param of POST /download-manifest: how the
+// URLs of the manifest are to be served. Only files that CloudFront serves get CloudFront URLs.
+func parseDelivery(queryParams map[string]string) (string, error) {
+	switch delivery := queryParams["delivery"]; delivery {
+	case "", manifest.DeliveryS3:
+		return manifest.DeliveryS3, nil
+	case manifest.DeliveryCloudFront:
+		return delivery, nil
+	default:
+		return "", fmt.Errorf("query param 'delivery' must be '%s' or '%s'", manifest.DeliveryS3, manifest.DeliveryCloudFront)
 	}
-	return false
 }
 
-// normalizeScanStatus turns a nullable DB scan_status into a plain
-// string: null / empty → "" (pre-migration rows, permissive default).
-func normalizeScanStatus(s sql.NullString) string {
-	if !s.Valid {
-		return ""
+// countDelivery counts the entries whose URLs have the given delivery.
+func countDelivery(entries []models.DownloadManifestEntry, delivery string) int {
+	count := 0
+	for _, entry := range entries {
+		if entry.Delivery == delivery {
+			count++
+		}
 	}
-	return s.String
+	return count
 }
 
-// getPackageHierarchy runs the recursive CTE to resolve package node IDs into
-// file-level rows with S3 locations, scoped to the given dataset.
-func (h *DownloadManifestHandler) getPackageHierarchy(ctx context.Context, orgId int, datasetNodeId string, nodeIds []string) ([]models.PackageHierarchyRow, error) {
-	query := fmt.Sprintf(`
-		WITH RECURSIVE parents AS (
-			SELECT
-				id, parent_id, dataset_id, name, type, node_id, size, state,
-				ARRAY[]::VARCHAR[] AS node_id_path,
-				ARRAY[]::VARCHAR[] AS name_path
-			FROM "%[1]d".packages
-			WHERE node_id = ANY($1::text[])
-			AND dataset_id = (SELECT id FROM "%[1]d".datasets WHERE node_id = $2)
-
-			UNION ALL
-
-			SELECT
-				children.id, children.parent_id, children.dataset_id, children.name,
-				children.type, children.node_id, children.size, children.state,
-				(parents.node_id_path || parents.node_id)::VARCHAR[],
-				(parents.name_path || parents.name)::VARCHAR[]
-			FROM "%[1]d".packages children
-			INNER JOIN parents ON parents.id = children.parent_id
-		)
-		SELECT
-			parents.dataset_id,
-			parents.node_id_path,
-			parents.id AS package_id,
-			parents.node_id,
-			parents.type AS package_type,
-			parents.state AS package_state,
-			parents.name_path AS package_name_path,
-			parents.name AS package_name,
-			f_count.package_file_count,
-			f.id AS file_id,
-			f.name AS file_name,
-			f.size,
-			f.file_type,
-			f.s3_bucket,
-			f.s3_key,
-            f.published_s3_version_id,
-            f.scan_status
-		FROM parents
-		JOIN "%[1]d".files f ON f.package_id = parents.id
-		JOIN (
-			SELECT package_id, count(*) AS package_file_count
-			FROM "%[1]d".files
-			WHERE object_type = 'source'
-			GROUP BY package_id
-		) AS f_count ON f_count.package_id = parents.id
-		WHERE parents.type != 'Collection'
-		AND parents.state != 'DELETING'
-		AND parents.state != 'DELETED'
-		AND f.object_type = 'source'`, orgId)
-
-	dbRows, err := PennsieveDB.QueryContext(ctx, query, pq.Array(nodeIds), datasetNodeId)
-	if err != nil {
-		return nil, fmt.Errorf("package hierarchy query failed: %w", err)
-	}
-	defer dbRows.Close()
-
-	var results []models.PackageHierarchyRow
-	for dbRows.Next() {
-		var row models.PackageHierarchyRow
-		if err := dbRows.Scan(
-			&row.DatasetId,
-			pq.Array(&row.NodeIdPath),
-			&row.PackageId,
-			&row.NodeId,
-			&row.PackageType,
-			&row.PackageState,
-			pq.Array(&row.PackageNamePath),
-			&row.PackageName,
-			&row.PackageFileCount,
-			&row.FileId,
-			&row.FileName,
-			&row.Size,
-			&row.FileType,
-			&row.S3Bucket,
-			&row.S3Key,
-			&row.PublishedS3VersionId,
-			&row.ScanStatus,
-		); err != nil {
-			return nil, fmt.Errorf("failed to scan hierarchy row: %w", err)
+// buildManifestFileResponse renders entries in format as a file download. Blocked files are not
+// listed in these formats.
+func buildManifestFileResponse(format manifest.Format, entries []models.DownloadManifestEntry) (*events.APIGatewayV2HTTPResponse, error) {
+	var body strings.Builder
+	writer := format.NewEntryWriter(&body)
+	for _, entry := range entries {
+		if err := writer.Write(entry); err != nil {
+			return nil, fmt.Errorf("failed to render manifest entry for %s as %s: %w", entry.NodeId, format, err)
 		}
-		results = append(results, row)
 	}
-	if err := dbRows.Err(); err != nil {
-		return nil, fmt.Errorf("hierarchy row iteration error: %w", err)
+	if err := writer.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to render manifest as %s: %w", format, err)
 	}
+	return &events.APIGatewayV2HTTPResponse{
+		Body:       body.String(),
+		StatusCode: http.StatusOK,
+		Headers: map[string]string{
+			"Content-Type":        format.ContentType(),
+			"Content-Disposition": fmt.Sprintf(`attachment; filename="%s"`, format.FileName()),
+		},
+	}, nil
+}
 
-	return results, nil
+// manifestHeader totals the downloadable files of rows and those that scanPolicy withholds.
+func manifestHeader(rows []models.PackageHierarchyRow, scanPolicy manifest.ScanPolicy) models.DownloadManifestHeader {
+	header := models.DownloadManifestHeader{}
+	for _, row := range rows {
+		if scanPolicy.Blocks(row) {
+			header.BlockedCount++
+			continue
+		}
+		header.Count++
+		header.Size += row.Size
+	}
+	return header
 }
 
-type BucketOptions struct {
-	Region              string
-	CredentialsProvider *aws.CredentialsCache
-	RequestPayer        types.RequestPayer
-	PresignDuration     time.Duration
+// withholdForQuota moves the files of rows that blocked withholds for quota from the totals of header to its
+// blocked count. manifestHeader counts them as downloadable, since which files fit in the quota is only known
+// once the page has been presigned. Files of other pages are counted as they are on this page.
+func withholdForQuota(header *models.DownloadManifestHeader, rows []models.PackageHierarchyRow, blocked []models.DownloadManifestBlockedEntry) {
+	withheld := quotaWithheldFileIds(blocked)
+	for _, row := range rows {
+		if withheld[row.FileId] {
+			header.Count--
+			header.Size -= row.Size
+			header.BlockedCount++
+		}
+	}
 }
 
-func (o BucketOptions) S3Options() func(s3Options *s3.Options) {
-	return func(s3Options *s3.Options) {
-		s3Options.Region = o.Region
-		if o.CredentialsProvider != nil {
-			s3Options.Credentials = o.CredentialsProvider
+// quotaWithheldFileIds returns the ids of the files that blocked withholds for quota.
+func quotaWithheldFileIds(blocked []models.DownloadManifestBlockedEntry) map[int64]bool {
+	withheld := map[int64]bool{}
+	for _, entry := range blocked {
+		if entry.Reason == models.DownloadBlockedReasonQuotaExceeded {
+			withheld[entry.FileId] = true
 		}
 	}
+	return withheld
 }
 
-type BucketOptionsCache struct {
-	cache                  map[string]BucketOptions
-	assumeRoleClient       stscreds.AssumeRoleAPIClient
-	stsCredentialsDuration time.Duration
-	externalBucketConfig   ExternalBucketConfig
+// maxManifestPageLimit is the largest page a client may request with the limit query param.
+// It keeps a page of presigned URLs well under the 6 MB Lambda response payload limit.
+const maxManifestPageLimit = 5000
+
+// manifestPage is the page of a download manifest requested with the limit and cursor query params.
+// A zero limit means the whole manifest, which is what clients that predate paging receive.
+type manifestPage struct {
+	limit         int
+	afterFileId   int64
+	snapshotToken string
 }
 
-func NewBucketOptionsCache(assumeRoleClient stscreds.AssumeRoleAPIClient, stsCredentialsDuration time.Duration, externalBucketConfig ExternalBucketConfig) *BucketOptionsCache {
-	return &BucketOptionsCache{
-		cache:                  make(map[string]BucketOptions),
-		assumeRoleClient:       assumeRoleClient,
-		stsCredentialsDuration: stsCredentialsDuration,
-		externalBucketConfig:   externalBucketConfig,
-	}
+// manifestCursor is the decoded form of the opaque cursor query param. Pages are cut in file id
+// order, so the last file id on a page is all that is needed to find the start of the next page.
+// The cursor of a manifest with a snapshot carries its token, for later pages to update it.
+type manifestCursor struct {
+	AfterFileId   int64  `json:"afterFileId"`
+	SnapshotToken string `json:"snapshotToken,omitempty"`
 }
 
-func (c *BucketOptionsCache) Get(bucketName string) BucketOptions {
-	bucketOptions, found := c.cache[bucketName]
-	if !found {
-		bucketOptions = BucketOptions{Region: regions.ForBucket(bucketName), PresignDuration: maxPresignDuration}
-		if roleARN, isExternal := c.externalBucketConfig[bucketName]; isExternal {
-			credentialsProvider := aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(c.assumeRoleClient, roleARN, func(options *stscreds.AssumeRoleOptions) {
-				options.RoleSessionName = "packages-service-presign-session"
-				options.Duration = c.stsCredentialsDuration
-				options.Policy = aws.String(`{
-        				"Version": "2012-10-17",
-        				"Statement": [
-            				{
-                				"Effect": "Allow",
-                				"Action": [
-                    				"s3:GetObject",
-                    				"s3:GetObjectVersion"
-                				],
-								"Resource": "*"
-            				}
-        				]
-					}`)
-			}))
-			bucketOptions.CredentialsProvider = credentialsProvider
-			bucketOptions.RequestPayer = types.RequestPayerRequester
-			bucketOptions.PresignDuration = stsCredentialsDuration
+func parseManifestPage(queryParams map[string]string) (manifestPage, error) {
+	var page manifestPage
+	if rawLimit, ok := queryParams["limit"]; ok {
+		limit, err := strconv.Atoi(rawLimit)
+		if err != nil || limit < 1 || limit > maxManifestPageLimit {
+			return manifestPage{}, fmt.Errorf("query param 'limit' must be an integer between 1 and %d", maxManifestPageLimit)
 		}
-		c.cache[bucketName] = bucketOptions
+		page.limit = limit
 	}
-	return bucketOptions
+	if rawCursor, ok := queryParams["cursor"]; ok {
+		cursor, err := decodeManifestCursor(rawCursor)
+		if err != nil {
+			return manifestPage{}, fmt.Errorf("query param 'cursor' is invalid: %w", err)
+		}
+		page.afterFileId = cursor.AfterFileId
+		page.snapshotToken = cursor.SnapshotToken
+	}
+	return page, nil
 }
 
-// Common multi-dot extensions from the Pennsieve file type map.
-var multiDotExtensions = []string{
-	".ome.tiff", ".ome.tif", ".ome.tf2", ".ome.tf8", ".ome.btf", ".ome.xml",
-	".nii.gz", ".tar.gz", ".brukertiff.gz", ".mefd.gz", ".mgh.gz",
+// apply returns the rows on the page along with the cursor of the next page, or an
+// empty cursor if this is the last page. rows must be in file id order.
+func (p manifestPage) apply(rows []models.PackageHierarchyRow) ([]models.PackageHierarchyRow, string) {
+	start := sort.Search(len(rows), func(i int) bool { return rows[i].FileId > p.afterFileId })
+	rows = rows[start:]
+	if p.limit == 0 || len(rows) <= p.limit {
+		return rows, ""
+	}
+	rows = rows[:p.limit]
+	return rows, encodeManifestCursor(manifestCursor{AfterFileId: rows[len(rows)-1].FileId, SnapshotToken: p.snapshotToken})
 }
 
-// getFullExtension returns the file extension without the leading dot.
-// It checks known multi-dot extensions first, then falls back to filepath.Ext.
-func getFullExtension(fileName string) string {
-	lower := strings.ToLower(fileName)
-	best := ""
-	for _, ext := range multiDotExtensions {
-		if strings.HasSuffix(lower, ext) && len(ext) > len(best) {
-			best = ext
-		}
+func encodeManifestCursor(cursor manifestCursor) string {
+	// Marshalling a struct of an int64 and a string cannot fail.
+	raw, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeManifestCursor(encoded string) (manifestCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return manifestCursor{}, err
 	}
-	if best != "" {
-		return best[1:] // strip leading dot
+	var cursor manifestCursor
+	if err := json.Unmarshal(raw, &cursor); err != nil {
+		return manifestCursor{}, err
 	}
-	ext := filepath.Ext(fileName)
-	if ext != "" {
-		return ext[1:]
+	if cursor.AfterFileId < 1 {
+		return manifestCursor{}, fmt.Errorf("cursor file id %d out of range", cursor.AfterFileId)
+	}
+	if cursor.SnapshotToken != "" {
+		if _, err := uuid.Parse(cursor.SnapshotToken); err != nil {
+			return manifestCursor{}, fmt.Errorf("cursor snapshot token is invalid: %w", err)
+		}
 	}
-	return ""
+	return cursor, nil
 }
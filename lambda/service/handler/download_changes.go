@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/uuid"
+	"github.com/pennsieve/packages-service/api/logging"
+	"github.com/pennsieve/packages-service/api/manifest"
+	"github.com/pennsieve/packages-service/api/models"
+	"github.com/pennsieve/packages-service/api/store"
+)
+
+// manifestChanges is what the snapshot and changed_since query params of POST /download-manifest ask for: a
+// snapshot token for the manifest, and only the changes since the manifest of the since token.
+type manifestChanges struct {
+	snapshot bool
+	since    string
+}
+
+// tracked reports whether the manifest gets a snapshot token, which it does if it is of changes since another.
+func (c manifestChanges) tracked() bool {
+	return c.snapshot || c.since != ""
+}
+
+func parseManifestChanges(queryParams map[string]string) (manifestChanges, error) {
+	var changes manifestChanges
+	if rawSnapshot, ok := queryParams["snapshot"]; ok {
+		snapshot, err := strconv.ParseBool(rawSnapshot)
+		if err != nil {
+			return manifestChanges{}, fmt.Errorf("query param 'snapshot' must be true or false")
+		}
+		changes.snapshot = snapshot
+	}
+	if since, ok := queryParams["changed_since"]; ok {
+		if _, err := uuid.Parse(since); err != nil {
+			return manifestChanges{}, fmt.Errorf("query param 'changed_since' must be the snapshotToken of a previous manifest")
+		}
+		changes.since = since
+	}
+	return changes, nil
+}
+
+// manifestChangeRows returns the rows of the files added or changed since the snapshot of changes.since, and the files
+// to remove, or rows unchanged if changes.since is empty. On the first page it also returns a snapshot of rows, which
+// saveManifestSnapshot saves once the page has been presigned. rows must have their target paths assigned.
+// If the request is not valid, the error response to return is non-nil.
+func (h *DownloadManifestHandler) manifestChangeRows(ctx context.Context, changes manifestChanges, orgId int, datasetNodeId string, rows []models.PackageHierarchyRow, scanPolicy manifest.ScanPolicy, firstPage bool, now time.Time) ([]models.PackageHierarchyRow, []models.DownloadManifestRemovedEntry, *models.ManifestSnapshot, *events.APIGatewayV2HTTPResponse, error) {
+	snapshots, errResp := h.manifestSnapshots()
+	if errResp != nil {
+		return nil, nil, nil, errResp, nil
+	}
+
+	var previous *models.ManifestSnapshot
+	if changes.since != "" {
+		var err error
+		if previous, err = snapshots.GetManifestSnapshot(ctx, changes.since); err != nil {
+			return nil, nil, nil, nil, err
+		}
+		if previous == nil {
+			return nil, nil, nil, h.logAndBuildError(fmt.Sprintf("query param 'changed_since' is not a snapshot token, or has expired after %d days; request the whole manifest with snapshot=true", store.ManifestSnapshotRetentionDays), http.StatusBadRequest), nil
+		}
+		if previous.OrgId != orgId || previous.DatasetNodeId != datasetNodeId {
+			return nil, nil, nil, h.logAndBuildError("query param 'changed_since' is the snapshot token of a manifest of another dataset", http.StatusBadRequest), nil
+		}
+	}
+
+	var snapshot *models.ManifestSnapshot
+	if firstPage {
+		newSnapshot := manifest.NewSnapshot(uuid.NewString(), orgId, datasetNodeId, rows, scanPolicy, now)
+		snapshot = &newSnapshot
+	}
+	if previous == nil {
+		return rows, nil, snapshot, nil, nil
+	}
+	changed, removed := manifest.Changes(*previous, rows, scanPolicy)
+	if !firstPage {
+		removed = nil
+	}
+	return changed, removed, snapshot, nil, nil
+}
+
+// saveManifestSnapshot saves the snapshot of the manifest, taken on its first page, once the files of a page have
+// been presigned. Files of the page that the quota withheld are left out of it, so that the next sync counts them as
+// added. snapshot is the new snapshot on the first page; on later pages it is nil, and the snapshot with the token
+// of the cursor is updated instead, if the page withheld any files. Pages can only be requested one after another,
+// since each needs the cursor of the last, so updates of a snapshot do not race.
+// If the request is not valid, the error response to return is non-nil.
+func (h *DownloadManifestHandler) saveManifestSnapshot(ctx context.Context, snapshot *models.ManifestSnapshot, snapshotToken string, orgId int, datasetNodeId string, blocked []models.DownloadManifestBlockedEntry) (*events.APIGatewayV2HTTPResponse, error) {
+	withheld := quotaWithheldFileIds(blocked)
+	if snapshot == nil && (snapshotToken == "" || len(withheld) == 0) {
+		return nil, nil
+	}
+	snapshots, errResp := h.manifestSnapshots()
+	if errResp != nil {
+		return errResp, nil
+	}
+	if snapshot == nil {
+		var err error
+		if snapshot, err = snapshots.GetManifestSnapshot(ctx, snapshotToken); err != nil {
+			return nil, err
+		}
+		// An expired snapshot cannot be synced from, so there is nothing to update.
+		if snapshot == nil {
+			return nil, nil
+		}
+		if snapshot.OrgId != orgId || snapshot.DatasetNodeId != datasetNodeId {
+			return h.logAndBuildError("query param 'cursor' is of a manifest of another dataset", http.StatusBadRequest), nil
+		}
+	}
+	updated := manifest.WithoutFiles(*snapshot, withheld)
+	return nil, snapshots.PutManifestSnapshot(ctx, updated)
+}
+
+func (h *DownloadManifestHandler) manifestSnapshots() (store.ManifestSnapshots, *events.APIGatewayV2HTTPResponse) {
+	snapshotStore := store.NewManifestSnapshotStoreFromEnv(S3Client)
+	if snapshotStore == nil {
+		return nil, h.logAndBuildError("manifest snapshots not configured", http.StatusServiceUnavailable)
+	}
+	return snapshotStore.WithLogging(&logging.Log{Entry: h.logger}), nil
+}
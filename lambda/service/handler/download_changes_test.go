@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/uuid"
+	"github.com/pennsieve/packages-service/api/manifest"
+	"github.com/pennsieve/packages-service/api/models"
+	"github.com/pennsieve/packages-service/api/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupManifestSnapshotsBucket points S3Client at a test bucket for manifest snapshots. Call it after setupS3Client.
+func setupManifestSnapshotsBucket(t *testing.T) {
+	t.Helper()
+	S3Client = s3.NewFromConfig(store.GetTestAWSConfig(t), func(options *s3.Options) {
+		options.BaseEndpoint = aws.String(store.GetTestMinioURL())
+		options.UsePathStyle = true
+	})
+	bucket := "download-jobs-" + strings.ToLower(store.RandString(8))
+	s3Fixture := store.NewS3Fixture(t, S3Client, &s3.CreateBucketInput{Bucket: aws.String(bucket)})
+	t.Cleanup(s3Fixture.Teardown)
+	t.Setenv(store.DownloadJobsBucketEnvKey, bucket)
+}
+
+func TestDownloadManifest_ChangedSince(t *testing.T) {
+	setupDownloadTestDB(t)
+	setupS3Client(t)
+	setupManifestSnapshotsBucket(t)
+	setupExternalBucketConfig(t, nil)
+
+	requestManifest := func(nodeIds []string, queryParams map[string]string) models.DownloadManifestResponse {
+		t.Helper()
+		body, _ := json.Marshal(models.DownloadRequest{NodeIds: nodeIds})
+		queryParams["dataset_id"] = "N:dataset:dl-test"
+		req := newTestRequest("POST", "/download-manifest", "test-req-changes", queryParams, string(body))
+		resp, err := NewHandler(req, editorClaims(2, "N:dataset:dl-test")).WithDefaultService().handle(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode, resp.Body)
+		var manifest models.DownloadManifestResponse
+		require.NoError(t, json.Unmarshal([]byte(resp.Body), &manifest))
+		return manifest
+	}
+	nodeIds := []string{"N:package:dl-standalone", "N:collection:dl-root"}
+
+	full := requestManifest(nodeIds, map[string]string{"snapshot": "true"})
+	assert.Equal(t, 4, full.Header.Count)
+	require.NotEmpty(t, full.Header.SnapshotToken)
+	for _, entry := range full.Data {
+		assert.Empty(t, entry.Change)
+	}
+
+	unchanged := requestManifest(nodeIds, map[string]string{"changed_since": full.Header.SnapshotToken})
+	assert.Equal(t, 0, unchanged.Header.Count)
+	assert.Empty(t, unchanged.Data)
+	assert.Empty(t, unchanged.Removed)
+	assert.NotEmpty(t, unchanged.Header.SnapshotToken)
+	assert.NotEqual(t, full.Header.SnapshotToken, unchanged.Header.SnapshotToken)
+
+	// The standalone package leaving the selection is as if it were deleted.
+	narrowed := requestManifest([]string{"N:collection:dl-root"}, map[string]string{"changed_since": full.Header.SnapshotToken})
+	assert.Empty(t, narrowed.Data)
+	assert.Equal(t, []models.DownloadManifestRemovedEntry{{NodeId: "N:package:dl-standalone", TargetPath: "image.ome.tiff"}}, narrowed.Removed)
+
+	widened := requestManifest(nodeIds, map[string]string{"changed_since": narrowed.Header.SnapshotToken})
+	require.Len(t, widened.Data, 1)
+	assert.Equal(t, "N:package:dl-standalone", widened.Data[0].NodeId)
+	assert.Equal(t, models.DownloadChangeAdded, widened.Data[0].Change)
+	assert.Empty(t, widened.Removed)
+}
+
+func TestDownloadManifest_ChangedSinceInvalid(t *testing.T) {
+	setupDownloadTestDB(t)
+	setupS3Client(t)
+	setupManifestSnapshotsBucket(t)
+	setupExternalBucketConfig(t, nil)
+
+	for name, queryParams := range map[string]map[string]string{
+		"not a token":        {"changed_since": "yesterday"},
+		"unknown token":      {"changed_since": uuid.NewString()},
+		"snapshot not bool":  {"snapshot": "yes"},
+		"non-json format":    {"changed_since": uuid.NewString(), "format": "csv"},
+		"async with changes": {"snapshot": "true", "async": "true"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			queryParams["dataset_id"] = "N:dataset:dl-test"
+			body, _ := json.Marshal(models.DownloadRequest{NodeIds: []string{"N:package:dl-standalone"}})
+			req := newTestRequest("POST", "/download-manifest", "test-req-changes-invalid", queryParams, string(body))
+			resp, err := NewHandler(req, editorClaims(2, "N:dataset:dl-test")).WithDefaultService().handle(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		})
+	}
+}
+
+func TestDownloadManifest_ChangedSinceQuota(t *testing.T) {
+	setupDownloadTestDB(t)
+	setupS3Client(t)
+	setupManifestSnapshotsBucket(t)
+	setupExternalBucketConfig(t, nil)
+	setupDownloadAuditTables(t)
+
+	requestManifest := func(queryParams map[string]string) models.DownloadManifestResponse {
+		t.Helper()
+		body, _ := json.Marshal(models.DownloadRequest{NodeIds: []string{"N:collection:dl-root"}})
+		queryParams["dataset_id"] = "N:dataset:dl-test"
+		req := newTestRequest("POST", "/download-manifest", "test-req-changes-quota", queryParams, string(body))
+		resp, err := NewHandler(req, editorClaims(2, "N:dataset:dl-test")).WithDefaultService().handle(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode, resp.Body)
+		var manifest models.DownloadManifestResponse
+		require.NoError(t, json.Unmarshal([]byte(resp.Body), &manifest))
+		return manifest
+	}
+	fileNames := func(manifest models.DownloadManifestResponse) []string {
+		var names []string
+		for _, entry := range manifest.Data {
+			names = append(names, entry.FileName)
+		}
+		return names
+	}
+
+	// Files come in file id order: data.csv (1024 bytes), part1.csv (2048) and part2.csv (4096).
+	// The first page of the full manifest withholds part1.csv and part2.csv for quota.
+	t.Setenv(manifest.DownloadQuotaPolicyKey, `{"default": {"userDailyBytes": 2000}}`)
+	full := requestManifest(map[string]string{"snapshot": "true"})
+	assert.Equal(t, []string{"data.csv"}, fileNames(full))
+	require.Len(t, full.Blocked, 2)
+	require.NotEmpty(t, full.Header.SnapshotToken)
+
+	// A later page withholds part2.csv for quota.
+	t.Setenv(manifest.DownloadQuotaPolicyKey, `{"default": {"userDailyBytes": 4000}}`)
+	firstPage := requestManifest(map[string]string{"changed_since": full.Header.SnapshotToken, "limit": "1"})
+	assert.Equal(t, []string{"part1.csv"}, fileNames(firstPage))
+	assert.Equal(t, models.DownloadChangeAdded, firstPage.Data[0].Change)
+	require.NotEmpty(t, firstPage.Header.SnapshotToken)
+	require.NotEmpty(t, firstPage.NextCursor)
+	secondPage := requestManifest(map[string]string{"changed_since": full.Header.SnapshotToken, "limit": "1", "cursor": firstPage.NextCursor})
+	assert.Empty(t, secondPage.Data)
+	require.Len(t, secondPage.Blocked, 1)
+	assert.Equal(t, models.DownloadBlockedReasonQuotaExceeded, secondPage.Blocked[0].Reason)
+
+	// Only the file withheld by the last sync is still to download.
+	t.Setenv(manifest.DownloadQuotaPolicyKey, `{}`)
+	next := requestManifest(map[string]string{"changed_since": firstPage.Header.SnapshotToken})
+	assert.Equal(t, []string{"part2.csv"}, fileNames(next))
+	assert.Equal(t, models.DownloadChangeAdded, next.Data[0].Change)
+	assert.Empty(t, next.Removed)
+}
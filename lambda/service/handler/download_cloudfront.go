@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/feature/cloudfront/sign"
+	"github.com/pennsieve/packages-service/api/manifest"
+	"github.com/pennsieve/packages-service/api/models"
+)
+
+// errCloudFrontNotConfigured is returned when CloudFront delivery is requested but the distribution domain
+// or the signing keys are not available.
+var errCloudFrontNotConfigured = errors.New("CloudFront delivery is not configured")
+
+// cloudFrontURLSigner signs CloudFront URLs for the files of an organization's storage bucket, which the
+// distribution serves under the organization's path prefix. Files of other buckets, and files pinned to an
+// S3 version, are left to be presigned for S3.
+type cloudFrontURLSigner struct {
+	pathPrefix    string
+	defaultBucket string
+	signer        *sign.URLSigner
+}
+
+// newCloudFrontURLSigner returns the CloudFront URL signer for the caller's organization, loading the signing
+// keys from Secrets Manager if they have not been loaded yet.
+func (h *RequestHandler) newCloudFrontURLSigner(ctx context.Context) (*cloudFrontURLSigner, error) {
+	if cloudfrontDistributionDomain == "" {
+		return nil, errCloudFrontNotConfigured
+	}
+	cfHandler := CloudFrontSignedURLHandler{RequestHandler: *h}
+	if cloudfrontPrivateKey == nil {
+		if secretName, ok := os.LookupEnv("CLOUDFRONT_SIGNING_KEYS_SECRET_NAME"); ok {
+			if err := cfHandler.loadKeysFromSecretsManager(ctx, secretName); err != nil {
+				h.logger.WithError(err).Warn("failed to load CloudFront signing keys")
+			}
+		}
+	}
+	if cloudfrontPrivateKey == nil {
+		return nil, errCloudFrontNotConfigured
+	}
+
+	pathPrefix, err := cfHandler.getOrganizationCloudFrontPath(ctx, h.claims.OrgClaim.IntId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get organization CloudFront path: %w", err)
+	}
+	return &cloudFrontURLSigner{
+		pathPrefix: pathPrefix,
+		// Organizations without a storage bucket of their own use the main storage bucket, which the
+		// distribution serves without a path prefix.
+		defaultBucket: os.Getenv("VIEWER_ASSETS_BUCKET"),
+		signer:        sign.NewURLSigner(cloudfrontKeyID, cloudfrontPrivateKey),
+	}, nil
+}
+
+// deliveryURLSigner returns the URL signer for delivery, or nil if URLs are to be presigned for S3.
+// If CloudFront delivery is not configured, the error response to return is non-nil.
+func (h *RequestHandler) deliveryURLSigner(ctx context.Context, delivery string) (manifest.URLSigner, *events.APIGatewayV2HTTPResponse, error) {
+	if delivery != manifest.DeliveryCloudFront {
+		return nil, nil, nil
+	}
+	cloudFrontSigner, err := h.newCloudFrontURLSigner(ctx)
+	if errors.Is(err, errCloudFrontNotConfigured) {
+		return nil, h.logAndBuildError(err.Error(), http.StatusServiceUnavailable), nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to set up CloudFront delivery: %w", err)
+	}
+	return cloudFrontSigner, nil, nil
+}
+
+// serves reports whether the distribution serves bucket under the signer's path prefix.
+func (s *cloudFrontURLSigner) serves(bucket string) bool {
+	if s.pathPrefix == "" {
+		return s.defaultBucket != "" && bucket == s.defaultBucket
+	}
+	return "/"+generateDeterministicPath(bucket) == s.pathPrefix
+}
+
+func (s *cloudFrontURLSigner) SignURL(row models.PackageHierarchyRow, expiresAt time.Time) (string, bool, error) {
+	// CloudFront does not pass the versionId of a pinned file on to S3.
+	if !s.serves(row.S3Bucket) || row.PublishedS3VersionId != nil {
+		return "", false, nil
+	}
+	objectURL := url.URL{Scheme: "https", Host: cloudfrontDistributionDomain, Path: s.pathPrefix + "/" + row.S3Key}
+	signedURL, err := s.signer.Sign(objectURL.String(), expiresAt)
+	if err != nil {
+		return "", false, err
+	}
+	return signedURL, true, nil
+}
+
+func (s *cloudFrontURLSigner) Delivery() string {
+	return manifest.DeliveryCloudFront
+}
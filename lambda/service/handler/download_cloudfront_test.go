@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/cloudfront/sign"
+	"github.com/pennsieve/packages-service/api/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloudFrontURLSigner_SignURL(t *testing.T) {
+	setupCloudFrontConfig()
+	defer resetCloudFrontConfig()
+
+	versionId := "v1"
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	for name, test := range map[string]struct {
+		pathPrefix   string
+		row          models.PackageHierarchyRow
+		expectedPath string
+	}{
+		"org bucket": {
+			pathPrefix:   "/" + generateDeterministicPath("org-bucket"),
+			row:          models.PackageHierarchyRow{S3Bucket: "org-bucket", S3Key: "org2/data.csv"},
+			expectedPath: "/" + generateDeterministicPath("org-bucket") + "/org2/data.csv",
+		},
+		"default bucket": {
+			row:          models.PackageHierarchyRow{S3Bucket: "main-storage", S3Key: "org2/data.csv"},
+			expectedPath: "/org2/data.csv",
+		},
+		"other bucket": {
+			pathPrefix: "/" + generateDeterministicPath("org-bucket"),
+			row:        models.PackageHierarchyRow{S3Bucket: "publish-bucket", S3Key: "org2/data.csv"},
+		},
+		"default bucket not served with a prefix": {
+			pathPrefix: "/" + generateDeterministicPath("org-bucket"),
+			row:        models.PackageHierarchyRow{S3Bucket: "main-storage", S3Key: "org2/data.csv"},
+		},
+		"version pinned": {
+			pathPrefix: "/" + generateDeterministicPath("org-bucket"),
+			row:        models.PackageHierarchyRow{S3Bucket: "org-bucket", S3Key: "org2/data.csv", PublishedS3VersionId: &versionId},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			signer := &cloudFrontURLSigner{
+				pathPrefix:    test.pathPrefix,
+				defaultBucket: "main-storage",
+				signer:        sign.NewURLSigner(cloudfrontKeyID, cloudfrontPrivateKey),
+			}
+			signedURL, ok, err := signer.SignURL(test.row, expiresAt)
+			require.NoError(t, err)
+			if test.expectedPath == "" {
+				assert.False(t, ok)
+				assert.Empty(t, signedURL)
+				return
+			}
+			require.True(t, ok)
+			parsed, err := url.Parse(signedURL)
+			require.NoError(t, err)
+			assert.Equal(t, "https", parsed.Scheme)
+			assert.Equal(t, "test.cloudfront.net", parsed.Host)
+			assert.Equal(t, test.expectedPath, parsed.Path)
+			assert.Equal(t, strconv.FormatInt(expiresAt.Unix(), 10), parsed.Query().Get("Expires"))
+			assert.NotEmpty(t, parsed.Query().Get("Signature"))
+			assert.Equal(t, "test-key-id", parsed.Query().Get("Key-Pair-Id"))
+		})
+	}
+}
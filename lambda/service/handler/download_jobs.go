@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/uuid"
+	"github.com/pennsieve/packages-service/api/logging"
+	"github.com/pennsieve/packages-service/api/manifest"
+	"github.com/pennsieve/packages-service/api/metrics"
+	"github.com/pennsieve/packages-service/api/models"
+	"github.com/pennsieve/packages-service/api/store"
+	"github.com/pennsieve/pennsieve-go-core/pkg/authorizer"
+	"github.com/pennsieve/pennsieve-go-core/pkg/models/permissions"
+)
+
+// downloadJobLinkDuration is the duration of the presigned links to a job's result objects. The links are
+// signed each time the job status is requested, so a client can always get a fresh one while the job is retained.
+const downloadJobLinkDuration = 1 * time.Hour
+
+// parseAsync returns the value of the async query param of POST /download-manifest. Paging
+// does not apply to asynchronous manifests, which always hold the whole selection.
+func parseAsync(queryParams map[string]string) (bool, error) {
+	rawAsync, ok := queryParams["async"]
+	if !ok {
+		return false, nil
+	}
+	async, err := strconv.ParseBool(rawAsync)
+	if err != nil {
+		return false, fmt.Errorf("query param 'async' must be true or false")
+	}
+	if !async {
+		return false, nil
+	}
+	for _, param := range []string{"limit", "cursor"} {
+		if _, ok := queryParams[param]; ok {
+			return false, fmt.Errorf("query param '%s' cannot be used with 'async'", param)
+		}
+	}
+	return true, nil
+}
+
+func (h *RequestHandler) downloadJobs() store.DownloadJobs {
+	jobStore := store.NewDownloadJobStore(DyDBClient, SQSClient, os.Getenv(store.DownloadJobsTableNameEnvKey), os.Getenv(store.DownloadJobsQueueURLEnvKey))
+	return jobStore.WithLogging(&logging.Log{Entry: h.logger})
+}
+
+// submitDownloadJob queues a job of the given kind for request, to be run by the download jobs lambda.
+// The format and presign expiry are only used by manifest jobs.
+func (h *RequestHandler) submitDownloadJob(ctx context.Context, kind models.DownloadJobKind, datasetNodeId string, request models.DownloadRequest, format manifest.Format, presignExpiry time.Duration) (*events.APIGatewayV2HTTPResponse, error) {
+	unavailable, err := manifest.GetUnavailablePackages(ctx, PennsieveDB, int(h.claims.OrgClaim.IntId), datasetNodeId, request.NodeIds)
+	if err != nil {
+		h.logger.Errorf("failed to check requested packages: %v", err)
+		return nil, err
+	}
+	job := models.DownloadJob{
+		JobId:                uuid.NewString(),
+		Kind:                 kind,
+		OrgId:                int(h.claims.OrgClaim.IntId),
+		DatasetNodeId:        datasetNodeId,
+		UserNodeId:           h.claims.UserClaim.NodeId,
+		NodeIds:              request.NodeIds,
+		Filter:               request.Filter,
+		ObjectTypes:          request.ObjectTypes,
+		Format:               string(format),
+		PresignExpirySeconds: int64(presignExpiry / time.Second),
+		Unavailable:          unavailable,
+	}
+	if err := h.downloadJobs().SubmitJob(ctx, job); err != nil {
+		h.logger.Errorf("failed to submit download %s job: %v", kind, err)
+		return nil, err
+	}
+	Metrics.Count("DownloadJobsSubmitted", 1, metrics.Dim("Kind", string(kind)))
+	h.logger.Infof("queued download %s job %s for %d requested packages", kind, job.JobId, len(request.NodeIds))
+	return h.buildResponse(models.DownloadJobResponse{
+		JobId:       job.JobId,
+		Kind:        job.Kind,
+		Status:      models.DownloadJobQueued,
+		Format:      job.Format,
+		Unavailable: job.Unavailable,
+	}, http.StatusAccepted)
+}
+
+type DownloadArchiveHandler struct {
+	RequestHandler
+}
+
+// handlePost queues a job that writes the requested files to a single ZIP archive. The files are
+// checked by the download jobs lambda, so an archive job is accepted for any selection.
+func (h *DownloadArchiveHandler) handlePost(ctx context.Context) (*events.APIGatewayV2HTTPResponse, error) {
+	datasetNodeId, request, _, errResp := h.readDownloadRequest()
+	if errResp != nil {
+		return errResp, nil
+	}
+	return h.submitDownloadJob(ctx, models.DownloadJobKindArchive, datasetNodeId, request, "", 0)
+}
+
+type DownloadJobsHandler struct {
+	RequestHandler
+}
+
+// handleGet returns the status of a download job. Jobs are only visible to the user that submitted
+// them: their results contain presigned URLs, so any other caller gets a 404.
+func (h *DownloadJobsHandler) handleGet(ctx context.Context, jobId string) (*events.APIGatewayV2HTTPResponse, error) {
+	if h.claims.DatasetClaim == nil {
+		return h.logAndBuildError("unauthorized", http.StatusUnauthorized), nil
+	}
+	if authorized := authorizer.HasRole(*h.claims, permissions.ViewFiles); !authorized {
+		return h.logAndBuildError("unauthorized", http.StatusUnauthorized), nil
+	}
+	if _, err := uuid.Parse(jobId); err != nil {
+		return h.logAndBuildError(fmt.Sprintf("invalid job id: %s", jobId), http.StatusBadRequest), nil
+	}
+
+	job, err := h.downloadJobs().GetJob(ctx, jobId)
+	if err != nil {
+		h.logger.Errorf("failed to get download job %s: %v", jobId, err)
+		return nil, err
+	}
+	if job == nil ||
+		job.OrgId != int(h.claims.OrgClaim.IntId) ||
+		job.DatasetNodeId != h.claims.DatasetClaim.NodeId ||
+		job.UserNodeId != h.claims.UserClaim.NodeId {
+		return h.logAndBuildError(fmt.Sprintf("download job %s not found", jobId), http.StatusNotFound), nil
+	}
+
+	resp := models.DownloadJobResponse{
+		JobId:       job.JobId,
+		Kind:        job.Kind,
+		Status:      job.Status,
+		Format:      job.Format,
+		CreatedAt:   job.CreatedAt,
+		UpdatedAt:   job.UpdatedAt,
+		Header:      job.Header,
+		Unavailable: job.Unavailable,
+		Error:       job.Error,
+	}
+	if job.Status == models.DownloadJobCompleted {
+		if resp.URL, err = presignDownloadJobResult(ctx, job.ResultKey); err != nil {
+			h.logger.Errorf("failed to presign result of download job %s: %v", jobId, err)
+			return nil, err
+		}
+		if job.BlockedKey != "" {
+			if resp.BlockedURL, err = presignDownloadJobResult(ctx, job.BlockedKey); err != nil {
+				h.logger.Errorf("failed to presign blocked list of download job %s: %v", jobId, err)
+				return nil, err
+			}
+		}
+	}
+	return h.buildResponse(resp, http.StatusOK)
+}
+
+func presignDownloadJobResult(ctx context.Context, key string) (string, error) {
+	bucket := os.Getenv(store.DownloadJobsBucketEnvKey)
+	if bucket == "" {
+		return "", errors.New(store.DownloadJobsBucketEnvKey + " not set")
+	}
+	presignResult, err := s3.NewPresignClient(S3Client).PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(downloadJobLinkDuration))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate presigned URL for bucket=%s key=%s: %w", bucket, key, err)
+	}
+	return presignResult.URL, nil
+}
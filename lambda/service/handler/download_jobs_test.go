@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/google/uuid"
+	"github.com/pennsieve/packages-service/api/models"
+	"github.com/pennsieve/packages-service/api/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// setupDownloadJobsTable creates a download jobs table holding jobs and points the handler at it.
+func setupDownloadJobsTable(t *testing.T, jobs ...models.DownloadJob) {
+	t.Helper()
+	dyClient := dynamodb.NewFromConfig(store.GetTestAWSConfig(t), func(options *dynamodb.Options) {
+		options.BaseEndpoint = aws.String(store.GetTestDynamoDBURL())
+	})
+	tableName := "download-jobs-" + store.RandString(8)
+	createTableInput := store.TestCreateDownloadJobTableInput(tableName)
+	var putItemInputs []*dynamodb.PutItemInput
+	for _, job := range jobs {
+		item, err := attributevalue.MarshalMap(job)
+		require.NoError(t, err)
+		putItemInputs = append(putItemInputs, &dynamodb.PutItemInput{TableName: aws.String(tableName), Item: item})
+	}
+	dyFixture := store.NewDynamoDBFixture(t, dyClient, &createTableInput).WithItems(putItemInputs...)
+
+	originalDyDBClient := DyDBClient
+	DyDBClient = dyClient
+	t.Setenv(store.DownloadJobsTableNameEnvKey, tableName)
+	t.Setenv(store.DownloadJobsBucketEnvKey, "pennsieve-test-download-jobs")
+	t.Cleanup(func() {
+		DyDBClient = originalDyDBClient
+		dyFixture.Teardown()
+	})
+}
+
+func TestDownloadJobs_Get(t *testing.T) {
+	setupS3Client(t)
+	now := time.Now().UTC().Truncate(time.Second)
+	completed := models.DownloadJob{
+		JobId:         uuid.NewString(),
+		Kind:          models.DownloadJobKindManifest,
+		Status:        models.DownloadJobCompleted,
+		OrgId:         2,
+		DatasetNodeId: "N:dataset:dl-test",
+		UserNodeId:    "N:user:test-101",
+		NodeIds:       []string{"N:collection:dl-root"},
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		Header:        &models.DownloadManifestHeader{Count: 3, Size: 7168, BlockedCount: 1},
+		ResultKey:     "jobs/completed/manifest.jsonl",
+		BlockedKey:    "jobs/completed/blocked.jsonl",
+	}
+	running := completed
+	running.JobId = uuid.NewString()
+	running.Status = models.DownloadJobRunning
+	running.Header = nil
+	running.ResultKey = ""
+	running.BlockedKey = ""
+	otherUsers := completed
+	otherUsers.JobId = uuid.NewString()
+	otherUsers.UserNodeId = "N:user:test-202"
+	setupDownloadJobsTable(t, completed, running, otherUsers)
+
+	getJob := func(jobId string) *events.APIGatewayV2HTTPResponse {
+		req := newTestRequest("GET", "/download-jobs/"+jobId, "test-req-job",
+			map[string]string{"dataset_id": "N:dataset:dl-test"}, "")
+		handler := NewHandler(req, viewerClaims(2, "N:dataset:dl-test")).WithDefaultService()
+		resp, err := handler.handle(context.Background())
+		require.NoError(t, err)
+		return resp
+	}
+
+	t.Run("completed", func(t *testing.T) {
+		resp := getJob(completed.JobId)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var job models.DownloadJobResponse
+		require.NoError(t, json.Unmarshal([]byte(resp.Body), &job))
+		assert.Equal(t, models.DownloadJobCompleted, job.Status)
+		assert.Equal(t, completed.Header, job.Header)
+		assert.Equal(t, now, job.CreatedAt)
+
+		resultURL, err := url.Parse(job.URL)
+		require.NoError(t, err)
+		assert.Contains(t, resultURL.Host+resultURL.Path, "pennsieve-test-download-jobs")
+		assert.Contains(t, resultURL.Path, completed.ResultKey)
+		assert.Equal(t, "3600", resultURL.Query().Get("X-Amz-Expires"))
+		blockedURL, err := url.Parse(job.BlockedURL)
+		require.NoError(t, err)
+		assert.Contains(t, blockedURL.Path, completed.BlockedKey)
+	})
+
+	t.Run("running", func(t *testing.T) {
+		resp := getJob(running.JobId)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var job models.DownloadJobResponse
+		require.NoError(t, json.Unmarshal([]byte(resp.Body), &job))
+		assert.Equal(t, models.DownloadJobRunning, job.Status)
+		assert.Nil(t, job.Header)
+		assert.Empty(t, job.URL)
+	})
+
+	t.Run("other user's job", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, getJob(otherUsers.JobId).StatusCode)
+	})
+
+	t.Run("unknown job", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, getJob(uuid.NewString()).StatusCode)
+	})
+
+	t.Run("invalid job id", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, getJob("not-a-uuid").StatusCode)
+	})
+}
+
+func TestDownloadArchive_InvalidRequest(t *testing.T) {
+	tests := map[string]struct {
+		method         string
+		queryParams    map[string]string
+		body           string
+		expectedStatus int
+	}{
+		"wrong method":       {"GET", map[string]string{"dataset_id": "N:dataset:dl-test"}, "", http.StatusMethodNotAllowed},
+		"missing dataset_id": {"POST", map[string]string{}, `{"nodeIds": ["N:package:dl-standalone"]}`, http.StatusBadRequest},
+		"malformed body":     {"POST", map[string]string{"dataset_id": "N:dataset:dl-test"}, `{"nodeIds": `, http.StatusBadRequest},
+		"invalid scope":      {"POST", map[string]string{"dataset_id": "N:dataset:dl-test", "scope": "packages"}, "", http.StatusBadRequest},
+		"invalid filter":     {"POST", map[string]string{"dataset_id": "N:dataset:dl-test"}, `{"nodeIds": ["N:package:dl-standalone"], "filter": {"formatIds": ["no-such-format"]}}`, http.StatusBadRequest},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := newTestRequest(test.method, "/download-archive", "test-req-archive", test.queryParams, test.body)
+			handler := NewHandler(req, viewerClaims(2, "N:dataset:dl-test")).WithDefaultService()
+			resp, err := handler.handle(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedStatus, resp.StatusCode, resp.Body)
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pennsieve/packages-service/api/manifest"
+	"github.com/pennsieve/packages-service/api/models"
+	"github.com/pennsieve/pennsieve-go-core/pkg/authorizer"
+	"github.com/pennsieve/pennsieve-go-core/pkg/models/permissions"
+)
+
+// DownloadResignHandler signs the URLs of files of a download manifest again, by file id, so that a client
+// working through a large manifest does not have to request its pages again as URLs expire.
+type DownloadResignHandler struct {
+	RequestHandler
+}
+
+func (h *DownloadResignHandler) handlePost(ctx context.Context) (*events.APIGatewayV2HTTPResponse, error) {
+	if h.claims.DatasetClaim == nil {
+		return h.logAndBuildError("unauthorized", http.StatusUnauthorized), nil
+	}
+	if authorized := authorizer.HasRole(*h.claims, permissions.ViewFiles); !authorized {
+		return h.logAndBuildError("unauthorized", http.StatusUnauthorized), nil
+	}
+	datasetNodeId, ok := h.request.QueryStringParameters["dataset_id"]
+	if !ok {
+		return h.logAndBuildError("query param 'dataset_id' is required", http.StatusBadRequest), nil
+	}
+
+	var request models.DownloadResignRequest
+	if err := json.Unmarshal([]byte(h.body), &request); err != nil {
+		return h.logAndBuildError(fmt.Sprintf("unable to unmarshal request body: %v", err), http.StatusBadRequest), nil
+	}
+	// A request is held to the size of a manifest page, which keeps its response under the Lambda payload limit.
+	if len(request.FileIds) == 0 || len(request.FileIds) > maxManifestPageLimit {
+		return h.logAndBuildError(fmt.Sprintf("fileIds must have between 1 and %d file ids", maxManifestPageLimit), http.StatusBadRequest), nil
+	}
+
+	presignExpiry, err := parsePresignExpiry(h.request.QueryStringParameters)
+	if err != nil {
+		return h.logAndBuildError(err.Error(), http.StatusBadRequest), nil
+	}
+	delivery, err := parseDelivery(h.request.QueryStringParameters)
+	if err != nil {
+		return h.logAndBuildError(err.Error(), http.StatusBadRequest), nil
+	}
+	expiryPolicy, err := manifest.LoadPresignExpiryPolicyFromEnv()
+	if err != nil {
+		return h.logAndBuildError(err.Error(), http.StatusInternalServerError), nil
+	}
+	quotaPolicy, err := manifest.LoadDownloadQuotaPolicyFromEnv()
+	if err != nil {
+		return h.logAndBuildError(err.Error(), http.StatusInternalServerError), nil
+	}
+	urlSigner, errResp, err := h.deliveryURLSigner(ctx, delivery)
+	if errResp != nil {
+		return errResp, nil
+	}
+	if err != nil {
+		h.logger.Error(err)
+		return nil, err
+	}
+
+	orgId := int(h.claims.OrgClaim.IntId)
+
+	rows, err := manifest.GetFiles(ctx, PennsieveDB, orgId, datasetNodeId, request.FileIds)
+	if err != nil {
+		h.logger.Errorf("failed to query files: %v", err)
+		return nil, err
+	}
+	scanPolicy, err := h.scanPolicy(ctx, orgId, datasetNodeId)
+	if err != nil {
+		h.logger.Errorf("failed to get scan policy: %v", err)
+		return nil, err
+	}
+	// Signing a URL again issues it again, so it takes from the download quotas as the manifest did.
+	now := time.Now()
+	quota, err := h.downloadQuota(ctx, quotaPolicy.Limits(orgId), datasetNodeId, now)
+	if err != nil {
+		h.logger.Errorf("failed to get download quota usage: %v", err)
+		return nil, err
+	}
+	presigner := manifest.NewPresigner(S3Client, BucketOptions).
+		WithExpiry(manifest.PresignExpiry{Policy: expiryPolicy, OrgId: orgId, Requested: presignExpiry})
+	if urlSigner != nil {
+		presigner.WithURLSigner(urlSigner)
+	}
+	entries, blocked, pageSize, err := presignManifestPage(ctx, presigner, scanPolicy, quota, rows)
+	if err != nil {
+		h.logger.Errorf("failed to presign download manifest entry: %v", err)
+		return nil, err
+	}
+	if err := h.recordDownloadIssuance(ctx, models.DownloadIssuance{
+		OrgId:         orgId,
+		DatasetNodeId: datasetNodeId,
+		UserNodeId:    h.claims.UserClaim.NodeId,
+		Source:        models.DownloadAuditResign,
+		RequestId:     h.requestID,
+		IssuedAt:      now,
+		Buckets:       presigner.Issued(),
+	}); err != nil {
+		h.logger.Errorf("failed to record download issuance: %v", err)
+		return nil, err
+	}
+
+	resp := models.DownloadResignResponse{
+		Data:    make([]models.DownloadResignedEntry, 0, len(entries)),
+		Blocked: blocked,
+		Missing: missingFileIds(request.FileIds, rows),
+		Quota:   quota.Remaining(),
+	}
+	for _, entry := range entries {
+		resp.Data = append(resp.Data, models.DownloadResignedEntry{
+			FileId:     entry.FileId,
+			NodeId:     entry.NodeId,
+			URL:        entry.URL,
+			ExpiresAt:  entry.ExpiresAt,
+			Resignable: entry.Resignable,
+			Delivery:   entry.Delivery,
+		})
+	}
+
+	Metrics.Count("ResignedFiles", len(entries))
+	Metrics.Bytes("ResignedBytes", pageSize)
+	h.logger.Infof("re-signed %d of %d requested files (%d bytes), %d blocked, %d missing",
+		len(entries), len(request.FileIds), pageSize, len(blocked), len(resp.Missing))
+	return h.buildResponse(resp, http.StatusOK)
+}
+
+// missingFileIds returns the fileIds that none of rows are for, in the order of fileIds, once per id.
+func missingFileIds(fileIds []int64, rows []models.PackageHierarchyRow) []int64 {
+	found := make(map[int64]bool, len(rows))
+	for _, row := range rows {
+		found[row.FileId] = true
+	}
+	var missing []int64
+	for _, fileId := range fileIds {
+		if found[fileId] {
+			continue
+		}
+		found[fileId] = true
+		missing = append(missing, fileId)
+	}
+	return missing
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pennsieve/packages-service/api/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadResign(t *testing.T) {
+	setupDownloadTestDB(t)
+	setupS3Client(t)
+	setupExternalBucketConfig(t, nil)
+
+	body, _ := json.Marshal(models.DownloadRequest{NodeIds: []string{"N:collection:dl-root"}})
+	req := newTestRequest("POST", "/download-manifest", "test-req-resign-manifest",
+		map[string]string{"dataset_id": "N:dataset:dl-test"}, string(body))
+	resp, err := NewHandler(req, editorClaims(2, "N:dataset:dl-test")).WithDefaultService().handle(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode, resp.Body)
+	var manifest models.DownloadManifestResponse
+	require.NoError(t, json.Unmarshal([]byte(resp.Body), &manifest))
+	require.Len(t, manifest.Data, 3)
+
+	// 5005 is the file of a deleted package, 5010 an infected file, and 9999 no file at all.
+	fileIds := []int64{manifest.Data[0].FileId, manifest.Data[1].FileId, manifest.Data[2].FileId, 5005, 5010, 9999}
+	body, _ = json.Marshal(models.DownloadResignRequest{FileIds: fileIds})
+	req = newTestRequest("POST", "/download-manifest/resign", "test-req-resign",
+		map[string]string{"dataset_id": "N:dataset:dl-test", "expires_in": "600"}, string(body))
+	resp, err = NewHandler(req, editorClaims(2, "N:dataset:dl-test")).WithDefaultService().handle(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode, resp.Body)
+
+	var resigned models.DownloadResignResponse
+	require.NoError(t, json.Unmarshal([]byte(resp.Body), &resigned))
+	require.Len(t, resigned.Data, 3)
+	for i, entry := range resigned.Data {
+		assert.Equal(t, manifest.Data[i].FileId, entry.FileId)
+		assert.Equal(t, manifest.Data[i].NodeId, entry.NodeId)
+		assert.NotEmpty(t, entry.URL)
+		assert.WithinDuration(t, time.Now().Add(10*time.Minute), entry.ExpiresAt, time.Minute)
+	}
+	require.Len(t, resigned.Blocked, 1)
+	assert.Equal(t, int64(5010), resigned.Blocked[0].FileId)
+	assert.Equal(t, models.DownloadBlockedReasonScanStatus, resigned.Blocked[0].Reason)
+	assert.Equal(t, []int64{5005, 9999}, resigned.Missing)
+}
+
+func TestDownloadResign_InvalidRequest(t *testing.T) {
+	tooMany, _ := json.Marshal(models.DownloadResignRequest{FileIds: make([]int64, maxManifestPageLimit+1)})
+	for name, body := range map[string]string{
+		"no body":       "",
+		"no file ids":   `{"fileIds": []}`,
+		"too many ids":  string(tooMany),
+		"not a file id": `{"fileIds": ["N:package:dl-standalone"]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := newTestRequest("POST", "/download-manifest/resign", "test-req-resign-invalid",
+				map[string]string{"dataset_id": "N:dataset:dl-test"}, body)
+			resp, err := NewHandler(req, editorClaims(2, "N:dataset:dl-test")).WithDefaultService().handle(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		})
+	}
+}
+
+func TestMissingFileIds(t *testing.T) {
+	rows := []models.PackageHierarchyRow{{FileId: 1}, {FileId: 3}}
+	assert.Equal(t, []int64{4, 2}, missingFileIds([]int64{4, 1, 2, 3, 4}, rows))
+	assert.Empty(t, missingFileIds([]int64{3, 1}, rows))
+}
@@ -2,7 +2,9 @@ package handler
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
@@ -11,14 +13,19 @@ import (
 	"github.com/stretchr/testify/mock"
 	"net/http"
 	"net/url"
+	"os"
 	"slices"
 	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/pennsieve/packages-service/api/manifest"
 	"github.com/pennsieve/packages-service/api/models"
+	"github.com/pennsieve/packages-service/api/regions"
 	"github.com/pennsieve/packages-service/api/store"
 	"github.com/pennsieve/pennsieve-go-core/pkg/authorizer"
 	"github.com/pennsieve/pennsieve-go-core/pkg/models/dataset"
@@ -59,10 +66,13 @@ func viewerClaims(orgId int64, datasetNodeId string) *authorizer.Claims {
 	}
 }
 
+// setupDownloadTestDB loads download-manifest-test.sql, and sets up an empty scan policies table, which manifests
+// need, so that every dataset has the permissive policy unless a test calls setupScanPolicies.
 func setupDownloadTestDB(t *testing.T) *store.TestDB {
 	t.Helper()
 	db := store.OpenDB(t)
 	db.ExecSQLFile("download-manifest-test.sql")
+	setupScanPolicies(t)
 
 	originalDB := PennsieveDB
 	PennsieveDB = db.DB
@@ -77,19 +87,36 @@ func setupDownloadTestDB(t *testing.T) *store.TestDB {
 	return db
 }
 
+// testBucketRegions is the region configuration for the buckets in download-manifest-test.sql.
+// The buckets do not exist in Minio, so they all need an entry here instead of relying on GetBucketLocation.
+var testBucketRegions = map[string]string{
+	"pennsieve-test-storage":      "us-east-1",
+	"pennsieve-test-publish":      "us-east-1",
+	"pennsieve-test-storage-afs1": "af-south-1",
+}
+
 func setupS3Client(t *testing.T) {
 	t.Helper()
 	awsConfig := store.GetTestAWSConfig(t)
 	originalS3 := S3Client
+	originalBucketRegions := BucketRegions
 	S3Client = s3.NewFromConfig(awsConfig)
-	t.Cleanup(func() { S3Client = originalS3 })
+	BucketRegions = regions.NewResolver(S3Client, testBucketRegions)
+	t.Cleanup(func() {
+		S3Client = originalS3
+		BucketRegions = originalBucketRegions
+	})
 }
 
-func setupExternalBucketConfig(t *testing.T, externalBucketConfig ExternalBucketConfig) {
+// setupExternalBucketConfig sets up the shared BucketOptions for the current S3Client, BucketRegions and
+// AssumeRoleClient, so call it after setting those up.
+func setupExternalBucketConfig(t *testing.T, externalBucketConfig manifest.ExternalBucketConfig) {
 	t.Helper()
-	bytes, err := json.Marshal(externalBucketConfig)
-	require.NoError(t, err)
-	t.Setenv(ExternalBucketsRoleMapKey, string(bytes))
+	originalBucketOptions := BucketOptions
+	BucketOptions = manifest.NewBucketOptionsCache(AssumeRoleClient, BucketRegions, manifest.STSCredentialsDuration, externalBucketConfig)
+	t.Cleanup(func() {
+		BucketOptions = originalBucketOptions
+	})
 }
 
 func setupAssumeRoleClient(t *testing.T, assumeRoleClient stscreds.AssumeRoleAPIClient) {
@@ -159,6 +186,9 @@ func TestDownloadManifest_Collection(t *testing.T) {
 	// Should have 3 files: 1 from child-single-file + 2 from child-multi-file
 	assert.Equal(t, 3, manifest.Header.Count)
 	assert.Equal(t, int64(1024+2048+4096), manifest.Header.Size)
+	// uploading-file is left out, and counted rather than listed since it was not requested itself
+	assert.Equal(t, 1, manifest.Header.UnavailableCount)
+	assert.Empty(t, manifest.Unavailable)
 
 	// Verify path logic: single-file packages get parent names only,
 	// multi-file packages get parent names + package name
@@ -170,10 +200,16 @@ func TestDownloadManifest_Collection(t *testing.T) {
 	// child-single-file: 1 source file -> path = [root-collection] (parent only)
 	single := fileNames["data.csv"]
 	assert.Equal(t, []string{"root-collection"}, single.Path)
+	assert.Equal(t, "root-collection/data.csv", single.TargetPath)
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", single.Checksum)
+	assert.Equal(t, "sha256", single.ChecksumAlgorithm)
 
 	// child-multi-file: 2 source files -> path = [root-collection, child-multi-file]
 	multi1 := fileNames["part1.csv"]
 	assert.Equal(t, []string{"root-collection", "child-multi-file"}, multi1.Path)
+	// No checksum was stored, and synchronous manifests don't fall back to the ETag
+	assert.Empty(t, multi1.Checksum)
+	assert.Empty(t, multi1.ChecksumAlgorithm)
 	multi2 := fileNames["part2.csv"]
 	assert.Equal(t, []string{"root-collection", "child-multi-file"}, multi2.Path)
 }
@@ -196,9 +232,15 @@ func TestDownloadManifest_DeletedPackagesExcluded(t *testing.T) {
 	var manifest models.DownloadManifestResponse
 	require.NoError(t, json.Unmarshal([]byte(resp.Body), &manifest))
 
-	// Only the non-deleted file should appear
+	// Only the non-deleted file should appear, and the deleted package is reported
 	assert.Equal(t, 1, manifest.Header.Count)
 	assert.Equal(t, "N:package:dl-standalone", manifest.Data[0].NodeId)
+	require.Len(t, manifest.Unavailable, 1)
+	assert.Equal(t, "N:package:dl-deleted", manifest.Unavailable[0].NodeId)
+	assert.Equal(t, models.DownloadUnavailableDeleted, manifest.Unavailable[0].Reason)
+	assert.Equal(t, "DELETED", manifest.Unavailable[0].State)
+	assert.NotEmpty(t, manifest.Unavailable[0].Message)
+	assert.Zero(t, manifest.Header.UnavailableCount)
 }
 
 func TestDownloadManifest_PublishedPackage(t *testing.T) {
@@ -239,7 +281,7 @@ func TestDownloadManifest_PublishedPackage(t *testing.T) {
 }
 
 // TestDownloadManifest_NonUSPackage indirectly tests that we are setting the
-// region based on bucket name suffix by looking at a query param in the presigned URL.
+// region based on the configured bucket regions by looking at a query param in the presigned URL.
 // Best option without a mockable S3 or presign client.
 func TestDownloadManifest_NonUSPackage(t *testing.T) {
 	setupDownloadTestDB(t)
@@ -282,10 +324,8 @@ func TestDownloadManifest_ExternalPublishBucket(t *testing.T) {
 	setupDownloadTestDB(t)
 	setupS3Client(t)
 	// treat pennsieve-test-publish as an external bucket
-	bucketConfig := ExternalBucketConfig(map[string]string{"pennsieve-test-publish": "pennsieve-test-role-arn"})
-	setupExternalBucketConfig(t, bucketConfig)
-
-	expectedSTSCredentialsDuration := stsCredentialsDuration
+	expectedSTSCredentialsDuration := manifest.STSCredentialsDuration
+	expectedMaxPresignDuration := manifest.MaxPresignDuration
 	mockAssumeRoleClient := new(MockAssumeRoleClient)
 	mockAssumeRoleClient.On("AssumeRole", mock.Anything, mock.MatchedBy(func(input *sts.AssumeRoleInput) bool {
 		return assert.Equal(t, "pennsieve-test-role-arn", *input.RoleArn) &&
@@ -307,6 +347,9 @@ func TestDownloadManifest_ExternalPublishBucket(t *testing.T) {
 		SourceIdentity:   nil,
 	}, nil)
 	setupAssumeRoleClient(t, mockAssumeRoleClient)
+	// treat pennsieve-test-publish as an external bucket
+	bucketConfig := manifest.ExternalBucketConfig{"pennsieve-test-publish": {RoleARN: "pennsieve-test-role-arn", RequesterPays: true}}
+	setupExternalBucketConfig(t, bucketConfig)
 
 	body, _ := json.Marshal(models.DownloadRequest{NodeIds: []string{"N:package:dl-published", "N:package:dl-standalone"}})
 	req := newTestRequest("POST", "/download-manifest", "test-req-400",
@@ -344,8 +387,10 @@ func TestDownloadManifest_ExternalPublishBucket(t *testing.T) {
 	assert.Equal(t, "Pu_BlishedVersionId", publishedURL.Query().Get("versionId"))
 	assert.Equal(t, "requester", publishedURL.Query().Get("x-amz-request-payer"))
 	assert.Contains(t, publishedURL.Query().Get("X-Amz-Credential"), "/us-east-1/s3/")
-	expectedPublishedURLDuration := strconv.FormatInt(int64(stsCredentialsDuration/time.Second), 10)
+	expectedPublishedURLDuration := strconv.FormatInt(int64(expectedSTSCredentialsDuration/time.Second), 10)
 	assert.Equal(t, expectedPublishedURLDuration, publishedURL.Query().Get("X-Amz-Expires"))
+	// The default expiry outlasts the assumed role's credentials
+	assert.True(t, publishedEntry.Resignable)
 	// Single-file package: path should be empty (no parents)
 	assert.Empty(t, publishedEntry.Path)
 
@@ -365,23 +410,186 @@ func TestDownloadManifest_ExternalPublishBucket(t *testing.T) {
 	assert.Empty(t, standaloneURL.Query().Get("versionId"))
 	assert.Empty(t, standaloneURL.Query().Get("x-amz-request-payer"))
 	assert.Contains(t, standaloneURL.Query().Get("X-Amz-Credential"), "/us-east-1/s3/")
-	expectedStandaloneURLDuration := strconv.FormatInt(int64(maxPresignDuration/time.Second), 10)
+	expectedStandaloneURLDuration := strconv.FormatInt(int64(expectedMaxPresignDuration/time.Second), 10)
 	assert.Equal(t, expectedStandaloneURLDuration, standaloneURL.Query().Get("X-Amz-Expires"))
+	assert.False(t, standaloneEntry.Resignable)
 	// Single-file package: path should be empty (no parents)
 	assert.Empty(t, standaloneEntry.Path)
 
 }
 
-func TestDownloadManifest_EmptyNodeIds(t *testing.T) {
-	setupExternalBucketConfig(t, nil)
-	body, _ := json.Marshal(models.DownloadRequest{NodeIds: []string{}})
-	req := newTestRequest("POST", "/download-manifest", "test-req-4",
-		map[string]string{"dataset_id": "N:dataset:dl-test"}, string(body))
-	handler := NewHandler(req, editorClaims(2, "N:dataset:dl-test")).WithDefaultService()
+func TestDownloadManifest_PresignExpiry(t *testing.T) {
+	setupDownloadTestDB(t)
+	setupS3Client(t)
+	mockAssumeRoleClient := new(MockAssumeRoleClient)
+	mockAssumeRoleClient.On("AssumeRole", mock.Anything, mock.Anything, mock.Anything).Return(&sts.AssumeRoleOutput{
+		AssumedRoleUser: &types.AssumedRoleUser{},
+		Credentials: &types.Credentials{
+			AccessKeyId:     aws.String(uuid.NewString()),
+			Expiration:      aws.Time(time.Now().Add(manifest.STSCredentialsDuration)),
+			SecretAccessKey: aws.String(uuid.NewString()),
+			SessionToken:    aws.String(uuid.NewString()),
+		},
+	}, nil)
+	setupAssumeRoleClient(t, mockAssumeRoleClient)
+	setupExternalBucketConfig(t, manifest.ExternalBucketConfig{"pennsieve-test-publish": {RoleARN: "pennsieve-test-role-arn", RequesterPays: true}})
 
-	resp, err := handler.handle(context.Background())
+	policy := manifest.PresignExpiryPolicy{
+		Default: manifest.PresignBounds{MinSeconds: 300},
+		Orgs:    map[int]manifest.PresignBounds{2: {MaxSeconds: 2 * 3600}},
+	}
+	policyJSON, err := json.Marshal(policy)
 	require.NoError(t, err)
-	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	t.Setenv(manifest.PresignExpiryPolicyKey, string(policyJSON))
+
+	tests := map[string]struct {
+		expiresIn                   string
+		expectedStandaloneExpires   int
+		expectedPublishedExpires    int
+		expectedPublishedResignable bool
+	}{
+		"shorter":              {"600", 600, 600, false},
+		"below the minimum":    {"60", 300, 300, false},
+		"longer":               {"5400", 5400, 3600, true},
+		"above the org limit":  {strconv.Itoa(3 * 3600), 2 * 3600, 3600, true},
+		"default is org limit": {"", 2 * 3600, 3600, true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			queryParams := map[string]string{"dataset_id": "N:dataset:dl-test"}
+			if test.expiresIn != "" {
+				queryParams["expires_in"] = test.expiresIn
+			}
+			body, _ := json.Marshal(models.DownloadRequest{NodeIds: []string{"N:package:dl-published", "N:package:dl-standalone"}})
+			req := newTestRequest("POST", "/download-manifest", "test-req-expiry", queryParams, string(body))
+			handler := NewHandler(req, editorClaims(2, "N:dataset:dl-test")).WithDefaultService()
+
+			requestedAt := time.Now().UTC().Truncate(time.Second)
+			resp, err := handler.handle(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, resp.StatusCode, resp.Body)
+
+			var manifest models.DownloadManifestResponse
+			require.NoError(t, json.Unmarshal([]byte(resp.Body), &manifest))
+			require.Len(t, manifest.Data, 2)
+
+			for _, entry := range manifest.Data {
+				expectedExpires, expectedResignable := test.expectedStandaloneExpires, false
+				if entry.NodeId == "N:package:dl-published" {
+					expectedExpires, expectedResignable = test.expectedPublishedExpires, test.expectedPublishedResignable
+				}
+				entryURL, err := url.Parse(entry.URL)
+				require.NoError(t, err)
+				assert.Equal(t, strconv.Itoa(expectedExpires), entryURL.Query().Get("X-Amz-Expires"), entry.NodeId)
+				assert.Equal(t, expectedResignable, entry.Resignable, entry.NodeId)
+				expiresIn := time.Duration(expectedExpires) * time.Second
+				assert.WithinDuration(t, requestedAt.Add(expiresIn), entry.ExpiresAt, 2*time.Second, entry.NodeId)
+			}
+		})
+	}
+}
+
+func TestDownloadManifest_WholeDataset(t *testing.T) {
+	setupDownloadTestDB(t)
+	setupS3Client(t)
+	setupExternalBucketConfig(t, nil)
+
+	emptyNodeIds, _ := json.Marshal(models.DownloadRequest{NodeIds: []string{}})
+	tests := map[string]struct {
+		queryParams map[string]string
+		body        string
+	}{
+		"empty nodeIds": {map[string]string{"dataset_id": "N:dataset:dl-test"}, string(emptyNodeIds)},
+		"no body":       {map[string]string{"dataset_id": "N:dataset:dl-test"}, ""},
+		"dataset scope": {map[string]string{"dataset_id": "N:dataset:dl-test", "scope": "dataset"}, "{}"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := newTestRequest("POST", "/download-manifest", "test-req-4", test.queryParams, test.body)
+			handler := NewHandler(req, editorClaims(2, "N:dataset:dl-test")).WithDefaultService()
+
+			resp, err := handler.handle(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, resp.StatusCode, resp.Body)
+
+			var manifest models.DownloadManifestResponse
+			require.NoError(t, json.Unmarshal([]byte(resp.Body), &manifest))
+
+			// Every source file of the dataset except the deleted package's, with the infected and failed ones blocked
+			expectedSize := int64(1024 + 2048 + 4096 + 8192 + 8192 + 8192 + 100 + 100)
+			// The deleted package and the package still uploading in root-collection are counted as unavailable
+			assert.Equal(t, models.DownloadManifestHeader{Count: 8, Size: expectedSize, BlockedCount: 2, UnavailableCount: 2}, manifest.Header)
+			assert.Len(t, manifest.Data, 8)
+
+			require.NotNil(t, manifest.Tree)
+			assert.Equal(t, models.DownloadManifestFolder{
+				Name:  "",
+				Count: 8,
+				Size:  expectedSize,
+				Folders: []models.DownloadManifestFolder{
+					{
+						Name:  "root-collection",
+						Count: 3,
+						Size:  1024 + 2048 + 4096,
+						Folders: []models.DownloadManifestFolder{
+							{Name: "child-multi-file", Count: 2, Size: 2048 + 4096},
+						},
+					},
+				},
+			}, *manifest.Tree)
+		})
+	}
+}
+
+func TestDownloadManifest_WholeDatasetTreeOnFirstPageOnly(t *testing.T) {
+	setupDownloadTestDB(t)
+	setupS3Client(t)
+	setupExternalBucketConfig(t, nil)
+
+	getPage := func(queryParams map[string]string) models.DownloadManifestResponse {
+		queryParams["dataset_id"] = "N:dataset:dl-test"
+		req := newTestRequest("POST", "/download-manifest", "test-req-tree-page", queryParams, "")
+		handler := NewHandler(req, editorClaims(2, "N:dataset:dl-test")).WithDefaultService()
+
+		resp, err := handler.handle(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode, resp.Body)
+
+		var manifest models.DownloadManifestResponse
+		require.NoError(t, json.Unmarshal([]byte(resp.Body), &manifest))
+		return manifest
+	}
+
+	first := getPage(map[string]string{"limit": "5"})
+	assert.NotNil(t, first.Tree)
+	require.NotEmpty(t, first.NextCursor)
+	second := getPage(map[string]string{"limit": "5", "cursor": first.NextCursor})
+	assert.Nil(t, second.Tree)
+}
+
+func TestDownloadManifest_InvalidScope(t *testing.T) {
+	setupExternalBucketConfig(t, nil)
+
+	tests := map[string]struct {
+		scope            string
+		body             string
+		expectedContains string
+	}{
+		"unknown scope":       {"packages", `{"nodeIds": ["N:package:dl-standalone"]}`, "query param 'scope' must be 'dataset'"},
+		"scope with node ids": {"dataset", `{"nodeIds": ["N:package:dl-standalone"]}`, "cannot be combined with scope=dataset"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := newTestRequest("POST", "/download-manifest", "test-req-scope",
+				map[string]string{"dataset_id": "N:dataset:dl-test", "scope": test.scope}, test.body)
+			handler := NewHandler(req, editorClaims(2, "N:dataset:dl-test")).WithDefaultService()
+
+			resp, err := handler.handle(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+			assert.Contains(t, resp.Body, test.expectedContains)
+		})
+	}
 }
 
 func TestDownloadManifest_MissingDatasetId(t *testing.T) {
@@ -439,6 +647,11 @@ func TestDownloadManifest_NonexistentPackage(t *testing.T) {
 	require.NoError(t, json.Unmarshal([]byte(resp.Body), &manifest))
 	assert.Equal(t, 0, manifest.Header.Count)
 	assert.Empty(t, manifest.Data)
+	assert.Equal(t, []models.DownloadManifestUnavailableEntry{{
+		NodeId:  "N:package:does-not-exist",
+		Reason:  models.DownloadUnavailableNotFound,
+		Message: "No package with this id exists in the dataset.",
+	}}, manifest.Unavailable)
 }
 
 // TestDownloadManifest_ScanStatusGating verifies that files with
@@ -494,30 +707,353 @@ func TestDownloadManifest_ScanStatusGating(t *testing.T) {
 	}
 	assert.Equal(t, "infected", blockedByName["infected-file"].ScanStatus)
 	assert.Equal(t, "failed", blockedByName["failed-file"].ScanStatus)
+	assert.Equal(t, models.DownloadBlockedReasonScanStatus, blockedByName["failed-file"].Reason)
+}
+
+// setupScanPolicies creates a scan policies table holding policies and points the handler at it.
+func setupScanPolicies(t *testing.T, policies ...models.ScanPolicy) {
+	t.Helper()
+	dyClient := dynamodb.NewFromConfig(store.GetTestAWSConfig(t), func(options *dynamodb.Options) {
+		options.BaseEndpoint = aws.String(store.GetTestDynamoDBURL())
+	})
+	tableName := "scan-policies-" + store.RandString(8)
+	tableInput := store.TestCreateScanPolicyTableInput(tableName)
+	dyFixture := store.NewDynamoDBFixture(t, dyClient, &tableInput)
+	for _, policy := range policies {
+		item, err := attributevalue.MarshalMap(policy)
+		require.NoError(t, err)
+		dyFixture.WithItems(&dynamodb.PutItemInput{TableName: aws.String(tableName), Item: item})
+	}
+
+	originalScanPolicies := ScanPolicies
+	ScanPolicies = store.NewScanPolicyStore(dyClient, tableName)
+	t.Cleanup(func() {
+		ScanPolicies = originalScanPolicies
+		dyFixture.Teardown()
+	})
+}
+
+func TestScanPolicy_NotConfigured(t *testing.T) {
+	originalScanPolicies := ScanPolicies
+	ScanPolicies = nil
+	t.Cleanup(func() {
+		ScanPolicies = originalScanPolicies
+	})
+
+	req := newTestRequest("POST", "/download-manifest", "test-req-no-scan-policies", map[string]string{"dataset_id": "N:dataset:dl-test"}, "")
+	_, err := NewHandler(req, editorClaims(2, "N:dataset:dl-test")).scanPolicy(context.Background(), 2, "N:dataset:dl-test")
+	assert.ErrorContains(t, err, "scan policies not configured")
+}
+
+func TestDownloadManifest_StrictScanPolicy(t *testing.T) {
+	setupDownloadTestDB(t)
+	setupS3Client(t)
+	setupExternalBucketConfig(t, nil)
+	setupScanPolicies(t,
+		models.ScanPolicy{OrgId: 2, Scope: models.ScanPolicyScopeOrg, Mode: models.ScanPolicyStrict},
+		models.ScanPolicy{OrgId: 2, Scope: "N:dataset:other", Mode: models.ScanPolicyPermissive},
+	)
+
+	body, _ := json.Marshal(models.DownloadRequest{NodeIds: []string{
+		"N:package:dl-infected",
+		"N:package:dl-pending",
+		"N:package:dl-clean",
+		"N:package:dl-standalone",
+	}})
+	req := newTestRequest("POST", "/download-manifest", "test-req-strict",
+		map[string]string{"dataset_id": "N:dataset:dl-test"}, string(body))
+	resp, err := NewHandler(req, editorClaims(2, "N:dataset:dl-test")).WithDefaultService().handle(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode, resp.Body)
+
+	var downloadManifest models.DownloadManifestResponse
+	require.NoError(t, json.Unmarshal([]byte(resp.Body), &downloadManifest))
+
+	// Only the clean file gets through; pending and never-scanned files are withheld along with infected ones.
+	assert.Equal(t, 1, downloadManifest.Header.Count)
+	assert.Equal(t, 3, downloadManifest.Header.BlockedCount)
+	require.Len(t, downloadManifest.Data, 1)
+	assert.Equal(t, "clean-file", downloadManifest.Data[0].PackageName)
+	blockedByName := map[string]models.DownloadManifestBlockedEntry{}
+	for _, b := range downloadManifest.Blocked {
+		blockedByName[b.PackageName] = b
+		assert.Equal(t, models.DownloadBlockedReasonScanStatus, b.Reason)
+		assert.NotEmpty(t, b.Message)
+		assert.NotEmpty(t, b.Remediation)
+	}
+	assert.Contains(t, blockedByName, "pending-file")
+	assert.Contains(t, blockedByName, "standalone-file")
+	assert.Contains(t, blockedByName, "infected-file")
+}
+
+func TestDownloadManifest_Pagination(t *testing.T) {
+	setupDownloadTestDB(t)
+	setupS3Client(t)
+	setupExternalBucketConfig(t, nil)
+
+	body, _ := json.Marshal(models.DownloadRequest{NodeIds: []string{"N:collection:dl-root"}})
+	getPage := func(queryParams map[string]string) models.DownloadManifestResponse {
+		queryParams["dataset_id"] = "N:dataset:dl-test"
+		req := newTestRequest("POST", "/download-manifest", "test-req-page", queryParams, string(body))
+		handler := NewHandler(req, editorClaims(2, "N:dataset:dl-test")).WithDefaultService()
+
+		resp, err := handler.handle(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var manifest models.DownloadManifestResponse
+		require.NoError(t, json.Unmarshal([]byte(resp.Body), &manifest))
+		return manifest
+	}
+
+	first := getPage(map[string]string{"limit": "2"})
+	require.Len(t, first.Data, 2)
+	require.NotEmpty(t, first.NextCursor)
+	// The header describes the whole manifest, not the page
+	assert.Equal(t, 3, first.Header.Count)
+	assert.Equal(t, int64(1024+2048+4096), first.Header.Size)
+
+	second := getPage(map[string]string{"limit": "2", "cursor": first.NextCursor})
+	require.Len(t, second.Data, 1)
+	assert.Empty(t, second.NextCursor)
+	assert.Equal(t, 3, second.Header.Count)
+
+	var fileNames []string
+	for _, e := range append(first.Data, second.Data...) {
+		fileNames = append(fileNames, e.FileName)
+	}
+	assert.Equal(t, []string{"data.csv", "part1.csv", "part2.csv"}, fileNames)
+}
+
+func TestDownloadManifest_ObjectTypes(t *testing.T) {
+	setupDownloadTestDB(t)
+	setupS3Client(t)
+	setupExternalBucketConfig(t, nil)
+
+	body, _ := json.Marshal(models.DownloadRequest{
+		NodeIds:     []string{"N:collection:dl-root"},
+		ObjectTypes: []string{"source", "view"},
+	})
+	req := newTestRequest("POST", "/download-manifest", "test-req-object-types",
+		map[string]string{"dataset_id": "N:dataset:dl-test"}, string(body))
+	handler := NewHandler(req, editorClaims(2, "N:dataset:dl-test")).WithDefaultService()
+
+	resp, err := handler.handle(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode, resp.Body)
+
+	var manifest models.DownloadManifestResponse
+	require.NoError(t, json.Unmarshal([]byte(resp.Body), &manifest))
+	assert.Equal(t, 4, manifest.Header.Count)
+
+	entries := map[string]models.DownloadManifestEntry{}
+	for _, e := range manifest.Data {
+		entries[e.FileName] = e
+	}
+	assert.Equal(t, "source", entries["data.csv"].ObjectType)
+	assert.Equal(t, "view", entries["data.parquet"].ObjectType)
+	// With its view included, child-single-file has two files and so gets its own directory
+	assert.Equal(t, []string{"root-collection", "child-single-file"}, entries["data.csv"].Path)
+	assert.Equal(t, []string{"root-collection", "child-single-file"}, entries["data.parquet"].Path)
+	assert.Equal(t, "source", entries["part1.csv"].ObjectType)
+}
+
+func TestDownloadManifest_InvalidObjectType(t *testing.T) {
+	setupExternalBucketConfig(t, nil)
+
+	body, _ := json.Marshal(models.DownloadRequest{NodeIds: []string{"N:collection:dl-root"}, ObjectTypes: []string{"thumbnail"}})
+	req := newTestRequest("POST", "/download-manifest", "test-req-invalid-object-type",
+		map[string]string{"dataset_id": "N:dataset:dl-test"}, string(body))
+	handler := NewHandler(req, editorClaims(2, "N:dataset:dl-test")).WithDefaultService()
+
+	resp, err := handler.handle(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, resp.Body, "unsupported object type")
 }
 
-func TestGetFullExtension(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected string
+func TestDownloadManifest_Filter(t *testing.T) {
+	setupDownloadTestDB(t)
+	setupS3Client(t)
+	setupExternalBucketConfig(t, nil)
+
+	tests := map[string]struct {
+		filter            models.DownloadFilter
+		expectedFileNames []string
 	}{
-		{"image.ome.tiff", "ome.tiff"},
-		{"brain.nii.gz", "nii.gz"},
-		{"archive.tar.gz", "tar.gz"},
-		{"document.pdf", "pdf"},
-		{"data.csv", "csv"},
-		{"noext", ""},
-		{"file.ome.tif", "ome.tif"},
-		{"FILE.OME.TIFF", "ome.tiff"},
+		"extension":  {models.DownloadFilter{Extensions: []string{"csv"}}, []string{"data.csv", "part1.csv", "part2.csv"}},
+		"format id":  {models.DownloadFilter{FormatIds: []string{"pdf"}}, nil},
+		"max size":   {models.DownloadFilter{MaxSize: aws.Int64(2048)}, []string{"data.csv", "part1.csv"}},
+		"path glob":  {models.DownloadFilter{Path: "root-collection/child-*"}, []string{"part1.csv", "part2.csv"}},
+		"no matches": {models.DownloadFilter{PackageTypes: []string{"Image"}}, nil},
 	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			body, _ := json.Marshal(models.DownloadRequest{NodeIds: []string{"N:collection:dl-root"}, Filter: &test.filter})
+			req := newTestRequest("POST", "/download-manifest", "test-req-filter",
+				map[string]string{"dataset_id": "N:dataset:dl-test"}, string(body))
+			handler := NewHandler(req, editorClaims(2, "N:dataset:dl-test")).WithDefaultService()
+
+			resp, err := handler.handle(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, resp.StatusCode, resp.Body)
+
+			var manifest models.DownloadManifestResponse
+			require.NoError(t, json.Unmarshal([]byte(resp.Body), &manifest))
+			var fileNames []string
+			for _, e := range manifest.Data {
+				fileNames = append(fileNames, e.FileName)
+			}
+			assert.Equal(t, test.expectedFileNames, fileNames)
+			// The header describes the filtered manifest
+			assert.Equal(t, len(test.expectedFileNames), manifest.Header.Count)
+		})
+	}
+}
 
-	for _, tt := range tests {
-		t.Run(tt.input, func(t *testing.T) {
-			assert.Equal(t, tt.expected, getFullExtension(tt.input))
+func TestDownloadManifest_InvalidFilter(t *testing.T) {
+	setupExternalBucketConfig(t, nil)
+
+	tests := map[string]struct {
+		filter           models.DownloadFilter
+		expectedContains string
+	}{
+		"unknown format id": {models.DownloadFilter{FormatIds: []string{"no-such-format"}}, "not in the formats registry"},
+		"min above max":     {models.DownloadFilter{MinSize: aws.Int64(10), MaxSize: aws.Int64(1)}, "greater than maxSize"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			body, _ := json.Marshal(models.DownloadRequest{NodeIds: []string{"N:collection:dl-root"}, Filter: &test.filter})
+			req := newTestRequest("POST", "/download-manifest", "test-req-invalid-filter",
+				map[string]string{"dataset_id": "N:dataset:dl-test"}, string(body))
+			handler := NewHandler(req, editorClaims(2, "N:dataset:dl-test")).WithDefaultService()
+
+			resp, err := handler.handle(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+			assert.Contains(t, resp.Body, test.expectedContains)
 		})
 	}
 }
 
+func TestDownloadManifest_Formats(t *testing.T) {
+	setupDownloadTestDB(t)
+	setupS3Client(t)
+	setupExternalBucketConfig(t, nil)
+
+	body, _ := json.Marshal(models.DownloadRequest{NodeIds: []string{"N:collection:dl-root"}})
+	for _, tt := range []struct {
+		format              string
+		expectedContentType string
+		expectedFileName    string
+		expectedLines       int
+	}{
+		{"csv", "text/csv; charset=utf-8", "manifest.csv", 4},
+		{"tsv", "text/tab-separated-values; charset=utf-8", "manifest.tsv", 4},
+		{"curl", "text/x-shellscript; charset=utf-8", "download-curl.sh", 6},
+		{"aria2", "text/plain; charset=utf-8", "aria2-input.txt", 6},
+	} {
+		t.Run(tt.format, func(t *testing.T) {
+			req := newTestRequest("POST", "/download-manifest", "test-req-format",
+				map[string]string{"dataset_id": "N:dataset:dl-test", "format": tt.format}, string(body))
+			handler := NewHandler(req, editorClaims(2, "N:dataset:dl-test")).WithDefaultService()
+
+			resp, err := handler.handle(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, resp.StatusCode, resp.Body)
+			assert.Equal(t, tt.expectedContentType, resp.Headers["Content-Type"])
+			assert.Equal(t, fmt.Sprintf(`attachment; filename="%s"`, tt.expectedFileName), resp.Headers["Content-Disposition"])
+			assert.Equal(t, tt.expectedLines, strings.Count(resp.Body, "\n"))
+			assert.Contains(t, resp.Body, "part1.csv")
+		})
+	}
+}
+
+func TestDownloadManifest_InvalidPage(t *testing.T) {
+	setupExternalBucketConfig(t, nil)
+
+	for name, queryParams := range map[string]map[string]string{
+		"zero limit":          {"limit": "0"},
+		"limit too large":     {"limit": strconv.Itoa(maxManifestPageLimit + 1)},
+		"non-numeric limit":   {"limit": "ten"},
+		"non-base64 cursor":   {"cursor": "not a cursor!"},
+		"non-JSON cursor":     {"cursor": "bm90LWpzb24"},
+		"zero file id cursor": {"cursor": encodeManifestCursor(manifestCursor{})},
+		"bad snapshot cursor": {"cursor": encodeManifestCursor(manifestCursor{AfterFileId: 1, SnapshotToken: "yesterday"})},
+		"non-boolean async":   {"async": "soon"},
+		"async with limit":    {"async": "true", "limit": "10"},
+		"unknown format":      {"format": "xml"},
+		"csv with limit":      {"format": "csv", "limit": "10"},
+		"curl with cursor":    {"format": "curl", "cursor": encodeManifestCursor(manifestCursor{AfterFileId: 1})},
+		"zero expires_in":     {"expires_in": "0"},
+		"expires_in too long": {"expires_in": strconv.FormatInt(int64(manifest.MaxPresignDuration/time.Second)+1, 10)},
+		"duration expires_in": {"expires_in": "2h"},
+		"unknown delivery":    {"delivery": "ftp"},
+		"async cloudfront":    {"async": "true", "delivery": "cloudfront"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			queryParams["dataset_id"] = "N:dataset:dl-test"
+			body, _ := json.Marshal(models.DownloadRequest{NodeIds: []string{"N:package:dl-standalone"}})
+			req := newTestRequest("POST", "/download-manifest", "test-req-bad-page", queryParams, string(body))
+			handler := NewHandler(req, editorClaims(2, "N:dataset:dl-test")).WithDefaultService()
+
+			resp, err := handler.handle(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		})
+	}
+}
+
+func TestManifestPage_Apply(t *testing.T) {
+	rows := []models.PackageHierarchyRow{{FileId: 10}, {FileId: 20}, {FileId: 30}}
+	fileIds := func(rows []models.PackageHierarchyRow) []int64 {
+		var ids []int64
+		for _, row := range rows {
+			ids = append(ids, row.FileId)
+		}
+		return ids
+	}
+
+	for name, tt := range map[string]struct {
+		page           manifestPage
+		expectedIds    []int64
+		expectedCursor *manifestCursor
+	}{
+		"no limit":         {page: manifestPage{}, expectedIds: []int64{10, 20, 30}},
+		"first page":       {page: manifestPage{limit: 2}, expectedIds: []int64{10, 20}, expectedCursor: &manifestCursor{AfterFileId: 20}},
+		"last page":        {page: manifestPage{limit: 2, afterFileId: 20}, expectedIds: []int64{30}},
+		"exact last page":  {page: manifestPage{limit: 3}, expectedIds: []int64{10, 20, 30}},
+		"cursor between":   {page: manifestPage{limit: 1, afterFileId: 15}, expectedIds: []int64{20}, expectedCursor: &manifestCursor{AfterFileId: 20}},
+		"cursor past end":  {page: manifestPage{limit: 2, afterFileId: 30}},
+		"cursor, no limit": {page: manifestPage{afterFileId: 10}, expectedIds: []int64{20, 30}},
+		"snapshot token":   {page: manifestPage{limit: 1, snapshotToken: "7d0f6c8e-2b1a-4c3d-9e5f-0a1b2c3d4e5f"}, expectedIds: []int64{10}, expectedCursor: &manifestCursor{AfterFileId: 10, SnapshotToken: "7d0f6c8e-2b1a-4c3d-9e5f-0a1b2c3d4e5f"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			pageRows, nextCursor := tt.page.apply(rows)
+			assert.Equal(t, tt.expectedIds, fileIds(pageRows))
+			if tt.expectedCursor == nil {
+				assert.Empty(t, nextCursor)
+				return
+			}
+			cursor, err := decodeManifestCursor(nextCursor)
+			require.NoError(t, err)
+			assert.Equal(t, *tt.expectedCursor, cursor)
+		})
+	}
+}
+
+func TestWithholdForQuota(t *testing.T) {
+	rows := []models.PackageHierarchyRow{{FileId: 10, Size: 100}, {FileId: 20, Size: 200}, {FileId: 30, Size: 400}}
+	blocked := []models.DownloadManifestBlockedEntry{
+		{FileId: 20, Reason: models.DownloadBlockedReasonQuotaExceeded},
+		{FileId: 40, Reason: models.DownloadBlockedReasonScanStatus},
+	}
+	header := models.DownloadManifestHeader{Count: 5, Size: 1500, BlockedCount: 1}
+
+	withholdForQuota(&header, rows, blocked)
+	assert.Equal(t, models.DownloadManifestHeader{Count: 4, Size: 1300, BlockedCount: 2}, header)
+}
+
 type MockAssumeRoleClient struct {
 	mock.Mock
 }
@@ -526,3 +1062,73 @@ func (m *MockAssumeRoleClient) AssumeRole(ctx context.Context, params *sts.Assum
 	args := m.Called(ctx, params, optFns)
 	return args.Get(0).(*sts.AssumeRoleOutput), args.Error(1)
 }
+
+func TestDownloadManifest_CloudFrontDelivery(t *testing.T) {
+	db := setupDownloadTestDB(t)
+	setupS3Client(t)
+	setupExternalBucketConfig(t, nil)
+	setupCloudFrontConfig()
+	t.Cleanup(resetCloudFrontConfig)
+
+	// Serve org 2's files from pennsieve-test-storage through the distribution
+	var originalStorageBucket sql.NullString
+	require.NoError(t, db.DB.QueryRow("SELECT storage_bucket FROM pennsieve.organizations WHERE id = 2").Scan(&originalStorageBucket))
+	_, err := db.DB.Exec("UPDATE pennsieve.organizations SET storage_bucket = 'pennsieve-test-storage' WHERE id = 2")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		db.DB.Exec("UPDATE pennsieve.organizations SET storage_bucket = $1 WHERE id = 2", originalStorageBucket)
+	})
+
+	body, _ := json.Marshal(models.DownloadRequest{NodeIds: []string{"N:package:dl-standalone", "N:package:dl-published", "N:package:dl-non-us"}})
+	req := newTestRequest("POST", "/download-manifest", "test-req-cloudfront",
+		map[string]string{"dataset_id": "N:dataset:dl-test", "delivery": "cloudfront", "expires_in": "600"}, string(body))
+	handler := NewHandler(req, editorClaims(2, "N:dataset:dl-test")).WithDefaultService()
+
+	resp, err := handler.handle(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode, resp.Body)
+
+	var manifest models.DownloadManifestResponse
+	require.NoError(t, json.Unmarshal([]byte(resp.Body), &manifest))
+	require.Len(t, manifest.Data, 3)
+
+	byNodeId := map[string]models.DownloadManifestEntry{}
+	for _, entry := range manifest.Data {
+		byNodeId[entry.NodeId] = entry
+	}
+
+	standalone := byNodeId["N:package:dl-standalone"]
+	assert.Equal(t, "cloudfront", standalone.Delivery)
+	standaloneURL, err := url.Parse(standalone.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "test.cloudfront.net", standaloneURL.Host)
+	assert.Equal(t, "/"+generateDeterministicPath("pennsieve-test-storage")+"/org2/image.ome.tiff", standaloneURL.Path)
+	assert.Equal(t, strconv.FormatInt(standalone.ExpiresAt.Unix(), 10), standaloneURL.Query().Get("Expires"))
+	assert.NotEmpty(t, standaloneURL.Query().Get("Signature"))
+	assert.Equal(t, "test-key-id", standaloneURL.Query().Get("Key-Pair-Id"))
+
+	// The published file is pinned to an S3 version, and the other is in a bucket the distribution does not serve
+	for _, nodeId := range []string{"N:package:dl-published", "N:package:dl-non-us"} {
+		entry := byNodeId[nodeId]
+		assert.Equal(t, "s3", entry.Delivery, nodeId)
+		entryURL, err := url.Parse(entry.URL)
+		require.NoError(t, err)
+		assert.Equal(t, "600", entryURL.Query().Get("X-Amz-Expires"), nodeId)
+	}
+}
+
+func TestDownloadManifest_CloudFrontNotConfigured(t *testing.T) {
+	setupExternalBucketConfig(t, nil)
+	resetCloudFrontConfig()
+	t.Setenv("CLOUDFRONT_SIGNING_KEYS_SECRET_NAME", "")
+	os.Unsetenv("CLOUDFRONT_SIGNING_KEYS_SECRET_NAME")
+
+	body, _ := json.Marshal(models.DownloadRequest{NodeIds: []string{"N:package:dl-standalone"}})
+	req := newTestRequest("POST", "/download-manifest", "test-req-no-cloudfront",
+		map[string]string{"dataset_id": "N:dataset:dl-test", "delivery": "cloudfront"}, string(body))
+	handler := NewHandler(req, editorClaims(2, "N:dataset:dl-test")).WithDefaultService()
+
+	resp, err := handler.handle(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
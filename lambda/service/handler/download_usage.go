@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pennsieve/packages-service/api/logging"
+	"github.com/pennsieve/packages-service/api/manifest"
+	"github.com/pennsieve/packages-service/api/models"
+	"github.com/pennsieve/packages-service/api/store"
+	"github.com/pennsieve/pennsieve-go-core/pkg/models/role"
+)
+
+// defaultUsageMonths is the number of months, up to and including the current one, that GET /download-usage
+// reports on when no from param is given.
+const defaultUsageMonths = 12
+
+func (h *RequestHandler) downloadAudit() store.DownloadAudit {
+	auditStore := store.NewDownloadAuditStoreFromEnv(DyDBClient)
+	if auditStore == nil {
+		return nil
+	}
+	return auditStore.WithLogging(&logging.Log{Entry: h.logger})
+}
+
+// recordDownloadIssuance records the files that download URLs were issued for in the download audit log.
+// The log is how data governance sees who downloaded what, so callers fail the request if the files cannot
+// be recorded rather than hand out URLs that were not.
+func (h *RequestHandler) recordDownloadIssuance(ctx context.Context, issuance models.DownloadIssuance) error {
+	if len(issuance.Buckets) == 0 {
+		return nil
+	}
+	audit := h.downloadAudit()
+	if audit == nil {
+		h.logger.Warnf("%s or %s not set; not recording download issuance", store.DownloadAuditTableNameEnvKey, store.DownloadUsageTableNameEnvKey)
+		return nil
+	}
+	return audit.RecordIssuance(ctx, issuance)
+}
+
+// downloadQuota returns what is left of the download quotas of limits for the user of the request and
+// the dataset at now, or nil if limits has no limits. Usage is read from the download audit, so quotas
+// are not enforced if it is not configured. Requests that run at the same time can each take what is left,
+// so a quota can be overshot by the size of the pages in flight.
+func (h *RequestHandler) downloadQuota(ctx context.Context, limits manifest.QuotaLimits, datasetNodeId string, now time.Time) (*manifest.Quota, error) {
+	if limits == (manifest.QuotaLimits{}) {
+		return nil, nil
+	}
+	audit := h.downloadAudit()
+	if audit == nil {
+		h.logger.Warnf("%s or %s not set; not enforcing download quotas", store.DownloadAuditTableNameEnvKey, store.DownloadUsageTableNameEnvKey)
+		return nil, nil
+	}
+	return manifest.GetQuota(ctx, audit, limits, h.claims.UserClaim.NodeId, datasetNodeId, now)
+}
+
+type DownloadUsageHandler struct {
+	RequestHandler
+}
+
+// handleGet returns the download usage of a dataset by month and user. The usage shows who downloaded
+// the dataset's files, so it is only available to managers of the dataset.
+func (h *DownloadUsageHandler) handleGet(ctx context.Context) (*events.APIGatewayV2HTTPResponse, error) {
+	if h.claims.DatasetClaim == nil || h.claims.DatasetClaim.Role < role.Manager {
+		return h.logAndBuildError("unauthorized", http.StatusUnauthorized), nil
+	}
+	datasetNodeId, ok := h.queryParams["dataset_id"]
+	if !ok {
+		return h.logAndBuildError("query param 'dataset_id' is required", http.StatusBadRequest), nil
+	}
+	from, to, err := parseUsageMonths(h.queryParams, time.Now().UTC())
+	if err != nil {
+		return h.logAndBuildError(err.Error(), http.StatusBadRequest), nil
+	}
+
+	audit := h.downloadAudit()
+	if audit == nil {
+		return h.logAndBuildError("download audit not configured", http.StatusServiceUnavailable), nil
+	}
+	usage, err := audit.GetUsage(ctx, datasetNodeId, from, to)
+	if err != nil {
+		h.logger.Errorf("failed to get download usage: %v", err)
+		return nil, err
+	}
+
+	resp := models.DownloadUsageResponse{
+		DatasetNodeId: datasetNodeId,
+		From:          from.Format(store.UsageMonthLayout),
+		To:            to.Format(store.UsageMonthLayout),
+		Usage:         usage,
+	}
+	for _, u := range usage {
+		resp.Total.Files += u.Files
+		resp.Total.Bytes += u.Bytes
+		resp.Total.RequesterPaysBytes += u.RequesterPaysBytes
+	}
+	return h.buildResponse(resp, http.StatusOK)
+}
+
+// parseUsageMonths returns the months of the from and to query params of GET /download-usage. to defaults to
+// the month of now, and from to the defaultUsageMonths months up to to.
+func parseUsageMonths(queryParams map[string]string, now time.Time) (time.Time, time.Time, error) {
+	to := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if rawTo, ok := queryParams["to"]; ok {
+		parsed, err := time.Parse(store.UsageMonthLayout, rawTo)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("query param 'to' must be a month, such as 2026-01")
+		}
+		to = parsed
+	}
+	from := to.AddDate(0, 1-defaultUsageMonths, 0)
+	if rawFrom, ok := queryParams["from"]; ok {
+		parsed, err := time.Parse(store.UsageMonthLayout, rawFrom)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("query param 'from' must be a month, such as 2026-01")
+		}
+		from = parsed
+	}
+	if from.After(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("query param 'from' cannot be after 'to'")
+	}
+	return from, to, nil
+}
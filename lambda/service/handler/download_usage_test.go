@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/pennsieve/packages-service/api/manifest"
+	"github.com/pennsieve/packages-service/api/models"
+	"github.com/pennsieve/packages-service/api/store"
+	"github.com/pennsieve/pennsieve-go-core/pkg/authorizer"
+	"github.com/pennsieve/pennsieve-go-core/pkg/models/role"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupDownloadAuditTables creates download audit and usage tables, points the handler at them, and returns a store for them.
+func setupDownloadAuditTables(t *testing.T) store.DownloadAudit {
+	t.Helper()
+	dyClient := dynamodb.NewFromConfig(store.GetTestAWSConfig(t), func(options *dynamodb.Options) {
+		options.BaseEndpoint = aws.String(store.GetTestDynamoDBURL())
+	})
+	auditTableName := "download-audit-" + store.RandString(8)
+	usageTableName := "download-usage-" + store.RandString(8)
+	auditTableInput := store.TestCreateDownloadAuditTableInput(auditTableName)
+	usageTableInput := store.TestCreateDownloadUsageTableInput(usageTableName)
+	dyFixture := store.NewDynamoDBFixture(t, dyClient, &auditTableInput, &usageTableInput)
+
+	originalDyDBClient := DyDBClient
+	DyDBClient = dyClient
+	t.Setenv(store.DownloadAuditTableNameEnvKey, auditTableName)
+	t.Setenv(store.DownloadUsageTableNameEnvKey, usageTableName)
+	t.Cleanup(func() {
+		DyDBClient = originalDyDBClient
+		dyFixture.Teardown()
+	})
+	return store.NewDownloadAuditStore(dyClient, auditTableName, usageTableName).WithLogging(store.NoLogger{})
+}
+
+func managerClaims(orgId int64, datasetNodeId string) *authorizer.Claims {
+	claims := editorClaims(orgId, datasetNodeId)
+	claims.DatasetClaim.Role = role.Manager
+	return claims
+}
+
+func TestParseUsageMonths(t *testing.T) {
+	now := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+	month := func(year int, m time.Month) time.Time {
+		return time.Date(year, m, 1, 0, 0, 0, 0, time.UTC)
+	}
+	for name, test := range map[string]struct {
+		queryParams  map[string]string
+		expectedFrom time.Time
+		expectedTo   time.Time
+	}{
+		"defaults":  {map[string]string{}, month(2025, time.November), month(2026, time.October)},
+		"from only": {map[string]string{"from": "2026-01"}, month(2026, time.January), month(2026, time.October)},
+		"to only":   {map[string]string{"to": "2026-03"}, month(2025, time.April), month(2026, time.March)},
+		"both":      {map[string]string{"from": "2026-02", "to": "2026-02"}, month(2026, time.February), month(2026, time.February)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			from, to, err := parseUsageMonths(test.queryParams, now)
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedFrom, from)
+			assert.Equal(t, test.expectedTo, to)
+		})
+	}
+
+	for name, queryParams := range map[string]map[string]string{
+		"day":                   {"from": "2026-01-01"},
+		"not a month":           {"to": "2026-13"},
+		"from after to":         {"from": "2026-05", "to": "2026-04"},
+		"from after this month": {"from": "2026-11"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := parseUsageMonths(queryParams, now)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestDownloadUsage(t *testing.T) {
+	audit := setupDownloadAuditTables(t)
+	now := time.Now().UTC()
+	thisMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, audit.RecordIssuance(context.Background(), models.DownloadIssuance{
+		OrgId: 2, DatasetNodeId: "N:dataset:dl-test", UserNodeId: "N:user:test-101", Source: models.DownloadAuditManifest,
+		RequestId: "earlier-request", IssuedAt: thisMonth,
+		Buckets: []models.DownloadIssuanceBucket{
+			{Bucket: "pennsieve-test-storage", FileIds: []int64{5001, 5002}, Bytes: 3072},
+			{Bucket: "external-publish", RequesterPays: true, FileIds: []int64{5003}, Bytes: 1024},
+		},
+	}))
+	require.NoError(t, audit.RecordIssuance(context.Background(), models.DownloadIssuance{
+		OrgId: 2, DatasetNodeId: "N:dataset:dl-test", UserNodeId: "N:user:test-202", Source: models.DownloadAuditArchiveJob,
+		RequestId: "earlier-job", IssuedAt: thisMonth.AddDate(0, -1, 0),
+		Buckets: []models.DownloadIssuanceBucket{{Bucket: "pennsieve-test-storage", FileIds: []int64{5001}, Bytes: 1024}},
+	}))
+
+	getUsage := func(claims *authorizer.Claims, queryParams map[string]string) *events.APIGatewayV2HTTPResponse {
+		req := newTestRequest("GET", "/download-usage", "test-req-usage", queryParams, "")
+		resp, err := NewHandler(req, claims).WithDefaultService().handle(context.Background())
+		require.NoError(t, err)
+		return resp
+	}
+
+	resp := getUsage(managerClaims(2, "N:dataset:dl-test"), map[string]string{"dataset_id": "N:dataset:dl-test"})
+	require.Equal(t, http.StatusOK, resp.StatusCode, resp.Body)
+	var usage models.DownloadUsageResponse
+	require.NoError(t, json.Unmarshal([]byte(resp.Body), &usage))
+	assert.Equal(t, "N:dataset:dl-test", usage.DatasetNodeId)
+	assert.Equal(t, thisMonth.Format(store.UsageMonthLayout), usage.To)
+	assert.Equal(t, []models.DownloadUsage{
+		{Month: thisMonth.AddDate(0, -1, 0).Format(store.UsageMonthLayout), UserNodeId: "N:user:test-202", Files: 1, Bytes: 1024},
+		{Month: thisMonth.Format(store.UsageMonthLayout), UserNodeId: "N:user:test-101", Files: 3, Bytes: 4096, RequesterPaysBytes: 1024},
+	}, usage.Usage)
+	assert.Equal(t, models.DownloadUsageTotal{Files: 4, Bytes: 5120, RequesterPaysBytes: 1024}, usage.Total)
+
+	resp = getUsage(managerClaims(2, "N:dataset:dl-test"), map[string]string{
+		"dataset_id": "N:dataset:dl-test",
+		"from":       thisMonth.Format(store.UsageMonthLayout),
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode, resp.Body)
+	require.NoError(t, json.Unmarshal([]byte(resp.Body), &usage))
+	require.Len(t, usage.Usage, 1)
+	assert.Equal(t, "N:user:test-101", usage.Usage[0].UserNodeId)
+
+	resp = getUsage(editorClaims(2, "N:dataset:dl-test"), map[string]string{"dataset_id": "N:dataset:dl-test"})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "only managers may see who downloaded a dataset")
+
+	resp = getUsage(managerClaims(2, "N:dataset:dl-test"), map[string]string{"dataset_id": "N:dataset:dl-test", "from": "last year"})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestDownloadManifest_RecordsIssuance(t *testing.T) {
+	setupDownloadTestDB(t)
+	setupS3Client(t)
+	setupExternalBucketConfig(t, nil)
+	audit := setupDownloadAuditTables(t)
+
+	body, _ := json.Marshal(models.DownloadRequest{NodeIds: []string{"N:package:dl-standalone"}})
+	req := newTestRequest("POST", "/download-manifest", "test-req-audit",
+		map[string]string{"dataset_id": "N:dataset:dl-test"}, string(body))
+	resp, err := NewHandler(req, editorClaims(2, "N:dataset:dl-test")).WithDefaultService().handle(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode, resp.Body)
+
+	thisMonth := time.Now().UTC()
+	usage, err := audit.GetUsage(context.Background(), "N:dataset:dl-test", thisMonth, thisMonth)
+	require.NoError(t, err)
+	assert.Equal(t, []models.DownloadUsage{
+		{Month: thisMonth.Format(store.UsageMonthLayout), UserNodeId: "N:user:test-101", Files: 1, Bytes: 8192},
+	}, usage)
+}
+
+func TestDownloadManifest_Quota(t *testing.T) {
+	setupDownloadTestDB(t)
+	setupS3Client(t)
+	setupExternalBucketConfig(t, nil)
+	setupDownloadAuditTables(t)
+	t.Setenv(manifest.DownloadQuotaPolicyKey, `{"default": {"userDailyBytes": 4000, "datasetMonthlyBytes": 100000}}`)
+
+	body, _ := json.Marshal(models.DownloadRequest{NodeIds: []string{"N:collection:dl-root"}})
+	getManifest := func() models.DownloadManifestResponse {
+		req := newTestRequest("POST", "/download-manifest", "test-req-quota",
+			map[string]string{"dataset_id": "N:dataset:dl-test"}, string(body))
+		resp, err := NewHandler(req, editorClaims(2, "N:dataset:dl-test")).WithDefaultService().handle(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode, resp.Body)
+		var downloadManifest models.DownloadManifestResponse
+		require.NoError(t, json.Unmarshal([]byte(resp.Body), &downloadManifest))
+		return downloadManifest
+	}
+	int64Ptr := func(v int64) *int64 { return &v }
+
+	// Files come in file id order: data.csv (1024 bytes), part1.csv (2048) and part2.csv (4096).
+	first := getManifest()
+	require.Len(t, first.Data, 2)
+	assert.Equal(t, "data.csv", first.Data[0].FileName)
+	assert.Equal(t, "part1.csv", first.Data[1].FileName)
+	require.Len(t, first.Blocked, 1)
+	assert.Equal(t, "part2.csv", first.Blocked[0].FileName)
+	assert.Equal(t, models.DownloadBlockedReasonQuotaExceeded, first.Blocked[0].Reason)
+	assert.Equal(t, 2, first.Header.Count, "the header totals only the files issued")
+	assert.Equal(t, int64(3072), first.Header.Size)
+	assert.Equal(t, 1, first.Header.BlockedCount)
+	assert.Equal(t, &models.DownloadManifestQuota{
+		UserDailyRemainingBytes:      int64Ptr(4000 - 3072),
+		DatasetMonthlyRemainingBytes: int64Ptr(100000 - 3072),
+	}, first.Header.Quota)
+
+	second := getManifest()
+	assert.Empty(t, second.Data)
+	assert.Len(t, second.Blocked, 3)
+	assert.Zero(t, second.Header.Count)
+	assert.Zero(t, second.Header.Size)
+	assert.Equal(t, 3, second.Header.BlockedCount)
+	assert.Equal(t, int64Ptr(4000-3072), second.Header.Quota.UserDailyRemainingBytes)
+}
@@ -10,12 +10,21 @@ import (
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/pennsieve/packages-service/api/awsclients"
 	"github.com/pennsieve/packages-service/api/logging"
+	"github.com/pennsieve/packages-service/api/manifest"
+	"github.com/pennsieve/packages-service/api/metrics"
+	"github.com/pennsieve/packages-service/api/regions"
 	"github.com/pennsieve/packages-service/api/service"
+	"github.com/pennsieve/packages-service/api/store"
+	"github.com/pennsieve/packages-service/api/tracing"
 	"github.com/pennsieve/pennsieve-go-core/pkg/authorizer"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"os"
 	"strconv"
 )
@@ -23,8 +32,14 @@ import (
 var PennsieveDB *sql.DB
 var DiscoverDB *sql.DB
 var SQSClient *sqs.Client
+var DyDBClient *dynamodb.Client
 var S3Client *s3.Client
 var AssumeRoleClient stscreds.AssumeRoleAPIClient
+var BucketRegions *regions.Resolver
+var BucketOptions *manifest.BucketOptionsCache
+var ScanPolicies *store.ScanPolicyStore
+var AWSClients *awsclients.Registry
+var Metrics *metrics.Recorder
 var ViewerAssetsBucket string
 
 func init() {
@@ -51,6 +66,23 @@ func init() {
 }
 
 func PackagesServiceHandler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (*events.APIGatewayV2HTTPResponse, error) {
+	defer flushTelemetry(ctx)
+	ctx, span := tracing.Start(ctx, "PackagesServiceHandler",
+		attribute.String("http.request.method", request.RequestContext.HTTP.Method),
+		attribute.String("url.path", request.RequestContext.HTTP.Path),
+		attribute.String("faas.invocation_id", request.RequestContext.RequestID))
+	response, err := routeRequest(ctx, request)
+	if response != nil {
+		span.SetAttributes(attribute.Int("http.response.status_code", response.StatusCode))
+		if response.StatusCode >= http.StatusInternalServerError && err == nil {
+			span.SetStatus(codes.Error, http.StatusText(response.StatusCode))
+		}
+	}
+	tracing.End(span, err)
+	return response, err
+}
+
+func routeRequest(ctx context.Context, request events.APIGatewayV2HTTPRequest) (*events.APIGatewayV2HTTPResponse, error) {
 	path := request.RequestContext.HTTP.Path
 
 	// Discover endpoints are unauthenticated — skip claim parsing
@@ -65,6 +97,16 @@ func PackagesServiceHandler(ctx context.Context, request events.APIGatewayV2HTTP
 	return handler.handle(ctx)
 }
 
+// flushTelemetry writes the metrics and spans recorded during an invocation. Failures are only logged so that they cannot fail the request.
+func flushTelemetry(ctx context.Context) {
+	if err := Metrics.Flush(); err != nil {
+		log.Warnf("unable to flush metrics: %v", err)
+	}
+	if err := tracing.Flush(ctx); err != nil {
+		log.Warnf("unable to flush traces: %v", err)
+	}
+}
+
 // RequestHandler wraps the incoming request with a logger and a service.PackagesService.
 // Some request params are pulled out for convenience. Use NewHandler followed by WithDefaultService to have things
 // initialized nicely. Use WithService in tests where a specially constructed or mock service.PackagesService is required.
@@ -213,6 +255,14 @@ func (h *RequestHandler) handleDiscover(ctx context.Context) (*events.APIGateway
 		default:
 			return h.logAndBuildError(fmt.Sprintf("method %s not allowed on /discover/assets", h.method), http.StatusMethodNotAllowed), nil
 		}
+	case "/discover/download-manifest":
+		discoverDownloadHandler := DiscoverDownloadManifestHandler{RequestHandler: *h}
+		switch h.method {
+		case http.MethodGet:
+			return discoverDownloadHandler.handleGet(ctx)
+		default:
+			return h.logAndBuildError(fmt.Sprintf("method %s not allowed on /discover/download-manifest", h.method), http.StatusMethodNotAllowed), nil
+		}
 	default:
 		return h.logAndBuildError("resource not found: "+h.path, http.StatusNotFound), nil
 	}
@@ -18,6 +18,30 @@ func (h *RequestHandler) handle(ctx context.Context) (*events.APIGatewayV2HTTPRe
 	case "/download-manifest":
 		downloadHandler := DownloadManifestHandler{RequestHandler: *h}
 		return downloadHandler.handle(ctx)
+	case "/download-manifest/resign":
+		downloadResignHandler := DownloadResignHandler{RequestHandler: *h}
+		switch h.method {
+		case http.MethodPost:
+			return downloadResignHandler.handlePost(ctx)
+		default:
+			return h.logAndBuildError(fmt.Sprintf("method %s not allowed on /download-manifest/resign", h.method), http.StatusMethodNotAllowed), nil
+		}
+	case "/download-archive":
+		downloadArchiveHandler := DownloadArchiveHandler{RequestHandler: *h}
+		switch h.method {
+		case http.MethodPost:
+			return downloadArchiveHandler.handlePost(ctx)
+		default:
+			return h.logAndBuildError(fmt.Sprintf("method %s not allowed on /download-archive", h.method), http.StatusMethodNotAllowed), nil
+		}
+	case "/download-usage":
+		downloadUsageHandler := DownloadUsageHandler{RequestHandler: *h}
+		switch h.method {
+		case http.MethodGet:
+			return downloadUsageHandler.handleGet(ctx)
+		default:
+			return h.logAndBuildError(fmt.Sprintf("method %s not allowed on /download-usage", h.method), http.StatusMethodNotAllowed), nil
+		}
 	case "/formats":
 		formatsHandler := FormatsHandler{RequestHandler: *h}
 		switch h.method {
@@ -51,6 +75,16 @@ func (h *RequestHandler) handle(ctx context.Context) (*events.APIGatewayV2HTTPRe
 				return h.logAndBuildError(fmt.Sprintf("method %s not allowed on /assets/{id}", h.method), http.StatusMethodNotAllowed), nil
 			}
 		}
+		if strings.HasPrefix(h.path, "/download-jobs/") {
+			jobId := strings.TrimPrefix(h.path, "/download-jobs/")
+			downloadJobsHandler := DownloadJobsHandler{RequestHandler: *h}
+			switch h.method {
+			case http.MethodGet:
+				return downloadJobsHandler.handleGet(ctx, jobId)
+			default:
+				return h.logAndBuildError(fmt.Sprintf("method %s not allowed on /download-jobs/{id}", h.method), http.StatusMethodNotAllowed), nil
+			}
+		}
 		return h.logAndBuildError("resource not found: "+h.path, http.StatusNotFound), nil
 	}
 }
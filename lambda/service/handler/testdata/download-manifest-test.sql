@@ -14,6 +14,7 @@ ON CONFLICT (id) DO NOTHING;
 -- deleted-file (Text, id=3004, DELETED, 1 source file — should NOT appear)
 -- published-file (Text, id=3005, 1 published source file, so need to use S3 versionId when creating presigned URL)
 -- non-us-file (Text, id=3006, 1 source file in a non us-east-1 bucket
+-- uploading-file (Text, id=3007, UNAVAILABLE, in root-collection, 1 source file — should NOT appear)
 
 INSERT INTO "2".packages (id, name, type, state, dataset_id, parent_id, updated_at, created_at, attributes, node_id, size, owner_id, import_id) VALUES
 (3000, 'root-collection', 'Collection', 'READY', 300, null, '2023-01-01 00:00:00', '2023-01-01 00:00:00', '[]', 'N:collection:dl-root', null, 1, '00000000-0000-0000-0000-000000003000'),
@@ -22,13 +23,19 @@ INSERT INTO "2".packages (id, name, type, state, dataset_id, parent_id, updated_
 (3003, 'standalone-file', 'Text', 'READY', 300, null, '2023-01-01 00:00:00', '2023-01-01 00:00:00', '[]', 'N:package:dl-standalone', null, 1, '00000000-0000-0000-0000-000000003003'),
 (3004, 'deleted-file', 'Text', 'DELETED', 300, null, '2023-01-01 00:00:00', '2023-01-01 00:00:00', '[]', 'N:package:dl-deleted', null, 1, '00000000-0000-0000-0000-000000003004'),
 (3005, 'published-file', 'Text', 'READY', 300, null, '2023-01-01 00:00:00', '2023-01-01 00:00:00', '[]', 'N:package:dl-published', null, 1, '00000000-0000-0000-0000-000000003005'),
-(3006, 'non-us-file', 'Text', 'READY', 300, null, '2023-01-01 00:00:00', '2023-01-01 00:00:00', '[]', 'N:package:dl-non-us', null, 1, '00000000-0000-0000-0000-000000003006')
+(3006, 'non-us-file', 'Text', 'READY', 300, null, '2023-01-01 00:00:00', '2023-01-01 00:00:00', '[]', 'N:package:dl-non-us', null, 1, '00000000-0000-0000-0000-000000003006'),
+(3007, 'uploading-file', 'Text', 'UNAVAILABLE', 300, 3000, '2023-01-01 00:00:00', '2023-01-01 00:00:00', '[]', 'N:package:dl-uploading', null, 1, '00000000-0000-0000-0000-000000003007')
 ON CONFLICT (id) DO NOTHING;
 
 -- Files: object_type = 'source' for downloadable files
--- child-single-file has 1 source file
+-- child-single-file has 1 source file, with a stored SHA-256 checksum
 INSERT INTO "2".files (id, package_id, name, file_type, s3_bucket, s3_key, object_type, size, checksum, uuid, processing_state, uploaded_state, created_at, updated_at) VALUES
-(5001, 3001, 'data.csv', 'CSV', 'pennsieve-test-storage', 'org2/data.csv', 'source', 1024, '{}', '00000000-0000-0000-0000-000000005001', 'unprocessed', 'uploaded', '2023-01-01 00:00:00', '2023-01-01 00:00:00')
+(5001, 3001, 'data.csv', 'CSV', 'pennsieve-test-storage', 'org2/data.csv', 'source', 1024, '{"chunkSize": 33554432, "checksum": "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"}', '00000000-0000-0000-0000-000000005001', 'unprocessed', 'uploaded', '2023-01-01 00:00:00', '2023-01-01 00:00:00')
+ON CONFLICT (id) DO NOTHING;
+
+-- child-single-file also has a view file, only returned when view objects are requested
+INSERT INTO "2".files (id, package_id, name, file_type, s3_bucket, s3_key, object_type, size, checksum, uuid, processing_state, uploaded_state, created_at, updated_at) VALUES
+(5014, 3001, 'data.parquet', 'Parquet', 'pennsieve-test-storage', 'org2/data.parquet', 'view', 512, '{}', '00000000-0000-0000-0000-000000005014', 'processed', 'uploaded', '2023-01-01 00:00:00', '2023-01-01 00:00:00')
 ON CONFLICT (id) DO NOTHING;
 
 -- child-multi-file has 2 source files
@@ -47,6 +54,11 @@ INSERT INTO "2".files (id, package_id, name, file_type, s3_bucket, s3_key, objec
 (5005, 3004, 'gone.txt', 'Text', 'pennsieve-test-storage', 'org2/gone.txt', 'source', 100, '{}', '00000000-0000-0000-0000-000000005005', 'unprocessed', 'uploaded', '2023-01-01 00:00:00', '2023-01-01 00:00:00')
 ON CONFLICT (id) DO NOTHING;
 
+-- uploading-file has 1 source file (should not be returned because its upload has not finished)
+INSERT INTO "2".files (id, package_id, name, file_type, s3_bucket, s3_key, object_type, size, checksum, uuid, processing_state, uploaded_state, created_at, updated_at) VALUES
+(5008, 3007, 'uploading.txt', 'Text', 'pennsieve-test-storage', 'org2/uploading.txt', 'source', 100, '{}', '00000000-0000-0000-0000-000000005008', 'unprocessed', 'uploaded', '2023-01-01 00:00:00', '2023-01-01 00:00:00')
+ON CONFLICT (id) DO NOTHING;
+
 -- published-file has 1 source file (with non-null versionId for publishedd file test)
 INSERT INTO "2".files (id, package_id, name, file_type, s3_bucket, s3_key, published_s3_version_id, object_type, size, checksum, uuid, processing_state, uploaded_state, created_at, updated_at) VALUES
     (5006, 3005, 'published-image.ome.tiff', 'OMETIFF', 'pennsieve-test-publish', '14/files/published-image.ome.tiff', 'Pu_BlishedVersionId','source', 8192, '{}', '00000000-0000-0000-0000-000000005006', 'unprocessed', 'uploaded', '2023-01-01 00:00:00', '2023-01-01 00:00:00')
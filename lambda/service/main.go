@@ -10,10 +10,15 @@ import (
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/feature/rds/auth"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
-	"github.com/aws/aws-sdk-go-v2/service/sts"
 	_ "github.com/lib/pq"
+	"github.com/pennsieve/packages-service/api/awsclients"
+	"github.com/pennsieve/packages-service/api/manifest"
+	"github.com/pennsieve/packages-service/api/metrics"
+	"github.com/pennsieve/packages-service/api/regions"
+	"github.com/pennsieve/packages-service/api/store"
+	"github.com/pennsieve/packages-service/api/tracing"
 	"github.com/pennsieve/packages-service/service/handler"
 	"github.com/pennsieve/pennsieve-go-core/pkg/queries/pgdb"
 	log "github.com/sirupsen/logrus"
@@ -30,6 +35,7 @@ func init() {
 	}
 	log.Info("connected to RDS database")
 	handler.PennsieveDB = db
+	handler.Metrics = metrics.NewFromEnv("packages-service")
 
 	// Create AWS config
 	region := os.Getenv("REGION")
@@ -38,9 +44,28 @@ func init() {
 		log.Fatalf("AWS configuration error: %v\n", err)
 	}
 
+	if err := tracing.Init(context.Background(), "packages-service"); err != nil {
+		log.Fatalf("tracing configuration error: %v\n", err)
+	}
+	tracing.AppendAWSMiddleware(&cfg.APIOptions)
+
+	handler.AWSClients = awsclients.NewRegistry(cfg)
 	handler.SQSClient = sqs.NewFromConfig(cfg)
-	handler.S3Client = s3.NewFromConfig(cfg)
-	handler.AssumeRoleClient = sts.NewFromConfig(cfg)
+	handler.DyDBClient = dynamodb.NewFromConfig(cfg)
+	handler.S3Client = handler.S3ClientFor("")
+	handler.AssumeRoleClient = handler.STSClientFor("")
+	handler.BucketRegions, err = regions.NewResolverFromEnv(handler.S3Client)
+	if err != nil {
+		log.Fatalf("bucket region configuration error: %v\n", err)
+	}
+	handler.BucketOptions, err = manifest.NewBucketOptionsCacheFromEnv(handler.AssumeRoleClient, handler.BucketRegions, manifest.STSCredentialsDuration)
+	if err != nil {
+		log.Fatalf("external bucket configuration error: %v\n", err)
+	}
+	handler.ScanPolicies, err = store.NewScanPolicyStoreFromEnv(handler.DyDBClient)
+	if err != nil {
+		log.Fatalf("scan policy configuration error: %v\n", err)
+	}
 
 	// Connect to discover_postgres database
 	discoverDB, err := connectRDSDiscover()
@@ -0,0 +1,122 @@
+# Download jobs submitted with POST /download-manifest?async=true. Items expire with their results.
+resource "aws_dynamodb_table" "download_jobs_table" {
+  name         = "${var.environment_name}-download-jobs-table-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "JobId"
+
+  attribute {
+    name = "JobId"
+    type = "S"
+  }
+
+  ttl {
+    attribute_name = "ExpiresAt"
+    enabled        = true
+  }
+
+  point_in_time_recovery {
+    enabled = false
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = merge(local.common_tags, {
+    Name        = "${var.environment_name}-download-jobs-table-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+    Description = "Status of asynchronous download jobs"
+  })
+}
+
+# Record of every set of download URLs, or archive, issued for files of a dataset. Kept indefinitely for data governance.
+resource "aws_dynamodb_table" "download_audit_table" {
+  name         = "${var.environment_name}-download-audit-table-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "DatasetKey"
+  range_key    = "RecordId"
+
+  attribute {
+    name = "DatasetKey"
+    type = "S"
+  }
+
+  attribute {
+    name = "RecordId"
+    type = "S"
+  }
+
+  point_in_time_recovery {
+    enabled = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = merge(local.common_tags, {
+    Name        = "${var.environment_name}-download-audit-table-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+    Description = "Audit log of issued download URLs"
+  })
+}
+
+# Totals of the download audit log by dataset, month and user, reported by GET /download-usage, and by user and day for download quotas.
+resource "aws_dynamodb_table" "download_usage_table" {
+  name         = "${var.environment_name}-download-usage-table-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "DatasetKey"
+  range_key    = "UsageKey"
+
+  attribute {
+    name = "DatasetKey"
+    type = "S"
+  }
+
+  attribute {
+    name = "UsageKey"
+    type = "S"
+  }
+
+  point_in_time_recovery {
+    enabled = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = merge(local.common_tags, {
+    Name        = "${var.environment_name}-download-usage-table-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+    Description = "Download usage by dataset, month and user"
+  })
+}
+
+# Scan-status download policies of organizations, and of datasets, which override those of their organizations.
+resource "aws_dynamodb_table" "scan_policies_table" {
+  name         = "${var.environment_name}-scan-policies-table-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "OrgId"
+  range_key    = "Scope"
+
+  attribute {
+    name = "OrgId"
+    type = "N"
+  }
+
+  attribute {
+    name = "Scope"
+    type = "S"
+  }
+
+  point_in_time_recovery {
+    enabled = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = merge(local.common_tags, {
+    Name        = "${var.environment_name}-scan-policies-table-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+    Description = "Scan-status download policies by organization and dataset"
+  })
+}
@@ -37,6 +37,12 @@ resource "aws_apigatewayv2_stage" "packages_service_gateway_stage" {
     throttling_rate_limit  = 5
   }
 
+  route_settings {
+    route_key              = "GET /discover/download-manifest"
+    throttling_burst_limit = 10
+    throttling_rate_limit  = 5
+  }
+
   access_log_settings {
     destination_arn = aws_cloudwatch_log_group.packages_service_gateway_log_group.arn
 
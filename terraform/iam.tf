@@ -81,9 +81,69 @@ data "aws_iam_policy_document" "packages_service_iam_policy_document" {
 
     resources = [
       aws_sqs_queue.restore_package_queue.arn,
+      aws_sqs_queue.download_jobs_queue.arn,
     ]
   }
 
+  statement {
+    sid    = "PackagesServiceLambdaDownloadJobsDynamoDBPermissions"
+    effect = "Allow"
+    actions = [
+      "dynamodb:GetItem",
+      "dynamodb:PutItem",
+      "dynamodb:UpdateItem"
+    ]
+    resources = [aws_dynamodb_table.download_jobs_table.arn]
+  }
+
+  statement {
+    sid    = "PackagesServiceLambdaScanPoliciesDynamoDBPermissions"
+    effect = "Allow"
+    actions = [
+      "dynamodb:GetItem"
+    ]
+    resources = [aws_dynamodb_table.scan_policies_table.arn]
+  }
+
+  statement {
+    sid    = "PackagesServiceLambdaDownloadAuditDynamoDBPermissions"
+    effect = "Allow"
+    actions = [
+      "dynamodb:PutItem"
+    ]
+    resources = [aws_dynamodb_table.download_audit_table.arn]
+  }
+
+  statement {
+    sid    = "PackagesServiceLambdaDownloadUsageDynamoDBPermissions"
+    effect = "Allow"
+    actions = [
+      "dynamodb:GetItem",
+      "dynamodb:UpdateItem",
+      "dynamodb:Query"
+    ]
+    resources = [aws_dynamodb_table.download_usage_table.arn]
+  }
+
+  statement {
+    sid    = "PackagesServiceLambdaDownloadJobsS3Permissions"
+    effect = "Allow"
+    actions = [
+      "s3:GetObject"
+    ]
+    resources = ["${aws_s3_bucket.download_jobs.arn}/jobs/*"]
+  }
+
+  statement {
+    sid    = "PackagesServiceLambdaManifestSnapshotsS3Permissions"
+    effect = "Allow"
+    actions = [
+      "s3:GetObject",
+      "s3:PutObject"
+    ]
+    resources = ["${aws_s3_bucket.download_jobs.arn}/manifest-snapshots/*"]
+  }
+
   statement {
     sid    = "PackagesServiceLambdaS3Permissions"
     effect = "Allow"
@@ -112,17 +172,20 @@ data "aws_iam_policy_document" "packages_service_iam_policy_document" {
     ]
   }
 
-  # Allow assuming cross-account roles for external publish buckets
-  # - sparc_bucket_role_arn: SPARC account buckets
-  # - rejoin_bucket_role_arn: RE-JOIN and PRECISION account buckets (same account)
+  # Region lookup for buckets not listed in BUCKET_REGION_MAP
+  statement {
+    sid       = "PackagesServiceLambdaS3BucketLocation"
+    effect    = "Allow"
+    actions   = ["s3:GetBucketLocation"]
+    resources = ["arn:aws:s3:::*"]
+  }
+
+  # Allow assuming the cross-account roles of external buckets
   statement {
     sid    = "AssumeExternalPublishBucketRoles"
     effect = "Allow"
     actions = ["sts:AssumeRole"]
-    resources = [
-      data.terraform_remote_state.platform_infrastructure.outputs.sparc_bucket_role_arn,
-      data.terraform_remote_state.platform_infrastructure.outputs.rejoin_bucket_role_arn,
-    ]
+    resources = distinct([for bucket in local.external_buckets : bucket.roleArn])
   }
 
   statement {
@@ -326,6 +389,13 @@ data "aws_iam_policy_document" "restore_package_iam_policy_document" {
     ]
   }
 
+  statement {
+    sid       = "RestorePackageLambdaS3BucketLocation"
+    effect    = "Allow"
+    actions   = ["s3:GetBucketLocation"]
+    resources = ["arn:aws:s3:::*"]
+  }
+
   statement {
     sid    = "PostChangeLogMessages"
     effect = "Allow"
@@ -357,6 +427,181 @@ data "aws_iam_policy_document" "restore_package_iam_policy_document" {
 
 }
 
+#
+# Download Jobs Lambda Role
+#
+
+resource "aws_iam_role" "download_jobs_lambda_role" {
+  name = "${var.environment_name}-download-jobs-lambda-role-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+
+  assume_role_policy = <<EOF
+{
+  "Version": "2012-10-17",
+  "Statement": [
+    {
+      "Action": "sts:AssumeRole",
+      "Principal": {
+        "Service": "lambda.amazonaws.com"
+      },
+      "Effect": "Allow",
+      "Sid": ""
+    }
+  ]
+}
+EOF
+}
+
+resource "aws_iam_role_policy_attachment" "download_jobs_lambda_iam_policy_attachment" {
+  role       = aws_iam_role.download_jobs_lambda_role.name
+  policy_arn = aws_iam_policy.download_jobs_lambda_iam_policy.arn
+}
+
+resource "aws_iam_policy" "download_jobs_lambda_iam_policy" {
+  name   = "${var.environment_name}-download-jobs-lambda-iam-policy-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+  path   = "/"
+  policy = data.aws_iam_policy_document.download_jobs_iam_policy_document.json
+}
+
+data "aws_iam_policy_document" "download_jobs_iam_policy_document" {
+
+  statement {
+    sid    = "DownloadJobsLambdaLogsPermissions"
+    effect = "Allow"
+    actions = [
+      "logs:CreateLogGroup",
+      "logs:CreateLogStream",
+      "logs:PutDestination",
+      "logs:PutLogEvents",
+      "logs:DescribeLogStreams"
+    ]
+    resources = ["*"]
+  }
+
+  statement {
+    sid    = "DownloadJobsLambdaEC2Permissions"
+    effect = "Allow"
+    actions = [
+      "ec2:CreateNetworkInterface",
+      "ec2:DescribeNetworkInterfaces",
+      "ec2:DeleteNetworkInterface",
+      "ec2:AssignPrivateIpAddresses",
+      "ec2:UnassignPrivateIpAddresses"
+    ]
+    resources = ["*"]
+  }
+
+  statement {
+    sid    = "DownloadJobsLambdaRDSPermissions"
+    effect = "Allow"
+    actions = [
+      "rds-db:connect"
+    ]
+    resources = ["*"]
+  }
+
+  statement {
+    sid    = "DownloadJobsLambdaReadFromEventsPermission"
+    effect = "Allow"
+
+    actions = [
+      "sqs:ReceiveMessage",
+      "sqs:DeleteMessage",
+      "sqs:GetQueueAttributes",
+      "sqs:GetQueueUrl"
+    ]
+
+    resources = [
+      aws_sqs_queue.download_jobs_queue.arn,
+      "${aws_sqs_queue.download_jobs_queue.arn}/*",
+    ]
+  }
+
+  statement {
+    sid    = "DownloadJobsLambdaDynamoDBPermissions"
+    effect = "Allow"
+    actions = [
+      "dynamodb:UpdateItem"
+    ]
+    resources = [aws_dynamodb_table.download_jobs_table.arn]
+  }
+
+  statement {
+    sid    = "DownloadJobsLambdaScanPoliciesDynamoDBPermissions"
+    effect = "Allow"
+    actions = [
+      "dynamodb:GetItem"
+    ]
+    resources = [aws_dynamodb_table.scan_policies_table.arn]
+  }
+
+  statement {
+    sid    = "DownloadJobsLambdaDownloadAuditDynamoDBPermissions"
+    effect = "Allow"
+    actions = [
+      "dynamodb:PutItem"
+    ]
+    resources = [aws_dynamodb_table.download_audit_table.arn]
+  }
+
+  statement {
+    sid    = "DownloadJobsLambdaDownloadUsageDynamoDBPermissions"
+    effect = "Allow"
+    actions = [
+      "dynamodb:UpdateItem"
+    ]
+    resources = [aws_dynamodb_table.download_usage_table.arn]
+  }
+
+  statement {
+    sid    = "DownloadJobsLambdaWriteResultsPermissions"
+    effect = "Allow"
+    actions = [
+      "s3:PutObject",
+      "s3:AbortMultipartUpload"
+    ]
+    resources = ["${aws_s3_bucket.download_jobs.arn}/jobs/*"]
+  }
+
+  # Manifest URLs are presigned with the lambda's own credentials, so it needs read access to the storage buckets
+  statement {
+    sid    = "DownloadJobsLambdaS3Permissions"
+    effect = "Allow"
+    actions = [
+      "s3:GetObject",
+      "s3:GetObjectVersion"
+    ]
+    resources = [
+      "${data.terraform_remote_state.platform_infrastructure.outputs.storage_bucket_arn}/*",
+      "${data.terraform_remote_state.platform_infrastructure.outputs.sparc_storage_bucket_arn}/*",
+      "${data.terraform_remote_state.platform_infrastructure.outputs.rejoin_storage_bucket_arn}/*",
+      "${data.terraform_remote_state.platform_infrastructure.outputs.precision_storage_bucket_arn}/*",
+      "${data.terraform_remote_state.africa_south_region.outputs.af_south_s3_storage_bucket_arn}/*",
+      "${data.terraform_remote_state.platform_infrastructure.outputs.awsod_sparc_publish50_bucket_arn}/*",
+      "${data.terraform_remote_state.platform_infrastructure.outputs.awsod_edots_publish50_bucket_arn}/*",
+      "${data.terraform_remote_state.upload_service.outputs.uploads_bucket_arn}/*",
+    ]
+  }
+
+  statement {
+    sid       = "DownloadJobsLambdaS3BucketLocation"
+    effect    = "Allow"
+    actions   = ["s3:GetBucketLocation"]
+    resources = ["arn:aws:s3:::*"]
+  }
+
+  statement {
+    sid    = "DownloadJobsAssumeExternalPublishBucketRoles"
+    effect = "Allow"
+    actions = ["sts:AssumeRole"]
+    resources = distinct([for bucket in local.external_buckets : bucket.roleArn])
+  }
+}
+
+resource "aws_iam_role_policy_attachment" "download_jobs_storage_bucket_read" {
+  role       = aws_iam_role.download_jobs_lambda_role.name
+  policy_arn = data.terraform_remote_state.account_service.outputs.storage_read_policy_arn
+}
+
 
 #
 # Asset Cleanup Lambda Role
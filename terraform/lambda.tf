@@ -27,7 +27,16 @@ resource "aws_lambda_function" "service_lambda" {
       CLOUDFRONT_SIGNING_KEYS_SECRET_NAME = aws_secretsmanager_secret.cloudfront_signing_keys.name
       UPLOAD_CREDENTIALS_ROLE_ARN              = aws_iam_role.viewer_assets_upload_credentials_role.arn
       VIEWER_ASSETS_BUCKET                    = data.terraform_remote_state.platform_infrastructure.outputs.storage_bucket_id
-      EXTERNAL_BUCKETS_ROLE_MAP = jsonencode(local.external_bucket_roles)
+      EXTERNAL_BUCKETS_ROLE_MAP = jsonencode(local.external_buckets)
+      BUCKET_REGION_MAP         = jsonencode(local.bucket_regions)
+      PRESIGN_EXPIRY_POLICY     = jsonencode(var.presign_expiry_policy)
+      DOWNLOAD_QUOTA_POLICY     = jsonencode(var.download_quota_policy)
+      DOWNLOAD_JOBS_DYNAMODB_TABLE_NAME  = aws_dynamodb_table.download_jobs_table.name
+      DOWNLOAD_JOBS_QUEUE_URL            = aws_sqs_queue.download_jobs_queue.url
+      DOWNLOAD_JOBS_BUCKET               = aws_s3_bucket.download_jobs.id
+      DOWNLOAD_AUDIT_DYNAMODB_TABLE_NAME = aws_dynamodb_table.download_audit_table.name
+      DOWNLOAD_USAGE_DYNAMODB_TABLE_NAME = aws_dynamodb_table.download_usage_table.name
+      SCAN_POLICIES_DYNAMODB_TABLE_NAME  = aws_dynamodb_table.scan_policies_table.name
     }
   }
 }
@@ -57,6 +66,42 @@ resource "aws_lambda_function" "restore_package_lambda" {
       RESTORE_PACKAGE_QUEUE_URL         = aws_sqs_queue.restore_package_queue.url
       DELETE_RECORD_DYNAMODB_TABLE_NAME = data.terraform_remote_state.process_jobs_service.outputs.process_jobs_table_name
       JOBS_QUEUE_ID                     = data.terraform_remote_state.platform_infrastructure.outputs.jobs_queue_id,
+      BUCKET_REGION_MAP                 = jsonencode(local.bucket_regions)
+    }
+  }
+}
+
+resource "aws_lambda_function" "download_jobs_lambda" {
+  description   = "Lambda Function which listens to a SQS queue to generate asynchronous download manifests"
+  function_name = "${var.environment_name}-download-jobs-lambda-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+  handler       = "bootstrap"
+  runtime       = "provided.al2"
+  role          = aws_iam_role.download_jobs_lambda_role.arn
+  timeout       = 900
+  memory_size   = 1024
+  s3_bucket     = var.lambda_bucket
+  s3_key        = "${var.service_name}/download-jobs-${var.image_tag}.zip"
+
+  vpc_config {
+    subnet_ids = tolist(data.terraform_remote_state.vpc.outputs.private_subnet_ids)
+    security_group_ids = [data.terraform_remote_state.platform_infrastructure.outputs.upload_v2_security_group_id]
+  }
+
+  environment {
+    variables = {
+      ENV                                = var.environment_name
+      PENNSIEVE_DOMAIN                   = data.terraform_remote_state.account.outputs.domain_name,
+      REGION                             = var.aws_region
+      RDS_PROXY_ENDPOINT                 = data.terraform_remote_state.pennsieve_postgres.outputs.rds_proxy_endpoint,
+      DOWNLOAD_JOBS_DYNAMODB_TABLE_NAME  = aws_dynamodb_table.download_jobs_table.name
+      DOWNLOAD_JOBS_BUCKET               = aws_s3_bucket.download_jobs.id
+      EXTERNAL_BUCKETS_ROLE_MAP          = jsonencode(local.external_buckets)
+      BUCKET_REGION_MAP                  = jsonencode(local.bucket_regions)
+      PRESIGN_EXPIRY_POLICY              = jsonencode(var.presign_expiry_policy)
+      DOWNLOAD_QUOTA_POLICY              = jsonencode(var.download_quota_policy)
+      DOWNLOAD_AUDIT_DYNAMODB_TABLE_NAME = aws_dynamodb_table.download_audit_table.name
+      DOWNLOAD_USAGE_DYNAMODB_TABLE_NAME = aws_dynamodb_table.download_usage_table.name
+      SCAN_POLICIES_DYNAMODB_TABLE_NAME  = aws_dynamodb_table.scan_policies_table.name
     }
   }
 }
@@ -74,3 +74,77 @@
 #     max_age_seconds = 3600
 #   }
 # }
+
+# S3 bucket for the results of asynchronous download jobs
+resource "aws_s3_bucket" "download_jobs" {
+  bucket = "pennsieve-${var.environment_name}-download-jobs-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+
+  tags = merge(local.common_tags, {
+    Name        = "pennsieve-${var.environment_name}-download-jobs-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+    Description = "S3 bucket for download job results"
+    Service     = "packages-service"
+  })
+}
+
+resource "aws_s3_bucket_public_access_block" "download_jobs" {
+  bucket = aws_s3_bucket.download_jobs.id
+
+  block_public_acls       = true
+  block_public_policy     = true
+  ignore_public_acls      = true
+  restrict_public_buckets = true
+}
+
+resource "aws_s3_bucket_server_side_encryption_configuration" "download_jobs" {
+  bucket = aws_s3_bucket.download_jobs.id
+
+  rule {
+    apply_server_side_encryption_by_default {
+      sse_algorithm = "AES256"
+    }
+  }
+}
+
+# Results are kept as long as the job records in the download jobs table, and manifest snapshots for 30 days
+resource "aws_s3_bucket_lifecycle_configuration" "download_jobs" {
+  bucket = aws_s3_bucket.download_jobs.id
+
+  rule {
+    id     = "expire_download_job_results"
+    status = "Enabled"
+
+    filter {
+      prefix = "jobs/"
+    }
+
+    expiration {
+      days = 7
+    }
+  }
+
+  # Archives are written with multipart uploads, which are left behind if an archive job is stopped mid-upload
+  rule {
+    id     = "abort_incomplete_multipart_uploads"
+    status = "Enabled"
+
+    filter {}
+
+    abort_incomplete_multipart_upload {
+      days_after_initiation = 1
+    }
+  }
+
+  # Snapshots of manifests, for manifests of the changes since them
+  rule {
+    id     = "expire_manifest_snapshots"
+    status = "Enabled"
+
+    filter {
+      prefix = "manifest-snapshots/"
+    }
+
+    expiration {
+      days = 30
+    }
+  }
+}